@@ -0,0 +1,161 @@
+package api
+
+import (
+	"net/http"
+	"time"
+)
+
+// Token type identifiers used by token_type_hint (RFC 7009 section 2.1) and
+// reported back in introspection responses.
+const (
+	tokenTypeAccess  = "access_token"
+	tokenTypeRefresh = "refresh_token"
+)
+
+// introspectionResponse follows RFC 7662 section 2.2. Only Active is
+// populated for tokens that are invalid, expired or revoked.
+type introspectionResponse struct {
+	Active    bool   `json:"active"`
+	Scope     string `json:"scope,omitempty"`
+	ClientID  string `json:"client_id,omitempty"`
+	Username  string `json:"username,omitempty"`
+	TokenType string `json:"token_type,omitempty"`
+	Exp       int64  `json:"exp,omitempty"`
+	Iat       int64  `json:"iat,omitempty"`
+	Sub       string `json:"sub,omitempty"`
+	Jti       string `json:"jti,omitempty"`
+}
+
+// handleIntrospect implements RFC 7662 token introspection for internal services.
+func (s *Server) handleIntrospect(w http.ResponseWriter, r *http.Request) {
+	if _, ok := s.authenticateClient(r); !ok {
+		writeInvalidClient(w)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_request")
+		return
+	}
+	token := r.PostForm.Get("token")
+	if token == "" {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_request")
+		return
+	}
+
+	tokenType, claims := s.identifyToken(s.tenantFor(r), token, r.PostForm.Get("token_type_hint"))
+	if claims == nil {
+		writeJSON(w, http.StatusOK, introspectionResponse{Active: false})
+		return
+	}
+	revoked, err := s.revocations.IsRevoked(r.Context(), claims.ID)
+	if err != nil {
+		writeOAuthError(w, http.StatusServiceUnavailable, "temporarily_unavailable")
+		return
+	}
+	if revoked {
+		writeJSON(w, http.StatusOK, introspectionResponse{Active: false})
+		return
+	}
+
+	resp := introspectionResponse{
+		Active:    true,
+		Scope:     claims.Scope,
+		ClientID:  claims.ClientID,
+		TokenType: tokenType,
+		Sub:       claims.Subject,
+		Jti:       claims.ID,
+	}
+	if claims.ExpiresAt != nil {
+		resp.Exp = claims.ExpiresAt.Unix()
+	}
+	if claims.IssuedAt != nil {
+		resp.Iat = claims.IssuedAt.Unix()
+	}
+	if u, err := s.users.GetByID(r.Context(), claims.Subject); err == nil {
+		resp.Username = u.Email
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// handleRevoke implements RFC 7009 token revocation. Per section 2.2 the
+// endpoint answers 200 for tokens that are unknown or already invalid.
+func (s *Server) handleRevoke(w http.ResponseWriter, r *http.Request) {
+	if _, ok := s.authenticateClient(r); !ok {
+		writeInvalidClient(w)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_request")
+		return
+	}
+	token := r.PostForm.Get("token")
+	if token == "" {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_request")
+		return
+	}
+
+	_, claims := s.identifyToken(s.tenantFor(r), token, r.PostForm.Get("token_type_hint"))
+	if claims == nil || claims.ID == "" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	expiresAt := time.Now().Add(s.refreshTTL)
+	if claims.ExpiresAt != nil {
+		expiresAt = claims.ExpiresAt.Time
+	}
+	if err := s.revocations.Revoke(r.Context(), claims.ID, expiresAt); err != nil {
+		writeOAuthError(w, http.StatusServiceUnavailable, "temporarily_unavailable")
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// identifyToken verifies token as an access or refresh token, trying the
+// hinted type first, using the secrets and audience of the requesting site.
+// It returns nil claims when neither secret verifies it.
+func (s *Server) identifyToken(t *tenant, token, hint string) (string, *tokenClaims) {
+	candidates := []struct {
+		kind   string
+		secret []byte
+	}{
+		{tokenTypeAccess, t.accessSecret},
+		{tokenTypeRefresh, t.refreshSecret},
+	}
+	if hint == tokenTypeRefresh {
+		candidates[0], candidates[1] = candidates[1], candidates[0]
+	}
+	for _, c := range candidates {
+		if claims, err := parseToken(token, c.secret, t.audience); err == nil {
+			return c.kind, claims
+		}
+	}
+	return "", nil
+}
+
+// authenticateClient checks client credentials sent with HTTP Basic auth or
+// as client_id/client_secret form parameters against the configured clients.
+func (s *Server) authenticateClient(r *http.Request) (string, bool) {
+	id, secret, ok := r.BasicAuth()
+	if !ok {
+		id = r.PostFormValue("client_id")
+		secret = r.PostFormValue("client_secret")
+	}
+	if id == "" || secret == "" {
+		return "", false
+	}
+	for _, c := range s.cfg.OAuth.Clients {
+		if c.ID == id && c.Secret != "" && constantTimeEqual([]byte(c.Secret), []byte(secret)) {
+			return id, true
+		}
+	}
+	return "", false
+}
+
+func writeInvalidClient(w http.ResponseWriter) {
+	w.Header().Set("WWW-Authenticate", `Basic realm="oauth"`)
+	writeOAuthError(w, http.StatusUnauthorized, "invalid_client")
+}
+
+func writeOAuthError(w http.ResponseWriter, code int, oauthErr string) {
+	writeJSON(w, code, map[string]string{"error": oauthErr})
+}
@@ -16,16 +16,75 @@ type AuthHandlers struct {
 
 // Protected bundles protected route handlers and middleware.
 type Protected struct {
-	Me             http.HandlerFunc
-	AuthMiddleware func(http.Handler) http.Handler
+	Me                http.HandlerFunc
+	GetPreferences    http.HandlerFunc
+	UpdatePreferences http.HandlerFunc
+	AuthMiddleware    func(http.Handler) http.Handler
+}
+
+// OAuthHandlers bundles the OAuth2 token introspection and revocation handlers.
+type OAuthHandlers struct {
+	Introspect http.HandlerFunc
+	Revoke     http.HandlerFunc
 }
 
 // PhotoHandlers bundles photo-related handler functions.
 type PhotoHandlers struct {
 	UploadPhoto    http.HandlerFunc
 	GetPhotoFeed   http.HandlerFunc
+	SearchPhotos   http.HandlerFunc
+	GetUserPhotos  http.HandlerFunc
+	GetMyPhotos    http.HandlerFunc
 	GetPhoto       http.HandlerFunc
+	UpdatePhoto    http.HandlerFunc
 	DeletePhoto    http.HandlerFunc
+	GetOriginal    http.HandlerFunc
+	AuthMiddleware func(http.Handler) http.Handler
+	// OptionalAuth identifies callers of the public routes when they send
+	// a token.
+	OptionalAuth func(http.Handler) http.Handler
+}
+
+// FollowHandlers bundles follow graph handler functions.
+type FollowHandlers struct {
+	Follow           http.HandlerFunc
+	Unfollow         http.HandlerFunc
+	GetFollowers     http.HandlerFunc
+	GetFollowing     http.HandlerFunc
+	GetStats         http.HandlerFunc
+	GetFollowingFeed http.HandlerFunc
+	AuthMiddleware   func(http.Handler) http.Handler
+}
+
+// LikeHandlers bundles photo like handler functions.
+type LikeHandlers struct {
+	Like           http.HandlerFunc
+	Unlike         http.HandlerFunc
+	ListMyLikes    http.HandlerFunc
+	AuthMiddleware func(http.Handler) http.Handler
+}
+
+// AlbumHandlers bundles album handler functions.
+type AlbumHandlers struct {
+	CreateAlbum        http.HandlerFunc
+	GetAlbum           http.HandlerFunc
+	UpdateAlbum        http.HandlerFunc
+	DeleteAlbum        http.HandlerFunc
+	ListUserAlbums     http.HandlerFunc
+	GetAlbumPhotos     http.HandlerFunc
+	AddAlbumPhotos     http.HandlerFunc
+	ReorderAlbumPhotos http.HandlerFunc
+	RemoveAlbumPhoto   http.HandlerFunc
+	AuthMiddleware     func(http.Handler) http.Handler
+	OptionalAuth       func(http.Handler) http.Handler
+}
+
+// NotificationHandlers bundles notification handler functions.
+type NotificationHandlers struct {
+	List           http.HandlerFunc
+	UnreadCount    http.HandlerFunc
+	MarkRead       http.HandlerFunc
+	Dismiss        http.HandlerFunc
 	AuthMiddleware func(http.Handler) http.Handler
 }
 
@@ -48,19 +107,158 @@ func RegisterProtectedRoutes(r chi.Router, p Protected) {
 	r.Group(func(r chi.Router) {
 		r.Use(p.AuthMiddleware)
 		r.Get("/me", p.Me)
+		r.Get("/me/preferences", p.GetPreferences)
+		r.Patch("/me/preferences", p.UpdatePreferences)
+	})
+}
+
+// RegisterOAuthRoutes registers the /oauth endpoints. They authenticate
+// clients themselves, so no user auth middleware is applied.
+func RegisterOAuthRoutes(r chi.Router, h OAuthHandlers) {
+	r.Route("/oauth", func(r chi.Router) {
+		r.Post("/introspect", h.Introspect)
+		r.Post("/revoke", h.Revoke)
 	})
 }
 
 // RegisterPhotoRoutes registers photo endpoints with appropriate auth.
 func RegisterPhotoRoutes(r chi.Router, h PhotoHandlers) {
 	// Public routes - no auth required for viewing
-	r.Get("/photos/feed", h.GetPhotoFeed)
-	r.Get("/photos/", h.GetPhoto) // ?id=photo_id
+	r.Group(func(r chi.Router) {
+		r.Use(h.OptionalAuth)
+		r.Get("/photos/feed", h.GetPhotoFeed)
+		r.Get("/photos/search", h.SearchPhotos)
+		r.Get("/photos/", h.GetPhoto) // ?id=photo_id
+		r.Get("/users/{id}/photos", h.GetUserPhotos)
+	})
 
 	// Protected routes - auth required for upload/delete
 	r.Group(func(r chi.Router) {
 		r.Use(h.AuthMiddleware)
+		r.Get("/me/photos", h.GetMyPhotos)
 		r.Post("/photos/upload", h.UploadPhoto)
+		r.Patch("/photos/{id}", h.UpdatePhoto)
 		r.Delete("/photos/", h.DeletePhoto) // ?id=photo_id
+		r.Get("/photos/original", h.GetOriginal)
+	})
+}
+
+// RegisterFollowRoutes registers follow graph endpoints and the following feed.
+func RegisterFollowRoutes(r chi.Router, h FollowHandlers) {
+	// Public routes - follow lists and counts are visible to everyone
+	r.Get("/users/{id}/followers", h.GetFollowers)
+	r.Get("/users/{id}/following", h.GetFollowing)
+	r.Get("/users/{id}/follow-stats", h.GetStats)
+
+	// Protected routes - auth required to change or read your own graph
+	r.Group(func(r chi.Router) {
+		r.Use(h.AuthMiddleware)
+		r.Put("/users/{id}/follow", h.Follow)
+		r.Delete("/users/{id}/follow", h.Unfollow)
+		r.Get("/photos/feed/following", h.GetFollowingFeed)
+	})
+}
+
+// RegisterLikeRoutes registers the caller's photo like endpoints.
+func RegisterLikeRoutes(r chi.Router, h LikeHandlers) {
+	r.Group(func(r chi.Router) {
+		r.Use(h.AuthMiddleware)
+		r.Put("/photos/{id}/like", h.Like)
+		r.Delete("/photos/{id}/like", h.Unlike)
+		r.Get("/me/likes", h.ListMyLikes)
+	})
+}
+
+// RegisterTagRoutes registers the public tag autocomplete endpoint.
+func RegisterTagRoutes(r chi.Router, listTags http.HandlerFunc) {
+	r.Get("/tags", listTags)
+}
+
+// RegisterAlbumRoutes registers album and album membership endpoints.
+func RegisterAlbumRoutes(r chi.Router, h AlbumHandlers) {
+	// Public routes - a token reveals the caller's own private albums
+	r.Group(func(r chi.Router) {
+		r.Use(h.OptionalAuth)
+		r.Get("/albums/{id}", h.GetAlbum)
+		r.Get("/albums/{id}/photos", h.GetAlbumPhotos)
+		r.Get("/users/{id}/albums", h.ListUserAlbums)
+	})
+
+	// Protected routes - auth required to change albums
+	r.Group(func(r chi.Router) {
+		r.Use(h.AuthMiddleware)
+		r.Post("/albums", h.CreateAlbum)
+		r.Patch("/albums/{id}", h.UpdateAlbum)
+		r.Delete("/albums/{id}", h.DeleteAlbum)
+		r.Post("/albums/{id}/photos", h.AddAlbumPhotos)
+		r.Put("/albums/{id}/photos", h.ReorderAlbumPhotos)
+		r.Delete("/albums/{id}/photos/{photoID}", h.RemoveAlbumPhoto)
+	})
+}
+
+// IIIFHandlers bundles the IIIF Image API handler functions.
+type IIIFHandlers struct {
+	Base         http.HandlerFunc
+	Info         http.HandlerFunc
+	Image        http.HandlerFunc
+	OptionalAuth func(http.Handler) http.Handler
+}
+
+// RegisterIIIFRoutes mounts the IIIF Image API 3.0 service for each photo.
+// It is public; a token lets owners reach their restricted photos.
+func RegisterIIIFRoutes(r chi.Router, h IIIFHandlers) {
+	r.Group(func(r chi.Router) {
+		r.Use(h.OptionalAuth)
+		r.Get("/iiif/{id}", h.Base)
+		r.Get("/iiif/{id}/info.json", h.Info)
+		r.Get("/iiif/{id}/{region}/{size}/{rotation}/{file}", h.Image) // file is {quality}.{format}
+	})
+}
+
+// FileHandlers serve uploaded photo files.
+type FileHandlers struct {
+	ServeUpload  http.HandlerFunc
+	OptionalAuth func(http.Handler) http.Handler
+}
+
+// RegisterFileRoutes serves /uploads/{kind}/{file}. Files are public unless
+// their photo is restricted; a token is only needed for signed URLs bound to
+// a user.
+func RegisterFileRoutes(r chi.Router, h FileHandlers) {
+	r.With(h.OptionalAuth).Handle("/uploads/{kind}/*", h.ServeUpload)
+}
+
+// TusHandlers serve resumable uploads.
+type TusHandlers struct {
+	Options        http.HandlerFunc
+	Create         http.HandlerFunc
+	Head           http.HandlerFunc
+	Patch          http.HandlerFunc
+	Delete         http.HandlerFunc
+	AuthMiddleware func(http.Handler) http.Handler
+}
+
+// RegisterTusRoutes mounts the tus 1.0 upload endpoint at /uploads/tus.
+func RegisterTusRoutes(r chi.Router, h TusHandlers) {
+	// Public route - protocol discovery only
+	r.Options("/uploads/tus", h.Options)
+
+	r.Group(func(r chi.Router) {
+		r.Use(h.AuthMiddleware)
+		r.Post("/uploads/tus", h.Create)
+		r.Head("/uploads/tus/{id}", h.Head)
+		r.Patch("/uploads/tus/{id}", h.Patch)
+		r.Delete("/uploads/tus/{id}", h.Delete)
+	})
+}
+
+// RegisterNotificationRoutes registers the caller's notification endpoints.
+func RegisterNotificationRoutes(r chi.Router, h NotificationHandlers) {
+	r.Group(func(r chi.Router) {
+		r.Use(h.AuthMiddleware)
+		r.Get("/notifications", h.List)
+		r.Get("/notifications/unread-count", h.UnreadCount)
+		r.Post("/notifications/read", h.MarkRead)
+		r.Post("/notifications/dismiss", h.Dismiss)
 	})
 }
@@ -20,7 +20,9 @@ import (
 	"github.com/go-playground/validator/v10"
 	"github.com/golang-jwt/jwt/v5"
 	_ "github.com/jackc/pgx/v5/stdlib"
+	"go.uber.org/zap"
 	"golang.org/x/crypto/argon2"
+	"golang.org/x/time/rate"
 	"nunoo.co/backend/api/routes"
 	"nunoo.co/backend/config"
 	"nunoo.co/backend/handlers"
@@ -28,6 +30,7 @@ import (
 	"nunoo.co/backend/migrations"
 	"nunoo.co/backend/models"
 	"nunoo.co/backend/repository"
+	"nunoo.co/backend/storage"
 	"nunoo.co/backend/types"
 )
 
@@ -37,19 +40,87 @@ type Server struct {
 	cfg           *config.Config
 	users         repository.UserRepository
 	photos        repository.PhotoRepository
+	albums        repository.AlbumRepository
+	revocations   repository.TokenRevocationRepository
+	preferences   repository.PreferencesRepository
+	follows       repository.FollowRepository
+	notifications repository.NotificationRepository
+	storage       storage.Storage
+	signer        *handlers.URLSigner
 	validate      *validator.Validate
 	accessSecret  []byte
 	refreshSecret []byte
 	accessTTL     time.Duration
 	refreshTTL    time.Duration
 	healthChecker *handlers.HealthChecker
+
+	tenantsByHost map[string]*tenant
+	tenantsByID   map[string]*tenant
+	defaultTenant *tenant
 }
 
 // ctxKey is the private context key type for user injection
 var userCtxKey = types.CtxKey{}
 
 // NewServerForTesting constructs a fully-wired HTTP handler for tests and dev.
+// It always uses in-memory repositories and panics on a storage or URL
+// signing configuration NewServer would reject.
 func NewServerForTesting(cfg *config.Config) http.Handler {
+	s, err := newServer(cfg)
+	if err != nil {
+		panic(err)
+	}
+	s.useMemoryRepos()
+	return s.handler()
+}
+
+// NewServer is the production-ready constructor. It attempts to connect to Postgres if configured;
+// otherwise, it falls back to in-memory storage. It fails when file storage
+// is misconfigured or shared storage has no URL signing keys.
+func NewServer(cfg *config.Config) (http.Handler, error) {
+	s, err := newServer(cfg)
+	if err != nil {
+		return nil, err
+	}
+	moveLegacyUploads(s.storage)
+
+	db := openPostgres(cfg)
+	if db == nil {
+		s.useMemoryRepos()
+		return s.handler(), nil
+	}
+	// Run migrations
+	_ = migrations.Apply(db, "./migrations")
+
+	photos := repository.NewPostgresPhotoRepo(db, cfg.Search.Language)
+	go reindexSearch(photos)
+
+	s.users = repository.NewPostgresUserRepo(db)
+	s.photos = photos
+	s.albums = repository.NewPostgresAlbumRepo(db)
+	s.revocations = repository.NewPostgresTokenRevocationRepo(db)
+	s.preferences = repository.NewPostgresPreferencesRepo(db)
+	s.follows = repository.NewPostgresFollowRepo(db)
+	s.notifications = repository.NewPostgresNotificationRepo(db)
+	s.healthChecker = handlers.NewHealthChecker(db)
+	return s.handler(), nil
+}
+
+// newServer builds the parts of a Server that do not depend on where its
+// records live: file storage, the URL signer and the JWT settings.
+func newServer(cfg *config.Config) (*Server, error) {
+	store, err := newStorage(cfg.Storage)
+	if err != nil {
+		return nil, err
+	}
+	signer, err := newURLSigner(cfg.Uploads.SignedURLs, cfg.Storage)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkTusConfig(cfg.Uploads, cfg.Storage); err != nil {
+		return nil, err
+	}
+
 	// Fallback to env secrets if config not wired
 	accessSecret := []byte(cfg.JWT.Secret)
 	refreshSecret := []byte(cfg.JWT.RefreshSecret)
@@ -74,42 +145,60 @@ func NewServerForTesting(cfg *config.Config) http.Handler {
 		refreshTTL = 72 * time.Hour
 	}
 
-	s := &Server{
+	return &Server{
 		r:             chi.NewRouter(),
 		cfg:           cfg,
-		users:         repository.NewMemoryUserRepo(),
-		photos:        repository.NewMemoryPhotoRepo(),
+		storage:       store,
+		signer:        signer,
 		validate:      validator.New(),
 		accessSecret:  accessSecret,
 		refreshSecret: refreshSecret,
 		accessTTL:     accessTTL,
 		refreshTTL:    refreshTTL,
-		healthChecker: handlers.NewHealthChecker(nil),
-	}
+	}, nil
+}
+
+// useMemoryRepos keeps the server's records in memory.
+func (s *Server) useMemoryRepos() {
+	photos := repository.NewMemoryPhotoRepo()
+	follows := repository.NewMemoryFollowRepo()
+	photos.SetFollowGraph(follows)
+	albums := repository.NewMemoryAlbumRepo()
+	photos.SetAlbums(albums)
+
+	s.users = repository.NewMemoryUserRepo()
+	s.photos = photos
+	s.albums = albums
+	s.revocations = repository.NewMemoryTokenRevocationRepo()
+	s.preferences = repository.NewMemoryPreferencesRepo()
+	s.follows = follows
+	s.notifications = repository.NewMemoryNotificationRepo()
+	s.healthChecker = handlers.NewHealthChecker(nil)
+}
+
+// handler finishes wiring the server and returns its router.
+func (s *Server) handler() http.Handler {
+	s.initTenants()
 	s.routes()
 	return s.r
 }
 
-// NewServer is the production-ready constructor. It attempts to connect to Postgres if configured;
-// otherwise, it falls back to in-memory storage.
-func NewServer(cfg *config.Config) http.Handler {
-	// Start with the testing server wiring (in-memory)
-	h := NewServerForTesting(cfg)
-
-	// Try to use Postgres if DATABASE_URL or database section is configured
+// openPostgres connects to the configured database, from DATABASE_URL or
+// the database section. It returns nil when none is configured or it
+// cannot be reached.
+func openPostgres(cfg *config.Config) *sql.DB {
 	dsn := os.Getenv("DATABASE_URL")
 	if dsn == "" && cfg.Database.Host != "" && cfg.Database.DBName != "" {
 		// Build DSN from parts
 		dsn = buildPostgresDSN(cfg)
 	}
 	if dsn == "" {
-		return h
+		return nil
 	}
 
-	// Connect and swap repository
 	db, err := sql.Open("pgx", dsn)
 	if err != nil {
-		return h
+		return nil
 	}
 	// Optimized connection pool settings for 2025 best practices
 	db.SetMaxOpenConns(25)                  // Increased for better concurrency
@@ -120,58 +209,65 @@ func NewServer(cfg *config.Config) http.Handler {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 	if err := db.PingContext(ctx); err != nil {
-		return h
+		_ = db.Close()
+		return nil
 	}
-	// Run migrations
-	_ = migrations.Apply(db, "./migrations")
+	return db
+}
 
-	// Swap repository using reflection-free approach: rebuild server with same config but Postgres repo
-	s := &Server{
-		r:             chi.NewRouter(),
-		cfg:           cfg,
-		users:         repository.NewPostgresUserRepo(db),
-		photos:        repository.NewPostgresPhotoRepo(db),
-		validate:      validator.New(),
-		accessSecret:  []byte(cfg.JWT.Secret),
-		refreshSecret: []byte(cfg.JWT.RefreshSecret),
-		accessTTL:     cfg.JWT.TokenExpiry,
-		refreshTTL:    cfg.JWT.RefreshExpiry,
-		healthChecker: handlers.NewHealthChecker(db),
-	}
-	if len(s.accessSecret) == 0 {
-		s.accessSecret = []byte(os.Getenv("JWT_SECRET"))
+// moveLegacyUploads moves files stored before uploads were split by
+// tenant to the default tenant, where they are now looked up. Only the
+// first start after upgrading does any work.
+func moveLegacyUploads(store storage.Storage) {
+	logger, _ := zap.NewProduction()
+	n, err := handlers.MoveLegacyUploads(context.Background(), store)
+	if err != nil {
+		logger.Error("failed to move legacy uploads", zap.Error(err), zap.Int("moved", n))
+		return
 	}
-	if len(s.refreshSecret) == 0 {
-		s.refreshSecret = []byte(os.Getenv("JWT_REFRESH_SECRET"))
+	if n > 0 {
+		logger.Info("moved legacy uploads to the default tenant", zap.Int("moved", n))
 	}
-	if s.accessTTL == 0 {
-		s.accessTTL = 15 * time.Minute
+}
+
+// reindexSearch indexes photos that have no search vector yet: those
+// stored before search existed, or cleared after a change of language.
+func reindexSearch(photos *repository.PostgresPhotoRepo) {
+	logger, _ := zap.NewProduction()
+	n, err := photos.ReindexSearch(context.Background())
+	if err != nil {
+		logger.Error("failed to reindex photo search", zap.Error(err), zap.Int64("indexed", n))
+		return
 	}
-	if s.refreshTTL == 0 {
-		s.refreshTTL = 72 * time.Hour
+	if n > 0 {
+		logger.Info("reindexed photo search", zap.Int64("indexed", n))
 	}
-
-	s.routes()
-	return s.r
 }
 
 func (s *Server) routes() {
+	preferenceHandlers := handlers.NewPreferencesHandlers(s.preferences, s.validate)
+	notifier := handlers.NewNotifier(s.notifications, s.preferences)
+
 	// Core middleware
 	s.r.Use(middleware.RequestID)
 	s.r.Use(middleware.RealIP)
+	s.r.Use(s.tenantMiddleware)
 	s.r.Use(middleware.Logger)
 	s.r.Use(middleware.Recoverer)
 
 	// Performance and security middleware
-	rateLimiter := custommiddleware.NewRateLimiter(100, 20) // 100 requests per second with burst of 20
+	rps := intOrDefault(s.cfg.Security.RateLimitRPS, 100)    // requests per second per client IP
+	burst := intOrDefault(s.cfg.Security.RateLimitBurst, 20) // with this burst on top
+	rateLimiter := custommiddleware.NewRateLimiter(rate.Limit(rps), burst)
 	s.r.Use(rateLimiter.Limit)
 	s.r.Use(custommiddleware.Timeout(30 * time.Second)) // 30 second timeout for all requests
 	s.r.Use(custommiddleware.SecurityHeaders)           // Security headers
+	s.r.Use(preferenceHandlers.Middleware)              // Lazy per-request preferences for handlers
 	s.r.Use(cors.Handler(cors.Options{
 		AllowedOrigins:   []string{"https://*", "http://localhost:*"}, // More restrictive for production
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token", "X-Request-ID"},
-		ExposedHeaders:   []string{"Link", "X-Request-ID"},
+		AllowedMethods:   []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+		AllowedHeaders:   append([]string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token", "X-Request-ID", "If-Match"}, tusRequestHeaders...),
+		ExposedHeaders:   append([]string{"Link", "X-Request-ID", "Location", "ETag"}, tusResponseHeaders...),
 		AllowCredentials: true,
 		MaxAge:           86400, // 24 hours cache for preflight requests
 	}))
@@ -185,22 +281,111 @@ func (s *Server) routes() {
 	})
 
 	routes.RegisterProtectedRoutes(s.r, routes.Protected{
-		Me:             s.handleMe,
-		AuthMiddleware: s.authMiddleware,
+		Me:                s.handleMe,
+		GetPreferences:    preferenceHandlers.GetPreferences,
+		UpdatePreferences: preferenceHandlers.UpdatePreferences,
+		AuthMiddleware:    s.authMiddleware,
+	})
+
+	routes.RegisterOAuthRoutes(s.r, routes.OAuthHandlers{
+		Introspect: s.handleIntrospect,
+		Revoke:     s.handleRevoke,
 	})
 
 	// Register photo routes
-	photoHandlers := handlers.NewPhotoHandlers(s.photos)
+	photoHandlers := handlers.NewPhotoHandlers(s.photos, s.photoOptions())
 	routes.RegisterPhotoRoutes(s.r, routes.PhotoHandlers{
 		UploadPhoto:    photoHandlers.UploadPhoto,
 		GetPhotoFeed:   photoHandlers.GetPhotoFeed,
+		SearchPhotos:   photoHandlers.SearchPhotos,
+		GetUserPhotos:  photoHandlers.GetUserPhotos,
+		GetMyPhotos:    photoHandlers.GetMyPhotos,
 		GetPhoto:       photoHandlers.GetPhoto,
+		UpdatePhoto:    photoHandlers.UpdatePhoto,
 		DeletePhoto:    photoHandlers.DeletePhoto,
+		GetOriginal:    photoHandlers.GetOriginal,
+		AuthMiddleware: s.authMiddleware,
+		OptionalAuth:   s.optionalAuthMiddleware,
+	})
+
+	likeHandlers := handlers.NewLikeHandlers(s.photos, notifier, s.signer)
+	routes.RegisterLikeRoutes(s.r, routes.LikeHandlers{
+		Like:           likeHandlers.Like,
+		Unlike:         likeHandlers.Unlike,
+		ListMyLikes:    likeHandlers.ListMyLikes,
+		AuthMiddleware: s.authMiddleware,
+	})
+
+	tagHandlers := handlers.NewTagHandlers(s.photos)
+	routes.RegisterTagRoutes(s.r, tagHandlers.ListTags)
+
+	albumHandlers := handlers.NewAlbumHandlers(s.albums, s.photos, s.signer, s.validate)
+	routes.RegisterAlbumRoutes(s.r, routes.AlbumHandlers{
+		CreateAlbum:        albumHandlers.CreateAlbum,
+		GetAlbum:           albumHandlers.GetAlbum,
+		UpdateAlbum:        albumHandlers.UpdateAlbum,
+		DeleteAlbum:        albumHandlers.DeleteAlbum,
+		ListUserAlbums:     albumHandlers.ListUserAlbums,
+		GetAlbumPhotos:     albumHandlers.GetAlbumPhotos,
+		AddAlbumPhotos:     albumHandlers.AddAlbumPhotos,
+		ReorderAlbumPhotos: albumHandlers.ReorderAlbumPhotos,
+		RemoveAlbumPhoto:   albumHandlers.RemoveAlbumPhoto,
+		AuthMiddleware:     s.authMiddleware,
+		OptionalAuth:       s.optionalAuthMiddleware,
+	})
+
+	tusHandlers := handlers.NewTusHandlers(photoHandlers, handlers.TusOptions{
+		MaxSize: s.cfg.Uploads.TusMaxSize,
+		Expiry:  s.cfg.Uploads.TusExpiry,
+	})
+	routes.RegisterTusRoutes(s.r, routes.TusHandlers{
+		Options:        tusHandlers.Options,
+		Create:         tusHandlers.Create,
+		Head:           tusHandlers.Head,
+		Patch:          tusHandlers.Patch,
+		Delete:         tusHandlers.Delete,
+		AuthMiddleware: s.authMiddleware,
+	})
+
+	followHandlers := handlers.NewFollowHandlers(s.follows, s.users, s.photos, notifier, s.signer)
+	routes.RegisterFollowRoutes(s.r, routes.FollowHandlers{
+		Follow:           followHandlers.Follow,
+		Unfollow:         followHandlers.Unfollow,
+		GetFollowers:     followHandlers.GetFollowers,
+		GetFollowing:     followHandlers.GetFollowing,
+		GetStats:         followHandlers.GetStats,
+		GetFollowingFeed: followHandlers.GetFollowingFeed,
+		AuthMiddleware:   s.authMiddleware,
+	})
+
+	notificationHandlers := handlers.NewNotificationHandlers(s.notifications)
+	routes.RegisterNotificationRoutes(s.r, routes.NotificationHandlers{
+		List:           notificationHandlers.ListNotifications,
+		UnreadCount:    notificationHandlers.UnreadCount,
+		MarkRead:       notificationHandlers.MarkRead,
+		Dismiss:        notificationHandlers.Dismiss,
 		AuthMiddleware: s.authMiddleware,
 	})
 
-	// Serve static files for uploaded photos
-	s.r.Handle("/uploads/*", http.StripPrefix("/uploads/", http.FileServer(http.Dir("./uploads"))))
+	iiifHandlers := handlers.NewIIIFHandlers(s.photos, handlers.IIIFOptions{
+		MaxSize:    s.cfg.Images.IIIFMaxSize,
+		CacheBytes: s.cfg.Images.IIIFCacheBytes,
+		MaxRenders: s.cfg.Images.IIIFMaxRenders,
+		Storage:    s.storage,
+		Signer:     s.signer,
+	})
+	routes.RegisterIIIFRoutes(s.r, routes.IIIFHandlers{
+		Base:         iiifHandlers.Base,
+		Info:         iiifHandlers.Info,
+		Image:        iiifHandlers.Image,
+		OptionalAuth: s.optionalAuthMiddleware,
+	})
+
+	fileHandlers := handlers.NewFileHandlers(s.photos, s.storage, s.signer)
+	routes.RegisterFileRoutes(s.r, routes.FileHandlers{
+		ServeUpload:  fileHandlers.ServeUpload,
+		OptionalAuth: s.optionalAuthMiddleware,
+	})
 
 	// Mount Huma for OpenAPI + Swagger at /api/
 	s.r.Mount("/api", s.mountHuma())
@@ -272,12 +457,13 @@ func (s *Server) handleLogin(w http.ResponseWriter, r *http.Request) {
 		writeError(w, http.StatusUnauthorized, "invalid credentials")
 		return
 	}
-	access, exp, err := s.issueAccessToken(u)
+	t := s.tenantFor(r)
+	access, exp, err := s.issueAccessToken(t, u)
 	if err != nil {
 		writeError(w, http.StatusInternalServerError, "failed to issue token")
 		return
 	}
-	refresh, _, err := s.issueRefreshToken(u)
+	refresh, _, err := s.issueRefreshToken(t, u)
 	if err != nil {
 		writeError(w, http.StatusInternalServerError, "failed to issue token")
 		return
@@ -294,14 +480,9 @@ func (s *Server) handleRefresh(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	// Validate refresh token
-	claims := &jwt.RegisteredClaims{}
-	tok, err := jwt.ParseWithClaims(body.RefreshToken, claims, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method")
-		}
-		return s.refreshSecret, nil
-	})
-	if err != nil || tok == nil || !tok.Valid || claims.Subject == "" {
+	t := s.tenantFor(r)
+	claims, err := s.parseActiveToken(r.Context(), body.RefreshToken, t.refreshSecret, t.audience)
+	if err != nil {
 		writeError(w, http.StatusUnauthorized, "invalid refresh token")
 		return
 	}
@@ -310,7 +491,7 @@ func (s *Server) handleRefresh(w http.ResponseWriter, r *http.Request) {
 		writeError(w, http.StatusUnauthorized, "invalid refresh token")
 		return
 	}
-	access, exp, err := s.issueAccessToken(u)
+	access, exp, err := s.issueAccessToken(t, u)
 	if err != nil {
 		writeError(w, http.StatusInternalServerError, "failed to issue token")
 		return
@@ -338,14 +519,9 @@ func (s *Server) authMiddleware(next http.Handler) http.Handler {
 			return
 		}
 		tokStr := strings.TrimSpace(strings.TrimPrefix(authz, "Bearer "))
-		claims := &jwt.RegisteredClaims{}
-		tok, err := jwt.ParseWithClaims(tokStr, claims, func(token *jwt.Token) (interface{}, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fmt.Errorf("unexpected signing method")
-			}
-			return s.accessSecret, nil
-		})
-		if err != nil || tok == nil || !tok.Valid || claims.Subject == "" {
+		t := s.tenantFor(r)
+		claims, err := s.parseActiveToken(r.Context(), tokStr, t.accessSecret, t.audience)
+		if err != nil {
 			writeError(w, http.StatusUnauthorized, "invalid token")
 			return
 		}
@@ -355,10 +531,27 @@ func (s *Server) authMiddleware(next http.Handler) http.Handler {
 			return
 		}
 		ctx := context.WithValue(r.Context(), userCtxKey, u)
+		if t.isAdmin(u) {
+			ctx = types.WithAdmin(ctx)
+		}
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
+// optionalAuthMiddleware loads the user when a Bearer token is sent and
+// lets anonymous requests through. A token that is sent but invalid is
+// still rejected.
+func (s *Server) optionalAuthMiddleware(next http.Handler) http.Handler {
+	auth := s.authMiddleware(next)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		auth.ServeHTTP(w, r)
+	})
+}
+
 // Helpers
 
 func writeJSON(w http.ResponseWriter, code int, v any) {
@@ -377,6 +570,21 @@ func randomBytes(n int) []byte {
 	return b
 }
 
+// photoOptions translates the images config into handler options.
+func (s *Server) photoOptions() handlers.PhotoOptions {
+	opts := handlers.PhotoOptions{
+		MetadataPolicy: s.cfg.Images.MetadataPolicy,
+		Storage:        s.storage,
+		Signer:         s.signer,
+		Validate:       s.validate,
+		Albums:         s.albums,
+	}
+	for _, r := range s.cfg.Images.Renditions {
+		opts.Renditions = append(opts.Renditions, handlers.Rendition{Width: r.Width, Quality: r.Quality})
+	}
+	return opts
+}
+
 func buildPostgresDSN(cfg *config.Config) string {
 	user := cfg.Database.User
 	pass := cfg.Database.Password
@@ -451,32 +659,102 @@ func constantTimeEqual(a, b []byte) bool {
 
 // JWT issuance
 
-func (s *Server) issueAccessToken(u *models.User) (string, time.Duration, error) {
+// defaultScope is granted to every token issued by password login.
+const defaultScope = "profile photos:read photos:write"
+
+// tokenClaims are the JWT claims carried by both access and refresh tokens.
+type tokenClaims struct {
+	Scope string `json:"scope,omitempty"`
+	// ClientID is the OAuth client the token was issued to. Tokens from
+	// the first-party login flow carry none.
+	ClientID string `json:"client_id,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// parseToken verifies an HS256 token against secret and, when non-empty,
+// the expected audience, and returns its claims.
+func parseToken(tokStr string, secret []byte, audience string) (*tokenClaims, error) {
+	var opts []jwt.ParserOption
+	if audience != "" {
+		opts = append(opts, jwt.WithAudience(audience))
+	}
+	claims := &tokenClaims{}
+	tok, err := jwt.ParseWithClaims(tokStr, claims, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method")
+		}
+		return secret, nil
+	}, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if tok == nil || !tok.Valid || claims.Subject == "" {
+		return nil, errInvalidToken
+	}
+	return claims, nil
+}
+
+// parseActiveToken is parseToken plus a check against server-side revocation state.
+func (s *Server) parseActiveToken(ctx context.Context, tokStr string, secret []byte, audience string) (*tokenClaims, error) {
+	claims, err := parseToken(tokStr, secret, audience)
+	if err != nil {
+		return nil, err
+	}
+	if claims.ID != "" {
+		revoked, err := s.revocations.IsRevoked(ctx, claims.ID)
+		if err != nil {
+			return nil, err
+		}
+		if revoked {
+			return nil, errTokenRevoked
+		}
+	}
+	return claims, nil
+}
+
+var (
+	errInvalidToken = errors.New("invalid token")
+	errTokenRevoked = errors.New("token revoked")
+)
+
+func (s *Server) issueAccessToken(t *tenant, u *models.User) (string, time.Duration, error) {
 	now := time.Now()
-	claims := jwt.RegisteredClaims{
-		Subject:   u.ID,
-		ID:        newJTI(),
-		IssuedAt:  jwt.NewNumericDate(now),
-		ExpiresAt: jwt.NewNumericDate(now.Add(s.accessTTL)),
-	}
-	t := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	signed, err := t.SignedString(s.accessSecret)
+	claims := tokenClaims{
+		Scope: defaultScope,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   u.ID,
+			ID:        newJTI(),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(s.accessTTL)),
+		},
+	}
+	if t.audience != "" {
+		claims.Audience = jwt.ClaimStrings{t.audience}
+	}
+	tok := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	signed, err := tok.SignedString(t.accessSecret)
 	if err != nil {
 		return "", 0, err
 	}
 	return signed, s.accessTTL, nil
 }
 
-func (s *Server) issueRefreshToken(u *models.User) (string, time.Duration, error) {
+func (s *Server) issueRefreshToken(t *tenant, u *models.User) (string, time.Duration, error) {
 	now := time.Now()
-	claims := jwt.RegisteredClaims{
-		Subject:   u.ID,
-		ID:        newJTI(),
-		IssuedAt:  jwt.NewNumericDate(now),
-		ExpiresAt: jwt.NewNumericDate(now.Add(s.refreshTTL)),
-	}
-	t := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	signed, err := t.SignedString(s.refreshSecret)
+	claims := tokenClaims{
+		Scope: defaultScope,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   u.ID,
+			ID:        newJTI(),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(s.refreshTTL)),
+		},
+	}
+	if t.audience != "" {
+		claims.Audience = jwt.ClaimStrings{t.audience}
+	}
+	tok := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	signed, err := tok.SignedString(t.refreshSecret)
 	if err != nil {
 		return "", 0, err
 	}
@@ -487,3 +765,10 @@ func newJTI() string {
 	b := randomBytes(12)
 	return base64.RawURLEncoding.EncodeToString(b)
 }
+
+func intOrDefault(v, def int) int {
+	if v <= 0 {
+		return def
+	}
+	return v
+}
@@ -0,0 +1,110 @@
+package api
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+
+	"nunoo.co/backend/models"
+	"nunoo.co/backend/types"
+)
+
+// tenant holds the per-site auth settings resolved from the Host header.
+type tenant struct {
+	id            string
+	audience      string
+	accessSecret  []byte
+	refreshSecret []byte
+	// admins points at the user IDs of the tenant's admins in config.
+	// Emails are not used: anyone may register any address.
+	admins *[]string
+}
+
+func (t *tenant) isAdmin(u *models.User) bool {
+	return t.admins != nil && slices.Contains(*t.admins, u.ID)
+}
+
+// initTenants builds the host -> tenant table from config. It must run after
+// the server's base secrets are set.
+func (s *Server) initTenants() {
+	s.tenantsByHost = make(map[string]*tenant)
+	s.tenantsByID = make(map[string]*tenant)
+
+	if len(s.cfg.Tenancy.Tenants) == 0 {
+		// Single-site mode: behave exactly as before tenancy existed
+		s.defaultTenant = &tenant{
+			id:            types.DefaultTenant,
+			accessSecret:  s.accessSecret,
+			refreshSecret: s.refreshSecret,
+			admins:        &s.cfg.Security.Admins,
+		}
+		s.tenantsByID[types.DefaultTenant] = s.defaultTenant
+		return
+	}
+
+	for i, tc := range s.cfg.Tenancy.Tenants {
+		t := &tenant{
+			id:            tc.ID,
+			audience:      tc.Audience,
+			accessSecret:  []byte(tc.JWTSecret),
+			refreshSecret: []byte(tc.JWTRefreshSecret),
+			admins:        &s.cfg.Tenancy.Tenants[i].Admins,
+		}
+		if t.audience == "" {
+			t.audience = tc.ID
+		}
+		if len(t.accessSecret) == 0 {
+			t.accessSecret = deriveTenantSecret(s.accessSecret, tc.ID)
+		}
+		if len(t.refreshSecret) == 0 {
+			t.refreshSecret = deriveTenantSecret(s.refreshSecret, tc.ID)
+		}
+		s.tenantsByID[tc.ID] = t
+		for _, h := range tc.Hosts {
+			s.tenantsByHost[normalizeHost(h)] = t
+		}
+	}
+	s.defaultTenant = s.tenantsByID[s.cfg.Tenancy.Default]
+}
+
+// tenantMiddleware resolves the tenant for the request's Host header and
+// stores its ID in the request context.
+func (s *Server) tenantMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t, ok := s.tenantsByHost[normalizeHost(r.Host)]
+		if !ok {
+			t = s.defaultTenant
+		}
+		if t == nil {
+			writeError(w, http.StatusNotFound, "unknown site")
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(types.WithTenant(r.Context(), t.id)))
+	})
+}
+
+// tenantFor returns the tenant resolved for r by tenantMiddleware.
+func (s *Server) tenantFor(r *http.Request) *tenant {
+	if t, ok := s.tenantsByID[types.TenantID(r.Context())]; ok {
+		return t
+	}
+	return s.defaultTenant
+}
+
+// deriveTenantSecret gives each tenant a distinct signing key when only the
+// shared top-level secret is configured.
+func deriveTenantSecret(base []byte, tenantID string) []byte {
+	mac := hmac.New(sha256.New, base)
+	mac.Write([]byte("tenant:" + tenantID))
+	return mac.Sum(nil)
+}
+
+func normalizeHost(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.ToLower(strings.TrimSuffix(host, "."))
+}
@@ -0,0 +1,73 @@
+package api
+
+import (
+	"fmt"
+
+	"go.uber.org/zap"
+	"nunoo.co/backend/config"
+	"nunoo.co/backend/handlers"
+	"nunoo.co/backend/storage"
+)
+
+// newStorage builds the configured storage backend. A bad configuration is
+// an error rather than a fallback to local files, which would split uploads
+// across replicas.
+func newStorage(cfg config.StorageConfig) (storage.Storage, error) {
+	switch cfg.Driver {
+	case "", "local":
+		dir := cfg.Dir
+		if dir == "" {
+			dir = handlers.UploadRoot
+		}
+		return storage.NewLocal(dir), nil
+	case "s3":
+		store, err := storage.NewS3(storage.S3Options{
+			Endpoint:        cfg.S3.Endpoint,
+			Region:          cfg.S3.Region,
+			Bucket:          cfg.S3.Bucket,
+			AccessKeyID:     cfg.S3.AccessKeyID,
+			SecretAccessKey: cfg.S3.SecretAccessKey,
+			PathStyle:       cfg.S3.PathStyle,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("storage: %w", err)
+		}
+		return store, nil
+	default:
+		return nil, fmt.Errorf("storage: unknown driver %q", cfg.Driver)
+	}
+}
+
+// newURLSigner builds the file URL signer from config. Shared storage is
+// served by several replicas, which must agree on the keys, so it requires
+// them; a lone local server falls back to a per-process key with a warning.
+func newURLSigner(cfg config.SignedURLsConfig, storageCfg config.StorageConfig) (*handlers.URLSigner, error) {
+	if len(cfg.Keys) == 0 {
+		if storageCfg.Driver != "" && storageCfg.Driver != "local" {
+			return nil, fmt.Errorf("uploads.signed_urls.keys is required with %s storage", storageCfg.Driver)
+		}
+		logger, _ := zap.NewProduction()
+		logger.Warn("no uploads.signed_urls.keys configured; signing with a random key, so signed URLs break on restart and across replicas")
+	}
+	opts := handlers.URLSignerOptions{TTL: cfg.TTL, SignAll: cfg.SignAll, BindUser: cfg.BindUser}
+	for _, k := range cfg.Keys {
+		opts.Keys = append(opts.Keys, handlers.SigningKey{ID: k.ID, Secret: []byte(k.Secret)})
+	}
+	return handlers.NewURLSigner(opts), nil
+}
+
+// Headers browsers must be allowed to send and read for tus uploads.
+var (
+	tusRequestHeaders  = []string{"Tus-Resumable", "Upload-Length", "Upload-Offset", "Upload-Metadata", "Upload-Defer-Length"}
+	tusResponseHeaders = []string{"Tus-Resumable", "Tus-Version", "Tus-Extension", "Tus-Max-Size", "Upload-Offset", "Upload-Length", "Upload-Metadata", "Upload-Expires", "Photo-Id"}
+)
+
+// checkTusConfig refuses shared storage unless the operator has confirmed
+// sticky sessions: unfinished tus uploads stay on the replica that created
+// them, and a chunk sent to any other replica would get 404.
+func checkTusConfig(cfg config.UploadsConfig, storageCfg config.StorageConfig) error {
+	if storageCfg.Driver != "" && storageCfg.Driver != "local" && !cfg.TusStickySessions {
+		return fmt.Errorf("uploads.tus_sticky_sessions is required with %s storage: route each tus upload to one replica, then set it", storageCfg.Driver)
+	}
+	return nil
+}
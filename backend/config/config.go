@@ -15,12 +15,135 @@ type Config struct {
 	Database DatabaseConfig
 	JWT      JWTConfig
 	Security SecurityConfig
+	OAuth    OAuthConfig
+	Tenancy  TenancyConfig
+	Images   ImagesConfig
+	Uploads  UploadsConfig
+	Storage  StorageConfig
+	Search   SearchConfig
+}
+
+// SearchConfig tunes photo search.
+type SearchConfig struct {
+	// Language is the Postgres text search configuration used to stem
+	// captions, tags and queries, such as "english" (default), "french" or
+	// "simple" for no stemming. Photos indexed under another configuration
+	// are only reindexed once their search_vector is cleared. The in-memory
+	// store does not stem.
+	Language string `mapstructure:"language"`
+}
+
+// StorageConfig selects where photos and their derivatives are stored.
+// Every replica must point at the same storage.
+type StorageConfig struct {
+	// Driver is "local" (default) or "s3".
+	Driver string `mapstructure:"driver"`
+	// Dir is the local driver's root directory, ./uploads by default.
+	Dir string   `mapstructure:"dir"`
+	S3  S3Config `mapstructure:"s3"`
+}
+
+// S3Config points at a bucket on AWS S3 or an S3-compatible server such as
+// MinIO.
+type S3Config struct {
+	Endpoint        string `mapstructure:"endpoint"`
+	Region          string `mapstructure:"region"`
+	Bucket          string `mapstructure:"bucket"`
+	AccessKeyID     string `mapstructure:"access_key_id"`
+	SecretAccessKey string `mapstructure:"secret_access_key"`
+	// PathStyle addresses the bucket as endpoint/bucket; MinIO needs it.
+	PathStyle bool `mapstructure:"path_style"`
+}
+
+// ImagesConfig controls the derivatives generated for every upload.
+type ImagesConfig struct {
+	// Renditions are the responsive sizes generated per photo. When empty,
+	// 320/640/1280/2048 pixel widths are used.
+	Renditions []Rendition `mapstructure:"renditions"`
+	// MetadataPolicy decides what is removed from the served copy of each
+	// upload: strip_private (default), strip_all or keep.
+	MetadataPolicy string `mapstructure:"metadata_policy"`
+	// IIIFMaxSize caps the longest edge the IIIF endpoint will render.
+	IIIFMaxSize int `mapstructure:"iiif_max_size"`
+	// IIIFCacheBytes bounds the on-disk cache of IIIF derivatives.
+	IIIFCacheBytes int64 `mapstructure:"iiif_cache_bytes"`
+	// IIIFMaxRenders caps how many IIIF renders decode an original at once
+	// (default 2).
+	IIIFMaxRenders int `mapstructure:"iiif_max_renders"`
+}
+
+// UploadsConfig controls resumable (tus) uploads and access to uploaded
+// files.
+type UploadsConfig struct {
+	// TusMaxSize caps the length of a single resumable upload.
+	TusMaxSize int64 `mapstructure:"tus_max_size"`
+	// TusExpiry is how long an unfinished upload is kept after its last
+	// chunk before it is discarded.
+	TusExpiry time.Duration `mapstructure:"tus_expiry"`
+	// TusStickySessions confirms that every request of a tus upload reaches
+	// the same replica. Unfinished uploads live on the replica's local disk,
+	// so shared storage refuses to start without it.
+	TusStickySessions bool `mapstructure:"tus_sticky_sessions"`
+	// SignedURLs controls the signed URLs handed out for restricted files.
+	SignedURLs SignedURLsConfig `mapstructure:"signed_urls"`
+}
+
+type SignedURLsConfig struct {
+	// Keys sign file URLs. The first signs new URLs and all of them are
+	// accepted, so rotate by adding a new key in front and removing the old
+	// one after TTL has passed. Every replica needs the same keys, so they
+	// are required with S3 storage; a local server without them generates
+	// its own at startup.
+	Keys []SigningKey `mapstructure:"keys"`
+	// TTL is how long a signed URL stays valid (default 1h).
+	TTL time.Duration `mapstructure:"ttl"`
+	// SignAll requires a signed URL for every photo file.
+	SignAll bool `mapstructure:"sign_all"`
+	// BindUser ties URLs given to a signed-in user to that user's token.
+	BindUser bool `mapstructure:"bind_user"`
+}
+
+type SigningKey struct {
+	ID     string `mapstructure:"id"`
+	Secret string `mapstructure:"secret"`
+}
+
+type Rendition struct {
+	Width   int `mapstructure:"width"`
+	Quality int `mapstructure:"quality"`
+}
+
+// TenancyConfig maps Host headers to tenants so one process can serve
+// several sites. With no tenants configured every request uses the
+// "default" tenant and the top-level JWT secrets.
+type TenancyConfig struct {
+	// Default is the tenant ID used for hosts that match no tenant. When
+	// empty, requests for unknown hosts are rejected.
+	Default string   `mapstructure:"default"`
+	Tenants []Tenant `mapstructure:"tenants"`
+}
+
+type Tenant struct {
+	ID    string   `mapstructure:"id"`
+	Hosts []string `mapstructure:"hosts"`
+	// Audience is the JWT aud claim for this tenant; defaults to the tenant ID.
+	Audience string `mapstructure:"audience"`
+	// Secrets default to values derived from the top-level JWT secrets.
+	JWTSecret        string `mapstructure:"jwt_secret"`
+	JWTRefreshSecret string `mapstructure:"jwt_refresh_secret"`
+	// Admins are the user IDs of this tenant's admin accounts.
+	Admins []string `mapstructure:"admins"`
 }
 
 type SecurityConfig struct {
+	// RateLimitRPS and RateLimitBurst bound each client IP's requests;
+	// zero picks 100 per second with a burst of 20.
 	RateLimitRPS   int           `mapstructure:"rate_limit_rps"`
 	RateLimitBurst int           `mapstructure:"rate_limit_burst"`
 	RequestTimeout time.Duration `mapstructure:"request_timeout"`
+	// Admins are the user IDs of accounts that may edit any photo. They
+	// apply in single-site mode; tenants list their own.
+	Admins []string `mapstructure:"admins"`
 }
 
 type ServerConfig struct {
@@ -39,6 +162,17 @@ type DatabaseConfig struct {
 	SSLMode  string
 }
 
+// OAuthConfig lists the confidential clients allowed to call the
+// introspection and revocation endpoints.
+type OAuthConfig struct {
+	Clients []OAuthClient
+}
+
+type OAuthClient struct {
+	ID     string `mapstructure:"id"`
+	Secret string `mapstructure:"secret"`
+}
+
 type JWTConfig struct {
 	Secret        string
 	TokenExpiry   time.Duration
@@ -75,8 +209,8 @@ func Load() (*Config, error) {
 	viper.SetDefault("jwt.tokenExpiry", "15m")
 	viper.SetDefault("jwt.refreshExpiry", "72h")
 
-	viper.SetDefault("security.rateLimitRPS", 100)
-	viper.SetDefault("security.rateLimitBurst", 20)
+	viper.SetDefault("security.rate_limit_rps", 100)
+	viper.SetDefault("security.rate_limit_burst", 20)
 	viper.SetDefault("security.requestTimeout", "30s")
 
 	if err := viper.ReadInConfig(); err != nil {
@@ -89,6 +223,32 @@ func Load() (*Config, error) {
 	if err := viper.Unmarshal(&config); err != nil {
 		return nil, fmt.Errorf("error unmarshaling config: %w", err)
 	}
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
 
 	return &config, nil
 }
+
+// Validate checks settings that would otherwise only fail once in use,
+// normalizing them where that is unambiguous.
+func (c *Config) Validate() error {
+	seen := make(map[int]bool)
+	renditions := c.Images.Renditions[:0]
+	for _, r := range c.Images.Renditions {
+		if r.Width <= 0 {
+			return fmt.Errorf("images.renditions: width must be positive, got %d", r.Width)
+		}
+		if r.Quality < 1 || r.Quality > 100 {
+			return fmt.Errorf("images.renditions: quality of the %dpx rendition must be between 1 and 100, got %d", r.Width, r.Quality)
+		}
+		// Each photo stores one rendition per width; keep the first.
+		if seen[r.Width] {
+			continue
+		}
+		seen[r.Width] = true
+		renditions = append(renditions, r)
+	}
+	c.Images.Renditions = renditions
+	return nil
+}
@@ -0,0 +1,357 @@
+// Package exif reads the camera metadata the photo pages show from JPEG and
+// TIFF-based files. It only understands the handful of tags it needs and
+// treats every offset in the file as untrusted.
+package exif
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrNoExif is returned for supported files that carry no EXIF block.
+	ErrNoExif = errors.New("exif: no metadata")
+	// ErrUnsupportedFormat is returned for files that are neither JPEG nor TIFF.
+	ErrUnsupportedFormat = errors.New("exif: unsupported format")
+	errMalformed         = errors.New("exif: malformed metadata")
+)
+
+// MaxTIFFSize bounds how much of a TIFF-based file is read, since its IFDs
+// may point anywhere in the file.
+const MaxTIFFSize = 64 << 20
+
+// Metadata holds the tags extracted from a file. Zero values mean the tag
+// was absent.
+type Metadata struct {
+	Make         string
+	Model        string
+	LensModel    string
+	FocalLength  float64 // millimetres
+	FNumber      float64
+	ExposureTime string // as written by the camera, e.g. "1/250" or "2"
+	ISO          int
+	Orientation  int // 1-8, see the TIFF specification
+	// TakenAt is DateTimeOriginal. When the file records OffsetTimeOriginal
+	// the time carries that zone and HasOffset is true; otherwise the wall
+	// clock is returned in UTC.
+	TakenAt   time.Time
+	HasOffset bool
+}
+
+const (
+	tagMake               = 0x010F
+	tagModel              = 0x0110
+	tagOrientation        = 0x0112
+	tagDateTime           = 0x0132
+	tagExifIFD            = 0x8769
+	tagExposureTime       = 0x829A
+	tagFNumber            = 0x829D
+	tagISO                = 0x8827
+	tagDateTimeOriginal   = 0x9003
+	tagOffsetTime         = 0x9010
+	tagOffsetTimeOriginal = 0x9011
+	tagFocalLength        = 0x920A
+	tagLensModel          = 0xA434
+)
+
+// Decode reads metadata from a JPEG or TIFF stream. JPEGs are read only up
+// to the start of the image data.
+func Decode(r io.Reader) (*Metadata, error) {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(4)
+	if err != nil {
+		return nil, ErrUnsupportedFormat
+	}
+
+	switch {
+	case magic[0] == 0xFF && magic[1] == 0xD8:
+		return decodeJPEG(br)
+	case bytes.Equal(magic, []byte("II*\x00")) || bytes.Equal(magic, []byte("MM\x00*")):
+		b, err := io.ReadAll(io.LimitReader(br, MaxTIFFSize))
+		if err != nil {
+			return nil, err
+		}
+		return parseTIFF(b)
+	default:
+		return nil, ErrUnsupportedFormat
+	}
+}
+
+// decodeJPEG walks the marker segments looking for an APP1 Exif block.
+func decodeJPEG(r *bufio.Reader) (*Metadata, error) {
+	if _, err := r.Discard(2); err != nil {
+		return nil, err
+	}
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, ErrNoExif
+		}
+		if b != 0xFF {
+			return nil, errMalformed
+		}
+		marker, err := r.ReadByte()
+		for err == nil && marker == 0xFF { // fill bytes
+			marker, err = r.ReadByte()
+		}
+		if err != nil {
+			return nil, ErrNoExif
+		}
+		switch {
+		case marker == 0xD9 || marker == 0xDA: // EOI, SOS: no metadata past here
+			return nil, ErrNoExif
+		case marker == 0x01 || (marker >= 0xD0 && marker <= 0xD7): // no payload
+			continue
+		}
+
+		var size [2]byte
+		if _, err := io.ReadFull(r, size[:]); err != nil {
+			return nil, ErrNoExif
+		}
+		n := int(binary.BigEndian.Uint16(size[:])) - 2
+		if n < 0 {
+			return nil, errMalformed
+		}
+		if marker != 0xE1 {
+			if _, err := r.Discard(n); err != nil {
+				return nil, ErrNoExif
+			}
+			continue
+		}
+
+		seg := make([]byte, n)
+		if _, err := io.ReadFull(r, seg); err != nil {
+			return nil, ErrNoExif
+		}
+		// APP1 is also used for XMP; keep looking if this is not Exif.
+		if body, ok := bytes.CutPrefix(seg, []byte("Exif\x00\x00")); ok {
+			return parseTIFF(body)
+		}
+	}
+}
+
+type entry struct {
+	tag   uint16
+	typ   uint16
+	count uint32
+	data  []byte
+}
+
+type byteOrder interface {
+	binary.ByteOrder
+	binary.AppendByteOrder
+}
+
+type tiff struct {
+	b     []byte
+	order byteOrder
+}
+
+// openTIFF checks the TIFF header of b and returns it with the offset of
+// the first IFD.
+func openTIFF(b []byte) (*tiff, uint32, error) {
+	if len(b) < 8 {
+		return nil, 0, errMalformed
+	}
+	t := &tiff{b: b}
+	switch string(b[:2]) {
+	case "II":
+		t.order = binary.LittleEndian
+	case "MM":
+		t.order = binary.BigEndian
+	default:
+		return nil, 0, errMalformed
+	}
+	if t.order.Uint16(b[2:]) != 42 {
+		return nil, 0, errMalformed
+	}
+	return t, t.order.Uint32(b[4:]), nil
+}
+
+func parseTIFF(b []byte) (*Metadata, error) {
+	t, off, err := openTIFF(b)
+	if err != nil {
+		return nil, err
+	}
+	ifd0, err := t.readIFD(off)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &Metadata{
+		Make:        t.ascii(ifd0[tagMake]),
+		Model:       t.ascii(ifd0[tagModel]),
+		Orientation: t.uint(ifd0[tagOrientation]),
+	}
+	if m.Orientation < 1 || m.Orientation > 8 {
+		m.Orientation = 0
+	}
+
+	taken, offset := t.ascii(ifd0[tagDateTime]), ""
+	if e, ok := ifd0[tagExifIFD]; ok {
+		// A broken Exif sub-IFD still leaves the IFD0 tags usable.
+		if sub, err := t.readIFD(uint32(t.uint(e))); err == nil {
+			m.LensModel = t.ascii(sub[tagLensModel])
+			m.FocalLength = t.rational(sub[tagFocalLength])
+			m.FNumber = t.rational(sub[tagFNumber])
+			m.ExposureTime = t.exposure(sub[tagExposureTime])
+			m.ISO = t.uint(sub[tagISO])
+			if v := t.ascii(sub[tagDateTimeOriginal]); v != "" {
+				taken = v
+				offset = t.ascii(sub[tagOffsetTimeOriginal])
+			}
+			if offset == "" {
+				offset = t.ascii(sub[tagOffsetTime])
+			}
+		}
+	}
+	m.TakenAt, m.HasOffset = parseDateTime(taken, offset)
+
+	return m, nil
+}
+
+// readIFD returns the entries of the IFD at off keyed by tag.
+func (t *tiff) readIFD(off uint32) (map[uint16]entry, error) {
+	list, _, err := t.readEntries(off)
+	if err != nil {
+		return nil, err
+	}
+	entries := make(map[uint16]entry, len(list))
+	for _, e := range list {
+		entries[e.tag] = e
+	}
+	return entries, nil
+}
+
+// readEntries returns the entries of the IFD at off in file order, skipping
+// those of unknown types or with values outside the file, and the offset of
+// the next IFD.
+func (t *tiff) readEntries(off uint32) ([]entry, uint32, error) {
+	if uint64(off)+2 > uint64(len(t.b)) {
+		return nil, 0, errMalformed
+	}
+	n := int(t.order.Uint16(t.b[off:]))
+	start := int(off) + 2
+	if start+n*12 > len(t.b) {
+		return nil, 0, errMalformed
+	}
+
+	entries := make([]entry, 0, n)
+	for i := 0; i < n; i++ {
+		raw := t.b[start+i*12 : start+(i+1)*12]
+		e := entry{tag: t.order.Uint16(raw), typ: t.order.Uint16(raw[2:]), count: t.order.Uint32(raw[4:])}
+		size := typeSize(e.typ)
+		if size == 0 {
+			continue
+		}
+		total := uint64(size) * uint64(e.count)
+		if total <= 4 {
+			e.data = raw[8 : 8+total]
+		} else {
+			at := uint64(t.order.Uint32(raw[8:]))
+			if at+total > uint64(len(t.b)) {
+				continue
+			}
+			e.data = t.b[at : at+total]
+		}
+		entries = append(entries, e)
+	}
+
+	var next uint32
+	if end := start + n*12; end+4 <= len(t.b) {
+		next = t.order.Uint32(t.b[end:])
+	}
+	return entries, next, nil
+}
+
+func typeSize(typ uint16) int {
+	switch typ {
+	case 1, 2, 6, 7: // BYTE, ASCII, SBYTE, UNDEFINED
+		return 1
+	case 3, 8: // SHORT, SSHORT
+		return 2
+	case 4, 9: // LONG, SLONG
+		return 4
+	case 5, 10: // RATIONAL, SRATIONAL
+		return 8
+	default:
+		return 0
+	}
+}
+
+func (t *tiff) ascii(e entry) string {
+	if e.typ != 2 {
+		return ""
+	}
+	s, _, _ := strings.Cut(string(e.data), "\x00")
+	return strings.TrimSpace(strings.ToValidUTF8(s, ""))
+}
+
+func (t *tiff) uint(e entry) int {
+	switch {
+	case e.typ == 3 && len(e.data) >= 2:
+		return int(t.order.Uint16(e.data))
+	case e.typ == 4 && len(e.data) >= 4:
+		return int(min(t.order.Uint32(e.data), math.MaxInt32))
+	default:
+		return 0
+	}
+}
+
+func (t *tiff) fraction(e entry) (num, den uint32, ok bool) {
+	if e.typ != 5 || len(e.data) < 8 {
+		return 0, 0, false
+	}
+	num, den = t.order.Uint32(e.data), t.order.Uint32(e.data[4:])
+	return num, den, den != 0
+}
+
+func (t *tiff) rational(e entry) float64 {
+	num, den, ok := t.fraction(e)
+	if !ok {
+		return 0
+	}
+	return math.Round(float64(num)/float64(den)*100) / 100
+}
+
+// exposure formats ExposureTime the way cameras display it: whole seconds,
+// or 1/n for fractions.
+func (t *tiff) exposure(e entry) string {
+	num, den, ok := t.fraction(e)
+	if !ok || num == 0 {
+		return ""
+	}
+	if num >= den {
+		v := float64(num) / float64(den)
+		if v == math.Trunc(v) {
+			return fmt.Sprintf("%d", int(v))
+		}
+		return fmt.Sprintf("%.1f", v)
+	}
+	return fmt.Sprintf("1/%d", int(math.Round(float64(den)/float64(num))))
+}
+
+// parseDateTime parses an EXIF "2006:01:02 15:04:05" timestamp with an
+// optional "+07:00" offset.
+func parseDateTime(value, offset string) (time.Time, bool) {
+	if value == "" {
+		return time.Time{}, false
+	}
+	if offset != "" {
+		if t, err := time.Parse("2006:01:02 15:04:05-07:00", value+offset); err == nil {
+			return t, true
+		}
+	}
+	t, err := time.Parse("2006:01:02 15:04:05", value)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return t, false
+}
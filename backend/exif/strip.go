@@ -0,0 +1,419 @@
+package exif
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+	"sort"
+)
+
+// StripLevel selects how much metadata Strip removes.
+type StripLevel int
+
+const (
+	// StripPrivate removes location, serial numbers, maker notes and other
+	// identifying blocks, keeping camera settings, orientation and colour
+	// profiles.
+	StripPrivate StripLevel = iota
+	// StripAll additionally removes every EXIF tag except orientation and
+	// resolution.
+	StripAll
+)
+
+// Names of the metadata groups Strip reports as removed.
+const (
+	StrippedGPS               = "gps"
+	StrippedSerialNumbers     = "serial_numbers"
+	StrippedMakerNotes        = "maker_notes"
+	StrippedOwner             = "owner"
+	StrippedUniqueID          = "unique_id"
+	StrippedXMP               = "xmp"
+	StrippedIPTC              = "iptc"
+	StrippedEmbeddedThumbnail = "embedded_thumbnail"
+	StrippedVendorSegments    = "vendor_segments"
+	StrippedTrailingData      = "trailing_data"
+	StrippedTextChunks        = "text_chunks"
+	StrippedCameraSettings    = "camera_settings"
+)
+
+const (
+	tagGPSIFD          = 0x8825
+	tagInteropIFD      = 0xA005
+	tagSubIFDs         = 0x014A
+	tagXMLPacket       = 0x02BC
+	tagIPTC            = 0x83BB
+	tagMakerNote       = 0x927C
+	tagOwnerName       = 0xA430
+	tagBodySerial      = 0xA431
+	tagLensSerial      = 0xA435
+	tagCameraSerial    = 0xC62F
+	tagImageUniqueID   = 0xA420
+	tagXResolution     = 0x011A
+	tagYResolution     = 0x011B
+	tagResolutionUnit  = 0x0128
+	tagJPEGInterchange = 0x0201
+)
+
+// privateTags maps tags removed at StripPrivate to the group they belong to.
+var privateTags = map[uint16]string{
+	tagGPSIFD:        StrippedGPS,
+	tagMakerNote:     StrippedMakerNotes,
+	tagOwnerName:     StrippedOwner,
+	tagBodySerial:    StrippedSerialNumbers,
+	tagLensSerial:    StrippedSerialNumbers,
+	tagCameraSerial:  StrippedSerialNumbers,
+	tagImageUniqueID: StrippedUniqueID,
+	tagXMLPacket:     StrippedXMP,
+	tagIPTC:          StrippedIPTC,
+}
+
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+// Strip copies the JPEG or PNG in r to w without the metadata level selects
+// and reports the groups it removed, sorted. Pixel data is copied untouched.
+// Other formats return ErrUnsupportedFormat without writing anything.
+func Strip(w io.Writer, r io.Reader, level StripLevel) ([]string, error) {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(8)
+	if err != nil && len(magic) < 2 {
+		return nil, ErrUnsupportedFormat
+	}
+
+	removed := map[string]bool{}
+	switch {
+	case magic[0] == 0xFF && magic[1] == 0xD8:
+		err = stripJPEG(w, br, level, removed)
+	case bytes.Equal(magic, pngSignature):
+		err = stripPNG(w, br, level, removed)
+	default:
+		return nil, ErrUnsupportedFormat
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	groups := make([]string, 0, len(removed))
+	for g := range removed {
+		groups = append(groups, g)
+	}
+	sort.Strings(groups)
+	return groups, nil
+}
+
+func stripJPEG(w io.Writer, r *bufio.Reader, level StripLevel, removed map[string]bool) error {
+	bw := bufio.NewWriter(w)
+	if _, err := r.Discard(2); err != nil {
+		return err
+	}
+	if _, err := bw.Write([]byte{0xFF, 0xD8}); err != nil {
+		return err
+	}
+
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return errMalformed
+		}
+		if b != 0xFF {
+			return errMalformed
+		}
+		marker, err := r.ReadByte()
+		for err == nil && marker == 0xFF {
+			marker, err = r.ReadByte()
+		}
+		if err != nil {
+			return errMalformed
+		}
+
+		if marker == 0xD9 { // EOI before any scan
+			if _, err := bw.Write([]byte{0xFF, 0xD9}); err != nil {
+				return err
+			}
+			return bw.Flush()
+		}
+		if marker == 0x01 || (marker >= 0xD0 && marker <= 0xD7) {
+			if _, err := bw.Write([]byte{0xFF, marker}); err != nil {
+				return err
+			}
+			continue
+		}
+
+		var size [2]byte
+		if _, err := io.ReadFull(r, size[:]); err != nil {
+			return errMalformed
+		}
+		n := int(binary.BigEndian.Uint16(size[:])) - 2
+		if n < 0 {
+			return errMalformed
+		}
+		seg := make([]byte, n)
+		if _, err := io.ReadFull(r, seg); err != nil {
+			return errMalformed
+		}
+
+		if marker == 0xDA {
+			// Start of scan: the rest is image data up to EOI. Anything after
+			// EOI (secondary images, vendor trailers) is dropped.
+			if err := writeSegment(bw, marker, seg); err != nil {
+				return err
+			}
+			rest, err := io.ReadAll(r)
+			if err != nil {
+				return err
+			}
+			if end := bytes.Index(rest, []byte{0xFF, 0xD9}); end >= 0 {
+				if len(rest) > end+2 {
+					removed[StrippedTrailingData] = true
+				}
+				rest = rest[:end+2]
+			}
+			if _, err := bw.Write(rest); err != nil {
+				return err
+			}
+			return bw.Flush()
+		}
+
+		keep, err := filterJPEGSegment(marker, seg, level, removed)
+		if err != nil {
+			return err
+		}
+		if keep != nil {
+			if err := writeSegment(bw, marker, keep); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// filterJPEGSegment returns the payload to write for a segment, or nil to
+// drop it.
+func filterJPEGSegment(marker byte, seg []byte, level StripLevel, removed map[string]bool) ([]byte, error) {
+	if marker < 0xE0 || marker > 0xEF {
+		return seg, nil // tables, frame headers, comments
+	}
+	switch {
+	case marker == 0xE0: // JFIF
+		return seg, nil
+	case marker == 0xE1 && bytes.HasPrefix(seg, []byte("Exif\x00\x00")):
+		tiffData, err := stripTIFF(seg[6:], level, removed)
+		if err != nil || tiffData == nil {
+			// An unreadable block cannot be vetted, so it goes entirely.
+			removed[StrippedCameraSettings] = true
+			return nil, nil
+		}
+		return append([]byte("Exif\x00\x00"), tiffData...), nil
+	case marker == 0xE1 && bytes.HasPrefix(seg, []byte("http://ns.adobe.com/")):
+		removed[StrippedXMP] = true
+		return nil, nil
+	case marker == 0xE2 && bytes.HasPrefix(seg, []byte("ICC_PROFILE\x00")):
+		return seg, nil
+	case marker == 0xEE && bytes.HasPrefix(seg, []byte("Adobe")): // colour transform
+		return seg, nil
+	case marker == 0xED:
+		removed[StrippedIPTC] = true
+		return nil, nil
+	default:
+		removed[StrippedVendorSegments] = true
+		return nil, nil
+	}
+}
+
+func writeSegment(w io.Writer, marker byte, payload []byte) error {
+	if len(payload)+2 > 0xFFFF {
+		return errMalformed
+	}
+	header := []byte{0xFF, marker, 0, 0}
+	binary.BigEndian.PutUint16(header[2:], uint16(len(payload)+2))
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	_, err := w.Write(payload)
+	return err
+}
+
+// stripTIFF rebuilds an EXIF TIFF block with only IFD0 and the Exif sub-IFD,
+// minus the tags level removes. It returns nil when nothing worth keeping
+// remains.
+func stripTIFF(b []byte, level StripLevel, removed map[string]bool) ([]byte, error) {
+	t, off, err := openTIFF(b)
+	if err != nil {
+		return nil, err
+	}
+	ifd0, next, err := t.readEntries(off)
+	if err != nil {
+		return nil, err
+	}
+	if next != 0 {
+		removed[StrippedEmbeddedThumbnail] = true
+	}
+
+	var keep0, keepExif []entry
+	for _, e := range ifd0 {
+		switch {
+		case e.tag == tagExifIFD:
+			if level == StripAll {
+				removed[StrippedCameraSettings] = true
+				continue
+			}
+			sub, _, err := t.readEntries(uint32(t.uint(e)))
+			if err != nil {
+				removed[StrippedCameraSettings] = true
+				continue
+			}
+			keepExif = filterEntries(sub, removed)
+		case e.tag == tagSubIFDs || e.tag == tagJPEGInterchange:
+			removed[StrippedEmbeddedThumbnail] = true
+		case privateTags[e.tag] != "":
+			removed[privateTags[e.tag]] = true
+		case level == StripAll && e.tag != tagOrientation && e.tag != tagXResolution &&
+			e.tag != tagYResolution && e.tag != tagResolutionUnit:
+			removed[StrippedCameraSettings] = true
+		default:
+			keep0 = append(keep0, e)
+		}
+	}
+
+	if len(keep0) == 0 && len(keepExif) == 0 {
+		return nil, nil
+	}
+	return writeTIFF(t.order, keep0, keepExif), nil
+}
+
+func filterEntries(entries []entry, removed map[string]bool) []entry {
+	var kept []entry
+	for _, e := range entries {
+		switch {
+		case privateTags[e.tag] != "":
+			removed[privateTags[e.tag]] = true
+		case e.tag == tagInteropIFD:
+			// Points to an IFD that is not carried over.
+		default:
+			kept = append(kept, e)
+		}
+	}
+	return kept
+}
+
+// writeTIFF lays out IFD0, then the Exif sub-IFD when present, then the
+// out-of-line values, each starting on a word boundary.
+func writeTIFF(order byteOrder, ifd0, sub []entry) []byte {
+	if len(sub) > 0 {
+		ifd0 = append(ifd0, entry{tag: tagExifIFD, typ: 4, count: 1})
+	}
+	sort.Slice(ifd0, func(i, j int) bool { return ifd0[i].tag < ifd0[j].tag })
+	sort.Slice(sub, func(i, j int) bool { return sub[i].tag < sub[j].tag })
+
+	ifdSize := func(n int) int { return 2 + 12*n + 4 }
+	subAt := 8 + ifdSize(len(ifd0))
+	dataAt := subAt
+	if len(sub) > 0 {
+		dataAt += ifdSize(len(sub))
+	}
+
+	var data []byte
+	writeIFD := func(out []byte, entries []entry) []byte {
+		out = order.AppendUint16(out, uint16(len(entries)))
+		for _, e := range entries {
+			out = order.AppendUint16(out, e.tag)
+			out = order.AppendUint16(out, e.typ)
+			out = order.AppendUint32(out, e.count)
+			switch {
+			case e.tag == tagExifIFD:
+				out = order.AppendUint32(out, uint32(subAt))
+			case len(e.data) <= 4:
+				out = append(out, e.data...)
+				out = append(out, make([]byte, 4-len(e.data))...)
+			default:
+				out = order.AppendUint32(out, uint32(dataAt+len(data)))
+				data = append(data, e.data...)
+				if len(data)%2 == 1 {
+					data = append(data, 0)
+				}
+			}
+		}
+		return order.AppendUint32(out, 0)
+	}
+
+	out := make([]byte, 0, dataAt)
+	if order == byteOrder(binary.LittleEndian) {
+		out = append(out, 'I', 'I')
+	} else {
+		out = append(out, 'M', 'M')
+	}
+	out = order.AppendUint16(out, 42)
+	out = order.AppendUint32(out, 8)
+	out = writeIFD(out, ifd0)
+	if len(sub) > 0 {
+		out = writeIFD(out, sub)
+	}
+	return append(out, data...)
+}
+
+// stripPNG drops text chunks, which carry XMP and free-form comments, and
+// rewrites any eXIf chunk the same way as a JPEG's Exif block.
+func stripPNG(w io.Writer, r *bufio.Reader, level StripLevel, removed map[string]bool) error {
+	bw := bufio.NewWriter(w)
+	if _, err := r.Discard(len(pngSignature)); err != nil {
+		return err
+	}
+	if _, err := bw.Write(pngSignature); err != nil {
+		return err
+	}
+
+	for {
+		var header [8]byte
+		if _, err := io.ReadFull(r, header[:]); err != nil {
+			return errMalformed
+		}
+		n := binary.BigEndian.Uint32(header[:4])
+		if n > 1<<31-1 {
+			return errMalformed
+		}
+		typ := string(header[4:])
+		body := make([]byte, int(n)+4) // data and CRC
+		if _, err := io.ReadFull(r, body); err != nil {
+			return errMalformed
+		}
+		data := body[:n]
+
+		switch typ {
+		case "tEXt", "zTXt", "iTXt":
+			removed[StrippedTextChunks] = true
+			continue
+		case "eXIf":
+			stripped, err := stripTIFF(data, level, removed)
+			if err != nil || stripped == nil {
+				removed[StrippedCameraSettings] = true
+				continue
+			}
+			if err := writePNGChunk(bw, typ, stripped); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if _, err := bw.Write(header[:]); err != nil {
+			return err
+		}
+		if _, err := bw.Write(body); err != nil {
+			return err
+		}
+		if typ == "IEND" {
+			if _, err := r.Peek(1); err == nil {
+				removed[StrippedTrailingData] = true
+			}
+			return bw.Flush()
+		}
+	}
+}
+
+func writePNGChunk(w io.Writer, typ string, data []byte) error {
+	chunk := binary.BigEndian.AppendUint32(nil, uint32(len(data)))
+	chunk = append(chunk, typ...)
+	chunk = append(chunk, data...)
+	chunk = binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE(chunk[4:]))
+	_, err := w.Write(chunk)
+	return err
+}
@@ -0,0 +1,459 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-playground/validator/v10"
+	"go.uber.org/zap"
+	"nunoo.co/backend/models"
+	"nunoo.co/backend/repository"
+	"nunoo.co/backend/types"
+)
+
+// maxSlugAttempts bounds how many numbered variants of a title's slug are
+// tried before giving up.
+const maxSlugAttempts = 20
+
+var slugPattern = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+type AlbumHandlers struct {
+	albums   repository.AlbumRepository
+	photos   repository.PhotoRepository
+	signer   *URLSigner
+	validate *validator.Validate
+	logger   *zap.Logger
+}
+
+func NewAlbumHandlers(albums repository.AlbumRepository, photos repository.PhotoRepository, signer *URLSigner, validate *validator.Validate) *AlbumHandlers {
+	logger, _ := zap.NewProduction()
+
+	return &AlbumHandlers{
+		albums:   albums,
+		photos:   photos,
+		signer:   signer,
+		validate: validate,
+		logger:   logger,
+	}
+}
+
+// CreateAlbum creates an empty album for the caller. Without an explicit
+// slug one is made from the title, numbered if the owner already uses it.
+func (h *AlbumHandlers) CreateAlbum(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+	if user == nil {
+		writeError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	patch, ok := h.decodePatch(w, r)
+	if !ok {
+		return
+	}
+	if patch.Title == nil || strings.TrimSpace(*patch.Title) == "" {
+		writeError(w, http.StatusBadRequest, "title is required")
+		return
+	}
+	if patch.CoverPhotoID != nil && *patch.CoverPhotoID != "" {
+		writeError(w, http.StatusBadRequest, "cover photo must be in the album")
+		return
+	}
+
+	now := time.Now()
+	album := &models.Album{
+		ID:         newAlbumID(),
+		UserID:     user.ID,
+		Visibility: models.VisibilityPublic,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+	applyAlbumPatch(album, patch)
+
+	var err error
+	if patch.Slug != nil {
+		err = h.albums.Create(r.Context(), album)
+	} else {
+		base := slugify(album.Title)
+		for i := 1; i <= maxSlugAttempts; i++ {
+			album.Slug = base
+			if i > 1 {
+				album.Slug = base + "-" + strconv.Itoa(i)
+			}
+			if err = h.albums.Create(r.Context(), album); err != repository.ErrAlbumSlugTaken {
+				break
+			}
+		}
+	}
+	if err != nil {
+		h.writeAlbumError(w, err, "failed to create album", user.ID, album.ID)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, map[string]*models.Album{"album": album})
+}
+
+func (h *AlbumHandlers) GetAlbum(w http.ResponseWriter, r *http.Request) {
+	album, ok := h.viewableAlbum(w, r)
+	if !ok {
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]*models.Album{"album": album})
+}
+
+// UpdateAlbum edits an album's details. Only its owner or an admin may.
+func (h *AlbumHandlers) UpdateAlbum(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+	if user == nil {
+		writeError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	patch, ok := h.decodePatch(w, r)
+	if !ok {
+		return
+	}
+	if patch.Title != nil && strings.TrimSpace(*patch.Title) == "" {
+		writeError(w, http.StatusBadRequest, "title cannot be empty")
+		return
+	}
+
+	album, ok := h.editableAlbum(w, r)
+	if !ok {
+		return
+	}
+	if patch.CoverPhotoID != nil && *patch.CoverPhotoID != "" {
+		member, err := h.albums.HasPhoto(r.Context(), album.ID, *patch.CoverPhotoID)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "failed to update album")
+			return
+		}
+		if !member {
+			writeError(w, http.StatusBadRequest, "cover photo must be in the album")
+			return
+		}
+	}
+
+	applyAlbumPatch(album, patch)
+	album.UpdatedAt = time.Now()
+	if err := h.albums.Update(r.Context(), album); err != nil {
+		h.writeAlbumError(w, err, "failed to update album", user.ID, album.ID)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]*models.Album{"album": album})
+}
+
+// DeleteAlbum deletes an album. Its photos are kept.
+func (h *AlbumHandlers) DeleteAlbum(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+	if user == nil {
+		writeError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	album, ok := h.editableAlbum(w, r)
+	if !ok {
+		return
+	}
+	if err := h.albums.Delete(r.Context(), album.ID); err != nil {
+		h.writeAlbumError(w, err, "failed to delete album", user.ID, album.ID)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListUserAlbums lists a user's albums, newest first. Others only see the
+// public ones.
+func (h *AlbumHandlers) ListUserAlbums(w http.ResponseWriter, r *http.Request) {
+	userID := chi.URLParam(r, "id")
+	page, limit := pageParams(r)
+
+	albums, totalCount, err := h.albums.GetByUserID(r.Context(), userID, viewerID(r) != userID, page, limit)
+	if err != nil {
+		h.logger.Error("failed to list albums",
+			zap.Error(err),
+			zap.String("user_id", userID))
+		writeError(w, http.StatusInternalServerError, "failed to list albums")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, &models.AlbumList{
+		Albums:     albums,
+		Page:       page,
+		Limit:      limit,
+		TotalCount: totalCount,
+		HasMore:    int64(page*limit) < totalCount,
+	})
+}
+
+// GetAlbumPhotos pages through an album's photos in album order. Private
+// photos are only listed for their owner.
+func (h *AlbumHandlers) GetAlbumPhotos(w http.ResponseWriter, r *http.Request) {
+	album, ok := h.viewableAlbum(w, r)
+	if !ok {
+		return
+	}
+	page, limit := pageParams(r)
+
+	viewer := viewerID(r)
+	photos, totalCount, err := h.photos.GetByAlbum(r.Context(), album.ID, viewer == album.UserID, page, limit)
+	if err != nil {
+		h.logger.Error("failed to get album photos",
+			zap.Error(err),
+			zap.String("album_id", album.ID))
+		writeError(w, http.StatusInternalServerError, "failed to get album photos")
+		return
+	}
+
+	feed := &models.PhotoFeed{
+		Photos:     photos,
+		Page:       page,
+		Limit:      limit,
+		TotalCount: totalCount,
+		HasMore:    int64(page*limit) < totalCount,
+	}
+	markLiked(r.Context(), h.logger, h.photos, feed.Photos, viewer)
+	h.signer.SignPhotos(r.Context(), feed.Photos, viewer)
+	writeJSON(w, http.StatusOK, feed)
+}
+
+// AddAlbumPhotos appends photos to the end of an album. They must belong
+// to the album's owner; photos already in it keep their place.
+func (h *AlbumHandlers) AddAlbumPhotos(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+	if user == nil {
+		writeError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	req, ok := h.decodePhotoIDs(w, r)
+	if !ok {
+		return
+	}
+	album, ok := h.editableAlbum(w, r)
+	if !ok {
+		return
+	}
+	for _, photoID := range req.PhotoIDs {
+		photo, err := h.photos.GetByID(r.Context(), photoID)
+		if err != nil {
+			if err == repository.ErrPhotoNotFound {
+				writeError(w, http.StatusBadRequest, "photo not found: "+photoID)
+				return
+			}
+			writeError(w, http.StatusInternalServerError, "failed to get photo")
+			return
+		}
+		if photo.UserID != album.UserID {
+			writeError(w, http.StatusBadRequest, "photo belongs to another user: "+photoID)
+			return
+		}
+	}
+
+	if err := h.albums.AddPhotos(r.Context(), album.ID, req.PhotoIDs); err != nil {
+		h.writeAlbumError(w, err, "failed to add photos", user.ID, album.ID)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ReorderAlbumPhotos replaces an album's order. The request must list
+// every photo in the album exactly once.
+func (h *AlbumHandlers) ReorderAlbumPhotos(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+	if user == nil {
+		writeError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	req, ok := h.decodePhotoIDs(w, r)
+	if !ok {
+		return
+	}
+	album, ok := h.editableAlbum(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.albums.ReorderPhotos(r.Context(), album.ID, req.PhotoIDs); err != nil {
+		h.writeAlbumError(w, err, "failed to reorder photos", user.ID, album.ID)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RemoveAlbumPhoto takes a photo out of an album without deleting it.
+func (h *AlbumHandlers) RemoveAlbumPhoto(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+	if user == nil {
+		writeError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	album, ok := h.editableAlbum(w, r)
+	if !ok {
+		return
+	}
+	if err := h.albums.RemovePhoto(r.Context(), album.ID, chi.URLParam(r, "photoID")); err != nil {
+		h.writeAlbumError(w, err, "failed to remove photo", user.ID, album.ID)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *AlbumHandlers) decodePatch(w http.ResponseWriter, r *http.Request) (*models.AlbumPatch, bool) {
+	var patch models.AlbumPatch
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&patch); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json body")
+		return nil, false
+	}
+	if err := h.validate.Struct(patch); err != nil {
+		writeError(w, http.StatusBadRequest, "validation failed")
+		return nil, false
+	}
+	if patch.Slug != nil && !slugPattern.MatchString(*patch.Slug) {
+		writeError(w, http.StatusBadRequest, "slug must be lowercase letters and digits separated by single hyphens")
+		return nil, false
+	}
+	return &patch, true
+}
+
+func (h *AlbumHandlers) decodePhotoIDs(w http.ResponseWriter, r *http.Request) (*models.AlbumPhotos, bool) {
+	var req models.AlbumPhotos
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json body")
+		return nil, false
+	}
+	if err := h.validate.Struct(req); err != nil {
+		writeError(w, http.StatusBadRequest, "validation failed")
+		return nil, false
+	}
+	return &req, true
+}
+
+// viewableAlbum loads the album in the URL, answering 404 if the caller
+// may not see it.
+func (h *AlbumHandlers) viewableAlbum(w http.ResponseWriter, r *http.Request) (*models.Album, bool) {
+	album, ok := h.getAlbum(w, r)
+	if ok && !canViewAlbum(r, album) {
+		writeError(w, http.StatusNotFound, "album not found")
+		return nil, false
+	}
+	return album, ok
+}
+
+// editableAlbum loads the album in the URL for its owner or an admin.
+// Others get 403, or 404 if they cannot see it at all.
+func (h *AlbumHandlers) editableAlbum(w http.ResponseWriter, r *http.Request) (*models.Album, bool) {
+	album, ok := h.getAlbum(w, r)
+	if !ok {
+		return nil, false
+	}
+	if album.UserID != viewerID(r) && !types.IsAdmin(r.Context()) {
+		if !canViewAlbum(r, album) {
+			writeError(w, http.StatusNotFound, "album not found")
+			return nil, false
+		}
+		writeError(w, http.StatusForbidden, "cannot edit another user's album")
+		return nil, false
+	}
+	return album, true
+}
+
+func (h *AlbumHandlers) getAlbum(w http.ResponseWriter, r *http.Request) (*models.Album, bool) {
+	album, err := h.albums.GetByID(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		if err == repository.ErrAlbumNotFound {
+			writeError(w, http.StatusNotFound, "album not found")
+			return nil, false
+		}
+		writeError(w, http.StatusInternalServerError, "failed to get album")
+		return nil, false
+	}
+	return album, true
+}
+
+func (h *AlbumHandlers) writeAlbumError(w http.ResponseWriter, err error, msg, userID, albumID string) {
+	switch err {
+	case repository.ErrAlbumNotFound:
+		writeError(w, http.StatusNotFound, "album not found")
+	case repository.ErrAlbumSlugTaken:
+		writeError(w, http.StatusConflict, err.Error())
+	case repository.ErrAlbumOrderMismatch:
+		writeError(w, http.StatusBadRequest, err.Error())
+	default:
+		h.logger.Error(msg,
+			zap.Error(err),
+			zap.String("user_id", userID),
+			zap.String("album_id", albumID))
+		writeError(w, http.StatusInternalServerError, msg)
+	}
+}
+
+func applyAlbumPatch(album *models.Album, patch *models.AlbumPatch) {
+	if patch.Title != nil {
+		album.Title = sanitizeInput(strings.TrimSpace(*patch.Title))
+	}
+	if patch.Description != nil {
+		album.Description = sanitizeInput(*patch.Description)
+	}
+	if patch.Slug != nil {
+		album.Slug = *patch.Slug
+	}
+	if patch.CoverPhotoID != nil {
+		album.CoverPhotoID = *patch.CoverPhotoID
+	}
+	if patch.Visibility != nil {
+		album.Visibility = *patch.Visibility
+	}
+}
+
+func canViewAlbum(r *http.Request, album *models.Album) bool {
+	return album.Visibility != models.VisibilityPrivate || viewerID(r) == album.UserID
+}
+
+// slugify makes a slug from a title, keeping ASCII letters and digits.
+func slugify(title string) string {
+	var b strings.Builder
+	dash := false
+	for _, c := range strings.ToLower(title) {
+		if (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') {
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteRune(c)
+			dash = false
+		} else {
+			dash = true
+		}
+		if b.Len() >= 80 {
+			break
+		}
+	}
+	if b.Len() == 0 {
+		return "album"
+	}
+	return b.String()
+}
+
+func newAlbumID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return "album_" + base64.RawURLEncoding.EncodeToString(b)
+}
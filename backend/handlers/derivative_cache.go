@@ -0,0 +1,150 @@
+package handlers
+
+import (
+	"container/list"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// DerivativeCache keeps rendered images on disk under a byte budget, evicting
+// the least recently used files once the budget is exceeded.
+type DerivativeCache struct {
+	mu       sync.Mutex
+	maxBytes int64
+	size     int64
+	order    *list.List // front is most recently used
+	entries  map[string]*list.Element
+}
+
+type cacheEntry struct {
+	path string
+	size int64
+}
+
+// NewDerivativeCache indexes files already under dir, oldest first, so a
+// restart keeps the cache warm and its size accounted for.
+func NewDerivativeCache(dir string, maxBytes int64) *DerivativeCache {
+	c := &DerivativeCache{
+		maxBytes: maxBytes,
+		order:    list.New(),
+		entries:  make(map[string]*list.Element),
+	}
+
+	type existing struct {
+		path string
+		info fs.FileInfo
+	}
+	var files []existing
+	_ = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		if strings.HasSuffix(path, ".tmp") {
+			// Left behind by an interrupted Put.
+			_ = os.Remove(path)
+			return nil
+		}
+		if info, err := d.Info(); err == nil {
+			files = append(files, existing{path, info})
+		}
+		return nil
+	})
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].info.ModTime().Before(files[j].info.ModTime())
+	})
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, f := range files {
+		c.add(f.path, f.info.Size())
+	}
+	c.evict()
+	return c
+}
+
+// Get returns the cached file at path and marks it recently used.
+func (c *DerivativeCache) Get(path string) ([]byte, bool) {
+	c.mu.Lock()
+	el, ok := c.entries[path]
+	if ok {
+		c.order.MoveToFront(el)
+	}
+	c.mu.Unlock()
+	if !ok {
+		return nil, false
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		// Removed behind our back, e.g. with its photo.
+		c.mu.Lock()
+		c.remove(path)
+		c.mu.Unlock()
+		return nil, false
+	}
+	return data, true
+}
+
+// Put writes data to path and evicts older entries if over budget. Files
+// larger than the whole budget are not cached.
+func (c *DerivativeCache) Put(path string, data []byte) error {
+	if int64(len(data)) > c.maxBytes {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.remove(path)
+	c.add(path, int64(len(data)))
+	c.evict()
+	return nil
+}
+
+// Size reports the bytes currently accounted to the cache.
+func (c *DerivativeCache) Size() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.size
+}
+
+func (c *DerivativeCache) add(path string, size int64) {
+	c.entries[path] = c.order.PushFront(&cacheEntry{path: path, size: size})
+	c.size += size
+}
+
+func (c *DerivativeCache) remove(path string) {
+	el, ok := c.entries[path]
+	if !ok {
+		return
+	}
+	c.order.Remove(el)
+	delete(c.entries, path)
+	c.size -= el.Value.(*cacheEntry).size
+}
+
+func (c *DerivativeCache) evict() {
+	for c.size > c.maxBytes {
+		el := c.order.Back()
+		if el == nil {
+			return
+		}
+		entry := el.Value.(*cacheEntry)
+		c.remove(entry.path)
+		_ = os.Remove(entry.path)
+	}
+}
@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+	"nunoo.co/backend/models"
+	"nunoo.co/backend/repository"
+	"nunoo.co/backend/storage"
+)
+
+// servedPrefixes are the storage prefixes reachable under /uploads. Retained
+// originals are deliberately absent; only their owner may fetch them.
+var servedPrefixes = map[string]bool{
+	PhotosPrefix:     true,
+	ThumbnailsPrefix: true,
+	VariantsPrefix:   true,
+}
+
+// FileHandlers serve photo files and their derivatives under /uploads.
+type FileHandlers struct {
+	photos repository.PhotoRepository
+	store  storage.Storage
+	signer *URLSigner
+	logger *zap.Logger
+}
+
+func NewFileHandlers(photos repository.PhotoRepository, store storage.Storage, signer *URLSigner) *FileHandlers {
+	logger, _ := zap.NewProduction()
+
+	return &FileHandlers{
+		photos: photos,
+		store:  store,
+		signer: signer,
+		logger: logger,
+	}
+}
+
+// ServeUpload serves /uploads/{kind}/{file} from the requesting tenant's
+// storage, so a file from one site can never be fetched through another
+// site's host. Files of restricted photos need a valid signed URL, or the
+// owner's bearer token; a URL bound to a user also needs that user's token.
+func (h *FileHandlers) ServeUpload(w http.ResponseWriter, r *http.Request) {
+	kind := chi.URLParam(r, "kind")
+	name, err := storage.CleanKey(chi.URLParam(r, "*"))
+	if !servedPrefixes[kind] || err != nil || strings.Contains(name, "/") {
+		writeError(w, http.StatusNotFound, "file not found")
+		return
+	}
+
+	photo, err := h.photoForFile(r.Context(), kind, name)
+	if err != nil {
+		if err == repository.ErrPhotoNotFound {
+			writeError(w, http.StatusNotFound, "file not found")
+			return
+		}
+		h.logger.Error("failed to get photo for file", zap.Error(err), zap.String("file", name))
+		writeError(w, http.StatusInternalServerError, "failed to get photo")
+		return
+	}
+
+	q := r.URL.Query()
+	switch {
+	case q.Has("sig"):
+		userID, err := h.signer.Verify(r.Context(), r.URL.Path, q)
+		if err != nil {
+			writeError(w, http.StatusForbidden, err.Error())
+			return
+		}
+		if userID != "" {
+			if user := getUserFromContext(r); user == nil || user.ID != userID {
+				writeError(w, http.StatusForbidden, "signed URL was issued to another user")
+				return
+			}
+		}
+		// Shared caches must not hand a signed response to someone else.
+		w.Header().Set("Cache-Control", "private")
+	case h.signer.Restricted(photo):
+		if viewerID(r) != photo.UserID {
+			writeError(w, http.StatusNotFound, "file not found")
+			return
+		}
+		w.Header().Set("Cache-Control", "private")
+	}
+
+	ServeObject(w, r, h.store, TenantKey(r.Context(), kind, name))
+}
+
+// photoForFile finds the photo a stored file belongs to. The photo itself
+// is {id}.{ext}, its thumbnail {id}-thumb.{ext} and its renditions
+// {id}-w{width}.{ext}; IDs may contain '-', so both readings of a name are
+// tried and the photo must list the file.
+func (h *FileHandlers) photoForFile(ctx context.Context, kind, name string) (*models.Photo, error) {
+	id := strings.TrimSuffix(name, path.Ext(name))
+	candidates := []string{id}
+	if trimmed, ok := strings.CutSuffix(id, "-thumb"); ok {
+		candidates = append([]string{trimmed}, candidates...)
+	} else if i := strings.LastIndex(id, "-w"); i > 0 && isDigits(id[i+2:]) {
+		candidates = append([]string{id[:i]}, candidates...)
+	}
+
+	for _, id := range candidates {
+		photo, err := h.photos.GetByID(ctx, id)
+		if err == repository.ErrPhotoNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if photoHasFile(photo, "/uploads/"+kind+"/"+name) {
+			return photo, nil
+		}
+	}
+	return nil, repository.ErrPhotoNotFound
+}
+
+func photoHasFile(photo *models.Photo, url string) bool {
+	if url == photo.OriginalURL || url == photo.ThumbnailURL {
+		return true
+	}
+	for _, v := range photo.Variants {
+		if url == v.URL {
+			return true
+		}
+	}
+	return false
+}
+
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,203 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+	"nunoo.co/backend/models"
+	"nunoo.co/backend/repository"
+)
+
+type FollowHandlers struct {
+	follows  repository.FollowRepository
+	users    repository.UserRepository
+	photos   repository.PhotoRepository
+	notifier *Notifier
+	signer   *URLSigner
+	logger   *zap.Logger
+}
+
+func NewFollowHandlers(follows repository.FollowRepository, users repository.UserRepository, photos repository.PhotoRepository, notifier *Notifier, signer *URLSigner) *FollowHandlers {
+	logger, _ := zap.NewProduction()
+
+	return &FollowHandlers{
+		follows:  follows,
+		users:    users,
+		photos:   photos,
+		notifier: notifier,
+		signer:   signer,
+		logger:   logger,
+	}
+}
+
+func (h *FollowHandlers) Follow(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+	if user == nil {
+		writeError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	followeeID := chi.URLParam(r, "id")
+	if _, err := h.users.GetByID(r.Context(), followeeID); err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			writeError(w, http.StatusNotFound, "user not found")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "failed to get user")
+		return
+	}
+
+	alreadyFollowing, err := h.follows.IsFollowing(r.Context(), user.ID, followeeID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to follow user")
+		return
+	}
+
+	if err := h.follows.Follow(r.Context(), user.ID, followeeID); err != nil {
+		if errors.Is(err, repository.ErrSelfFollow) {
+			writeError(w, http.StatusBadRequest, "cannot follow yourself")
+			return
+		}
+		h.logger.Error("failed to follow user",
+			zap.Error(err),
+			zap.String("follower_id", user.ID),
+			zap.String("followee_id", followeeID))
+		writeError(w, http.StatusInternalServerError, "failed to follow user")
+		return
+	}
+
+	if !alreadyFollowing {
+		h.notifier.Notify(r.Context(), followeeID, user.ID, models.NotificationFollow, followeeID)
+	}
+
+	h.writeStats(w, r, followeeID)
+}
+
+func (h *FollowHandlers) Unfollow(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+	if user == nil {
+		writeError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	followeeID := chi.URLParam(r, "id")
+	if err := h.follows.Unfollow(r.Context(), user.ID, followeeID); err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to unfollow user")
+		return
+	}
+
+	h.writeStats(w, r, followeeID)
+}
+
+func (h *FollowHandlers) GetFollowers(w http.ResponseWriter, r *http.Request) {
+	userID := chi.URLParam(r, "id")
+	page, limit := pageParams(r)
+
+	follows, totalCount, err := h.follows.GetFollowers(r.Context(), userID, page, limit)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to get followers")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, followList(follows, page, limit, totalCount))
+}
+
+func (h *FollowHandlers) GetFollowing(w http.ResponseWriter, r *http.Request) {
+	userID := chi.URLParam(r, "id")
+	page, limit := pageParams(r)
+
+	follows, totalCount, err := h.follows.GetFollowing(r.Context(), userID, page, limit)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to get following")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, followList(follows, page, limit, totalCount))
+}
+
+func (h *FollowHandlers) GetStats(w http.ResponseWriter, r *http.Request) {
+	h.writeStats(w, r, chi.URLParam(r, "id"))
+}
+
+// GetFollowingFeed returns photos from accounts the caller follows, paged
+// with an opaque cursor rather than page numbers.
+func (h *FollowHandlers) GetFollowingFeed(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+	if user == nil {
+		writeError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	_, limit := pageParams(r)
+	var cursor *repository.FeedCursor
+	if raw := r.URL.Query().Get("cursor"); raw != "" {
+		c, err := repository.DecodeFeedCursor(raw)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid cursor")
+			return
+		}
+		cursor = c
+	}
+
+	// Fetch one extra row to learn whether another page exists
+	photos, err := h.photos.GetFollowingFeed(r.Context(), user.ID, cursor, limit+1)
+	if err != nil {
+		h.logger.Error("failed to get following feed",
+			zap.Error(err),
+			zap.String("user_id", user.ID))
+		writeError(w, http.StatusInternalServerError, "failed to get photos")
+		return
+	}
+
+	feed := &models.PhotoFeed{Photos: photos, Limit: limit}
+	if len(photos) > limit {
+		feed.Photos = photos[:limit]
+		feed.HasMore = true
+		last := feed.Photos[limit-1]
+		feed.NextCursor = repository.FeedCursor{CreatedAt: last.CreatedAt, ID: last.ID}.Encode()
+		w.Header().Set("Link", pageLink(r, "next", "cursor", feed.NextCursor))
+	}
+
+	markLiked(r.Context(), h.logger, h.photos, feed.Photos, user.ID)
+	h.signer.SignPhotos(r.Context(), feed.Photos, user.ID)
+	writeJSON(w, http.StatusOK, feed)
+}
+
+func (h *FollowHandlers) writeStats(w http.ResponseWriter, r *http.Request, userID string) {
+	stats, err := h.follows.GetStats(r.Context(), userID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to get follow stats")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, stats)
+}
+
+func followList(follows []models.Follow, page, limit int, totalCount int64) *models.FollowList {
+	return &models.FollowList{
+		Follows:    follows,
+		Page:       page,
+		Limit:      limit,
+		TotalCount: totalCount,
+		HasMore:    int64(page*limit) < totalCount,
+	}
+}
+
+// pageParams reads page and limit query parameters, defaulting to the first
+// page of 20 and capping limit at 50.
+func pageParams(r *http.Request) (int, int) {
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	if page < 1 {
+		page = 1
+	}
+
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	if limit < 1 || limit > 50 {
+		limit = 20
+	}
+
+	return page, limit
+}
@@ -0,0 +1,559 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/gif"
+	"math"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+	"golang.org/x/sync/singleflight"
+	"nunoo.co/backend/imaging"
+	"nunoo.co/backend/models"
+	"nunoo.co/backend/repository"
+	"nunoo.co/backend/storage"
+)
+
+const (
+	IIIFCacheDir          = "./uploads/iiif"
+	DefaultIIIFMaxSize    = 4096      // longest edge in pixels
+	DefaultIIIFCacheBytes = 512 << 20 // 512MB
+	DefaultIIIFMaxRenders = 2         // originals decoded at once
+	IIIFQuality           = 85
+
+	iiifContext = "http://iiif.io/api/image/3/context.json"
+	iiifProfile = "http://iiif.io/api/image/3/level2.json"
+)
+
+var iiifContentTypes = map[string]string{
+	"jpg": "image/jpeg",
+	"png": "image/png",
+	"gif": "image/gif",
+}
+
+type IIIFOptions struct {
+	MaxSize    int
+	CacheBytes int64
+	// MaxRenders caps how many renders decode an original at once. A large
+	// original takes hundreds of megabytes decoded, and renders of different
+	// regions or sizes are not merged, so the rest wait for a slot.
+	MaxRenders int
+	// Storage holds the photos rendered from; it defaults to local files
+	// under UploadRoot. Rendered derivatives are cached locally either way.
+	Storage storage.Storage
+	// Signer decides which photos are restricted. Their image services are
+	// only open to the owner, since IIIF URLs are built by clients and
+	// cannot carry a signature.
+	Signer *URLSigner
+}
+
+// IIIFHandlers implement the IIIF Image API 3.0 at compliance level 2 over
+// the stored originals, rendering derivatives on demand.
+type IIIFHandlers struct {
+	photos  repository.PhotoRepository
+	store   storage.Storage
+	signer  *URLSigner
+	cache   *DerivativeCache
+	renders singleflight.Group
+	slots   chan struct{}
+	maxSize int
+	logger  *zap.Logger
+}
+
+func NewIIIFHandlers(photos repository.PhotoRepository, opts IIIFOptions) *IIIFHandlers {
+	logger, _ := zap.NewProduction()
+
+	if opts.MaxSize <= 0 {
+		opts.MaxSize = DefaultIIIFMaxSize
+	}
+	if opts.CacheBytes <= 0 {
+		opts.CacheBytes = DefaultIIIFCacheBytes
+	}
+	if opts.MaxRenders <= 0 {
+		opts.MaxRenders = DefaultIIIFMaxRenders
+	}
+	if opts.Storage == nil {
+		opts.Storage = storage.NewLocal(UploadRoot)
+	}
+	if opts.Signer == nil {
+		opts.Signer = NewURLSigner(URLSignerOptions{})
+	}
+
+	return &IIIFHandlers{
+		photos:  photos,
+		store:   opts.Storage,
+		signer:  opts.Signer,
+		cache:   NewDerivativeCache(IIIFCacheDir, opts.CacheBytes),
+		slots:   make(chan struct{}, opts.MaxRenders),
+		maxSize: opts.MaxSize,
+		logger:  logger,
+	}
+}
+
+type iiifSize struct {
+	Type   string `json:"type"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+}
+
+type iiifInfo struct {
+	Context          string     `json:"@context"`
+	ID               string     `json:"id"`
+	Type             string     `json:"type"`
+	Protocol         string     `json:"protocol"`
+	Profile          string     `json:"profile"`
+	Width            int        `json:"width"`
+	Height           int        `json:"height"`
+	MaxWidth         int        `json:"maxWidth"`
+	MaxHeight        int        `json:"maxHeight"`
+	Sizes            []iiifSize `json:"sizes,omitempty"`
+	ExtraQualities   []string   `json:"extraQualities"`
+	ExtraFormats     []string   `json:"extraFormats"`
+	ExtraFeatures    []string   `json:"extraFeatures"`
+	PreferredFormats []string   `json:"preferredFormats"`
+}
+
+// Base redirects the image service URI to its info.json, as the spec asks.
+func (h *IIIFHandlers) Base(w http.ResponseWriter, r *http.Request) {
+	http.Redirect(w, r, iiifBaseURI(r, chi.URLParam(r, "id"))+"/info.json", http.StatusSeeOther)
+}
+
+func (h *IIIFHandlers) Info(w http.ResponseWriter, r *http.Request) {
+	photo, ok := h.servablePhoto(w, r)
+	if !ok {
+		return
+	}
+
+	info := iiifInfo{
+		Context:          iiifContext,
+		ID:               iiifBaseURI(r, photo.ID),
+		Type:             "ImageService3",
+		Protocol:         "http://iiif.io/api/image",
+		Profile:          "level2",
+		Width:            photo.Width,
+		Height:           photo.Height,
+		MaxWidth:         h.maxSize,
+		MaxHeight:        h.maxSize,
+		ExtraQualities:   []string{"color", "gray", "bitonal"},
+		ExtraFormats:     []string{"gif"},
+		ExtraFeatures:    []string{"mirroring", "sizeUpscaling"},
+		PreferredFormats: []string{"jpg"},
+	}
+	// Pre-rendered renditions are the cheapest sizes to ask for.
+	for _, v := range photo.Variants {
+		info.Sizes = append(info.Sizes, iiifSize{Type: "Size", Width: v.Width, Height: v.Height})
+	}
+
+	contentType := "application/json"
+	if strings.Contains(r.Header.Get("Accept"), "application/ld+json") {
+		contentType = `application/ld+json;profile="` + iiifContext + `"`
+	}
+	w.Header().Set("Link", `<`+iiifProfile+`>;rel="profile"`)
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(info); err != nil {
+		fmt.Println("failed to write JSON", zap.Error(err))
+	}
+}
+
+func (h *IIIFHandlers) Image(w http.ResponseWriter, r *http.Request) {
+	photo, ok := h.servablePhoto(w, r)
+	if !ok {
+		return
+	}
+
+	params := make([]string, 4)
+	for i, name := range []string{"region", "size", "rotation", "file"} {
+		v, err := url.PathUnescape(chi.URLParam(r, name))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "malformed image request")
+			return
+		}
+		params[i] = v
+	}
+
+	req, err := parseIIIFRequest(params[0], params[1], params[2], params[3], photo.Width, photo.Height, h.maxSize)
+	if err != nil {
+		var iiifErr *iiifError
+		if errors.As(err, &iiifErr) {
+			writeError(w, iiifErr.status, iiifErr.msg)
+			return
+		}
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	canonical := req.canonical(photo.Width, photo.Height)
+	sum := sha256.Sum256([]byte(canonical))
+	cachePath := filepath.Join(TenantDir(r.Context(), IIIFCacheDir), photo.ID, hex.EncodeToString(sum[:16])+"."+req.format)
+
+	data, ok := h.cache.Get(cachePath)
+	if !ok {
+		// Identical requests arriving together share one render.
+		v, err, _ := h.renders.Do(cachePath, func() (any, error) {
+			if data, ok := h.cache.Get(cachePath); ok {
+				return data, nil
+			}
+			// The render outlives a caller that gives up; others may be waiting.
+			data, err := h.render(context.WithoutCancel(r.Context()), photo, req)
+			if err != nil {
+				return nil, err
+			}
+			if err := h.cache.Put(cachePath, data); err != nil {
+				h.logger.Error("failed to cache derivative", zap.Error(err), zap.String("photo_id", photo.ID))
+			}
+			return data, nil
+		})
+		if err != nil {
+			h.logger.Error("failed to render derivative", zap.Error(err), zap.String("photo_id", photo.ID))
+			writeError(w, http.StatusInternalServerError, "failed to render image")
+			return
+		}
+		data = v.([]byte)
+	}
+
+	w.Header().Add("Link", `<`+iiifProfile+`>;rel="profile"`)
+	w.Header().Add("Link", `<`+iiifBaseURI(r, photo.ID)+"/"+canonical+`>;rel="canonical"`)
+	w.Header().Set("Content-Type", iiifContentTypes[req.format])
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(data); err != nil {
+		fmt.Println("failed to write image", zap.Error(err))
+	}
+}
+
+// servablePhoto loads the photo named in the URL and checks the caller may
+// see it. Photos without recorded dimensions could not be decoded on upload,
+// so there is nothing for the image service to work from.
+func (h *IIIFHandlers) servablePhoto(w http.ResponseWriter, r *http.Request) (*models.Photo, bool) {
+	photo, err := h.photos.GetByID(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		if err == repository.ErrPhotoNotFound {
+			writeError(w, http.StatusNotFound, "photo not found")
+			return nil, false
+		}
+		writeError(w, http.StatusInternalServerError, "failed to get photo")
+		return nil, false
+	}
+	if !canViewPhoto(r, photo) || (h.signer.Restricted(photo) && viewerID(r) != photo.UserID) {
+		writeError(w, http.StatusNotFound, "photo not found")
+		return nil, false
+	}
+	if photo.Width == 0 || photo.Height == 0 {
+		writeError(w, http.StatusNotFound, "image service unavailable for this photo")
+		return nil, false
+	}
+	return photo, true
+}
+
+func (h *IIIFHandlers) render(ctx context.Context, photo *models.Photo, req *iiifRequest) ([]byte, error) {
+	select {
+	case h.slots <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	defer func() {
+		<-h.slots
+	}()
+
+	img, _, err := decodeStored(ctx, h.store, photo)
+	if err != nil {
+		return nil, err
+	}
+
+	img = imaging.Crop(img, req.region)
+	if req.width != req.region.Dx() || req.height != req.region.Dy() {
+		img = imaging.Resize(img, req.width, req.height)
+	}
+	if req.mirror {
+		img = imaging.Mirror(img)
+	}
+	img = imaging.Rotate(img, req.rotation)
+	switch req.quality {
+	case "gray":
+		img = imaging.Gray(img)
+	case "bitonal":
+		img = imaging.Bitonal(img)
+	}
+
+	var buf bytes.Buffer
+	switch req.format {
+	case "jpg":
+		err = imaging.Encode(&buf, img, "jpeg", IIIFQuality)
+	case "png":
+		err = imaging.Encode(&buf, img, "png", 0)
+	case "gif":
+		err = gif.Encode(&buf, img, nil)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// iiifRequest is an image request resolved against a photo's dimensions.
+type iiifRequest struct {
+	region   image.Rectangle
+	width    int
+	height   int
+	mirror   bool
+	rotation int
+	quality  string
+	format   string
+}
+
+type iiifError struct {
+	status int
+	msg    string
+}
+
+func (e *iiifError) Error() string { return e.msg }
+
+func badIIIFRequest(msg string) error {
+	return &iiifError{status: http.StatusBadRequest, msg: msg}
+}
+
+func unsupportedIIIFRequest(msg string) error {
+	return &iiifError{status: http.StatusNotImplemented, msg: msg}
+}
+
+// parseIIIFRequest parses the region, size, rotation and quality.format
+// segments of an image request for a w x h image. Syntax errors are 400s;
+// valid requests for features not offered here are 501s.
+func parseIIIFRequest(region, size, rotation, file string, w, h, maxSize int) (*iiifRequest, error) {
+	req := &iiifRequest{}
+
+	rect, err := parseIIIFRegion(region, w, h)
+	if err != nil {
+		return nil, err
+	}
+	req.region = rect
+
+	req.width, req.height, err = parseIIIFSize(size, rect.Dx(), rect.Dy(), maxSize)
+	if err != nil {
+		return nil, err
+	}
+
+	if strings.HasPrefix(rotation, "!") {
+		req.mirror = true
+		rotation = rotation[1:]
+	}
+	// The spec allows plain decimals only; ParseFloat alone would also take
+	// NaN, Inf, exponents and hex.
+	whole, frac, hasFrac := strings.Cut(rotation, ".")
+	if !isDigits(whole) || hasFrac && !isDigits(frac) {
+		return nil, badIIIFRequest("invalid rotation")
+	}
+	degrees, err := strconv.ParseFloat(rotation, 64)
+	if err != nil || degrees < 0 || degrees > 360 {
+		return nil, badIIIFRequest("invalid rotation")
+	}
+	if math.Mod(degrees, 90) != 0 {
+		return nil, unsupportedIIIFRequest("only rotation by multiples of 90 is supported")
+	}
+	req.rotation = int(degrees) % 360
+
+	dot := strings.LastIndexByte(file, '.')
+	if dot < 0 {
+		return nil, badIIIFRequest("missing format")
+	}
+	req.quality, req.format = file[:dot], file[dot+1:]
+	switch req.quality {
+	case "default", "color", "gray", "bitonal":
+	default:
+		return nil, badIIIFRequest("invalid quality")
+	}
+	switch req.format {
+	case "jpg", "png", "gif":
+	case "tif", "jp2", "pdf", "webp":
+		return nil, unsupportedIIIFRequest("unsupported format")
+	default:
+		return nil, badIIIFRequest("invalid format")
+	}
+
+	return req, nil
+}
+
+func parseIIIFRegion(region string, w, h int) (image.Rectangle, error) {
+	switch region {
+	case "full":
+		return image.Rect(0, 0, w, h), nil
+	case "square":
+		side := min(w, h)
+		x, y := (w-side)/2, (h-side)/2
+		return image.Rect(x, y, x+side, y+side), nil
+	}
+
+	var rect image.Rectangle
+	if pct, ok := strings.CutPrefix(region, "pct:"); ok {
+		v, err := parseFloats(pct, 4)
+		if err != nil {
+			return rect, badIIIFRequest("invalid region")
+		}
+		x, y := int(math.Round(v[0]*float64(w)/100)), int(math.Round(v[1]*float64(h)/100))
+		rw, rh := int(math.Round(v[2]*float64(w)/100)), int(math.Round(v[3]*float64(h)/100))
+		rect = image.Rect(x, y, x+rw, y+rh)
+	} else {
+		v, err := parseFloats(region, 4)
+		if err != nil {
+			return rect, badIIIFRequest("invalid region")
+		}
+		for _, n := range v {
+			if n != math.Trunc(n) {
+				return rect, badIIIFRequest("invalid region")
+			}
+		}
+		rect = image.Rect(int(v[0]), int(v[1]), int(v[0]+v[2]), int(v[1]+v[3]))
+	}
+
+	// Regions may extend past the image and are clipped, but must overlap it.
+	rect = rect.Intersect(image.Rect(0, 0, w, h))
+	if rect.Empty() {
+		return rect, badIIIFRequest("region is outside the image")
+	}
+	return rect, nil
+}
+
+func parseIIIFSize(size string, rw, rh, maxSize int) (int, int, error) {
+	upscale := strings.HasPrefix(size, "^")
+	size = strings.TrimPrefix(size, "^")
+
+	var w, h int
+	switch {
+	case size == "max":
+		w, h = rw, rh
+		if upscale {
+			w, h = scaleToFit(rw, rh, maxSize, maxSize, true)
+		}
+		w, h = imaging.Fit(w, h, maxSize, maxSize)
+		return w, h, nil
+
+	case strings.HasPrefix(size, "pct:"):
+		n, err := strconv.ParseFloat(size[len("pct:"):], 64)
+		if err != nil || n <= 0 {
+			return 0, 0, badIIIFRequest("invalid size")
+		}
+		w, h = int(math.Round(float64(rw)*n/100)), int(math.Round(float64(rh)*n/100))
+
+	case strings.HasPrefix(size, "!"):
+		v, err := parseInts(size[1:])
+		if err != nil || v[0] <= 0 || v[1] <= 0 {
+			return 0, 0, badIIIFRequest("invalid size")
+		}
+		w, h = scaleToFit(rw, rh, v[0], v[1], upscale)
+
+	default:
+		parts := strings.Split(size, ",")
+		if len(parts) != 2 || (parts[0] == "" && parts[1] == "") {
+			return 0, 0, badIIIFRequest("invalid size")
+		}
+		var err error
+		switch {
+		case parts[1] == "":
+			w, err = strconv.Atoi(parts[0])
+			h = int(math.Round(float64(rh) * float64(w) / float64(rw)))
+		case parts[0] == "":
+			h, err = strconv.Atoi(parts[1])
+			w = int(math.Round(float64(rw) * float64(h) / float64(rh)))
+		default:
+			var v []int
+			v, err = parseInts(size)
+			if err == nil {
+				w, h = v[0], v[1]
+			}
+		}
+		if err != nil {
+			return 0, 0, badIIIFRequest("invalid size")
+		}
+	}
+
+	if w < 1 || h < 1 {
+		return 0, 0, badIIIFRequest("requested size is empty")
+	}
+	if !upscale && (w > rw || h > rh) {
+		return 0, 0, badIIIFRequest("size exceeds region; use ^ to upscale")
+	}
+	if w > maxSize || h > maxSize {
+		return 0, 0, badIIIFRequest("requested size exceeds maximum")
+	}
+	return w, h, nil
+}
+
+// scaleToFit scales w x h to the largest size inside maxW x maxH, never
+// growing it unless upscale is set.
+func scaleToFit(w, h, maxW, maxH int, upscale bool) (int, int) {
+	scale := math.Min(float64(maxW)/float64(w), float64(maxH)/float64(h))
+	if !upscale {
+		scale = math.Min(scale, 1)
+	}
+	return max(1, int(math.Round(float64(w)*scale))), max(1, int(math.Round(float64(h)*scale)))
+}
+
+// canonical renders the request in the spec's canonical URI syntax.
+func (q *iiifRequest) canonical(w, h int) string {
+	region := "full"
+	if q.region != image.Rect(0, 0, w, h) {
+		region = fmt.Sprintf("%d,%d,%d,%d", q.region.Min.X, q.region.Min.Y, q.region.Dx(), q.region.Dy())
+	}
+	size := fmt.Sprintf("%d,%d", q.width, q.height)
+	if q.width > q.region.Dx() || q.height > q.region.Dy() {
+		size = "^" + size
+	}
+	rotation := strconv.Itoa(q.rotation)
+	if q.mirror {
+		rotation = "!" + rotation
+	}
+	return fmt.Sprintf("%s/%s/%s/%s.%s", region, size, rotation, q.quality, q.format)
+}
+
+func iiifBaseURI(r *http.Request, photoID string) string {
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host + "/iiif/" + url.PathEscape(photoID)
+}
+
+func parseFloats(s string, n int) ([]float64, error) {
+	parts := strings.Split(s, ",")
+	if len(parts) != n {
+		return nil, errors.New("wrong number of values")
+	}
+	v := make([]float64, n)
+	for i, p := range parts {
+		f, err := strconv.ParseFloat(p, 64)
+		if err != nil || f < 0 {
+			return nil, errors.New("invalid number")
+		}
+		v[i] = f
+	}
+	return v, nil
+}
+
+func parseInts(s string) ([]int, error) {
+	parts := strings.Split(s, ",")
+	if len(parts) != 2 {
+		return nil, errors.New("wrong number of values")
+	}
+	v := make([]int, 2)
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil {
+			return nil, err
+		}
+		v[i] = n
+	}
+	return v, nil
+}
@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"nunoo.co/backend/storage"
+	"nunoo.co/backend/types"
+)
+
+// LegacyUploadsMarker is the object MoveLegacyUploads writes once it has
+// finished, so later starts skip listing every stored file.
+const LegacyUploadsMarker = "migrations/tenant-layout"
+
+// MoveLegacyUploads moves files stored before uploads were split by tenant,
+// at prefix/name, to prefix/default/name where the default tenant now looks
+// them up, then writes LegacyUploadsMarker. Once the marker exists it does
+// nothing. It returns how many files were moved.
+func MoveLegacyUploads(ctx context.Context, store storage.Storage) (int, error) {
+	if _, err := store.Stat(ctx, LegacyUploadsMarker); err == nil {
+		return 0, nil
+	} else if !errors.Is(err, storage.ErrNotFound) {
+		return 0, fmt.Errorf("check %s: %w", LegacyUploadsMarker, err)
+	}
+
+	moved := 0
+	for _, prefix := range []string{PhotosPrefix, ThumbnailsPrefix, VariantsPrefix, OriginalsPrefix} {
+		objects, err := store.List(ctx, prefix+"/")
+		if err != nil {
+			return moved, fmt.Errorf("list %s: %w", prefix, err)
+		}
+		for _, info := range objects {
+			name := strings.TrimPrefix(info.Key, prefix+"/")
+			if strings.Contains(name, "/") {
+				continue
+			}
+			if err := moveObject(ctx, store, info, path.Join(prefix, types.DefaultTenant, name)); err != nil {
+				return moved, fmt.Errorf("move %s: %w", info.Key, err)
+			}
+			moved++
+		}
+	}
+
+	done := time.Now().UTC().Format(time.RFC3339)
+	if err := store.Put(ctx, LegacyUploadsMarker, strings.NewReader(done), int64(len(done)), "text/plain"); err != nil {
+		return moved, fmt.Errorf("write %s: %w", LegacyUploadsMarker, err)
+	}
+	return moved, nil
+}
+
+// moveObject copies info's object to key and deletes the original. An
+// object another replica moved first is skipped.
+func moveObject(ctx context.Context, store storage.Storage, info storage.ObjectInfo, key string) error {
+	obj, err := store.Get(ctx, info.Key, nil)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return nil
+		}
+		return err
+	}
+	defer func() {
+		_ = obj.Body.Close()
+	}()
+
+	if err := store.Put(ctx, key, obj.Body, obj.Size, obj.ContentType); err != nil {
+		return err
+	}
+	return store.Delete(ctx, info.Key)
+}
@@ -0,0 +1,177 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+	"nunoo.co/backend/models"
+	"nunoo.co/backend/repository"
+)
+
+type LikeHandlers struct {
+	photos   repository.PhotoRepository
+	notifier *Notifier
+	signer   *URLSigner
+	logger   *zap.Logger
+}
+
+func NewLikeHandlers(photos repository.PhotoRepository, notifier *Notifier, signer *URLSigner) *LikeHandlers {
+	logger, _ := zap.NewProduction()
+
+	return &LikeHandlers{
+		photos:   photos,
+		notifier: notifier,
+		signer:   signer,
+		logger:   logger,
+	}
+}
+
+// Like adds the caller's like to a photo they can see. Liking again changes
+// nothing; only the first like notifies the owner.
+func (h *LikeHandlers) Like(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+	if user == nil {
+		writeError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	photo, ok := h.likeablePhoto(w, r)
+	if !ok {
+		return
+	}
+
+	count, added, err := h.photos.Like(r.Context(), photo.ID, user.ID)
+	if err != nil {
+		h.writeLikeError(w, err, "failed to like photo", photo.ID, user.ID)
+		return
+	}
+
+	if added {
+		h.notifier.Notify(r.Context(), photo.UserID, user.ID, models.NotificationLike, photo.ID)
+	}
+
+	writeJSON(w, http.StatusOK, &models.PhotoLikeState{PhotoID: photo.ID, LikeCount: count, Liked: true})
+}
+
+// Unlike removes the caller's like, if any.
+func (h *LikeHandlers) Unlike(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+	if user == nil {
+		writeError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	photo, ok := h.likeablePhoto(w, r)
+	if !ok {
+		return
+	}
+
+	count, _, err := h.photos.Unlike(r.Context(), photo.ID, user.ID)
+	if err != nil {
+		h.writeLikeError(w, err, "failed to unlike photo", photo.ID, user.ID)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, &models.PhotoLikeState{PhotoID: photo.ID, LikeCount: count})
+}
+
+// ListMyLikes pages through the photos the caller likes, most recently
+// liked first, with an opaque cursor.
+func (h *LikeHandlers) ListMyLikes(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+	if user == nil {
+		writeError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	_, limit := pageParams(r)
+	var cursor *repository.FeedCursor
+	if raw := r.URL.Query().Get("cursor"); raw != "" {
+		c, err := repository.DecodeFeedCursor(raw)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid cursor")
+			return
+		}
+		cursor = c
+	}
+
+	// Fetch one extra row to learn whether another page exists
+	likes, err := h.photos.GetLikes(r.Context(), user.ID, cursor, limit+1)
+	if err != nil {
+		h.logger.Error("failed to list likes",
+			zap.Error(err),
+			zap.String("user_id", user.ID))
+		writeError(w, http.StatusInternalServerError, "failed to list likes")
+		return
+	}
+
+	list := &models.PhotoLikeList{Likes: likes, Limit: limit}
+	if len(likes) > limit {
+		list.Likes = likes[:limit]
+		list.HasMore = true
+		last := list.Likes[limit-1]
+		list.NextCursor = repository.FeedCursor{CreatedAt: last.LikedAt, ID: last.Photo.ID}.Encode()
+		w.Header().Set("Link", pageLink(r, "next", "cursor", list.NextCursor))
+	}
+
+	for i := range list.Likes {
+		list.Likes[i].Photo = *h.signer.SignPhoto(r.Context(), &list.Likes[i].Photo, user.ID)
+		list.Likes[i].Photo.Liked = true
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+// likeablePhoto loads the {id} photo, answering 404 when the caller cannot
+// see it.
+func (h *LikeHandlers) likeablePhoto(w http.ResponseWriter, r *http.Request) (*models.Photo, bool) {
+	photo, err := h.photos.GetByID(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		if errors.Is(err, repository.ErrPhotoNotFound) {
+			writeError(w, http.StatusNotFound, "photo not found")
+			return nil, false
+		}
+		writeError(w, http.StatusInternalServerError, "failed to get photo")
+		return nil, false
+	}
+	if !canViewPhoto(r, photo) {
+		writeError(w, http.StatusNotFound, "photo not found")
+		return nil, false
+	}
+	return photo, true
+}
+
+func (h *LikeHandlers) writeLikeError(w http.ResponseWriter, err error, msg, photoID, userID string) {
+	if errors.Is(err, repository.ErrPhotoNotFound) {
+		writeError(w, http.StatusNotFound, "photo not found")
+		return
+	}
+	h.logger.Error(msg,
+		zap.Error(err),
+		zap.String("photo_id", photoID),
+		zap.String("user_id", userID))
+	writeError(w, http.StatusInternalServerError, msg)
+}
+
+// markLiked sets Liked on the photos viewerID likes, looking them all up in
+// one query. Anonymous viewers like nothing. A failed lookup is logged and
+// leaves the photos unmarked rather than failing the response.
+func markLiked(ctx context.Context, logger *zap.Logger, photos repository.PhotoRepository, list []models.Photo, viewerID string) {
+	if viewerID == "" || len(list) == 0 {
+		return
+	}
+	ids := make([]string, len(list))
+	for i := range list {
+		ids[i] = list[i].ID
+	}
+	liked, err := photos.LikedPhotoIDs(ctx, viewerID, ids)
+	if err != nil {
+		logger.Warn("failed to load liked photos",
+			zap.Error(err),
+			zap.String("user_id", viewerID))
+		return
+	}
+	for i := range list {
+		list[i].Liked = liked[list[i].ID]
+	}
+}
@@ -0,0 +1,202 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"go.uber.org/zap"
+	"nunoo.co/backend/models"
+	"nunoo.co/backend/repository"
+)
+
+// Notifier is the producer API other handlers use to tell users about
+// activity on their content. Delivery is best effort: failures are logged and
+// never fail the request that triggered them.
+type Notifier struct {
+	notifications repository.NotificationRepository
+	prefs         repository.PreferencesRepository
+	logger        *zap.Logger
+}
+
+func NewNotifier(notifications repository.NotificationRepository, prefs repository.PreferencesRepository) *Notifier {
+	logger, _ := zap.NewProduction()
+
+	return &Notifier{
+		notifications: notifications,
+		prefs:         prefs,
+		logger:        logger,
+	}
+}
+
+// Notify records that actorID did something of the given kind (one of the
+// models.Notification* constants) to subjectID, owned by recipientID. Users
+// are never notified about their own actions or about kinds they opted out of.
+func (n *Notifier) Notify(ctx context.Context, recipientID, actorID, kind, subjectID string) {
+	if n == nil || recipientID == "" || recipientID == actorID {
+		return
+	}
+
+	prefs, err := n.prefs.Get(ctx, recipientID)
+	if err != nil && !errors.Is(err, repository.ErrPreferencesNotFound) {
+		n.logger.Warn("failed to load preferences for notification",
+			zap.Error(err),
+			zap.String("user_id", recipientID))
+	}
+	if prefs != nil && prefs.OptedOut(kind) {
+		return
+	}
+
+	notification := &models.Notification{
+		ID:        newNotificationID(),
+		UserID:    recipientID,
+		Kind:      kind,
+		SubjectID: subjectID,
+	}
+	if err := n.notifications.Add(ctx, notification, actorID); err != nil {
+		n.logger.Error("failed to add notification",
+			zap.Error(err),
+			zap.String("user_id", recipientID),
+			zap.String("kind", kind))
+	}
+}
+
+type NotificationHandlers struct {
+	notifications repository.NotificationRepository
+	logger        *zap.Logger
+}
+
+func NewNotificationHandlers(notifications repository.NotificationRepository) *NotificationHandlers {
+	logger, _ := zap.NewProduction()
+
+	return &NotificationHandlers{
+		notifications: notifications,
+		logger:        logger,
+	}
+}
+
+// NotificationSelection picks notifications for bulk actions. With All set,
+// IDs is ignored and every notification of the caller is affected.
+type NotificationSelection struct {
+	IDs []string `json:"ids"`
+	All bool     `json:"all"`
+}
+
+func (h *NotificationHandlers) ListNotifications(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+	if user == nil {
+		writeError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	_, limit := pageParams(r)
+	var cursor *repository.FeedCursor
+	if raw := r.URL.Query().Get("cursor"); raw != "" {
+		c, err := repository.DecodeFeedCursor(raw)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid cursor")
+			return
+		}
+		cursor = c
+	}
+
+	list, err := h.notifications.List(r.Context(), user.ID, cursor, limit+1)
+	if err != nil {
+		h.logger.Error("failed to list notifications",
+			zap.Error(err),
+			zap.String("user_id", user.ID))
+		writeError(w, http.StatusInternalServerError, "failed to get notifications")
+		return
+	}
+
+	page := &models.NotificationPage{Notifications: list, Limit: limit}
+	if len(list) > limit {
+		page.Notifications = list[:limit]
+		page.HasMore = true
+		last := page.Notifications[limit-1]
+		page.NextCursor = repository.FeedCursor{CreatedAt: last.UpdatedAt, ID: last.ID}.Encode()
+	}
+
+	writeJSON(w, http.StatusOK, page)
+}
+
+func (h *NotificationHandlers) UnreadCount(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+	if user == nil {
+		writeError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	count, err := h.notifications.UnreadCount(r.Context(), user.ID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to count notifications")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]int64{"unread": count})
+}
+
+func (h *NotificationHandlers) MarkRead(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+	if user == nil {
+		writeError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	ids, ok := decodeSelection(w, r)
+	if !ok {
+		return
+	}
+	if err := h.notifications.MarkRead(r.Context(), user.ID, ids); err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to mark notifications read")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *NotificationHandlers) Dismiss(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+	if user == nil {
+		writeError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	ids, ok := decodeSelection(w, r)
+	if !ok {
+		return
+	}
+	if err := h.notifications.Dismiss(r.Context(), user.ID, ids); err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to dismiss notifications")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// decodeSelection reads a NotificationSelection body. It returns nil ids for
+// "all" and rejects an empty selection so a missing body never acts on everything.
+func decodeSelection(w http.ResponseWriter, r *http.Request) ([]string, bool) {
+	var sel NotificationSelection
+	if err := json.NewDecoder(r.Body).Decode(&sel); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json body")
+		return nil, false
+	}
+	if sel.All {
+		return nil, true
+	}
+	if len(sel.IDs) == 0 || len(sel.IDs) > 500 {
+		writeError(w, http.StatusBadRequest, "ids must contain between 1 and 500 notification ids, or set all")
+		return nil, false
+	}
+	return sel.IDs, true
+}
+
+func newNotificationID() string {
+	b := make([]byte, 12)
+	_, _ = rand.Read(b)
+	return "ntf_" + base64.RawURLEncoding.EncodeToString(b)
+}
@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"go.uber.org/zap"
+	"nunoo.co/backend/models"
+	"nunoo.co/backend/repository"
+)
+
+// photoSource lists the photos of one feed by offset or by keyset, and
+// estimates how many there are.
+type photoSource struct {
+	page     func(page, limit int) ([]models.Photo, int64, error)
+	after    func(cursor *repository.FeedCursor, limit int) ([]models.Photo, error)
+	estimate func() (int64, error)
+}
+
+// writePhotoFeed answers a feed request from src. A cursor parameter, even
+// an empty one for the first page, selects keyset paging, which never
+// counts and is not shifted by new uploads; without it page and limit page
+// by offset with an exact total_count. Feeds sorted by creation carry a
+// next_cursor either way, total=approx adds an estimated total, and
+// neighbouring pages are linked with an RFC 8288 Link header.
+func (h *PhotoHandlers) writePhotoFeed(w http.ResponseWriter, r *http.Request, sort repository.PhotoSort, src photoSource) {
+	q := r.URL.Query()
+	page, limit := pageParams(r)
+	keyset := q.Has("cursor")
+	if keyset && sort == repository.SortTakenAt {
+		writeError(w, http.StatusBadRequest, "cursor paging requires sort=created_at")
+		return
+	}
+
+	feed := &models.PhotoFeed{Limit: limit}
+	if keyset {
+		var cursor *repository.FeedCursor
+		if raw := q.Get("cursor"); raw != "" {
+			c, err := repository.DecodeFeedCursor(raw)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, "invalid cursor")
+				return
+			}
+			cursor = c
+		}
+
+		// Fetch one extra row to learn whether another page exists
+		photos, err := src.after(cursor, limit+1)
+		if err != nil {
+			h.logger.Error("failed to get photos",
+				zap.Error(err),
+				zap.Int("limit", limit))
+			writeError(w, http.StatusInternalServerError, "failed to get photos")
+			return
+		}
+		feed.Photos = photos
+		if len(photos) > limit {
+			feed.Photos = photos[:limit]
+			feed.HasMore = true
+		}
+	} else {
+		photos, totalCount, err := src.page(page, limit)
+		if err != nil {
+			h.logger.Error("failed to get photos",
+				zap.Error(err),
+				zap.Int("page", page),
+				zap.Int("limit", limit))
+			writeError(w, http.StatusInternalServerError, "failed to get photos")
+			return
+		}
+		feed.Photos = photos
+		feed.Page = page
+		feed.TotalCount = totalCount
+		feed.HasMore = int64(page*limit) < totalCount
+	}
+
+	if feed.HasMore && len(feed.Photos) > 0 && sort != repository.SortTakenAt {
+		last := feed.Photos[len(feed.Photos)-1]
+		feed.NextCursor = repository.FeedCursor{CreatedAt: last.CreatedAt, ID: last.ID}.Encode()
+	}
+	if q.Get("total") == "approx" {
+		if n, err := src.estimate(); err != nil {
+			h.logger.Warn("failed to estimate photo count", zap.Error(err))
+		} else {
+			feed.ApproximateTotal = &n
+		}
+	}
+
+	var links []string
+	switch {
+	case keyset:
+		if feed.NextCursor != "" {
+			links = append(links, pageLink(r, "next", "cursor", feed.NextCursor))
+		}
+	default:
+		if feed.HasMore {
+			links = append(links, pageLink(r, "next", "page", strconv.Itoa(page+1)))
+		}
+		if page > 1 {
+			links = append(links, pageLink(r, "prev", "page", strconv.Itoa(page-1)))
+		}
+	}
+	if len(links) > 0 {
+		w.Header().Set("Link", strings.Join(links, ", "))
+	}
+
+	markLiked(r.Context(), h.logger, h.photos, feed.Photos, viewerID(r))
+	h.signer.SignPhotos(r.Context(), feed.Photos, viewerID(r))
+	writeJSON(w, http.StatusOK, feed)
+}
+
+// pageLink is an RFC 8288 link to the request's URL with param set to value,
+// switching between page and cursor paging as needed.
+func pageLink(r *http.Request, rel, param, value string) string {
+	q := r.URL.Query()
+	q.Del("page")
+	q.Del("cursor")
+	q.Set(param, value)
+	u := url.URL{Path: r.URL.Path, RawQuery: q.Encode()}
+	return "<" + u.String() + `>; rel="` + rel + `"`
+}
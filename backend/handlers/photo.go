@@ -1,62 +1,152 @@
 package handlers
 
 import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"image"
 	"io"
-	"mime/multipart"
 	"net/http"
+	"net/url"
 	"os"
+	"path"
 	"path/filepath"
+	"slices"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/go-chi/chi/v5"
+	"github.com/go-playground/validator/v10"
 	"go.uber.org/zap"
+	"nunoo.co/backend/exif"
+	"nunoo.co/backend/imaging"
 	"nunoo.co/backend/models"
 	"nunoo.co/backend/repository"
+	"nunoo.co/backend/storage"
 	"nunoo.co/backend/types"
 )
 
 const (
-	MaxFileSize  = 20 << 20 // 20MB
-	MaxMemory    = 10 << 20 // 10MB for form parsing
-	UploadDir    = "./uploads/photos"
-	ThumbnailDir = "./uploads/thumbnails"
+	MaxFileSize      = 20 << 20 // 20MB
+	UploadRoot       = "./uploads"
+	StagingDir       = "./uploads/staging"
+	ThumbnailSize    = 400 // longest edge in pixels
+	ThumbnailQuality = 80
 )
 
-var allowedMimeTypes = map[string]bool{
-	"image/jpeg":               true,
-	"image/png":                true,
-	"image/webp":               true,
-	"image/gif":                true,
-	"image/heic":               true,
-	"image/heif":               true,
-	"image/tiff":               true,
-	"image/bmp":                true,
-	"application/octet-stream": true, // Fallback for content type detection issues
+// Storage key prefixes. Every stored file lives at prefix/tenant/name; see
+// TenantKey.
+const (
+	PhotosPrefix     = "photos"
+	ThumbnailsPrefix = "thumbnails"
+	VariantsPrefix   = "variants"
+	// OriginalsPrefix holds retained originals, which are never served
+	// under /uploads.
+	OriginalsPrefix = "originals"
+)
+
+// Rendition is one responsive size generated for every upload.
+type Rendition struct {
+	Width   int
+	Quality int
+}
+
+// DefaultRenditions are used when PhotoOptions lists none.
+var DefaultRenditions = []Rendition{
+	{Width: 320, Quality: 75},
+	{Width: 640, Quality: 80},
+	{Width: 1280, Quality: 82},
+	{Width: 2048, Quality: 85},
+}
+
+// Metadata policies for the served copy of each upload.
+const (
+	// MetadataStripPrivate removes location, serial numbers, maker notes and
+	// similar identifying metadata. It is the default.
+	MetadataStripPrivate = "strip_private"
+	// MetadataStripAll keeps only orientation and resolution tags.
+	MetadataStripAll = "strip_all"
+	// MetadataKeep serves uploads byte-for-byte.
+	MetadataKeep = "keep"
+)
+
+type PhotoOptions struct {
+	Renditions     []Rendition
+	MetadataPolicy string
+	// Storage holds photos and their derivatives. It defaults to local
+	// files under UploadRoot.
+	Storage storage.Storage
+	// Signer signs the file URLs of restricted photos; by default with an
+	// ephemeral key.
+	Signer *URLSigner
+	// Validate checks photo edits; a fresh validator is used when nil.
+	Validate *validator.Validate
+	// Albums lose deleted photos. Without them no album cleanup happens.
+	Albums repository.AlbumRepository
 }
 
 type PhotoHandlers struct {
-	photos repository.PhotoRepository
-	logger *zap.Logger
+	photos         repository.PhotoRepository
+	store          storage.Storage
+	signer         *URLSigner
+	albums         repository.AlbumRepository
+	validate       *validator.Validate
+	renditions     []Rendition
+	metadataPolicy string
+	logger         *zap.Logger
 }
 
-func NewPhotoHandlers(photos repository.PhotoRepository) *PhotoHandlers {
+func NewPhotoHandlers(photos repository.PhotoRepository, opts PhotoOptions) *PhotoHandlers {
 	logger, _ := zap.NewProduction()
 
-	err := os.MkdirAll(UploadDir, 0755)
-	if err != nil {
-		logger.Error("failed to create upload directory", zap.Error(err))
+	renditions := opts.Renditions
+	if len(renditions) == 0 {
+		renditions = DefaultRenditions
 	}
-	err = os.MkdirAll(ThumbnailDir, 0755)
-	if err != nil {
-		logger.Error("failed to create thumbnail directory", zap.Error(err))
+	policy := opts.MetadataPolicy
+	switch policy {
+	case MetadataStripPrivate, MetadataStripAll, MetadataKeep:
+	case "":
+		policy = MetadataStripPrivate
+	default:
+		logger.Error("unknown metadata policy, stripping private metadata", zap.String("policy", policy))
+		policy = MetadataStripPrivate
+	}
+
+	// Largest first so each rendition can be resized from the previous one,
+	// and one per width since the width names the stored file.
+	renditions = append([]Rendition(nil), renditions...)
+	sort.SliceStable(renditions, func(i, j int) bool { return renditions[i].Width > renditions[j].Width })
+	renditions = slices.CompactFunc(renditions, func(a, b Rendition) bool { return a.Width == b.Width })
+
+	store := opts.Storage
+	if store == nil {
+		store = storage.NewLocal(UploadRoot)
+	}
+	signer := opts.Signer
+	if signer == nil {
+		signer = NewURLSigner(URLSignerOptions{})
+	}
+	validate := opts.Validate
+	if validate == nil {
+		validate = validator.New()
 	}
 
 	return &PhotoHandlers{
-		photos: photos,
-		logger: logger,
+		photos:         photos,
+		store:          store,
+		signer:         signer,
+		albums:         opts.Albums,
+		validate:       validate,
+		renditions:     renditions,
+		metadataPolicy: policy,
+		logger:         logger,
 	}
 }
 
@@ -68,130 +158,242 @@ type UploadPhotoResponse struct {
 	Photo *models.Photo `json:"photo"`
 }
 
-func (h *PhotoHandlers) UploadPhoto(w http.ResponseWriter, r *http.Request) {
-	if err := r.ParseMultipartForm(MaxMemory); err != nil {
-		writeError(w, http.StatusBadRequest, "failed to parse multipart form")
-		return
-	}
+// Values of the on_duplicate upload field, deciding what happens when the
+// user already has a photo with the same bytes.
+const (
+	// DuplicateReject answers 409 with the existing photo. It is the default.
+	DuplicateReject = "reject"
+	// DuplicateReturn answers 200 with the existing photo as if uploaded.
+	DuplicateReturn = "return"
+)
 
-	file, header, err := r.FormFile("photo")
-	if err != nil {
-		writeError(w, http.StatusBadRequest, "photo file is required")
-		return
-	}
-	defer func() {
-		if err := file.Close(); err != nil {
-			fmt.Println("failed to close file", zap.Error(err))
-		}
-	}()
+type DuplicatePhotoResponse struct {
+	Error string        `json:"error"`
+	Photo *models.Photo `json:"photo"`
+}
 
-	if header.Size > MaxFileSize {
-		writeError(w, http.StatusBadRequest, "file too large")
-		return
+func validOnDuplicate(v string) error {
+	if v != "" && v != DuplicateReject && v != DuplicateReturn {
+		return badUpload("on_duplicate must be reject or return")
 	}
+	return nil
+}
 
-	mimeType := header.Header.Get("Content-Type")
-	// Fallback to detecting MIME type from file content if not set
-	if mimeType == "" {
-		// Read a small portion to detect MIME type
-		buf := make([]byte, 512)
-		n, _ := file.Read(buf)
-		mimeType = http.DetectContentType(buf[:n])
-		if _, err := file.Seek(0, 0); err != nil {
-			fmt.Println("failed to reset file pointer", zap.Error(err))
-		}
+func validVisibility(v string) error {
+	if v != "" && !models.Visibility(v).Valid() {
+		return badUpload("visibility must be public, unlisted or private")
 	}
+	return nil
+}
 
-	if !allowedMimeTypes[mimeType] {
-		writeError(w, http.StatusBadRequest, fmt.Sprintf("unsupported file type (jpeg, png, webp, gif only): %s", mimeType))
-		return
+// uploadVisibility picks the visibility of an upload: the visibility field
+// when sent, else the uploader's default_visibility preference.
+func uploadVisibility(field string, prefs models.Preferences) (models.Visibility, error) {
+	if err := validVisibility(field); err != nil {
+		return "", err
 	}
-
-	// Read file content for security validation
-	fileContent := make([]byte, header.Size)
-	if _, err := file.Read(fileContent); err != nil {
-		writeError(w, http.StatusInternalServerError, "failed to read file")
-		return
+	if field != "" {
+		return models.Visibility(field), nil
 	}
-	if _, err := file.Seek(0, 0); err != nil {
-		fmt.Println("failed to reset file pointer", zap.Error(err))
+	if v := models.Visibility(prefs.DefaultVisibility); v.Valid() {
+		return v, nil
 	}
+	return models.VisibilityPublic, nil
+}
 
-	// Security validation
-	if err := ValidateImageFile(fileContent); err != nil {
-		writeError(w, http.StatusBadRequest, err.Error())
+func (h *PhotoHandlers) writeDuplicate(ctx context.Context, w http.ResponseWriter, existing *models.Photo, onDuplicate, userID string) {
+	w.Header().Set("Location", "/photos/?id="+url.QueryEscape(existing.ID))
+	existing = h.signer.SignPhoto(ctx, existing, userID)
+	if onDuplicate == DuplicateReturn {
+		writeJSON(w, http.StatusOK, UploadPhotoResponse{Photo: existing})
 		return
 	}
+	writeJSON(w, http.StatusConflict, DuplicatePhotoResponse{Error: "photo already exists", Photo: existing})
+}
 
+func (h *PhotoHandlers) UploadPhoto(w http.ResponseWriter, r *http.Request) {
 	user := getUserFromContext(r)
 	if user == nil {
 		writeError(w, http.StatusUnauthorized, "unauthorized")
 		return
 	}
 
-	caption := r.FormValue("caption")
-	// Sanitize caption to prevent XSS
-	caption = sanitizeInput(caption)
+	form, err := readUploadForm(r.Context(), w, r)
+	if err != nil {
+		h.writeUploadError(w, err, user.ID)
+		return
+	}
 
-	photo, err := h.savePhoto(file, header, user.ID, caption, mimeType)
+	photo, duplicate, err := h.ingest(r.Context(), user.ID, UserPreferences(r), form.file, form.fields)
 	if err != nil {
-		writeError(w, http.StatusInternalServerError, fmt.Sprintf("failed to save photo: %v", err))
+		h.writeUploadError(w, err, user.ID)
 		return
 	}
+	if duplicate {
+		h.writeDuplicate(r.Context(), w, photo, form.fields["on_duplicate"], user.ID)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, UploadPhotoResponse{Photo: h.signer.SignPhoto(r.Context(), photo, user.ID)})
+}
+
+// ingest turns a staged upload into userID's photo: it reads its EXIF,
+// applies the metadata policy and renders derivatives while the file is
+// still local, then stores it and records it. When the user already has a
+// photo with the same bytes that photo is returned with duplicate set
+// instead. ingest takes ownership of file; fields are the upload's text
+// fields (caption, tags, visibility, keep_original, on_duplicate) and
+// prefs the uploader's preferences.
+func (h *PhotoHandlers) ingest(ctx context.Context, userID string, prefs models.Preferences, file *stagedFile, fields map[string]string) (photo *models.Photo, duplicate bool, err error) {
+	defer file.discard()
+
+	if err := validOnDuplicate(fields["on_duplicate"]); err != nil {
+		return nil, false, err
+	}
+	visibility, err := uploadVisibility(fields["visibility"], prefs)
+	if err != nil {
+		return nil, false, err
+	}
+	tags, err := splitTags(fields["tags"])
+	if err != nil {
+		return nil, false, err
+	}
+	existing, err := h.photos.GetByContentHash(ctx, userID, file.sha256)
+	if err == nil {
+		return existing, true, nil
+	}
+	if err != repository.ErrPhotoNotFound {
+		return nil, false, fmt.Errorf("look up content hash: %w", err)
+	}
+
+	// Sanitize caption to prevent XSS
+	caption := sanitizeInput(fields["caption"])
+	photo = newPhoto(file, userID, caption)
+	photo.Visibility = visibility
+	photo.Tags = tags
+
+	h.readExif(photo, file)
+	keepOriginal, _ := strconv.ParseBool(fields["keep_original"])
+	if err := h.applyMetadataPolicy(ctx, photo, file, keepOriginal); err != nil {
+		h.deletePhotoFiles(ctx, photo)
+		return nil, false, fmt.Errorf("strip photo metadata: %w", err)
+	}
+	h.generateDerivatives(ctx, photo, file)
+
+	if err := file.store(ctx, h.store, TenantKey(ctx, PhotosPrefix, photo.FileName)); err != nil {
+		h.deletePhotoFiles(ctx, photo)
+		return nil, false, &uploadError{status: http.StatusInternalServerError, msg: fmt.Sprintf("failed to save photo: %v", err)}
+	}
 
-	if err := h.photos.Create(r.Context(), photo); err != nil {
+	if err := h.photos.Create(ctx, photo); err != nil {
 		h.logger.Error("failed to create photo record",
 			zap.Error(err),
-			zap.String("user_id", user.ID),
+			zap.String("user_id", userID),
 			zap.String("photo_id", photo.ID))
 
 		// Clean up uploaded file on database error
-		h.deletePhotoFiles(photo)
+		h.deletePhotoFiles(ctx, photo)
 
 		if err == repository.ErrPhotoExists {
-			writeError(w, http.StatusConflict, "photo already exists")
-			return
+			// Lost a race with a concurrent upload of the same file.
+			if existing, err := h.photos.GetByContentHash(ctx, userID, photo.ContentHash); err == nil {
+				return existing, true, nil
+			}
+			return nil, false, &uploadError{status: http.StatusConflict, msg: "photo already exists"}
 		}
-		writeError(w, http.StatusInternalServerError, "failed to save photo metadata")
-		return
+		return nil, false, &uploadError{status: http.StatusInternalServerError, msg: "failed to save photo metadata"}
 	}
 
-	writeJSON(w, http.StatusCreated, UploadPhotoResponse{Photo: photo})
+	return photo, false, nil
 }
 
-func (h *PhotoHandlers) GetPhotoFeed(w http.ResponseWriter, r *http.Request) {
-	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
-	if page < 1 {
-		page = 1
+// writeUploadError answers with the status of an uploadError, or logs err
+// and answers 500.
+func (h *PhotoHandlers) writeUploadError(w http.ResponseWriter, err error, userID string) {
+	var uploadErr *uploadError
+	if errors.As(err, &uploadErr) {
+		writeError(w, uploadErr.status, uploadErr.msg)
+		return
 	}
+	h.logger.Error("failed to save upload", zap.Error(err), zap.String("user_id", userID))
+	writeError(w, http.StatusInternalServerError, "failed to save photo")
+}
 
-	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
-	if limit < 1 || limit > 50 {
-		limit = 20
+func (h *PhotoHandlers) GetPhotoFeed(w http.ResponseWriter, r *http.Request) {
+	filter, err := photoFilterParams(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
 	}
 
 	// Public feed - get all photos regardless of user
-	photos, totalCount, err := h.photos.GetAll(r.Context(), page, limit)
+	ctx := r.Context()
+	h.writePhotoFeed(w, r, filter.Sort, photoSource{
+		page: func(page, limit int) ([]models.Photo, int64, error) {
+			return h.photos.GetAll(ctx, filter, page, limit)
+		},
+		after: func(cursor *repository.FeedCursor, limit int) ([]models.Photo, error) {
+			return h.photos.GetAllAfter(ctx, filter, cursor, limit)
+		},
+		estimate: func() (int64, error) {
+			return h.photos.EstimateCount(ctx, "", filter)
+		},
+	})
+}
+
+// GetUserPhotos lists one account's photos. Others see its public photos
+// only; the owner also sees their unlisted and private ones.
+func (h *PhotoHandlers) GetUserPhotos(w http.ResponseWriter, r *http.Request) {
+	userID := chi.URLParam(r, "id")
+	filter, err := photoFilterParams(r)
 	if err != nil {
-		h.logger.Error("failed to get photos",
-			zap.Error(err),
-			zap.Int("page", page),
-			zap.Int("limit", limit))
-		writeError(w, http.StatusInternalServerError, "failed to get photos")
+		writeError(w, http.StatusBadRequest, err.Error())
 		return
 	}
+	if viewerID(r) != userID {
+		filter.Visibility = models.VisibilityPublic
+	}
 
-	hasMore := int64(page*limit) < totalCount
+	h.writePhotoFeed(w, r, filter.Sort, h.userPhotos(r.Context(), userID, filter))
+}
 
-	feed := &models.PhotoFeed{
-		Photos:     photos,
-		Page:       page,
-		Limit:      limit,
-		TotalCount: totalCount,
-		HasMore:    hasMore,
+// GetMyPhotos lists the caller's own library, optionally narrowed to one
+// visibility.
+func (h *PhotoHandlers) GetMyPhotos(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+	if user == nil {
+		writeError(w, http.StatusUnauthorized, "unauthorized")
+		return
 	}
 
-	writeJSON(w, http.StatusOK, feed)
+	filter, err := photoFilterParams(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if v := models.Visibility(r.URL.Query().Get("visibility")); v != "" {
+		if !v.Valid() {
+			writeError(w, http.StatusBadRequest, "visibility must be public, unlisted or private")
+			return
+		}
+		filter.Visibility = v
+	}
+
+	h.writePhotoFeed(w, r, filter.Sort, h.userPhotos(r.Context(), user.ID, filter))
+}
+
+func (h *PhotoHandlers) userPhotos(ctx context.Context, userID string, filter repository.PhotoFilter) photoSource {
+	return photoSource{
+		page: func(page, limit int) ([]models.Photo, int64, error) {
+			return h.photos.GetByUserID(ctx, userID, filter, page, limit)
+		},
+		after: func(cursor *repository.FeedCursor, limit int) ([]models.Photo, error) {
+			return h.photos.GetByUserIDAfter(ctx, userID, filter, cursor, limit)
+		},
+		estimate: func() (int64, error) {
+			return h.photos.EstimateCount(ctx, userID, filter)
+		},
+	}
 }
 
 func (h *PhotoHandlers) GetPhoto(w http.ResponseWriter, r *http.Request) {
@@ -210,8 +412,139 @@ func (h *PhotoHandlers) GetPhoto(w http.ResponseWriter, r *http.Request) {
 		writeError(w, http.StatusInternalServerError, "failed to get photo")
 		return
 	}
+	if !canViewPhoto(r, photo) {
+		writeError(w, http.StatusNotFound, "photo not found")
+		return
+	}
+
+	// The repo may hand out a shared photo; mark a copy.
+	viewed := []models.Photo{*photo}
+	markLiked(r.Context(), h.logger, h.photos, viewed, viewerID(r))
+
+	w.Header().Set("ETag", photoETag(photo))
+	writeJSON(w, http.StatusOK, map[string]*models.Photo{"photo": h.signer.SignPhoto(r.Context(), &viewed[0], viewerID(r))})
+}
+
+// UpdatePhoto edits the caption, alt text, visibility and capture time of
+// a photo. Only its owner or an admin may edit it, and If-Match must carry
+// the ETag the editor last saw so concurrent edits cannot overwrite each
+// other.
+func (h *PhotoHandlers) UpdatePhoto(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+	if user == nil {
+		writeError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	var patch models.PhotoPatch
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&patch); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json body")
+		return
+	}
+	if err := h.validate.Struct(patch); err != nil {
+		writeError(w, http.StatusBadRequest, "validation failed")
+		return
+	}
+	var takenAt *time.Time
+	if patch.TakenAt != nil && *patch.TakenAt != "" {
+		t, err := parseDate(*patch.TakenAt)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "taken_at must be an RFC 3339 timestamp or a date")
+			return
+		}
+		takenAt = &t
+	}
+	var tags []string
+	if patch.Tags != nil {
+		var err error
+		if tags, err = normalizeTags(*patch.Tags); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	ifMatch := r.Header.Get("If-Match")
+	if ifMatch == "" {
+		writeError(w, http.StatusPreconditionRequired, "If-Match is required")
+		return
+	}
+
+	photo, err := h.photos.GetByID(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		if err == repository.ErrPhotoNotFound {
+			writeError(w, http.StatusNotFound, "photo not found")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "failed to get photo")
+		return
+	}
+	if photo.UserID != user.ID && !types.IsAdmin(r.Context()) {
+		if !canViewPhoto(r, photo) {
+			writeError(w, http.StatusNotFound, "photo not found")
+			return
+		}
+		writeError(w, http.StatusForbidden, "cannot edit another user's photo")
+		return
+	}
+	if !etagMatches(ifMatch, photoETag(photo)) {
+		w.Header().Set("ETag", photoETag(photo))
+		writeError(w, http.StatusPreconditionFailed, "photo was modified")
+		return
+	}
+
+	// The repository may hand out shared values; edit a copy.
+	updated := *photo
+	if patch.Caption != nil {
+		updated.Caption = sanitizeInput(*patch.Caption)
+	}
+	if patch.AltText != nil {
+		updated.AltText = sanitizeInput(*patch.AltText)
+	}
+	if patch.Visibility != nil {
+		updated.Visibility = *patch.Visibility
+	}
+	if patch.TakenAt != nil {
+		updated.TakenAt, updated.TakenAtLocal = takenAt, false
+	}
+	if patch.Tags != nil {
+		updated.Tags = tags
+	}
+	updated.UpdatedAt = time.Now()
 
-	writeJSON(w, http.StatusOK, map[string]*models.Photo{"photo": photo})
+	if err := h.photos.Update(r.Context(), &updated); err != nil {
+		switch err {
+		case repository.ErrPhotoVersionConflict:
+			writeError(w, http.StatusPreconditionFailed, "photo was modified")
+		case repository.ErrPhotoNotFound:
+			writeError(w, http.StatusNotFound, "photo not found")
+		default:
+			h.logger.Error("failed to update photo",
+				zap.Error(err),
+				zap.String("user_id", user.ID),
+				zap.String("photo_id", photo.ID))
+			writeError(w, http.StatusInternalServerError, "failed to update photo")
+		}
+		return
+	}
+
+	w.Header().Set("ETag", photoETag(&updated))
+	writeJSON(w, http.StatusOK, map[string]*models.Photo{"photo": h.signer.SignPhoto(r.Context(), &updated, user.ID)})
+}
+
+// photoETag is the strong ETag of a photo's editable state.
+func photoETag(photo *models.Photo) string {
+	return `"` + strconv.FormatInt(photo.Version, 10) + `"`
+}
+
+// etagMatches evaluates an If-Match header against etag.
+func etagMatches(ifMatch, etag string) bool {
+	for _, tag := range strings.Split(ifMatch, ",") {
+		if tag = strings.TrimSpace(tag); tag == "*" || tag == etag {
+			return true
+		}
+	}
+	return false
 }
 
 func (h *PhotoHandlers) DeletePhoto(w http.ResponseWriter, r *http.Request) {
@@ -237,6 +570,11 @@ func (h *PhotoHandlers) DeletePhoto(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Photos the caller cannot see do not exist for them.
+	if !canViewPhoto(r, photo) {
+		writeError(w, http.StatusNotFound, "photo not found")
+		return
+	}
 	if photo.UserID != user.ID {
 		writeError(w, http.StatusForbidden, "cannot delete another user's photo")
 		return
@@ -247,63 +585,414 @@ func (h *PhotoHandlers) DeletePhoto(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	h.deletePhotoFiles(photo)
+	if h.albums != nil {
+		if err := h.albums.RemovePhotoEverywhere(r.Context(), photoID); err != nil {
+			h.logger.Error("failed to remove deleted photo from albums",
+				zap.Error(err),
+				zap.String("photo_id", photoID))
+		}
+	}
+	h.deletePhotoFiles(r.Context(), photo)
 
 	w.WriteHeader(http.StatusNoContent)
 }
 
-func (h *PhotoHandlers) savePhoto(file multipart.File, header *multipart.FileHeader, userID, caption, mimeType string) (*models.Photo, error) {
-	photoID := newPhotoID()
-	ext := getFileExtension(mimeType)
-	fileName := fmt.Sprintf("%s%s", photoID, ext)
-	filePath := filepath.Join(UploadDir, fileName)
+// GetOriginal serves the untouched upload an owner chose to keep. Only the
+// owner can fetch it.
+func (h *PhotoHandlers) GetOriginal(w http.ResponseWriter, r *http.Request) {
+	photoID := r.URL.Query().Get("id")
+	if photoID == "" {
+		writeError(w, http.StatusBadRequest, "photo id is required")
+		return
+	}
 
-	dst, err := os.Create(filePath)
-	if err != nil {
-		return nil, err
+	user := getUserFromContext(r)
+	if user == nil {
+		writeError(w, http.StatusUnauthorized, "unauthorized")
+		return
 	}
-	defer func() {
-		if err := dst.Close(); err != nil {
-			fmt.Println("failed to close destination file", zap.Error(err))
+
+	photo, err := h.photos.GetByID(r.Context(), photoID)
+	if err != nil {
+		if err == repository.ErrPhotoNotFound {
+			writeError(w, http.StatusNotFound, "photo not found")
+			return
 		}
-	}()
+		writeError(w, http.StatusInternalServerError, "failed to get photo")
+		return
+	}
 
-	if _, err := io.Copy(dst, file); err != nil {
-		return nil, err
+	if photo.UserID != user.ID {
+		writeError(w, http.StatusForbidden, "cannot access another user's original")
+		return
+	}
+	if !photo.OriginalRetained {
+		writeError(w, http.StatusNotFound, "original not retained")
+		return
 	}
 
-	photo := &models.Photo{
+	w.Header().Set("Content-Type", photo.MimeType)
+	w.Header().Set("Cache-Control", "private, no-store")
+	ServeObject(w, r, h.store, TenantKey(r.Context(), OriginalsPrefix, photo.FileName))
+}
+
+// newPhoto describes a staged upload as a new photo with a fresh ID.
+func newPhoto(file *stagedFile, userID, caption string) *models.Photo {
+	photoID := newPhotoID()
+	fileName := photoID + getFileExtension(file.mimeType)
+	return &models.Photo{
 		ID:          photoID,
 		UserID:      userID,
 		FileName:    fileName,
 		OriginalURL: fmt.Sprintf("/uploads/photos/%s", fileName),
 		Caption:     caption,
-		FileSize:    header.Size,
-		MimeType:    mimeType,
+		FileSize:    file.size,
+		MimeType:    file.mimeType,
+		ContentHash: file.sha256,
 		CreatedAt:   time.Now(),
 		UpdatedAt:   time.Now(),
 	}
+}
+
+// readExif records the camera metadata of the upload. Files without EXIF,
+// or in formats the parser does not read, keep none.
+func (h *PhotoHandlers) readExif(photo *models.Photo, file *stagedFile) {
+	src, err := os.Open(file.path)
+	if err != nil {
+		h.logger.Error("failed to open photo for exif", zap.Error(err), zap.String("photo_id", photo.ID))
+		return
+	}
+	defer func() {
+		if err := src.Close(); err != nil {
+			fmt.Println("failed to close source file", zap.Error(err))
+		}
+	}()
+
+	meta, err := exif.Decode(src)
+	if err != nil {
+		if err != exif.ErrNoExif && err != exif.ErrUnsupportedFormat {
+			h.logger.Info("ignoring unreadable exif", zap.Error(err), zap.String("photo_id", photo.ID))
+		}
+		return
+	}
+
+	if !meta.TakenAt.IsZero() {
+		takenAt := meta.TakenAt
+		photo.TakenAt = &takenAt
+		photo.TakenAtLocal = !meta.HasOffset
+	}
+	data := models.PhotoExif{
+		CameraMake:   meta.Make,
+		CameraModel:  meta.Model,
+		LensModel:    meta.LensModel,
+		FocalLength:  meta.FocalLength,
+		FNumber:      meta.FNumber,
+		ExposureTime: meta.ExposureTime,
+		ISO:          meta.ISO,
+		Orientation:  meta.Orientation,
+	}
+	if data != (models.PhotoExif{}) {
+		photo.Exif = &data
+	}
+}
+
+// applyMetadataPolicy rewrites the staged upload without the metadata the
+// policy removes and records what went. With keepOriginal the untouched
+// upload is stored under the owner's private originals first, whether or
+// not anything is then removed. Formats the stripper cannot rewrite are
+// served as uploaded.
+func (h *PhotoHandlers) applyMetadataPolicy(ctx context.Context, photo *models.Photo, file *stagedFile, keepOriginal bool) error {
+	if keepOriginal {
+		if err := file.store(ctx, h.store, TenantKey(ctx, OriginalsPrefix, photo.FileName)); err != nil {
+			return err
+		}
+		photo.OriginalRetained = true
+	}
+	if h.metadataPolicy == MetadataKeep {
+		return nil
+	}
+	level := exif.StripPrivate
+	if h.metadataPolicy == MetadataStripAll {
+		level = exif.StripAll
+	}
+
+	src, err := os.Open(file.path)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := src.Close(); err != nil {
+			fmt.Println("failed to close source file", zap.Error(err))
+		}
+	}()
 
-	return photo, nil
+	dst, err := os.CreateTemp(filepath.Dir(file.path), "strip-*.tmp")
+	if err != nil {
+		return err
+	}
+	tmpPath := dst.Name()
+	cw := &countingWriter{w: dst}
+	removed, err := exif.Strip(cw, src, level)
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil || len(removed) == 0 {
+		_ = os.Remove(tmpPath)
+		if err == exif.ErrUnsupportedFormat {
+			return nil
+		}
+		return err
+	}
+
+	if err := os.Rename(tmpPath, file.path); err != nil {
+		_ = os.Remove(tmpPath)
+		return err
+	}
+
+	file.size = cw.n
+	photo.FileSize = cw.n
+	photo.StrippedMetadata = removed
+	return nil
 }
 
-func (h *PhotoHandlers) deletePhotoFiles(photo *models.Photo) {
-	originalPath := filepath.Join(UploadDir, photo.FileName)
-	if err := os.Remove(originalPath); err != nil {
+// generateDerivatives decodes the staged upload once, records its upright
+// pixel dimensions and stores the thumbnail and responsive renditions.
+// Formats the standard library cannot decode (WebP, HEIC, ...) are stored
+// without derivatives rather than rejected.
+func (h *PhotoHandlers) generateDerivatives(ctx context.Context, photo *models.Photo, file *stagedFile) {
+	img, format, err := decodeStaged(file, photo)
+	if err != nil {
+		h.logger.Info("skipping derivatives for undecodable photo",
+			zap.Error(err),
+			zap.String("photo_id", photo.ID),
+			zap.String("mime_type", photo.MimeType))
+		return
+	}
+	bounds := img.Bounds()
+	photo.Width, photo.Height = bounds.Dx(), bounds.Dy()
+
+	thumbName := photo.ID + "-thumb" + imaging.Extension(format)
+	if _, err := h.writeDerivative(ctx, ThumbnailsPrefix, thumbName, imaging.Thumbnail(img, ThumbnailSize), format, ThumbnailQuality); err != nil {
+		h.logger.Error("failed to write thumbnail", zap.Error(err), zap.String("photo_id", photo.ID))
+	} else {
+		photo.ThumbnailURL = "/uploads/thumbnails/" + thumbName
+	}
+
+	// Renditions run largest first, each resized from the previous one, so
+	// the full-size original is only scaled once. Widths at or above the
+	// original's are skipped; upscaling would only waste bytes.
+	var variants []models.PhotoVariant
+	prev := img
+	for _, rendition := range h.renditions {
+		if rendition.Width <= 0 || rendition.Width >= photo.Width {
+			continue
+		}
+		w, hgt := imaging.Fit(photo.Width, photo.Height, rendition.Width, photo.Height)
+		resized := imaging.Resize(prev, w, hgt)
+		prev = resized
+
+		name := fmt.Sprintf("%s-w%d%s", photo.ID, w, imaging.Extension(format))
+		size, err := h.writeDerivative(ctx, VariantsPrefix, name, resized, format, rendition.Quality)
+		if err != nil {
+			h.logger.Error("failed to write rendition",
+				zap.Error(err),
+				zap.String("photo_id", photo.ID),
+				zap.Int("width", w))
+			continue
+		}
+		variants = append(variants, models.PhotoVariant{
+			URL:    "/uploads/variants/" + name,
+			Width:  w,
+			Height: hgt,
+			Bytes:  size,
+			Format: format,
+		})
+	}
+	for i, j := 0, len(variants)-1; i < j; i, j = i+1, j-1 {
+		variants[i], variants[j] = variants[j], variants[i]
+	}
+	photo.Variants = variants
+}
+
+// decodeStaged decodes the staged upload of photo.
+func decodeStaged(file *stagedFile, photo *models.Photo) (image.Image, string, error) {
+	src, err := os.Open(file.path)
+	if err != nil {
+		return nil, "", err
+	}
+	defer func() {
+		if err := src.Close(); err != nil {
+			fmt.Println("failed to close source file", zap.Error(err))
+		}
+	}()
+	return decodeUpright(src, photo)
+}
+
+// decodeStored decodes photo's served copy from store.
+func decodeStored(ctx context.Context, store storage.Storage, photo *models.Photo) (image.Image, string, error) {
+	obj, err := store.Get(ctx, TenantKey(ctx, PhotosPrefix, photo.FileName), nil)
+	if err != nil {
+		return nil, "", err
+	}
+	defer func() {
+		if err := obj.Body.Close(); err != nil {
+			fmt.Println("failed to close stored photo", zap.Error(err))
+		}
+	}()
+	return decodeUpright(obj.Body, photo)
+}
+
+// decodeUpright decodes r and applies photo's EXIF orientation, so
+// everything derived from the pixels is upright.
+func decodeUpright(r io.Reader, photo *models.Photo) (image.Image, string, error) {
+	img, format, err := imaging.Decode(r)
+	if err != nil {
+		return nil, "", err
+	}
+	if photo.Exif != nil {
+		img = imaging.Orient(img, photo.Exif.Orientation)
+	}
+	return img, format, nil
+}
+
+// writeDerivative encodes img and stores it as name under the tenant's
+// prefix, returning its size in bytes.
+func (h *PhotoHandlers) writeDerivative(ctx context.Context, prefix, name string, img image.Image, format string, quality int) (int64, error) {
+	var buf bytes.Buffer
+	if err := imaging.Encode(&buf, img, format, quality); err != nil {
+		return 0, err
+	}
+	size := int64(buf.Len())
+	if err := h.store.Put(ctx, TenantKey(ctx, prefix, name), &buf, size, formatContentType(format)); err != nil {
+		return 0, err
+	}
+	return size, nil
+}
+
+// formatContentType is the MIME type of an imaging format name.
+func formatContentType(format string) string {
+	if format == "jpeg" || format == "png" || format == "gif" {
+		return "image/" + format
+	}
+	return "application/octet-stream"
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func (h *PhotoHandlers) deletePhotoFiles(ctx context.Context, photo *models.Photo) {
+	if err := h.store.Delete(ctx, TenantKey(ctx, PhotosPrefix, photo.FileName)); err != nil {
 		fmt.Println("failed to remove original file", zap.Error(err))
 	}
 
 	if photo.ThumbnailURL != "" {
 		thumbnailFileName := strings.TrimPrefix(photo.ThumbnailURL, "/uploads/thumbnails/")
-		thumbnailPath := filepath.Join(ThumbnailDir, thumbnailFileName)
-		if err := os.Remove(thumbnailPath); err != nil {
+		if err := h.store.Delete(ctx, TenantKey(ctx, ThumbnailsPrefix, thumbnailFileName)); err != nil {
 			fmt.Println("failed to remove thumbnail file", zap.Error(err))
 		}
 	}
+
+	if photo.OriginalRetained {
+		if err := h.store.Delete(ctx, TenantKey(ctx, OriginalsPrefix, photo.FileName)); err != nil {
+			fmt.Println("failed to remove retained original", zap.Error(err))
+		}
+	}
+
+	// On-demand IIIF derivatives are cached per photo; the cache index drops
+	// entries whose files have gone.
+	if err := os.RemoveAll(filepath.Join(TenantDir(ctx, IIIFCacheDir), photo.ID)); err != nil {
+		fmt.Println("failed to remove cached derivatives", zap.Error(err))
+	}
+
+	for _, v := range photo.Variants {
+		variantKey := TenantKey(ctx, VariantsPrefix, strings.TrimPrefix(v.URL, "/uploads/variants/"))
+		if err := h.store.Delete(ctx, variantKey); err != nil {
+			fmt.Println("failed to remove variant file", zap.Error(err))
+		}
+	}
 }
 
+// photoFilterParams reads the feed's sort, tag and EXIF filters from the
+// query string. Dates accept RFC 3339 or YYYY-MM-DD.
+func photoFilterParams(r *http.Request) (repository.PhotoFilter, error) {
+	q := r.URL.Query()
+	filter := repository.PhotoFilter{
+		Tag:         models.NormalizeTag(q.Get("tag")),
+		MimeType:    q.Get("mime_type"),
+		CameraMake:  q.Get("camera_make"),
+		CameraModel: q.Get("camera_model"),
+		LensModel:   q.Get("lens_model"),
+	}
+
+	switch order := repository.PhotoSort(q.Get("sort")); order {
+	case "", repository.SortCreatedAt, repository.SortTakenAt:
+		filter.Sort = order
+	default:
+		return filter, fmt.Errorf("sort must be %q or %q", repository.SortCreatedAt, repository.SortTakenAt)
+	}
+
+	for name, dst := range map[string]*int{"min_iso": &filter.MinISO, "max_iso": &filter.MaxISO} {
+		if v := q.Get(name); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				return filter, fmt.Errorf("%s must be a non-negative integer", name)
+			}
+			*dst = n
+		}
+	}
+
+	for name, dst := range map[string]*time.Time{
+		"taken_after":    &filter.TakenAfter,
+		"taken_before":   &filter.TakenBefore,
+		"created_after":  &filter.CreatedAfter,
+		"created_before": &filter.CreatedBefore,
+	} {
+		if v := q.Get(name); v != "" {
+			t, err := parseDate(v)
+			if err != nil {
+				return filter, fmt.Errorf("%s must be an RFC 3339 timestamp or a date", name)
+			}
+			*dst = t
+		}
+	}
+
+	return filter, nil
+}
+
+// parseDate reads an RFC 3339 timestamp or a YYYY-MM-DD date.
+func parseDate(v string) (time.Time, error) {
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		t, err = time.Parse(time.DateOnly, v)
+	}
+	return t, err
+}
+
+// TenantDir returns the subdirectory of base that holds files for the tenant in ctx.
+func TenantDir(ctx context.Context, base string) string {
+	return filepath.Join(base, types.TenantID(ctx))
+}
+
+// TenantKey returns the storage key of name under prefix for the tenant in
+// ctx.
+func TenantKey(ctx context.Context, prefix, name string) string {
+	return path.Join(prefix, types.TenantID(ctx), name)
+}
+
+// newPhotoID returns a random ID. 128 bits make collisions between
+// concurrent uploads practically impossible.
 func newPhotoID() string {
-	return fmt.Sprintf("photo_%d", time.Now().UnixNano())
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return "photo_" + base64.RawURLEncoding.EncodeToString(b)
 }
 
 func getFileExtension(mimeType string) string {
@@ -316,11 +1005,25 @@ func getFileExtension(mimeType string) string {
 		return ".webp"
 	case "image/gif":
 		return ".gif"
+	case "image/bmp":
+		return ".bmp"
+	case "image/tiff":
+		return ".tif"
+	case "image/heic":
+		return ".heic"
 	default:
 		return ".jpg"
 	}
 }
 
+// canViewPhoto reports whether the caller may see photo. GetByID already
+// scopes lookups to the request's tenant; within it public and unlisted
+// photos are open to anyone who asks for them by ID, private ones to their
+// owner only.
+func canViewPhoto(r *http.Request, photo *models.Photo) bool {
+	return photo.Visibility != models.VisibilityPrivate || viewerID(r) == photo.UserID
+}
+
 func getUserFromContext(r *http.Request) *models.User {
 	val := r.Context().Value(types.CtxKey{})
 	if user, ok := val.(*models.User); ok {
@@ -329,6 +1032,14 @@ func getUserFromContext(r *http.Request) *models.User {
 	return nil
 }
 
+// viewerID is the signed-in caller's ID, or "" for anonymous requests.
+func viewerID(r *http.Request) string {
+	if user := getUserFromContext(r); user != nil {
+		return user.ID
+	}
+	return ""
+}
+
 func sanitizeInput(input string) string {
 	// Remove potential XSS patterns
 	input = strings.ReplaceAll(input, "<", "")
@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"go.uber.org/zap"
+	"nunoo.co/backend/models"
+	"nunoo.co/backend/repository"
+)
+
+type PreferencesHandlers struct {
+	prefs    repository.PreferencesRepository
+	validate *validator.Validate
+	logger   *zap.Logger
+}
+
+func NewPreferencesHandlers(prefs repository.PreferencesRepository, validate *validator.Validate) *PreferencesHandlers {
+	logger, _ := zap.NewProduction()
+
+	return &PreferencesHandlers{
+		prefs:    prefs,
+		validate: validate,
+		logger:   logger,
+	}
+}
+
+type PreferencesResponse struct {
+	Preferences *models.Preferences `json:"preferences"`
+}
+
+func (h *PreferencesHandlers) GetPreferences(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+	if user == nil {
+		writeError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	prefs, err := h.load(r.Context(), user.ID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to get preferences")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, PreferencesResponse{Preferences: prefs})
+}
+
+func (h *PreferencesHandlers) UpdatePreferences(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+	if user == nil {
+		writeError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	var patch models.PreferencesPatch
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&patch); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid json body")
+		return
+	}
+	if err := h.validate.Struct(patch); err != nil {
+		writeError(w, http.StatusBadRequest, "validation failed")
+		return
+	}
+
+	prefs, err := h.load(r.Context(), user.ID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to get preferences")
+		return
+	}
+	prefs.Apply(patch)
+	prefs.Version = models.PreferencesVersion
+	prefs.UpdatedAt = time.Now()
+	if err := h.validate.Struct(prefs); err != nil {
+		writeError(w, http.StatusBadRequest, "validation failed")
+		return
+	}
+
+	if err := h.prefs.Put(r.Context(), user.ID, prefs); err != nil {
+		h.logger.Error("failed to save preferences",
+			zap.Error(err),
+			zap.String("user_id", user.ID))
+		writeError(w, http.StatusInternalServerError, "failed to save preferences")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, PreferencesResponse{Preferences: prefs})
+}
+
+// load returns the stored preferences merged over the defaults.
+func (h *PreferencesHandlers) load(ctx context.Context, userID string) (*models.Preferences, error) {
+	prefs, err := h.prefs.Get(ctx, userID)
+	if errors.Is(err, repository.ErrPreferencesNotFound) {
+		defaults := models.DefaultPreferences()
+		return &defaults, nil
+	}
+	return prefs, err
+}
+
+type prefsCtxKey struct{}
+
+// prefsLoader loads the caller's preferences at most once per request.
+type prefsLoader struct {
+	h     *PreferencesHandlers
+	once  sync.Once
+	prefs models.Preferences
+}
+
+// Middleware makes UserPreferences available to every handler further down
+// the chain. Nothing is loaded unless a handler asks for it.
+func (h *PreferencesHandlers) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), prefsCtxKey{}, &prefsLoader{h: h})
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// UserPreferences returns the authenticated user's preferences for r. It
+// falls back to the defaults for anonymous requests, when the middleware is
+// not installed, or when loading fails.
+func UserPreferences(r *http.Request) models.Preferences {
+	loader, _ := r.Context().Value(prefsCtxKey{}).(*prefsLoader)
+	user := getUserFromContext(r)
+	if loader == nil || user == nil {
+		return models.DefaultPreferences()
+	}
+
+	loader.once.Do(func() {
+		prefs, err := loader.h.load(r.Context(), user.ID)
+		if err != nil {
+			loader.h.logger.Warn("failed to load preferences, using defaults",
+				zap.Error(err),
+				zap.String("user_id", user.ID))
+			loader.prefs = models.DefaultPreferences()
+			return
+		}
+		loader.prefs = *prefs
+	})
+	return loader.prefs
+}
@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"go.uber.org/zap"
+	"nunoo.co/backend/models"
+	"nunoo.co/backend/repository"
+)
+
+// maxSearchQuery caps the length of a search query, in characters.
+const maxSearchQuery = 200
+
+// SearchPhotos finds photos by the words of their caption, tags and camera
+// metadata, best match first, paged with an opaque cursor. Anonymous
+// callers search public photos; signed-in callers also find their own.
+func (h *PhotoHandlers) SearchPhotos(w http.ResponseWriter, r *http.Request) {
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	if query == "" {
+		writeError(w, http.StatusBadRequest, "q is required")
+		return
+	}
+	if utf8.RuneCountInString(query) > maxSearchQuery {
+		writeError(w, http.StatusBadRequest, "q is too long")
+		return
+	}
+
+	_, limit := pageParams(r)
+	var cursor *repository.SearchCursor
+	if raw := r.URL.Query().Get("cursor"); raw != "" {
+		c, err := repository.DecodeSearchCursor(raw)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid cursor")
+			return
+		}
+		cursor = c
+	}
+
+	viewer := viewerID(r)
+	// Fetch one extra hit to learn whether another page exists
+	hits, err := h.photos.Search(r.Context(), query, viewer, cursor, limit+1)
+	if err != nil {
+		h.logger.Error("failed to search photos",
+			zap.Error(err),
+			zap.String("query", query))
+		writeError(w, http.StatusInternalServerError, "failed to search photos")
+		return
+	}
+
+	results := &models.PhotoSearchResults{Hits: hits, Limit: limit}
+	if len(hits) > limit {
+		results.Hits = hits[:limit]
+		results.HasMore = true
+		last := results.Hits[limit-1]
+		results.NextCursor = repository.SearchCursor{Rank: last.Rank, ID: last.Photo.ID}.Encode()
+	}
+	photos := make([]models.Photo, len(results.Hits))
+	for i := range results.Hits {
+		photos[i] = results.Hits[i].Photo
+	}
+	markLiked(r.Context(), h.logger, h.photos, photos, viewer)
+	for i := range results.Hits {
+		results.Hits[i].Photo = *h.signer.SignPhoto(r.Context(), &photos[i], viewer)
+	}
+
+	writeJSON(w, http.StatusOK, results)
+}
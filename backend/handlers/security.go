@@ -3,67 +3,604 @@ package handlers
 import (
 	"bufio"
 	"bytes"
-	"strings"
+	"encoding/binary"
+	"image"
+	_ "image/gif"  // registers the GIF header parser with image.DecodeConfig
+	_ "image/jpeg" // registers the JPEG header parser with image.DecodeConfig
+	_ "image/png"  // registers the PNG header parser with image.DecodeConfig
+	"io"
 )
 
-func ValidateImageFile(file []byte) error {
-	reader := bytes.NewReader(file)
-	scanner := bufio.NewScanner(reader)
+// Limits checked against the image header, before any pixel data is
+// decoded, so a small file cannot claim a huge canvas.
+const (
+	MaxImageEdge   = 20000
+	MaxImagePixels = 80_000_000
+)
+
+var (
+	ErrInvalidImageFile = &ValidationError{Message: "invalid image file format"}
+	ErrMaliciousFile    = &ValidationError{Message: "potentially malicious file detected"}
+	ErrUnsupportedImage = &ValidationError{Message: "unsupported file type (jpeg, png, gif, webp, heic, tiff, bmp only)"}
+	ErrImageTooLarge    = &ValidationError{Message: "image dimensions too large"}
+)
+
+type ValidationError struct {
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	return e.Message
+}
+
+// ImageInfo is what ValidateImage verified about a file.
+type ImageInfo struct {
+	Format   string
+	MimeType string
+	Width    int
+	Height   int
+}
+
+type imageFormat struct {
+	name     string
+	mimeType string
+	sniff    func(head []byte) bool
+	// size reads the pixel dimensions from the header.
+	size func(r *io.SectionReader) (int, int, error)
+	// end returns the offset just past the image data, for formats whose
+	// structure ends before the file may; nil when it cannot be told.
+	end func(r *io.SectionReader) (int64, error)
+}
+
+var imageFormats = []imageFormat{
+	{"jpeg", "image/jpeg", sniffJPEG, stdlibSize, jpegEnd},
+	{"png", "image/png", sniffPrefix("\x89PNG\r\n\x1a\n"), stdlibSize, pngEnd},
+	{"gif", "image/gif", sniffGIF, stdlibSize, gifEnd},
+	{"webp", "image/webp", sniffWebP, webpSize, webpEnd},
+	{"bmp", "image/bmp", sniffPrefix("BM"), bmpSize, bmpEnd},
+	{"tiff", "image/tiff", sniffTIFF, tiffSize, nil},
+	{"heic", "image/heic", sniffHEIF, heifSize, nil},
+}
+
+// sniffImage identifies the format from the leading bytes of a file.
+func sniffImage(head []byte) (*imageFormat, error) {
+	for i := range imageFormats {
+		if imageFormats[i].sniff(head) {
+			return &imageFormats[i], nil
+		}
+	}
+	if len(head) < 10 {
+		return nil, ErrInvalidImageFile
+	}
+	return nil, ErrUnsupportedImage
+}
+
+// ValidateImage identifies the format of the size bytes in r from their
+// content alone, parses the header and checks the dimensions against
+// MaxImageEdge and MaxImagePixels. Files carrying an archive or markup
+// after the end of the image, or a ZIP directory anywhere a ZIP reader
+// would find it, are rejected as polyglots. Pixel data is never decoded.
+func ValidateImage(r io.ReaderAt, size int64) (*ImageInfo, error) {
+	head := make([]byte, min(size, sniffLen))
+	if _, err := r.ReadAt(head, 0); err != nil && err != io.EOF {
+		return nil, err
+	}
+	format, err := sniffImage(head)
+	if err != nil {
+		return nil, err
+	}
+
+	w, h, err := format.size(io.NewSectionReader(r, 0, size))
+	if err != nil || w <= 0 || h <= 0 {
+		return nil, ErrInvalidImageFile
+	}
+	if w > MaxImageEdge || h > MaxImageEdge || int64(w)*int64(h) > MaxImagePixels {
+		return nil, ErrImageTooLarge
+	}
+
+	if format.end != nil {
+		end, err := format.end(io.NewSectionReader(r, 0, size))
+		if err != nil || end > size {
+			return nil, ErrInvalidImageFile
+		}
+		if end < size {
+			suspicious, err := hasEmbeddedPayload(io.NewSectionReader(r, end, size-end))
+			if err != nil {
+				return nil, err
+			}
+			if suspicious {
+				return nil, ErrMaliciousFile
+			}
+		}
+	}
+	zip, err := hasZipDirectory(r, size)
+	if err != nil {
+		return nil, err
+	}
+	if zip {
+		return nil, ErrMaliciousFile
+	}
+
+	return &ImageInfo{Format: format.name, MimeType: format.mimeType, Width: w, Height: h}, nil
+}
 
-	// Read first few bytes to check for executable headers
-	if len(file) < 10 {
-		return ErrInvalidImageFile
+func sniffPrefix(magic string) func([]byte) bool {
+	return func(head []byte) bool { return bytes.HasPrefix(head, []byte(magic)) }
+}
+
+func sniffJPEG(head []byte) bool {
+	return len(head) >= 3 && head[0] == 0xFF && head[1] == 0xD8 && head[2] == 0xFF
+}
+
+func sniffGIF(head []byte) bool {
+	return bytes.HasPrefix(head, []byte("GIF87a")) || bytes.HasPrefix(head, []byte("GIF89a"))
+}
+
+func sniffWebP(head []byte) bool {
+	return len(head) >= 12 && string(head[:4]) == "RIFF" && string(head[8:12]) == "WEBP"
+}
+
+func sniffTIFF(head []byte) bool {
+	return bytes.HasPrefix(head, []byte("II*\x00")) || bytes.HasPrefix(head, []byte("MM\x00*"))
+}
+
+// heifBrands are the ftyp brands of HEIF still images.
+var heifBrands = map[string]bool{
+	"heic": true, "heix": true, "hevc": true, "hevx": true,
+	"heim": true, "heis": true, "mif1": true, "msf1": true,
+}
+
+func sniffHEIF(head []byte) bool {
+	return len(head) >= 12 && string(head[4:8]) == "ftyp" && heifBrands[string(head[8:12])]
+}
+
+// stdlibSize reads dimensions with the standard library's header parsers.
+func stdlibSize(r *io.SectionReader) (int, int, error) {
+	cfg, _, err := image.DecodeConfig(bufio.NewReader(r))
+	if err != nil {
+		return 0, 0, err
 	}
+	return cfg.Width, cfg.Height, nil
+}
+
+// offsetReader tracks how far into a stream it has read.
+type offsetReader struct {
+	br *bufio.Reader
+	n  int64
+}
 
-	// Check for malicious patterns
-	firstBytes := file[:10]
+func newOffsetReader(r io.Reader) *offsetReader {
+	return &offsetReader{br: bufio.NewReader(r)}
+}
 
-	// Detect executable file signatures
-	executableSignatures := [][]byte{
-		{0x4D, 0x5A},             // PE executable (MZ)
-		{0x7F, 0x45, 0x4C, 0x46}, // ELF executable
-		{0xFE, 0xED, 0xFA, 0xCE}, // Mach-O executable (32-bit)
-		{0xFE, 0xED, 0xFA, 0xCF}, // Mach-O executable (64-bit)
-		{0xCA, 0xFE, 0xBA, 0xBE}, // Java class file
-		{0x50, 0x4B, 0x03, 0x04}, // ZIP file (could contain executable)
+func (o *offsetReader) ReadByte() (byte, error) {
+	b, err := o.br.ReadByte()
+	if err == nil {
+		o.n++
 	}
+	return b, err
+}
+
+func (o *offsetReader) Read(p []byte) (int, error) {
+	n, err := io.ReadFull(o.br, p)
+	o.n += int64(n)
+	return n, err
+}
 
-	for _, sig := range executableSignatures {
-		if bytes.HasPrefix(firstBytes, sig) {
-			return ErrMaliciousFile
+func (o *offsetReader) Discard(n int64) error {
+	for n > 0 {
+		step := int(min(n, 1<<30))
+		d, err := o.br.Discard(step)
+		o.n += int64(d)
+		if err != nil {
+			return err
 		}
+		n -= int64(d)
 	}
+	return nil
+}
+
+// jpegEnd walks the marker segments and entropy-coded scans to the EOI
+// marker.
+func jpegEnd(r *io.SectionReader) (int64, error) {
+	o := newOffsetReader(r)
+	if err := o.Discard(2); err != nil {
+		return 0, err
+	}
+	var marker byte
+	for {
+		if marker == 0 {
+			b, err := o.ReadByte()
+			if err != nil {
+				return 0, err
+			}
+			if b != 0xFF {
+				return 0, ErrInvalidImageFile
+			}
+			for b == 0xFF { // fill bytes
+				if b, err = o.ReadByte(); err != nil {
+					return 0, err
+				}
+			}
+			marker = b
+		}
+		switch {
+		case marker == 0xD9:
+			return o.n, nil
+		case marker == 0x01 || (marker >= 0xD0 && marker <= 0xD8):
+			marker = 0
+			continue
+		}
 
-	// Check for script patterns
-	if scanner.Scan() {
-		firstLine := strings.ToLower(strings.TrimSpace(scanner.Text()))
-		scriptPatterns := []string{
-			"#!",
-			"<script",
-			"<?php",
-			"#!/bin/",
-			"#!/usr/bin/",
+		var length [2]byte
+		if _, err := o.Read(length[:]); err != nil {
+			return 0, err
+		}
+		n := int64(binary.BigEndian.Uint16(length[:])) - 2
+		if n < 0 {
+			return 0, ErrInvalidImageFile
+		}
+		if err := o.Discard(n); err != nil {
+			return 0, err
+		}
+		if marker != 0xDA {
+			marker = 0
+			continue
 		}
 
-		for _, pattern := range scriptPatterns {
-			if strings.HasPrefix(firstLine, pattern) {
-				return ErrMaliciousFile
+		// Scan data runs until a marker other than a stuffed 0xFF00 or a
+		// restart marker.
+		marker = 0
+		for marker == 0 {
+			b, err := o.ReadByte()
+			if err != nil {
+				return 0, err
+			}
+			if b != 0xFF {
+				continue
+			}
+			for b == 0xFF {
+				if b, err = o.ReadByte(); err != nil {
+					return 0, err
+				}
+			}
+			if b != 0x00 && (b < 0xD0 || b > 0xD7) {
+				marker = b
 			}
 		}
 	}
+}
 
+// pngEnd walks the chunks to the end of IEND.
+func pngEnd(r *io.SectionReader) (int64, error) {
+	o := newOffsetReader(r)
+	if err := o.Discard(8); err != nil {
+		return 0, err
+	}
+	var header [8]byte
+	for {
+		if _, err := o.Read(header[:]); err != nil {
+			return 0, err
+		}
+		length := int64(binary.BigEndian.Uint32(header[:4]))
+		if length > 1<<31-1 {
+			return 0, ErrInvalidImageFile
+		}
+		if err := o.Discard(length + 4); err != nil { // data and CRC
+			return 0, err
+		}
+		if string(header[4:]) == "IEND" {
+			return o.n, nil
+		}
+	}
+}
+
+// gifEnd walks the blocks to the trailer byte.
+func gifEnd(r *io.SectionReader) (int64, error) {
+	o := newOffsetReader(r)
+	var screen [13]byte // header and logical screen descriptor
+	if _, err := o.Read(screen[:]); err != nil {
+		return 0, err
+	}
+	if screen[10]&0x80 != 0 {
+		if err := o.Discard(3 << (screen[10]&7 + 1)); err != nil {
+			return 0, err
+		}
+	}
+	subBlocks := func() error {
+		for {
+			n, err := o.ReadByte()
+			if err != nil {
+				return err
+			}
+			if n == 0 {
+				return nil
+			}
+			if err := o.Discard(int64(n)); err != nil {
+				return err
+			}
+		}
+	}
+	for {
+		b, err := o.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		switch b {
+		case 0x3B: // trailer
+			return o.n, nil
+		case 0x21: // extension: label, then data sub-blocks
+			if _, err := o.ReadByte(); err != nil {
+				return 0, err
+			}
+		case 0x2C: // image descriptor, optional local color table, LZW code size
+			var desc [9]byte
+			if _, err := o.Read(desc[:]); err != nil {
+				return 0, err
+			}
+			if desc[8]&0x80 != 0 {
+				if err := o.Discard(3 << (desc[8]&7 + 1)); err != nil {
+					return 0, err
+				}
+			}
+			if _, err := o.ReadByte(); err != nil {
+				return 0, err
+			}
+		default:
+			return 0, ErrInvalidImageFile
+		}
+		if err := subBlocks(); err != nil {
+			return 0, err
+		}
+	}
+}
+
+func readAt(r io.ReaderAt, off int64, n int) ([]byte, error) {
+	b := make([]byte, n)
+	if _, err := r.ReadAt(b, off); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// webpSize reads the canvas size of a lossy, lossless or extended WebP.
+func webpSize(r *io.SectionReader) (int, int, error) {
+	b, err := readAt(r, 12, 18)
+	if err != nil {
+		return 0, 0, err
+	}
+	data := b[8:]
+	switch string(b[:4]) {
+	case "VP8 ":
+		// 3-byte frame tag, then the start code and 14-bit dimensions.
+		if !bytes.Equal(data[3:6], []byte{0x9D, 0x01, 0x2A}) {
+			return 0, 0, ErrInvalidImageFile
+		}
+		return int(binary.LittleEndian.Uint16(data[6:]) & 0x3FFF), int(binary.LittleEndian.Uint16(data[8:]) & 0x3FFF), nil
+	case "VP8L":
+		if data[0] != 0x2F {
+			return 0, 0, ErrInvalidImageFile
+		}
+		bits := binary.LittleEndian.Uint32(data[1:])
+		return int(bits&0x3FFF) + 1, int(bits>>14&0x3FFF) + 1, nil
+	case "VP8X":
+		w := uint32(data[4]) | uint32(data[5])<<8 | uint32(data[6])<<16
+		h := uint32(data[7]) | uint32(data[8])<<8 | uint32(data[9])<<16
+		return int(w) + 1, int(h) + 1, nil
+	default:
+		return 0, 0, ErrInvalidImageFile
+	}
+}
+
+// webpEnd is where the RIFF container says the file ends.
+func webpEnd(r *io.SectionReader) (int64, error) {
+	b, err := readAt(r, 4, 4)
+	if err != nil {
+		return 0, err
+	}
+	size := int64(binary.LittleEndian.Uint32(b))
+	return 8 + size + size&1, nil
+}
+
+func bmpSize(r *io.SectionReader) (int, int, error) {
+	b, err := readAt(r, 14, 12)
+	if err != nil {
+		return 0, 0, err
+	}
+	switch header := binary.LittleEndian.Uint32(b); {
+	case header == 12: // OS/2 BITMAPCOREHEADER
+		return int(binary.LittleEndian.Uint16(b[4:])), int(binary.LittleEndian.Uint16(b[6:])), nil
+	case header >= 40:
+		w := int64(int32(binary.LittleEndian.Uint32(b[4:])))
+		h := int64(int32(binary.LittleEndian.Uint32(b[8:])))
+		if h < 0 { // top-down bitmap
+			h = -h
+		}
+		return int(min(w, MaxImageEdge+1)), int(min(h, MaxImageEdge+1)), nil
+	default:
+		return 0, 0, ErrInvalidImageFile
+	}
+}
+
+// bmpEnd is the file size recorded in the header. Some writers leave it
+// zero, in which case the whole file counts as image.
+func bmpEnd(r *io.SectionReader) (int64, error) {
+	b, err := readAt(r, 2, 4)
+	if err != nil {
+		return 0, err
+	}
+	if end := int64(binary.LittleEndian.Uint32(b)); end != 0 {
+		return end, nil
+	}
+	return r.Size(), nil
+}
+
+// tiffSize reads ImageWidth and ImageLength from the first IFD.
+func tiffSize(r *io.SectionReader) (int, int, error) {
+	header, err := readAt(r, 0, 8)
+	if err != nil {
+		return 0, 0, err
+	}
+	var order binary.ByteOrder = binary.LittleEndian
+	if header[0] == 'M' {
+		order = binary.BigEndian
+	}
+	off := int64(order.Uint32(header[4:]))
+	count, err := readAt(r, off, 2)
+	if err != nil {
+		return 0, 0, err
+	}
+	entries, err := readAt(r, off+2, int(order.Uint16(count))*12)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var w, h int
+	for e := entries; len(e) >= 12; e = e[12:] {
+		var v int
+		switch order.Uint16(e[2:]) {
+		case 3: // SHORT
+			v = int(order.Uint16(e[8:]))
+		case 4: // LONG
+			v = int(min(order.Uint32(e[8:]), MaxImageEdge+1))
+		default:
+			continue
+		}
+		switch order.Uint16(e) {
+		case 256:
+			w = v
+		case 257:
+			h = v
+		}
+	}
+	return w, h, nil
+}
+
+// heifSize returns the largest image spatial extent ("ispe") declared in
+// meta/iprp/ipco.
+func heifSize(r *io.SectionReader) (int, int, error) {
+	var w, h int
+	err := eachBox(r, func(typ string, meta *io.SectionReader) error {
+		if typ != "meta" {
+			return nil
+		}
+		// meta is a full box: skip version and flags.
+		children := io.NewSectionReader(meta, 4, meta.Size()-4)
+		return eachBox(children, func(typ string, iprp *io.SectionReader) error {
+			if typ != "iprp" {
+				return nil
+			}
+			return eachBox(iprp, func(typ string, ipco *io.SectionReader) error {
+				if typ != "ipco" {
+					return nil
+				}
+				return eachBox(ipco, func(typ string, ispe *io.SectionReader) error {
+					if typ != "ispe" {
+						return nil
+					}
+					b, err := readAt(ispe, 4, 8)
+					if err != nil {
+						return err
+					}
+					iw := int(min(binary.BigEndian.Uint32(b), MaxImageEdge+1))
+					ih := int(min(binary.BigEndian.Uint32(b[4:]), MaxImageEdge+1))
+					if iw*ih > w*h {
+						w, h = iw, ih
+					}
+					return nil
+				})
+			})
+		})
+	})
+	return w, h, err
+}
+
+// eachBox calls fn with the type and body of each ISO BMFF box in r.
+func eachBox(r *io.SectionReader, fn func(typ string, body *io.SectionReader) error) error {
+	for off := int64(0); off < r.Size(); {
+		header, err := readAt(r, off, 8)
+		if err != nil {
+			return err
+		}
+		size, headerLen := int64(binary.BigEndian.Uint32(header)), int64(8)
+		switch size {
+		case 0: // extends to the end
+			size = r.Size() - off
+		case 1: // 64-bit size follows the type
+			large, err := readAt(r, off+8, 8)
+			if err != nil {
+				return err
+			}
+			size, headerLen = int64(binary.BigEndian.Uint64(large)), 16
+		}
+		if size < headerLen || size > r.Size()-off {
+			return ErrInvalidImageFile
+		}
+		if err := fn(string(header[4:]), io.NewSectionReader(r, off+headerLen, size-headerLen)); err != nil {
+			return err
+		}
+		off += size
+	}
 	return nil
 }
 
-var (
-	ErrInvalidImageFile = &ValidationError{Message: "invalid image file format"}
-	ErrMaliciousFile    = &ValidationError{Message: "potentially malicious file detected"}
-)
+// payloadSignatures mark archives and markup that browsers or unpackers
+// would find in data appended to an image. They are matched lowercased.
+var payloadSignatures = [][]byte{
+	[]byte("pk\x03\x04"),
+	[]byte("pk\x05\x06"),
+	[]byte("rar!\x1a\x07"),
+	[]byte("7z\xbc\xaf\x27\x1c"),
+	[]byte("<html"),
+	[]byte("<!doctype"),
+	[]byte("<head"),
+	[]byte("<body"),
+	[]byte("<script"),
+	[]byte("<iframe"),
+	[]byte("<svg"),
+	[]byte("<?php"),
+}
 
-type ValidationError struct {
-	Message string
+// hasEmbeddedPayload scans data trailing an image for payloadSignatures.
+// Other trailing data, such as the video of a motion photo, is allowed.
+func hasEmbeddedPayload(r io.Reader) (bool, error) {
+	const overlap = 15 // longer than any signature
+	buf := make([]byte, 32<<10)
+	keep := 0
+	for {
+		n, err := io.ReadFull(r, buf[keep:])
+		chunk := bytes.ToLower(buf[:keep+n])
+		for _, sig := range payloadSignatures {
+			if bytes.Contains(chunk, sig) {
+				return true, nil
+			}
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		keep = copy(buf, buf[len(chunk)-overlap:len(chunk)])
+	}
 }
 
-func (e *ValidationError) Error() string {
-	return e.Message
+// hasZipDirectory looks for a ZIP end of central directory record where a
+// ZIP reader would: at the very end of the file, after its comment.
+func hasZipDirectory(r io.ReaderAt, size int64) (bool, error) {
+	const eocdLen = 22
+	tailLen := min(size, eocdLen+0xFFFF)
+	tail := make([]byte, tailLen)
+	if _, err := r.ReadAt(tail, size-tailLen); err != nil && err != io.EOF {
+		return false, err
+	}
+	for i := len(tail) - eocdLen; i >= 0; i-- {
+		if string(tail[i:i+4]) != "PK\x05\x06" {
+			continue
+		}
+		if comment := int(binary.LittleEndian.Uint16(tail[i+20:])); i+eocdLen+comment == len(tail) {
+			return true, nil
+		}
+	}
+	return false, nil
 }
@@ -0,0 +1,184 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"nunoo.co/backend/storage"
+)
+
+// ServeObject answers a GET or HEAD for key in store. It honours
+// conditional requests and single byte ranges, the parts of
+// http.ServeContent that make sense without a seekable file. A Content-Type
+// already set on w wins over the stored one.
+func ServeObject(w http.ResponseWriter, r *http.Request, store storage.Storage, key string) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	info, err := store.Stat(r.Context(), key)
+	if err != nil {
+		writeStorageError(w, err)
+		return
+	}
+
+	header := w.Header()
+	if info.ETag != "" {
+		header.Set("ETag", info.ETag)
+	}
+	if !info.ModTime.IsZero() {
+		header.Set("Last-Modified", info.ModTime.UTC().Format(http.TimeFormat))
+	}
+	header.Set("Accept-Ranges", "bytes")
+	if header.Get("Content-Type") == "" && info.ContentType != "" {
+		header.Set("Content-Type", info.ContentType)
+	}
+	if notModified(r, info) {
+		header.Del("Content-Type")
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	var rng *storage.Range
+	if spec := r.Header.Get("Range"); spec != "" && ifRangeMatches(r, info) {
+		rng, err = parseByteRange(spec, info.Size)
+		if err != nil {
+			header.Set("Content-Range", fmt.Sprintf("bytes */%d", info.Size))
+			writeError(w, http.StatusRequestedRangeNotSatisfiable, "range not satisfiable")
+			return
+		}
+	}
+
+	if r.Method == http.MethodHead {
+		status, length := http.StatusOK, info.Size
+		if rng != nil {
+			status, length = http.StatusPartialContent, rng.Length
+			header.Set("Content-Range", contentRange(rng, info.Size))
+		}
+		header.Set("Content-Length", strconv.FormatInt(length, 10))
+		w.WriteHeader(status)
+		return
+	}
+
+	obj, err := store.Get(r.Context(), key, rng)
+	if err != nil {
+		writeStorageError(w, err)
+		return
+	}
+	defer func() {
+		if err := obj.Body.Close(); err != nil {
+			fmt.Println("failed to close stored object", zap.Error(err))
+		}
+	}()
+
+	status, length := http.StatusOK, obj.Size
+	if obj.Range != nil {
+		status, length = http.StatusPartialContent, obj.Range.Length
+		header.Set("Content-Range", contentRange(obj.Range, obj.Size))
+	}
+	header.Set("Content-Length", strconv.FormatInt(length, 10))
+	w.WriteHeader(status)
+	if _, err := io.Copy(w, obj.Body); err != nil {
+		fmt.Println("failed to write stored object", zap.Error(err))
+	}
+}
+
+func writeStorageError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, storage.ErrNotFound), errors.Is(err, storage.ErrInvalidKey):
+		writeError(w, http.StatusNotFound, "file not found")
+	case errors.Is(err, storage.ErrInvalidRange):
+		writeError(w, http.StatusRequestedRangeNotSatisfiable, "range not satisfiable")
+	default:
+		fmt.Println("failed to read stored object", zap.Error(err))
+		writeError(w, http.StatusInternalServerError, "failed to read file")
+	}
+}
+
+// notModified evaluates If-None-Match, or If-Modified-Since when there is
+// no If-None-Match.
+func notModified(r *http.Request, info *storage.ObjectInfo) bool {
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		for _, tag := range strings.Split(inm, ",") {
+			tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+			if tag == "*" || (info.ETag != "" && tag == strings.TrimPrefix(info.ETag, "W/")) {
+				return true
+			}
+		}
+		return false
+	}
+	since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil || info.ModTime.IsZero() {
+		return false
+	}
+	return !info.ModTime.Truncate(time.Second).After(since)
+}
+
+// ifRangeMatches reports whether a Range header should be honoured given
+// If-Range: only when the client's copy is still current.
+func ifRangeMatches(r *http.Request, info *storage.ObjectInfo) bool {
+	ir := r.Header.Get("If-Range")
+	if ir == "" {
+		return true
+	}
+	if strings.HasPrefix(ir, `"`) {
+		return info.ETag != "" && ir == info.ETag
+	}
+	t, err := http.ParseTime(ir)
+	return err == nil && !info.ModTime.IsZero() && info.ModTime.Truncate(time.Second).Equal(t)
+}
+
+// parseByteRange resolves a Range header against an object of size bytes.
+// Only single ranges are served; anything else is ignored and the whole
+// object sent, which the spec allows. Ranges that start past the end are
+// unsatisfiable.
+func parseByteRange(spec string, size int64) (*storage.Range, error) {
+	spec, ok := strings.CutPrefix(spec, "bytes=")
+	if !ok || strings.Contains(spec, ",") {
+		return nil, nil
+	}
+	first, last, ok := strings.Cut(strings.TrimSpace(spec), "-")
+	if !ok {
+		return nil, nil
+	}
+	if first == "" {
+		// Suffix range: the last n bytes.
+		n, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || n < 0 {
+			return nil, nil
+		}
+		if n == 0 || size == 0 {
+			return nil, storage.ErrInvalidRange
+		}
+		n = min(n, size)
+		return &storage.Range{Offset: size - n, Length: n}, nil
+	}
+	start, err := strconv.ParseInt(first, 10, 64)
+	if err != nil || start < 0 {
+		return nil, nil
+	}
+	if start >= size {
+		return nil, storage.ErrInvalidRange
+	}
+	end := size - 1
+	if last != "" {
+		end, err = strconv.ParseInt(last, 10, 64)
+		if err != nil || end < start {
+			return nil, nil
+		}
+		end = min(end, size-1)
+	}
+	return &storage.Range{Offset: start, Length: end - start + 1}, nil
+}
+
+func contentRange(rng *storage.Range, size int64) string {
+	return fmt.Sprintf("bytes %d-%d/%d", rng.Offset, rng.Offset+rng.Length-1, size)
+}
@@ -0,0 +1,162 @@
+package handlers
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"nunoo.co/backend/models"
+	"nunoo.co/backend/types"
+)
+
+// DefaultSignedURLTTL is how long a signed file URL stays valid.
+const DefaultSignedURLTTL = time.Hour
+
+var (
+	ErrSignatureInvalid = errors.New("invalid signature")
+	ErrSignatureExpired = errors.New("signature expired")
+)
+
+// SigningKey is one HMAC key for file URLs, named so a URL records which
+// key signed it.
+type SigningKey struct {
+	ID     string
+	Secret []byte
+}
+
+type URLSignerOptions struct {
+	// Keys sign and verify file URLs. The first key signs new URLs; every
+	// key verifies, so a key is rotated out by adding its successor in front
+	// and dropping it once URLs it signed have expired. With no keys a
+	// random one is generated, and URLs do not survive a restart.
+	Keys []SigningKey
+	// TTL is how long a signed URL stays valid; DefaultSignedURLTTL when 0.
+	TTL time.Duration
+	// SignAll treats every photo as restricted, so no photo file is served
+	// without a valid signature.
+	SignAll bool
+	// BindUser ties URLs handed to a signed-in user to that user; serving
+	// them then needs their bearer token too.
+	BindUser bool
+}
+
+// URLSigner issues and checks expiring, HMAC-signed URLs for the files of
+// restricted photos. A signature covers the tenant, the path, the expiry and
+// the bound user, if any.
+type URLSigner struct {
+	keys     []SigningKey
+	ttl      time.Duration
+	signAll  bool
+	bindUser bool
+}
+
+// NewURLSigner returns a signer for opts. Without keys it signs with a
+// random key, which only suits a single process: URLs die with it.
+func NewURLSigner(opts URLSignerOptions) *URLSigner {
+	keys := opts.Keys
+	if len(keys) == 0 {
+		secret := make([]byte, 32)
+		_, _ = rand.Read(secret)
+		keys = []SigningKey{{ID: "ephemeral", Secret: secret}}
+	}
+	ttl := opts.TTL
+	if ttl <= 0 {
+		ttl = DefaultSignedURLTTL
+	}
+	return &URLSigner{keys: keys, ttl: ttl, signAll: opts.SignAll, bindUser: opts.BindUser}
+}
+
+// Restricted reports whether photo's files need a signed URL. Private
+// photos always do: their URLs are only handed to the owner, so a valid
+// signature shows the owner shared it.
+func (s *URLSigner) Restricted(photo *models.Photo) bool {
+	return s.signAll || photo.Visibility == models.VisibilityPrivate
+}
+
+// Sign returns path with an expiry, key ID and signature appended, bound
+// to userID when it is non-empty. Expiries are rounded up to a quarter of
+// the TTL so repeated requests get the same URL and browser caches hit.
+func (s *URLSigner) Sign(ctx context.Context, path, userID string) string {
+	window := int64(s.ttl/4/time.Second) + 1
+	expires := (time.Now().Add(s.ttl).Unix()/window + 1) * window
+	key := s.keys[0]
+
+	q := url.Values{}
+	q.Set("expires", strconv.FormatInt(expires, 10))
+	q.Set("kid", key.ID)
+	if userID != "" {
+		q.Set("uid", userID)
+	}
+	q.Set("sig", signature(key.Secret, types.TenantID(ctx), path, expires, userID))
+	return path + "?" + q.Encode()
+}
+
+// Verify checks the signature query parameters of a request for path and
+// returns the user the URL is bound to, if any.
+func (s *URLSigner) Verify(ctx context.Context, path string, q url.Values) (userID string, err error) {
+	expires, err := strconv.ParseInt(q.Get("expires"), 10, 64)
+	if err != nil {
+		return "", ErrSignatureInvalid
+	}
+	userID = q.Get("uid")
+	sig := q.Get("sig")
+	for _, key := range s.keys {
+		if key.ID != q.Get("kid") {
+			continue
+		}
+		want := signature(key.Secret, types.TenantID(ctx), path, expires, userID)
+		if !hmac.Equal([]byte(sig), []byte(want)) {
+			return "", ErrSignatureInvalid
+		}
+		if time.Now().Unix() > expires {
+			return "", ErrSignatureExpired
+		}
+		return userID, nil
+	}
+	return "", ErrSignatureInvalid
+}
+
+// SignPhoto returns photo with its file URLs signed for viewerID when it is
+// restricted, and photo itself otherwise. Repositories may hand out shared
+// values, so a signed photo is always a copy.
+func (s *URLSigner) SignPhoto(ctx context.Context, photo *models.Photo, viewerID string) *models.Photo {
+	if !s.Restricted(photo) {
+		return photo
+	}
+	if !s.bindUser {
+		viewerID = ""
+	}
+	signed := *photo
+	signed.OriginalURL = s.Sign(ctx, photo.OriginalURL, viewerID)
+	if photo.ThumbnailURL != "" {
+		signed.ThumbnailURL = s.Sign(ctx, photo.ThumbnailURL, viewerID)
+	}
+	if photo.Variants != nil {
+		signed.Variants = make([]models.PhotoVariant, len(photo.Variants))
+		for i, v := range photo.Variants {
+			v.URL = s.Sign(ctx, v.URL, viewerID)
+			signed.Variants[i] = v
+		}
+	}
+	return &signed
+}
+
+// SignPhotos signs each restricted photo in photos in place.
+func (s *URLSigner) SignPhotos(ctx context.Context, photos []models.Photo, viewerID string) {
+	for i := range photos {
+		photos[i] = *s.SignPhoto(ctx, &photos[i], viewerID)
+	}
+}
+
+func signature(secret []byte, tenantID, path string, expires int64, userID string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(strings.Join([]string{"v1", tenantID, path, strconv.FormatInt(expires, 10), userID}, "\n")))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"go.uber.org/zap"
+	"nunoo.co/backend/models"
+	"nunoo.co/backend/repository"
+)
+
+type TagHandlers struct {
+	photos repository.PhotoRepository
+	logger *zap.Logger
+}
+
+func NewTagHandlers(photos repository.PhotoRepository) *TagHandlers {
+	logger, _ := zap.NewProduction()
+
+	return &TagHandlers{
+		photos: photos,
+		logger: logger,
+	}
+}
+
+// ListTags autocompletes tags: those of public photos starting with the
+// normalized prefix, most used first, with their usage counts.
+func (h *TagHandlers) ListTags(w http.ResponseWriter, r *http.Request) {
+	prefix := models.NormalizeTag(r.URL.Query().Get("prefix"))
+	_, limit := pageParams(r)
+
+	tags, err := h.photos.GetTags(r.Context(), prefix, limit)
+	if err != nil {
+		h.logger.Error("failed to get tags",
+			zap.Error(err),
+			zap.String("prefix", prefix))
+		writeError(w, http.StatusInternalServerError, "failed to get tags")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, &models.TagList{Tags: tags})
+}
+
+// normalizeTags normalizes raw tags, dropping empty ones and duplicates,
+// and sorts them. It fails when a tag is too long or there are too many.
+func normalizeTags(raw []string) ([]string, error) {
+	tags := []string{}
+	for _, t := range raw {
+		tag := models.NormalizeTag(t)
+		if tag == "" {
+			continue
+		}
+		if utf8.RuneCountInString(tag) > models.MaxTagLength {
+			return nil, badUpload(fmt.Sprintf("tags must be at most %d characters", models.MaxTagLength))
+		}
+		tags = append(tags, tag)
+	}
+	slices.Sort(tags)
+	tags = slices.Compact(tags)
+	if len(tags) > models.MaxTags {
+		return nil, badUpload(fmt.Sprintf("a photo can have at most %d tags", models.MaxTags))
+	}
+	return tags, nil
+}
+
+// splitTags reads the comma-separated tags field of an upload.
+func splitTags(field string) ([]string, error) {
+	return normalizeTags(strings.Split(field, ","))
+}
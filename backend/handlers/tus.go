@@ -0,0 +1,542 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+)
+
+const (
+	TusDir            = "./uploads/tus"
+	TusVersion        = "1.0.0"
+	TusExtensions     = "creation,termination,expiration"
+	DefaultTusMaxSize = 100 << 20 // 100MB, matching the frontend's upload-v2 route
+	DefaultTusExpiry  = 24 * time.Hour
+	tusSweepInterval  = time.Minute
+	tusContentType    = "application/offset+octet-stream"
+)
+
+type TusOptions struct {
+	MaxSize int64
+	Expiry  time.Duration
+}
+
+// TusHandlers implement the tus 1.0 resumable upload protocol with the
+// creation, termination and expiration extensions. Partial uploads live on
+// disk as {id}.bin with an {id}.info sidecar; the length of the .bin file is
+// the upload offset, so a crash mid-chunk loses nothing already written.
+// Finished uploads go through the same validation and ingest path as
+// PhotoHandlers.UploadPhoto.
+type TusHandlers struct {
+	photos    *PhotoHandlers
+	maxSize   int64
+	expiry    time.Duration
+	locks     sync.Map // upload ID -> *sync.Mutex, held while a request changes it
+	lastSweep atomic.Int64
+	logger    *zap.Logger
+}
+
+func NewTusHandlers(photos *PhotoHandlers, opts TusOptions) *TusHandlers {
+	logger, _ := zap.NewProduction()
+
+	if opts.MaxSize <= 0 {
+		opts.MaxSize = DefaultTusMaxSize
+	}
+	if opts.Expiry <= 0 {
+		opts.Expiry = DefaultTusExpiry
+	}
+
+	return &TusHandlers{
+		photos:  photos,
+		maxSize: opts.MaxSize,
+		expiry:  opts.Expiry,
+		logger:  logger,
+	}
+}
+
+// tusUpload is the .info sidecar of an upload.
+type tusUpload struct {
+	ID       string            `json:"id"`
+	UserID   string            `json:"user_id"`
+	Length   int64             `json:"length"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+	// RawMetadata is the Upload-Metadata header as sent, echoed back on HEAD.
+	RawMetadata string    `json:"raw_metadata,omitempty"`
+	ExpiresAt   time.Time `json:"expires_at"`
+	// PhotoID is set once the upload has been turned into a photo.
+	PhotoID string `json:"photo_id,omitempty"`
+
+	dir string
+}
+
+func (u *tusUpload) infoPath() string { return filepath.Join(u.dir, u.ID+".info") }
+func (u *tusUpload) dataPath() string { return filepath.Join(u.dir, u.ID+".bin") }
+
+func (u *tusUpload) save() error {
+	data, err := json.Marshal(u)
+	if err != nil {
+		return err
+	}
+	tmp := u.infoPath() + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, u.infoPath())
+}
+
+// offset is the number of bytes received so far.
+func (u *tusUpload) offset() (int64, error) {
+	info, err := os.Stat(u.dataPath())
+	if err != nil {
+		if os.IsNotExist(err) && u.PhotoID != "" {
+			return u.Length, nil
+		}
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+func (u *tusUpload) remove() {
+	for _, path := range []string{u.dataPath(), u.infoPath()} {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			fmt.Println("failed to remove tus upload file", zap.Error(err))
+		}
+	}
+}
+
+// Options answers protocol discovery. It needs no authentication.
+func (h *TusHandlers) Options(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Tus-Resumable", TusVersion)
+	w.Header().Set("Tus-Version", TusVersion)
+	w.Header().Set("Tus-Extension", TusExtensions)
+	w.Header().Set("Tus-Max-Size", strconv.FormatInt(h.maxSize, 10))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Create starts an upload of Upload-Length bytes. Upload-Metadata may carry
+// the text fields UploadPhoto accepts: caption, tags, visibility,
+// keep_original and on_duplicate.
+func (h *TusHandlers) Create(w http.ResponseWriter, r *http.Request) {
+	if !h.checkVersion(w, r) {
+		return
+	}
+	user := getUserFromContext(r)
+	if user == nil {
+		writeError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	h.maybeSweep()
+
+	if r.Header.Get("Upload-Defer-Length") != "" {
+		writeError(w, http.StatusBadRequest, "Upload-Defer-Length is not supported")
+		return
+	}
+	length, err := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+	if err != nil || length <= 0 {
+		writeError(w, http.StatusBadRequest, "Upload-Length must be a positive integer")
+		return
+	}
+	if length > h.maxSize {
+		writeError(w, http.StatusRequestEntityTooLarge, "file too large")
+		return
+	}
+	raw := r.Header.Get("Upload-Metadata")
+	metadata, err := parseTusMetadata(raw)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := validOnDuplicate(metadata["on_duplicate"]); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := validVisibility(metadata["visibility"]); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if _, err := splitTags(metadata["tags"]); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	upload := &tusUpload{
+		ID:          newTusID(),
+		UserID:      user.ID,
+		Length:      length,
+		Metadata:    metadata,
+		RawMetadata: raw,
+		ExpiresAt:   time.Now().Add(h.expiry),
+		dir:         TenantDir(r.Context(), TusDir),
+	}
+	if err := os.MkdirAll(upload.dir, 0755); err != nil {
+		h.logger.Error("failed to create tus directory", zap.Error(err))
+		writeError(w, http.StatusInternalServerError, "failed to create upload")
+		return
+	}
+	data, err := os.OpenFile(upload.dataPath(), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err == nil {
+		err = data.Close()
+	}
+	if err == nil {
+		err = upload.save()
+	}
+	if err != nil {
+		upload.remove()
+		h.logger.Error("failed to create tus upload", zap.Error(err))
+		writeError(w, http.StatusInternalServerError, "failed to create upload")
+		return
+	}
+
+	w.Header().Set("Location", "/uploads/tus/"+upload.ID)
+	w.Header().Set("Upload-Expires", upload.ExpiresAt.UTC().Format(http.TimeFormat))
+	w.WriteHeader(http.StatusCreated)
+}
+
+// Head reports how much of an upload has been received.
+func (h *TusHandlers) Head(w http.ResponseWriter, r *http.Request) {
+	if !h.checkVersion(w, r) {
+		return
+	}
+	upload, ok := h.load(w, r)
+	if !ok {
+		return
+	}
+	offset, err := upload.offset()
+	if err != nil {
+		h.logger.Error("failed to stat tus upload", zap.Error(err), zap.String("upload_id", upload.ID))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Upload-Offset", strconv.FormatInt(offset, 10))
+	w.Header().Set("Upload-Length", strconv.FormatInt(upload.Length, 10))
+	if upload.RawMetadata != "" {
+		w.Header().Set("Upload-Metadata", upload.RawMetadata)
+	}
+	w.Header().Set("Upload-Expires", upload.ExpiresAt.UTC().Format(http.TimeFormat))
+	if upload.PhotoID != "" {
+		w.Header().Set("Photo-Id", upload.PhotoID)
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// Patch appends a chunk at Upload-Offset. The chunk that completes the
+// upload also creates the photo; its response carries Photo-Id, or the
+// error UploadPhoto would have returned. A PATCH with an empty body at the
+// full length retries a completion that failed on the server side.
+func (h *TusHandlers) Patch(w http.ResponseWriter, r *http.Request) {
+	if !h.checkVersion(w, r) {
+		return
+	}
+	if r.Header.Get("Content-Type") != tusContentType {
+		writeError(w, http.StatusUnsupportedMediaType, "Content-Type must be "+tusContentType)
+		return
+	}
+	claimed, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil || claimed < 0 {
+		writeError(w, http.StatusBadRequest, "Upload-Offset must be a non-negative integer")
+		return
+	}
+
+	upload, unlock, ok := h.loadLocked(w, r)
+	if !ok {
+		return
+	}
+	defer unlock()
+	if upload.PhotoID != "" {
+		w.Header().Set("Upload-Offset", strconv.FormatInt(upload.Length, 10))
+		w.Header().Set("Photo-Id", upload.PhotoID)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	offset, err := upload.offset()
+	if err != nil {
+		h.logger.Error("failed to stat tus upload", zap.Error(err), zap.String("upload_id", upload.ID))
+		writeError(w, http.StatusInternalServerError, "failed to read upload")
+		return
+	}
+	if claimed != offset {
+		w.Header().Set("Upload-Offset", strconv.FormatInt(offset, 10))
+		writeError(w, http.StatusConflict, "Upload-Offset does not match the upload")
+		return
+	}
+	remaining := upload.Length - offset
+	if r.ContentLength > remaining {
+		writeError(w, http.StatusRequestEntityTooLarge, "chunk exceeds Upload-Length")
+		return
+	}
+
+	data, err := os.OpenFile(upload.dataPath(), os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		h.logger.Error("failed to open tus upload", zap.Error(err), zap.String("upload_id", upload.ID))
+		writeError(w, http.StatusInternalServerError, "failed to write upload")
+		return
+	}
+	n, copyErr := io.Copy(data, io.LimitReader(r.Body, remaining))
+	if err := data.Close(); err != nil && copyErr == nil {
+		copyErr = err
+	}
+	offset += n
+
+	// Whatever arrived is kept, so a dropped connection resumes from here.
+	upload.ExpiresAt = time.Now().Add(h.expiry)
+	if err := upload.save(); err != nil {
+		h.logger.Error("failed to save tus upload", zap.Error(err), zap.String("upload_id", upload.ID))
+	}
+	w.Header().Set("Upload-Offset", strconv.FormatInt(offset, 10))
+	w.Header().Set("Upload-Expires", upload.ExpiresAt.UTC().Format(http.TimeFormat))
+	if copyErr != nil {
+		writeError(w, http.StatusBadRequest, "failed to read upload body")
+		return
+	}
+	if offset < upload.Length {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	h.complete(w, r, upload)
+}
+
+// complete hands a fully received upload to the photo ingest path.
+func (h *TusHandlers) complete(w http.ResponseWriter, r *http.Request, upload *tusUpload) {
+	src, err := os.Open(upload.dataPath())
+	if err != nil {
+		h.logger.Error("failed to open tus upload", zap.Error(err), zap.String("upload_id", upload.ID))
+		writeError(w, http.StatusInternalServerError, "failed to read upload")
+		return
+	}
+	staged, err := stageFile(r.Context(), src, h.maxSize)
+	if closeErr := src.Close(); closeErr != nil {
+		fmt.Println("failed to close tus upload", zap.Error(closeErr))
+	}
+	if err != nil {
+		h.fail(w, upload, err)
+		return
+	}
+
+	photo, duplicate, err := h.photos.ingest(r.Context(), upload.UserID, UserPreferences(r), staged, upload.Metadata)
+	if err != nil {
+		h.fail(w, upload, err)
+		return
+	}
+	if duplicate && upload.Metadata["on_duplicate"] != DuplicateReturn {
+		upload.remove()
+		h.locks.Delete(upload.ID)
+		h.photos.writeDuplicate(r.Context(), w, photo, DuplicateReject, upload.UserID)
+		return
+	}
+
+	// Keep the sidecar until it expires so a client that missed this
+	// response can still find its photo with HEAD.
+	upload.PhotoID = photo.ID
+	if err := upload.save(); err != nil {
+		h.logger.Error("failed to save tus upload", zap.Error(err), zap.String("upload_id", upload.ID))
+	}
+	if err := os.Remove(upload.dataPath()); err != nil {
+		fmt.Println("failed to remove tus upload data", zap.Error(err))
+	}
+	// Later requests only read the finished upload, so its lock can go.
+	h.locks.Delete(upload.ID)
+	w.Header().Set("Photo-Id", photo.ID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// fail answers a failed completion. Rejected files are discarded, since
+// resending the same bytes cannot succeed; server errors keep the upload so
+// the client can retry the completion.
+func (h *TusHandlers) fail(w http.ResponseWriter, upload *tusUpload, err error) {
+	var uploadErr *uploadError
+	if errors.As(err, &uploadErr) && uploadErr.status < http.StatusInternalServerError {
+		upload.remove()
+		h.locks.Delete(upload.ID)
+	}
+	h.photos.writeUploadError(w, err, upload.UserID)
+}
+
+// Delete terminates an upload and discards what was received.
+func (h *TusHandlers) Delete(w http.ResponseWriter, r *http.Request) {
+	if !h.checkVersion(w, r) {
+		return
+	}
+	upload, unlock, ok := h.loadLocked(w, r)
+	if !ok {
+		return
+	}
+	defer unlock()
+	upload.remove()
+	h.locks.Delete(upload.ID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// checkVersion rejects requests for protocol versions other than 1.0.0.
+func (h *TusHandlers) checkVersion(w http.ResponseWriter, r *http.Request) bool {
+	w.Header().Set("Tus-Resumable", TusVersion)
+	if r.Header.Get("Tus-Resumable") != TusVersion {
+		w.Header().Set("Tus-Version", TusVersion)
+		writeError(w, http.StatusPreconditionFailed, "unsupported Tus-Resumable version")
+		return false
+	}
+	return true
+}
+
+// lock serialises requests that change one upload. A concurrent request
+// for the same upload gets 423 rather than interleaving its bytes.
+func (h *TusHandlers) lock(w http.ResponseWriter, id string) (unlock func(), ok bool) {
+	v, _ := h.locks.LoadOrStore(id, &sync.Mutex{})
+	mu := v.(*sync.Mutex)
+	if !mu.TryLock() {
+		writeError(w, http.StatusLocked, "upload is in use by another request")
+		return nil, false
+	}
+	return mu.Unlock, true
+}
+
+// loadLocked loads the caller's upload named in the URL and locks it. Only
+// uploads that exist and belong to the caller get a lock, so made-up IDs
+// cannot grow the lock table. The upload is read again under the lock, as
+// the request that held it may have changed or removed it.
+func (h *TusHandlers) loadLocked(w http.ResponseWriter, r *http.Request) (*tusUpload, func(), bool) {
+	upload, ok := h.load(w, r)
+	if !ok {
+		return nil, nil, false
+	}
+	unlock, ok := h.lock(w, upload.ID)
+	if !ok {
+		return nil, nil, false
+	}
+	upload, err := readTusUpload(upload.dir, upload.ID)
+	if err != nil {
+		unlock()
+		writeError(w, http.StatusNotFound, "upload not found")
+		return nil, nil, false
+	}
+	return upload, unlock, true
+}
+
+// load reads the caller's upload named in the URL. Uploads of other users
+// are reported missing; expired ones are removed and reported gone.
+func (h *TusHandlers) load(w http.ResponseWriter, r *http.Request) (*tusUpload, bool) {
+	user := getUserFromContext(r)
+	if user == nil {
+		writeError(w, http.StatusUnauthorized, "unauthorized")
+		return nil, false
+	}
+	id := chi.URLParam(r, "id")
+	if !validTusID(id) {
+		writeError(w, http.StatusNotFound, "upload not found")
+		return nil, false
+	}
+
+	upload, err := readTusUpload(TenantDir(r.Context(), TusDir), id)
+	if err != nil || upload.UserID != user.ID {
+		writeError(w, http.StatusNotFound, "upload not found")
+		return nil, false
+	}
+	if time.Now().After(upload.ExpiresAt) {
+		upload.remove()
+		writeError(w, http.StatusGone, "upload expired")
+		return nil, false
+	}
+	return upload, true
+}
+
+func readTusUpload(dir, id string) (*tusUpload, error) {
+	data, err := os.ReadFile(filepath.Join(dir, id+".info"))
+	if err != nil {
+		return nil, err
+	}
+	upload := &tusUpload{}
+	if err := json.Unmarshal(data, upload); err != nil {
+		return nil, err
+	}
+	upload.dir = dir
+	return upload, nil
+}
+
+// maybeSweep removes expired uploads of every tenant, at most once per
+// tusSweepInterval. It runs on creation, which is when abandoned uploads
+// would otherwise keep piling up.
+func (h *TusHandlers) maybeSweep() {
+	now := time.Now()
+	last := h.lastSweep.Load()
+	if now.UnixNano()-last < int64(tusSweepInterval) || !h.lastSweep.CompareAndSwap(last, now.UnixNano()) {
+		return
+	}
+
+	_ = filepath.WalkDir(TusDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || filepath.Ext(path) != ".info" {
+			return nil
+		}
+		upload, err := readTusUpload(filepath.Dir(path), strings.TrimSuffix(d.Name(), ".info"))
+		if err != nil || !now.After(upload.ExpiresAt) {
+			return nil
+		}
+		v, _ := h.locks.LoadOrStore(upload.ID, &sync.Mutex{})
+		if mu := v.(*sync.Mutex); mu.TryLock() {
+			upload.remove()
+			h.locks.Delete(upload.ID)
+			mu.Unlock()
+		}
+		return nil
+	})
+}
+
+// parseTusMetadata decodes an Upload-Metadata header: comma-separated
+// "key base64value" pairs, where the value may be omitted.
+func parseTusMetadata(header string) (map[string]string, error) {
+	metadata := make(map[string]string)
+	if strings.TrimSpace(header) == "" {
+		return metadata, nil
+	}
+	for _, pair := range strings.Split(header, ",") {
+		key, encoded, _ := strings.Cut(strings.TrimSpace(pair), " ")
+		if key == "" {
+			return nil, errors.New("invalid Upload-Metadata")
+		}
+		if _, dup := metadata[key]; dup {
+			return nil, errors.New("duplicate Upload-Metadata key: " + key)
+		}
+		value, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+		if err != nil {
+			return nil, errors.New("invalid Upload-Metadata value for " + key)
+		}
+		if len(value) > MaxFieldSize {
+			return nil, errors.New("Upload-Metadata value too large: " + key)
+		}
+		metadata[key] = string(value)
+	}
+	return metadata, nil
+}
+
+func newTusID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// validTusID reports whether id could have come from newTusID, so it is
+// safe to use as a file name.
+func validTusID(id string) bool {
+	if len(id) != base64.RawURLEncoding.EncodedLen(16) {
+		return false
+	}
+	_, err := base64.RawURLEncoding.DecodeString(id)
+	return err == nil
+}
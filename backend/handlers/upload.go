@@ -0,0 +1,211 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+
+	"go.uber.org/zap"
+	"nunoo.co/backend/storage"
+)
+
+const (
+	// MaxFieldSize bounds each text field sent alongside an upload.
+	MaxFieldSize = 64 << 10
+	// maxFormOverhead is what a request may carry beyond the file itself:
+	// part headers, boundaries and text fields.
+	maxFormOverhead = 1 << 20
+	// sniffLen is how much of a file is inspected before any of it is stored.
+	sniffLen = 512
+)
+
+// uploadError is an upload failure with the status and message to return.
+type uploadError struct {
+	status int
+	msg    string
+}
+
+func (e *uploadError) Error() string { return e.msg }
+
+func badUpload(msg string) error {
+	return &uploadError{status: http.StatusBadRequest, msg: msg}
+}
+
+var errFileTooLarge = badUpload("file too large")
+
+// stagedFile is an uploaded file written to the tenant's local staging
+// directory, where it is inspected and processed before being stored.
+type stagedFile struct {
+	path     string
+	size     int64
+	sha256   string // hex
+	mimeType string
+}
+
+// store copies the staged file to key in s. The staged copy stays until
+// discarded.
+func (f *stagedFile) store(ctx context.Context, s storage.Storage, key string) error {
+	src, err := os.Open(f.path)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := src.Close(); err != nil {
+			fmt.Println("failed to close staged upload", zap.Error(err))
+		}
+	}()
+	return s.Put(ctx, key, src, f.size, f.mimeType)
+}
+
+func (f *stagedFile) discard() {
+	if err := os.Remove(f.path); err != nil && !os.IsNotExist(err) {
+		fmt.Println("failed to remove staged upload", zap.Error(err))
+	}
+}
+
+// uploadForm is a parsed photo upload: the staged file and the text fields
+// sent with it, in either order.
+type uploadForm struct {
+	file   *stagedFile
+	fields map[string]string
+}
+
+// readUploadForm streams a multipart photo upload. The "photo" part flows
+// through a size limit, a sniffer for its leading bytes, a SHA-256 hasher and
+// a temp file in one pass, so memory use does not grow with the file. Other
+// parts are read as text fields of at most MaxFieldSize bytes. Callers own
+// the staged file once this returns without error.
+func readUploadForm(ctx context.Context, w http.ResponseWriter, r *http.Request) (*uploadForm, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, MaxFileSize+maxFormOverhead)
+	mr, err := r.MultipartReader()
+	if err != nil {
+		return nil, badUpload("failed to parse multipart form")
+	}
+
+	form := &uploadForm{fields: make(map[string]string)}
+	fail := func(err error) (*uploadForm, error) {
+		if form.file != nil {
+			form.file.discard()
+		}
+		return nil, err
+	}
+
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fail(readError(err, "failed to parse multipart form"))
+		}
+
+		switch name := part.FormName(); {
+		case name == "photo" && part.FileName() != "":
+			if form.file != nil {
+				return fail(badUpload("only one photo per upload"))
+			}
+			form.file, err = stageFile(ctx, part, MaxFileSize)
+		case part.FileName() != "":
+			// Stray files are drained, still within the body limit.
+			_, err = io.Copy(io.Discard, part)
+			err = readError(err, "failed to read upload")
+		default:
+			var value []byte
+			value, err = io.ReadAll(io.LimitReader(part, MaxFieldSize+1))
+			switch {
+			case err != nil:
+				err = readError(err, "failed to read upload")
+			case len(value) > MaxFieldSize:
+				err = badUpload("form field too large: " + name)
+			case form.fields[name] == "":
+				form.fields[name] = string(value)
+			}
+		}
+		_ = part.Close()
+		if err != nil {
+			return fail(err)
+		}
+	}
+
+	if form.file == nil {
+		return nil, badUpload("photo file is required")
+	}
+	return form, nil
+}
+
+// stageFile checks that the leading bytes of src look like a supported
+// image before writing anything, copies the rest to a temp file while
+// hashing it, then validates the whole file with ValidateImage. The stored
+// type comes from the content; whatever type the client declared is
+// ignored. Files over maxSize are rejected.
+func stageFile(ctx context.Context, src io.Reader, maxSize int64) (*stagedFile, error) {
+	limited := io.LimitReader(src, maxSize+1)
+	br := bufio.NewReaderSize(limited, sniffLen)
+	head, err := br.Peek(sniffLen)
+	if err != nil && err != io.EOF {
+		return nil, readError(err, "failed to read upload")
+	}
+	if _, err := sniffImage(head); err != nil {
+		return nil, badUpload(err.Error())
+	}
+
+	dir := TenantDir(ctx, StagingDir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	tmp, err := os.CreateTemp(dir, "upload-*.tmp")
+	if err != nil {
+		return nil, err
+	}
+	staged := &stagedFile{path: tmp.Name()}
+
+	hash := sha256.New()
+	n, err := io.Copy(io.MultiWriter(tmp, hash), br)
+	var info *ImageInfo
+	if err == nil && n <= maxSize {
+		info, err = ValidateImage(tmp, n)
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	switch {
+	case err != nil:
+		staged.discard()
+		var validationErr *ValidationError
+		var pathErr *os.PathError
+		switch {
+		case errors.As(err, &validationErr):
+			return nil, badUpload(validationErr.Message)
+		case errors.As(err, &pathErr):
+			return nil, err
+		}
+		return nil, readError(err, "failed to read upload")
+	case n > maxSize:
+		staged.discard()
+		return nil, errFileTooLarge
+	}
+
+	staged.size = n
+	staged.sha256 = hex.EncodeToString(hash.Sum(nil))
+	staged.mimeType = info.MimeType
+	return staged, nil
+}
+
+// readError maps a failure reading the request body to an upload error.
+// Hitting the body limit means the file was too large.
+func readError(err error, msg string) error {
+	if err == nil {
+		return nil
+	}
+	var maxErr *http.MaxBytesError
+	if errors.As(err, &maxErr) {
+		return errFileTooLarge
+	}
+	return badUpload(msg)
+}
@@ -0,0 +1,134 @@
+// Package imaging decodes uploaded photos and produces resized derivatives
+// using only the standard library image codecs.
+package imaging
+
+import (
+	"errors"
+	"image"
+	_ "image/gif" // registers the GIF decoder with image.Decode
+	"image/jpeg"
+	"image/png"
+	"io"
+)
+
+var ErrUnsupportedFormat = errors.New("unsupported image format")
+
+// Decode reads a JPEG, PNG or GIF image and returns it with its format name
+// ("jpeg", "png" or "gif"). Only the first frame of an animated GIF is read.
+func Decode(r io.Reader) (image.Image, string, error) {
+	img, format, err := image.Decode(r)
+	if err != nil {
+		if errors.Is(err, image.ErrFormat) {
+			return nil, "", ErrUnsupportedFormat
+		}
+		return nil, "", err
+	}
+	return img, format, nil
+}
+
+// Fit scales w x h down to fit inside maxW x maxH, preserving the aspect
+// ratio. Images already inside the box are returned unchanged.
+func Fit(w, h, maxW, maxH int) (int, int) {
+	if w <= maxW && h <= maxH {
+		return w, h
+	}
+	if w*maxH > h*maxW {
+		return maxW, max(1, h*maxW/w)
+	}
+	return max(1, w*maxH/h), maxH
+}
+
+// Resize scales img to w x h. Each destination pixel is the average of the
+// source pixels it covers (a box filter), which is cheap and avoids the
+// aliasing of nearest-neighbour sampling when shrinking photos.
+func Resize(img image.Image, w, h int) *image.RGBA {
+	src := img.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	sw, sh := src.Dx(), src.Dy()
+	if sw == 0 || sh == 0 || w == 0 || h == 0 {
+		return dst
+	}
+	at := pixelReader(img)
+
+	for y := 0; y < h; y++ {
+		y0 := src.Min.Y + y*sh/h
+		y1 := max(y0+1, src.Min.Y+(y+1)*sh/h)
+		for x := 0; x < w; x++ {
+			x0 := src.Min.X + x*sw/w
+			x1 := max(x0+1, src.Min.X+(x+1)*sw/w)
+
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					pr, pg, pb, pa := at(sx, sy)
+					r += uint64(pr)
+					g += uint64(pg)
+					b += uint64(pb)
+					a += uint64(pa)
+					n++
+				}
+			}
+
+			i := dst.PixOffset(x, y)
+			dst.Pix[i+0] = uint8(r / n >> 8)
+			dst.Pix[i+1] = uint8(g / n >> 8)
+			dst.Pix[i+2] = uint8(b / n >> 8)
+			dst.Pix[i+3] = uint8(a / n >> 8)
+		}
+	}
+	return dst
+}
+
+// Thumbnail returns img scaled to fit inside a size x size box.
+func Thumbnail(img image.Image, size int) image.Image {
+	b := img.Bounds()
+	w, h := Fit(b.Dx(), b.Dy(), size, size)
+	if w == b.Dx() && h == b.Dy() {
+		return img
+	}
+	return Resize(img, w, h)
+}
+
+// Encode writes img as a JPEG for "jpeg" sources and as a PNG otherwise, so
+// transparency in PNG and GIF uploads survives.
+func Encode(w io.Writer, img image.Image, format string, quality int) error {
+	if format == "jpeg" {
+		return jpeg.Encode(w, img, &jpeg.Options{Quality: quality})
+	}
+	return png.Encode(w, img)
+}
+
+// Extension returns the file extension used by Encode for a source format.
+func Extension(format string) string {
+	if format == "jpeg" {
+		return ".jpg"
+	}
+	return ".png"
+}
+
+// pixelReader returns a fast accessor for the premultiplied 16-bit RGBA
+// values of img, avoiding a color.Color allocation per pixel for the
+// concrete types the standard decoders produce.
+func pixelReader(img image.Image) func(x, y int) (uint32, uint32, uint32, uint32) {
+	switch m := img.(type) {
+	case *image.YCbCr:
+		return func(x, y int) (uint32, uint32, uint32, uint32) {
+			return m.YCbCrAt(x, y).RGBA()
+		}
+	case *image.RGBA:
+		return func(x, y int) (uint32, uint32, uint32, uint32) {
+			i := m.PixOffset(x, y)
+			p := m.Pix[i : i+4 : i+4]
+			return uint32(p[0]) * 0x101, uint32(p[1]) * 0x101, uint32(p[2]) * 0x101, uint32(p[3]) * 0x101
+		}
+	case *image.Gray:
+		return func(x, y int) (uint32, uint32, uint32, uint32) {
+			v := uint32(m.Pix[m.PixOffset(x, y)]) * 0x101
+			return v, v, v, 0xffff
+		}
+	default:
+		return func(x, y int) (uint32, uint32, uint32, uint32) {
+			return img.At(x, y).RGBA()
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package imaging
+
+import "image"
+
+// Crop returns the part of img inside r, sharing pixels with img when its
+// type supports SubImage.
+func Crop(img image.Image, r image.Rectangle) image.Image {
+	r = r.Add(img.Bounds().Min).Intersect(img.Bounds())
+	if sub, ok := img.(interface {
+		SubImage(image.Rectangle) image.Image
+	}); ok {
+		return sub.SubImage(r)
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, r.Dx(), r.Dy()))
+	px := pixelReader(img)
+	for y := 0; y < r.Dy(); y++ {
+		for x := 0; x < r.Dx(); x++ {
+			cr, cg, cb, ca := px(r.Min.X+x, r.Min.Y+y)
+			i := dst.PixOffset(x, y)
+			dst.Pix[i+0] = uint8(cr >> 8)
+			dst.Pix[i+1] = uint8(cg >> 8)
+			dst.Pix[i+2] = uint8(cb >> 8)
+			dst.Pix[i+3] = uint8(ca >> 8)
+		}
+	}
+	return dst
+}
+
+// Rotate turns img clockwise by degrees, which must be 0, 90, 180 or 270.
+func Rotate(img image.Image, degrees int) image.Image {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	switch degrees {
+	case 90:
+		return remap(img, h, w, func(x, y int) (int, int) { return y, h - 1 - x })
+	case 180:
+		return remap(img, w, h, func(x, y int) (int, int) { return w - 1 - x, h - 1 - y })
+	case 270:
+		return remap(img, h, w, func(x, y int) (int, int) { return w - 1 - y, x })
+	default:
+		return img
+	}
+}
+
+// Mirror flips img horizontally.
+func Mirror(img image.Image) image.Image {
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+	return remap(img, w, h, func(x, y int) (int, int) { return w - 1 - x, y })
+}
+
+// Orient applies an EXIF orientation (1-8) so the result displays upright.
+// Unknown values leave img unchanged.
+func Orient(img image.Image, orientation int) image.Image {
+	switch orientation {
+	case 2:
+		return Mirror(img)
+	case 3:
+		return Rotate(img, 180)
+	case 4: // flipped vertically
+		return Rotate(Mirror(img), 180)
+	case 5: // transposed
+		return Rotate(Mirror(img), 270)
+	case 6:
+		return Rotate(img, 90)
+	case 7: // transversed
+		return Rotate(Mirror(img), 90)
+	case 8:
+		return Rotate(img, 270)
+	default:
+		return img
+	}
+}
+
+// Gray converts img to 8-bit grayscale.
+func Gray(img image.Image) *image.Gray {
+	b := img.Bounds()
+	dst := image.NewGray(image.Rect(0, 0, b.Dx(), b.Dy()))
+	px := pixelReader(img)
+	for y := 0; y < b.Dy(); y++ {
+		for x := 0; x < b.Dx(); x++ {
+			r, g, bl, _ := px(b.Min.X+x, b.Min.Y+y)
+			// Same weights as color.GrayModel, without boxing every pixel.
+			dst.Pix[dst.PixOffset(x, y)] = uint8((19595*r + 38470*g + 7471*bl + 1<<15) >> 24)
+		}
+	}
+	return dst
+}
+
+// Bitonal converts img to pure black and white around the midpoint.
+func Bitonal(img image.Image) *image.Gray {
+	dst := Gray(img)
+	for i, v := range dst.Pix {
+		if v < 128 {
+			dst.Pix[i] = 0
+		} else {
+			dst.Pix[i] = 255
+		}
+	}
+	return dst
+}
+
+// remap builds a w x h image whose pixel (x, y) is taken from src(x, y) of
+// img, relative to img's bounds.
+func remap(img image.Image, w, h int, src func(x, y int) (int, int)) *image.RGBA {
+	b := img.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	px := pixelReader(img)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			sx, sy := src(x, y)
+			r, g, bl, a := px(b.Min.X+sx, b.Min.Y+sy)
+			i := dst.PixOffset(x, y)
+			dst.Pix[i+0] = uint8(r >> 8)
+			dst.Pix[i+1] = uint8(g >> 8)
+			dst.Pix[i+2] = uint8(bl >> 8)
+			dst.Pix[i+3] = uint8(a >> 8)
+		}
+	}
+	return dst
+}
@@ -42,7 +42,10 @@ func main() {
 		port = "8080"
 	}
 
-	h := api.NewServer(cfg)
+	h, err := api.NewServer(cfg)
+	if err != nil {
+		logger.Fatal("failed to build server", zap.Error(err))
+	}
 
 	srv := &http.Server{
 		Addr:              ":" + port,
@@ -0,0 +1,15 @@
+-- Multi-site tenancy: users and photos belong to the tenant resolved from the Host header.
+-- Existing rows are assigned to the implicit 'default' tenant.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS tenant_id VARCHAR(255) NOT NULL DEFAULT 'default';
+ALTER TABLE photos ADD COLUMN IF NOT EXISTS tenant_id VARCHAR(255) NOT NULL DEFAULT 'default';
+
+-- Emails are unique per tenant rather than globally
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_email_key;
+DROP INDEX IF EXISTS idx_users_email_lookup;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_tenant_email ON users (tenant_id, email);
+
+-- Feed and per-user queries always filter by tenant first
+DROP INDEX IF EXISTS idx_photos_user_id;
+DROP INDEX IF EXISTS idx_photos_created_at;
+CREATE INDEX IF NOT EXISTS idx_photos_tenant_created_at ON photos (tenant_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_photos_tenant_user_created_at ON photos (tenant_id, user_id, created_at DESC);
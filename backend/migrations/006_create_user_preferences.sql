@@ -0,0 +1,11 @@
+-- Per-user preferences stored as a versioned JSON document
+CREATE TABLE IF NOT EXISTS user_preferences (
+    tenant_id VARCHAR(255) NOT NULL,
+    user_id VARCHAR(255) NOT NULL,
+    version INTEGER NOT NULL,
+    data JSONB NOT NULL,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL,
+
+    PRIMARY KEY (tenant_id, user_id),
+    CONSTRAINT fk_user_preferences_user_id FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
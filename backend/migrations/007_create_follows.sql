@@ -0,0 +1,21 @@
+-- Directed follow graph
+CREATE TABLE IF NOT EXISTS follows (
+    tenant_id VARCHAR(255) NOT NULL,
+    follower_id VARCHAR(255) NOT NULL,
+    followee_id VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+
+    PRIMARY KEY (tenant_id, follower_id, followee_id),
+    CONSTRAINT fk_follows_follower_id FOREIGN KEY (follower_id) REFERENCES users(id) ON DELETE CASCADE,
+    CONSTRAINT fk_follows_followee_id FOREIGN KEY (followee_id) REFERENCES users(id) ON DELETE CASCADE,
+    CONSTRAINT chk_follows_not_self CHECK (follower_id <> followee_id)
+);
+
+-- Follower lists and counts; the primary key already covers the following side
+CREATE INDEX IF NOT EXISTS idx_follows_followee ON follows (tenant_id, followee_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_follows_follower_created ON follows (tenant_id, follower_id, created_at DESC);
+
+-- The following feed reads each followed account's newest photos with a
+-- LATERAL LIMIT, so it needs a per-user index in full keyset order
+DROP INDEX IF EXISTS idx_photos_tenant_user_created_at;
+CREATE INDEX IF NOT EXISTS idx_photos_tenant_user_keyset ON photos (tenant_id, user_id, created_at DESC, id DESC);
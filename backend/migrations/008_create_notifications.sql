@@ -0,0 +1,24 @@
+-- Grouped in-app notifications
+CREATE TABLE IF NOT EXISTS notifications (
+    id VARCHAR(255) PRIMARY KEY,
+    tenant_id VARCHAR(255) NOT NULL,
+    user_id VARCHAR(255) NOT NULL,
+    kind VARCHAR(50) NOT NULL,
+    subject_id VARCHAR(255) NOT NULL DEFAULT '',
+    group_key VARCHAR(320) NOT NULL,
+    actor_ids JSONB NOT NULL DEFAULT '[]',
+    actor_count INTEGER NOT NULL DEFAULT 0,
+    read_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL,
+
+    CONSTRAINT fk_notifications_user_id FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- At most one unread entry per group; new events merge into it
+CREATE UNIQUE INDEX IF NOT EXISTS idx_notifications_unread_group
+    ON notifications (tenant_id, user_id, group_key) WHERE read_at IS NULL;
+
+-- Listing by recent activity and unread counts
+CREATE INDEX IF NOT EXISTS idx_notifications_user_keyset ON notifications (tenant_id, user_id, updated_at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS idx_notifications_user_unread ON notifications (tenant_id, user_id) WHERE read_at IS NULL;
@@ -0,0 +1,15 @@
+-- Responsive renditions generated for each photo
+CREATE TABLE IF NOT EXISTS photo_variants (
+    photo_id VARCHAR(255) NOT NULL,
+    tenant_id VARCHAR(255) NOT NULL,
+    width INTEGER NOT NULL,
+    height INTEGER NOT NULL,
+    bytes BIGINT NOT NULL,
+    format VARCHAR(20) NOT NULL,
+    url VARCHAR(500) NOT NULL,
+
+    PRIMARY KEY (photo_id, width),
+    CONSTRAINT fk_photo_variants_photo_id FOREIGN KEY (photo_id) REFERENCES photos(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_photo_variants_tenant_photo ON photo_variants (tenant_id, photo_id);
@@ -0,0 +1,16 @@
+-- Camera metadata read from uploads
+ALTER TABLE photos
+    ADD COLUMN IF NOT EXISTS taken_at TIMESTAMP WITH TIME ZONE,
+    ADD COLUMN IF NOT EXISTS taken_at_offset VARCHAR(6),
+    ADD COLUMN IF NOT EXISTS camera_make VARCHAR(255),
+    ADD COLUMN IF NOT EXISTS camera_model VARCHAR(255),
+    ADD COLUMN IF NOT EXISTS lens_model VARCHAR(255),
+    ADD COLUMN IF NOT EXISTS focal_length DOUBLE PRECISION,
+    ADD COLUMN IF NOT EXISTS f_number DOUBLE PRECISION,
+    ADD COLUMN IF NOT EXISTS exposure_time VARCHAR(20),
+    ADD COLUMN IF NOT EXISTS iso INTEGER,
+    ADD COLUMN IF NOT EXISTS orientation SMALLINT;
+
+-- Feeds sorted by capture time, and the common camera filter
+CREATE INDEX IF NOT EXISTS idx_photos_tenant_taken_at ON photos (tenant_id, taken_at DESC NULLS LAST, created_at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS idx_photos_tenant_camera ON photos (tenant_id, lower(camera_make), lower(camera_model));
@@ -0,0 +1,4 @@
+-- Metadata removed from served originals, and whether an untouched copy was kept
+ALTER TABLE photos
+    ADD COLUMN IF NOT EXISTS stripped_metadata JSONB NOT NULL DEFAULT '[]',
+    ADD COLUMN IF NOT EXISTS original_retained BOOLEAN NOT NULL DEFAULT FALSE;
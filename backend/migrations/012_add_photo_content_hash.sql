@@ -0,0 +1,4 @@
+-- SHA-256 of each upload as received; re-uploading the same bytes is a duplicate per user.
+-- Photos uploaded before hashing keep NULL, which the unique index ignores.
+ALTER TABLE photos ADD COLUMN IF NOT EXISTS content_hash CHAR(64);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_photos_tenant_user_content_hash ON photos (tenant_id, user_id, content_hash);
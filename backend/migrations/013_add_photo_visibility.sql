@@ -0,0 +1,7 @@
+-- Who can see a photo: public photos are listed in feeds, unlisted ones are
+-- reachable by link only, and private ones by their owner only.
+ALTER TABLE photos ADD COLUMN IF NOT EXISTS visibility TEXT NOT NULL DEFAULT 'public'
+    CHECK (visibility IN ('public', 'unlisted', 'private'));
+-- Feeds only ever read public photos.
+DROP INDEX IF EXISTS idx_photos_tenant_created_at;
+CREATE INDEX IF NOT EXISTS idx_photos_tenant_public_created_at ON photos (tenant_id, created_at DESC, id DESC) WHERE visibility = 'public';
@@ -0,0 +1,5 @@
+-- Editable alt text, and a version bumped by every edit so concurrent edits
+-- are detected (served as the photo's ETag).
+ALTER TABLE photos
+    ADD COLUMN IF NOT EXISTS alt_text TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS version BIGINT NOT NULL DEFAULT 1;
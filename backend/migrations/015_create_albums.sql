@@ -0,0 +1,35 @@
+-- Albums: titled, ordered collections of one user's photos
+CREATE TABLE IF NOT EXISTS albums (
+    id VARCHAR(255) PRIMARY KEY,
+    tenant_id VARCHAR(255) NOT NULL,
+    user_id VARCHAR(255) NOT NULL,
+    title VARCHAR(200) NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    slug VARCHAR(100) NOT NULL,
+    cover_photo_id VARCHAR(255),
+    visibility TEXT NOT NULL DEFAULT 'public' CHECK (visibility IN ('public', 'unlisted', 'private')),
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+
+    CONSTRAINT fk_albums_user_id FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    CONSTRAINT fk_albums_cover_photo_id FOREIGN KEY (cover_photo_id) REFERENCES photos(id) ON DELETE SET NULL
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_albums_tenant_user_slug ON albums (tenant_id, user_id, slug);
+CREATE INDEX IF NOT EXISTS idx_albums_tenant_user_created ON albums (tenant_id, user_id, created_at DESC, id DESC);
+
+-- Album membership; position orders an album's photos and may have gaps
+CREATE TABLE IF NOT EXISTS album_photos (
+    album_id VARCHAR(255) NOT NULL,
+    photo_id VARCHAR(255) NOT NULL,
+    tenant_id VARCHAR(255) NOT NULL,
+    position INTEGER NOT NULL,
+    added_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+
+    PRIMARY KEY (album_id, photo_id),
+    CONSTRAINT fk_album_photos_album_id FOREIGN KEY (album_id) REFERENCES albums(id) ON DELETE CASCADE,
+    CONSTRAINT fk_album_photos_photo_id FOREIGN KEY (photo_id) REFERENCES photos(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_album_photos_order ON album_photos (album_id, position);
+CREATE INDEX IF NOT EXISTS idx_album_photos_tenant_photo ON album_photos (tenant_id, photo_id);
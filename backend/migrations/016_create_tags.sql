@@ -0,0 +1,23 @@
+-- Tags: normalized (NFKC, case-folded) names shared by a tenant's photos
+CREATE TABLE IF NOT EXISTS tags (
+    id BIGSERIAL PRIMARY KEY,
+    tenant_id VARCHAR(255) NOT NULL,
+    name VARCHAR(255) NOT NULL
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_tags_tenant_name ON tags (tenant_id, name);
+-- Serves prefix autocomplete (name LIKE 'prefix%') whatever the collation
+CREATE INDEX IF NOT EXISTS idx_tags_tenant_name_prefix ON tags (tenant_id, name text_pattern_ops);
+
+CREATE TABLE IF NOT EXISTS photo_tags (
+    photo_id VARCHAR(255) NOT NULL,
+    tag_id BIGINT NOT NULL,
+    tenant_id VARCHAR(255) NOT NULL,
+
+    PRIMARY KEY (photo_id, tag_id),
+    CONSTRAINT fk_photo_tags_photo_id FOREIGN KEY (photo_id) REFERENCES photos(id) ON DELETE CASCADE,
+    CONSTRAINT fk_photo_tags_tag_id FOREIGN KEY (tag_id) REFERENCES tags(id) ON DELETE CASCADE
+);
+
+-- Tag-filtered feeds walk a tag's photos
+CREATE INDEX IF NOT EXISTS idx_photo_tags_tag_photo ON photo_tags (tag_id, photo_id);
@@ -0,0 +1,5 @@
+-- Full-text search over captions (weight A), tags (B) and camera/lens (C).
+-- The vector is built by the server with the configured text search
+-- language; rows left NULL here are indexed when the server starts.
+ALTER TABLE photos ADD COLUMN IF NOT EXISTS search_vector tsvector;
+CREATE INDEX IF NOT EXISTS idx_photos_search_vector ON photos USING GIN (search_vector);
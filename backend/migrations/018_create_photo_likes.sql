@@ -0,0 +1,32 @@
+-- Likes: who liked which photo. photos.like_count is kept in step with this
+-- table by a trigger so feeds never count rows, and likes removed by a
+-- cascade, such as when their user is deleted, are uncounted too.
+CREATE TABLE IF NOT EXISTS photo_likes (
+    photo_id VARCHAR(255) NOT NULL,
+    user_id VARCHAR(255) NOT NULL,
+    tenant_id VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+
+    PRIMARY KEY (photo_id, user_id),
+    CONSTRAINT fk_photo_likes_photo_id FOREIGN KEY (photo_id) REFERENCES photos(id) ON DELETE CASCADE,
+    CONSTRAINT fk_photo_likes_user_id FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_photo_likes_tenant_user_created ON photo_likes (tenant_id, user_id, created_at DESC, photo_id DESC);
+
+ALTER TABLE photos ADD COLUMN IF NOT EXISTS like_count BIGINT NOT NULL DEFAULT 0 CHECK (like_count >= 0);
+
+CREATE OR REPLACE FUNCTION count_photo_likes() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP = 'INSERT' THEN
+        UPDATE photos SET like_count = like_count + 1 WHERE id = NEW.photo_id;
+    ELSE
+        UPDATE photos SET like_count = like_count - 1 WHERE id = OLD.photo_id;
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS trg_photo_likes_count ON photo_likes;
+CREATE TRIGGER trg_photo_likes_count AFTER INSERT OR DELETE ON photo_likes
+    FOR EACH ROW EXECUTE FUNCTION count_photo_likes();
@@ -0,0 +1,44 @@
+package models
+
+import "time"
+
+// Album is a titled, manually ordered collection of one user's photos with
+// its own visibility. A photo may belong to any number of albums.
+type Album struct {
+	ID          string `json:"id"`
+	TenantID    string `json:"-"`
+	UserID      string `json:"user_id"`
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	// Slug is unique among the owner's albums.
+	Slug string `json:"slug"`
+	// CoverPhotoID is always a member of the album, or empty.
+	CoverPhotoID string     `json:"cover_photo_id,omitempty"`
+	Visibility   Visibility `json:"visibility"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+}
+
+// AlbumPatch creates or edits an album; nil fields are left unchanged.
+// Creating an album needs a title; the slug defaults to one made from it.
+type AlbumPatch struct {
+	Title        *string     `json:"title" validate:"omitempty,max=200"`
+	Description  *string     `json:"description" validate:"omitempty,max=2000"`
+	Slug         *string     `json:"slug" validate:"omitempty,max=100"`
+	CoverPhotoID *string     `json:"cover_photo_id"`
+	Visibility   *Visibility `json:"visibility" validate:"omitempty,oneof=public unlisted private"`
+}
+
+// AlbumPhotos lists photos to add to an album, or every member of it in
+// its new order.
+type AlbumPhotos struct {
+	PhotoIDs []string `json:"photo_ids" validate:"required,min=1,max=500,dive,required"`
+}
+
+type AlbumList struct {
+	Albums     []Album `json:"albums"`
+	Page       int     `json:"page"`
+	Limit      int     `json:"limit"`
+	TotalCount int64   `json:"total_count"`
+	HasMore    bool    `json:"has_more"`
+}
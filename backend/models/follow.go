@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+// Follow is a directed edge in the follow graph.
+type Follow struct {
+	FollowerID string    `json:"follower_id"`
+	FolloweeID string    `json:"followee_id"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+type FollowList struct {
+	Follows    []Follow `json:"follows"`
+	Page       int      `json:"page"`
+	Limit      int      `json:"limit"`
+	TotalCount int64    `json:"total_count"`
+	HasMore    bool     `json:"has_more"`
+}
+
+type FollowStats struct {
+	UserID    string `json:"user_id"`
+	Followers int64  `json:"followers"`
+	Following int64  `json:"following"`
+}
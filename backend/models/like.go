@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// PhotoLikeState is a photo's like count and whether the caller likes it.
+type PhotoLikeState struct {
+	PhotoID   string `json:"photo_id"`
+	LikeCount int64  `json:"like_count"`
+	Liked     bool   `json:"liked"`
+}
+
+// PhotoLike is a photo a user liked and when.
+type PhotoLike struct {
+	Photo   Photo     `json:"photo"`
+	LikedAt time.Time `json:"liked_at"`
+}
+
+type PhotoLikeList struct {
+	Likes      []PhotoLike `json:"likes"`
+	Limit      int         `json:"limit"`
+	HasMore    bool        `json:"has_more"`
+	NextCursor string      `json:"next_cursor,omitempty"`
+}
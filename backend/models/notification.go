@@ -0,0 +1,58 @@
+package models
+
+import "time"
+
+// MaxNotificationActors caps how many recent actor IDs a grouped
+// notification keeps; ActorCount keeps counting past it.
+const MaxNotificationActors = 10
+
+// Notification tells a user something happened to their content. Events of
+// the same kind about the same subject collapse into one unread entry, so
+// fifty likes on a photo show up once with ActorCount 50.
+type Notification struct {
+	ID         string     `json:"id"`
+	UserID     string     `json:"user_id"`
+	Kind       string     `json:"kind"`
+	SubjectID  string     `json:"subject_id,omitempty"`
+	ActorIDs   []string   `json:"actor_ids"`
+	ActorCount int        `json:"actor_count"`
+	Read       bool       `json:"read"`
+	ReadAt     *time.Time `json:"read_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+}
+
+// GroupKey identifies the notifications that collapse into one entry.
+func (n *Notification) GroupKey() string {
+	return n.Kind + ":" + n.SubjectID
+}
+
+// AddActor records another actor on a grouped notification. Repeat actors
+// that are still in the recent list are not counted twice.
+func (n *Notification) AddActor(actorID string, at time.Time) {
+	n.UpdatedAt = at
+	if actorID == "" {
+		n.ActorCount++
+		return
+	}
+	for i, id := range n.ActorIDs {
+		if id == actorID {
+			// Move to the front so the list stays most-recent-first
+			copy(n.ActorIDs[1:i+1], n.ActorIDs[:i])
+			n.ActorIDs[0] = actorID
+			return
+		}
+	}
+	n.ActorIDs = append([]string{actorID}, n.ActorIDs...)
+	if len(n.ActorIDs) > MaxNotificationActors {
+		n.ActorIDs = n.ActorIDs[:MaxNotificationActors]
+	}
+	n.ActorCount++
+}
+
+type NotificationPage struct {
+	Notifications []Notification `json:"notifications"`
+	Limit         int            `json:"limit"`
+	HasMore       bool           `json:"has_more"`
+	NextCursor    string         `json:"next_cursor,omitempty"`
+}
@@ -1,20 +1,150 @@
 package models
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+)
 
 type Photo struct {
-	ID           string    `json:"id"`
-	UserID       string    `json:"user_id"`
-	FileName     string    `json:"file_name"`
-	OriginalURL  string    `json:"original_url"`
-	ThumbnailURL string    `json:"thumbnail_url,omitempty"`
-	Caption      string    `json:"caption,omitempty"`
-	FileSize     int64     `json:"file_size"`
-	MimeType     string    `json:"mime_type"`
-	Width        int       `json:"width,omitempty"`
-	Height       int       `json:"height,omitempty"`
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
+	ID           string         `json:"id"`
+	TenantID     string         `json:"-"`
+	UserID       string         `json:"user_id"`
+	FileName     string         `json:"file_name"`
+	OriginalURL  string         `json:"original_url"`
+	ThumbnailURL string         `json:"thumbnail_url,omitempty"`
+	Caption      string         `json:"caption,omitempty"`
+	AltText      string         `json:"alt_text,omitempty"`
+	Tags         []string       `json:"tags,omitempty"` // normalized, unique and sorted
+	Visibility   Visibility     `json:"visibility"`
+	FileSize     int64          `json:"file_size"`
+	MimeType     string         `json:"mime_type"`
+	Width        int            `json:"width,omitempty"`
+	Height       int            `json:"height,omitempty"`
+	Variants     []PhotoVariant `json:"variants,omitempty"`
+	TakenAt      *time.Time     `json:"taken_at,omitempty"`
+	// TakenAtLocal is set when the capture's UTC offset is unknown: TakenAt
+	// then holds the camera's wall clock in UTC and is shown without an
+	// offset.
+	TakenAtLocal bool       `json:"-"`
+	Exif         *PhotoExif `json:"exif,omitempty"`
+	// StrippedMetadata names the metadata groups removed from the served
+	// original; OriginalRetained is set when the owner kept an untouched copy.
+	StrippedMetadata []string `json:"stripped_metadata,omitempty"`
+	OriginalRetained bool     `json:"original_retained,omitempty"`
+	// LikeCount is how many users like the photo; Liked is set when the
+	// caller is one of them.
+	LikeCount int64 `json:"like_count"`
+	Liked     bool  `json:"liked,omitempty"`
+	// ContentHash is the hex SHA-256 of the file as uploaded, before any
+	// metadata was stripped. It is unique per user.
+	ContentHash string `json:"content_hash,omitempty"`
+	// Version starts at 1 and is bumped by every edit; it is the photo's
+	// ETag.
+	Version   int64     `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// localTimeLayout formats a TakenAt whose offset is unknown.
+const localTimeLayout = "2006-01-02T15:04:05"
+
+// photoJSON is the wire form of a Photo, with taken_at as text so that a
+// capture time without an offset can leave it out.
+type photoJSON struct {
+	photoFields
+	TakenAt *string `json:"taken_at,omitempty"`
+}
+
+type photoFields Photo
+
+func (p Photo) MarshalJSON() ([]byte, error) {
+	out := photoJSON{photoFields: photoFields(p)}
+	if p.TakenAt != nil {
+		s := p.TakenAt.Format(time.RFC3339Nano)
+		if p.TakenAtLocal {
+			s = p.TakenAt.Format(localTimeLayout)
+		}
+		out.TakenAt = &s
+	}
+	return json.Marshal(out)
+}
+
+func (p *Photo) UnmarshalJSON(data []byte) error {
+	var in photoJSON
+	if err := json.Unmarshal(data, &in); err != nil {
+		return err
+	}
+	*p = Photo(in.photoFields)
+	p.TakenAt, p.TakenAtLocal = nil, false
+	if in.TakenAt == nil {
+		return nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, *in.TakenAt)
+	if err != nil {
+		if t, err = time.Parse(localTimeLayout, *in.TakenAt); err != nil {
+			return err
+		}
+		p.TakenAtLocal = true
+	}
+	p.TakenAt = &t
+	return nil
+}
+
+// PhotoPatch is an edit of a photo's descriptive fields; nil fields are
+// left unchanged. TakenAt is an RFC 3339 timestamp or a date, and an empty
+// string clears it. Tags replace the photo's tags; an empty list clears
+// them.
+type PhotoPatch struct {
+	Caption    *string     `json:"caption" validate:"omitempty,max=2000"`
+	AltText    *string     `json:"alt_text" validate:"omitempty,max=1000"`
+	Visibility *Visibility `json:"visibility" validate:"omitempty,oneof=public unlisted private"`
+	TakenAt    *string     `json:"taken_at"`
+	Tags       *[]string   `json:"tags" validate:"omitempty,dive,max=200"`
+}
+
+// Visibility decides who can see a photo and its files.
+type Visibility string
+
+const (
+	// VisibilityPublic photos are listed in feeds. It is the default.
+	VisibilityPublic Visibility = "public"
+	// VisibilityUnlisted photos are left out of feeds but open to anyone
+	// with a link.
+	VisibilityUnlisted Visibility = "unlisted"
+	// VisibilityPrivate photos are visible to their owner only.
+	VisibilityPrivate Visibility = "private"
+)
+
+// Valid reports whether v is one of the known visibilities.
+func (v Visibility) Valid() bool {
+	switch v {
+	case VisibilityPublic, VisibilityUnlisted, VisibilityPrivate:
+		return true
+	}
+	return false
+}
+
+// PhotoVariant is one resized rendition of a photo. Photo.Variants lists
+// them smallest first so clients can build a srcset directly.
+type PhotoVariant struct {
+	URL    string `json:"url"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+	Bytes  int64  `json:"bytes"`
+	Format string `json:"format"`
+}
+
+// PhotoExif is the camera metadata read from an upload. TakenAt lives on
+// Photo itself since feeds sort and filter on it.
+type PhotoExif struct {
+	CameraMake   string  `json:"camera_make,omitempty"`
+	CameraModel  string  `json:"camera_model,omitempty"`
+	LensModel    string  `json:"lens_model,omitempty"`
+	FocalLength  float64 `json:"focal_length,omitempty"` // millimetres
+	FNumber      float64 `json:"f_number,omitempty"`
+	ExposureTime string  `json:"exposure_time,omitempty"`
+	ISO          int     `json:"iso,omitempty"`
+	Orientation  int     `json:"orientation,omitempty"`
 }
 
 type PhotoFeed struct {
@@ -23,4 +153,8 @@ type PhotoFeed struct {
 	Limit      int     `json:"limit"`
 	TotalCount int64   `json:"total_count"`
 	HasMore    bool    `json:"has_more"`
+	NextCursor string  `json:"next_cursor,omitempty"`
+	// ApproximateTotal estimates the feed's size when asked for with
+	// total=approx.
+	ApproximateTotal *int64 `json:"approximate_total,omitempty"`
 }
@@ -0,0 +1,96 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// PreferencesVersion is the current schema version of stored preference documents.
+const PreferencesVersion = 1
+
+// Notification kinds a user can opt out of.
+const (
+	NotificationFollow     = "follow"
+	NotificationLike       = "like"
+	NotificationComment    = "comment"
+	NotificationModeration = "moderation"
+	NotificationProcessing = "processing"
+)
+
+// Preferences are per-user settings, stored as a versioned JSON document.
+type Preferences struct {
+	Version             int       `json:"version" validate:"min=1"`
+	DefaultVisibility   string    `json:"default_visibility" validate:"oneof=public unlisted private"`
+	FeedDensity         string    `json:"feed_density" validate:"oneof=compact comfortable spacious"`
+	Locale              string    `json:"locale" validate:"bcp47_language_tag"`
+	NotificationOptOuts []string  `json:"notification_opt_outs" validate:"max=16,unique,dive,oneof=follow like comment moderation processing"`
+	UpdatedAt           time.Time `json:"updated_at,omitempty"`
+}
+
+// PreferencesPatch is a partial update; nil fields are left unchanged.
+type PreferencesPatch struct {
+	DefaultVisibility   *string   `json:"default_visibility" validate:"omitempty,oneof=public unlisted private"`
+	FeedDensity         *string   `json:"feed_density" validate:"omitempty,oneof=compact comfortable spacious"`
+	Locale              *string   `json:"locale" validate:"omitempty,bcp47_language_tag"`
+	NotificationOptOuts *[]string `json:"notification_opt_outs" validate:"omitempty,max=16,unique,dive,oneof=follow like comment moderation processing"`
+}
+
+// DefaultPreferences returns the settings used for anything a user has not set.
+func DefaultPreferences() Preferences {
+	return Preferences{
+		Version:             PreferencesVersion,
+		DefaultVisibility:   "public",
+		FeedDensity:         "comfortable",
+		Locale:              "en",
+		NotificationOptOuts: []string{},
+	}
+}
+
+// Apply copies the non-nil fields of patch onto p.
+func (p *Preferences) Apply(patch PreferencesPatch) {
+	if patch.DefaultVisibility != nil {
+		p.DefaultVisibility = *patch.DefaultVisibility
+	}
+	if patch.FeedDensity != nil {
+		p.FeedDensity = *patch.FeedDensity
+	}
+	if patch.Locale != nil {
+		p.Locale = *patch.Locale
+	}
+	if patch.NotificationOptOuts != nil {
+		p.NotificationOptOuts = *patch.NotificationOptOuts
+	}
+}
+
+// OptedOut reports whether the user has disabled notifications of the given kind.
+func (p *Preferences) OptedOut(kind string) bool {
+	for _, k := range p.NotificationOptOuts {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// DecodePreferences parses a stored document, merging it over the defaults so
+// fields added after it was written get their default values, and upgrades
+// it to PreferencesVersion.
+func DecodePreferences(data []byte) (*Preferences, error) {
+	p := DefaultPreferences()
+	p.Version = 0
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, err
+	}
+	if p.Version > PreferencesVersion {
+		return nil, fmt.Errorf("preferences version %d is newer than supported version %d", p.Version, PreferencesVersion)
+	}
+	// Documents written before versioning carry no version; they are v1-shaped.
+	if p.Version < 1 {
+		p.Version = 1
+	}
+	if p.NotificationOptOuts == nil {
+		p.NotificationOptOuts = []string{}
+	}
+	return &p, nil
+}
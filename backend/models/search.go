@@ -0,0 +1,16 @@
+package models
+
+// PhotoSearchHit is a photo matching a search, with its relevance and the
+// caption excerpt that matched, the matched words wrapped in <mark>.
+type PhotoSearchHit struct {
+	Photo     Photo   `json:"photo"`
+	Rank      float64 `json:"rank"`
+	Highlight string  `json:"highlight,omitempty"`
+}
+
+type PhotoSearchResults struct {
+	Hits       []PhotoSearchHit `json:"hits"`
+	Limit      int              `json:"limit"`
+	HasMore    bool             `json:"has_more"`
+	NextCursor string           `json:"next_cursor,omitempty"`
+}
@@ -0,0 +1,37 @@
+package models
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+)
+
+const (
+	// MaxTags is the most tags one photo may carry.
+	MaxTags = 30
+	// MaxTagLength is the longest tag allowed, in characters.
+	MaxTagLength = 50
+)
+
+var tagFolder = cases.Fold()
+
+// NormalizeTag returns the canonical form of a tag: NFKC-normalized,
+// case-folded, without a leading '#' and with runs of whitespace collapsed
+// to one space. "Été", "ÉTÉ" and "#été" all become "été".
+func NormalizeTag(raw string) string {
+	tag := norm.NFKC.String(tagFolder.String(norm.NFKC.String(raw)))
+	tag = strings.TrimLeft(strings.TrimSpace(tag), "#")
+	return strings.Join(strings.FieldsFunc(tag, unicode.IsSpace), " ")
+}
+
+// TagCount is a tag and the number of photos carrying it.
+type TagCount struct {
+	Tag   string `json:"tag"`
+	Count int64  `json:"count"`
+}
+
+type TagList struct {
+	Tags []TagCount `json:"tags"`
+}
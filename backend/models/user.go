@@ -6,6 +6,7 @@ import "time"
 // For now, we use an in-memory store; replace with a real DB repository later.
 type User struct {
 	ID           string    `json:"id"`
+	TenantID     string    `json:"-"`
 	Email        string    `json:"email"`
 	PasswordHash string    `json:"-"`
 	CreatedAt    time.Time `json:"created_at"`
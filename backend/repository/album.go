@@ -0,0 +1,42 @@
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"nunoo.co/backend/models"
+)
+
+var (
+	ErrAlbumNotFound = errors.New("album not found")
+	// ErrAlbumSlugTaken is returned when the owner already has an album
+	// with the slug.
+	ErrAlbumSlugTaken = errors.New("album slug already in use")
+	// ErrAlbumOrderMismatch is returned by ReorderPhotos when the IDs are
+	// not exactly the album's members.
+	ErrAlbumOrderMismatch = errors.New("photo_ids must list every photo in the album once")
+)
+
+// AlbumRepository stores albums and their ordered membership. Membership
+// changes are idempotent.
+type AlbumRepository interface {
+	Create(ctx context.Context, album *models.Album) error
+	GetByID(ctx context.Context, id string) (*models.Album, error)
+	// GetByUserID lists userID's albums, newest first, leaving out unlisted
+	// and private ones when publicOnly is set.
+	GetByUserID(ctx context.Context, userID string, publicOnly bool, page, limit int) ([]models.Album, int64, error)
+	Update(ctx context.Context, album *models.Album) error
+	Delete(ctx context.Context, id string) error
+
+	// AddPhotos appends the photos not yet in the album, in order.
+	AddPhotos(ctx context.Context, albumID string, photoIDs []string) error
+	// RemovePhoto takes a photo out of an album, clearing the cover if it
+	// was the cover.
+	RemovePhoto(ctx context.Context, albumID, photoID string) error
+	// RemovePhotoEverywhere takes a photo out of every album.
+	RemovePhotoEverywhere(ctx context.Context, photoID string) error
+	// ReorderPhotos sets the album's order to photoIDs, which must list
+	// every member exactly once.
+	ReorderPhotos(ctx context.Context, albumID string, photoIDs []string) error
+	HasPhoto(ctx context.Context, albumID, photoID string) (bool, error)
+}
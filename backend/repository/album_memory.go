@@ -0,0 +1,234 @@
+package repository
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"nunoo.co/backend/models"
+	"nunoo.co/backend/types"
+)
+
+type MemoryAlbumRepo struct {
+	mu      sync.RWMutex
+	albums  map[string]*models.Album
+	members map[string][]string // album ID -> photo IDs in album order
+}
+
+func NewMemoryAlbumRepo() *MemoryAlbumRepo {
+	return &MemoryAlbumRepo{
+		albums:  make(map[string]*models.Album),
+		members: make(map[string][]string),
+	}
+}
+
+func (r *MemoryAlbumRepo) Create(ctx context.Context, album *models.Album) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	album.TenantID = types.TenantID(ctx)
+	if r.slugTaken(album) {
+		return ErrAlbumSlugTaken
+	}
+	stored := *album
+	r.albums[album.ID] = &stored
+	return nil
+}
+
+func (r *MemoryAlbumRepo) GetByID(ctx context.Context, id string) (*models.Album, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	album, err := r.get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	found := *album
+	return &found, nil
+}
+
+func (r *MemoryAlbumRepo) GetByUserID(ctx context.Context, userID string, publicOnly bool, page, limit int) ([]models.Album, int64, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	tenantID := types.TenantID(ctx)
+	var albums []models.Album
+	for _, album := range r.albums {
+		if album.TenantID == tenantID && album.UserID == userID && (!publicOnly || album.Visibility == models.VisibilityPublic) {
+			albums = append(albums, *album)
+		}
+	}
+	sort.Slice(albums, func(i, j int) bool {
+		if albums[i].CreatedAt.Equal(albums[j].CreatedAt) {
+			return albums[i].ID > albums[j].ID
+		}
+		return albums[i].CreatedAt.After(albums[j].CreatedAt)
+	})
+
+	totalCount := int64(len(albums))
+	offset := (page - 1) * limit
+	if offset >= len(albums) {
+		return []models.Album{}, totalCount, nil
+	}
+	end := offset + limit
+	if end > len(albums) {
+		end = len(albums)
+	}
+	return albums[offset:end], totalCount, nil
+}
+
+func (r *MemoryAlbumRepo) Update(ctx context.Context, album *models.Album) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	existing, err := r.get(ctx, album.ID)
+	if err != nil {
+		return err
+	}
+	album.TenantID = existing.TenantID
+	if r.slugTaken(album) {
+		return ErrAlbumSlugTaken
+	}
+	stored := *album
+	r.albums[album.ID] = &stored
+	return nil
+}
+
+func (r *MemoryAlbumRepo) Delete(ctx context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, err := r.get(ctx, id); err != nil {
+		return err
+	}
+	delete(r.albums, id)
+	delete(r.members, id)
+	return nil
+}
+
+func (r *MemoryAlbumRepo) AddPhotos(ctx context.Context, albumID string, photoIDs []string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, err := r.get(ctx, albumID); err != nil {
+		return err
+	}
+	present := make(map[string]bool, len(r.members[albumID]))
+	for _, id := range r.members[albumID] {
+		present[id] = true
+	}
+	for _, id := range photoIDs {
+		if !present[id] {
+			present[id] = true
+			r.members[albumID] = append(r.members[albumID], id)
+		}
+	}
+	return nil
+}
+
+func (r *MemoryAlbumRepo) RemovePhoto(ctx context.Context, albumID, photoID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	album, err := r.get(ctx, albumID)
+	if err != nil {
+		return err
+	}
+	r.remove(album, photoID)
+	return nil
+}
+
+func (r *MemoryAlbumRepo) RemovePhotoEverywhere(ctx context.Context, photoID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	tenantID := types.TenantID(ctx)
+	for _, album := range r.albums {
+		if album.TenantID == tenantID {
+			r.remove(album, photoID)
+		}
+	}
+	return nil
+}
+
+func (r *MemoryAlbumRepo) ReorderPhotos(ctx context.Context, albumID string, photoIDs []string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, err := r.get(ctx, albumID); err != nil {
+		return err
+	}
+	members := r.members[albumID]
+	if len(photoIDs) != len(members) {
+		return ErrAlbumOrderMismatch
+	}
+	want := make(map[string]bool, len(members))
+	for _, id := range members {
+		want[id] = true
+	}
+	for _, id := range photoIDs {
+		if !want[id] {
+			return ErrAlbumOrderMismatch
+		}
+		delete(want, id)
+	}
+	r.members[albumID] = append([]string(nil), photoIDs...)
+	return nil
+}
+
+func (r *MemoryAlbumRepo) HasPhoto(ctx context.Context, albumID, photoID string) (bool, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if _, err := r.get(ctx, albumID); err != nil {
+		return false, err
+	}
+	for _, id := range r.members[albumID] {
+		if id == photoID {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// photoIDs returns the members of an album in the ctx tenant, in order.
+func (r *MemoryAlbumRepo) photoIDs(ctx context.Context, albumID string) []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if _, err := r.get(ctx, albumID); err != nil {
+		return nil
+	}
+	return append([]string(nil), r.members[albumID]...)
+}
+
+func (r *MemoryAlbumRepo) get(ctx context.Context, id string) (*models.Album, error) {
+	album, exists := r.albums[id]
+	if !exists || album.TenantID != types.TenantID(ctx) {
+		return nil, ErrAlbumNotFound
+	}
+	return album, nil
+}
+
+func (r *MemoryAlbumRepo) slugTaken(album *models.Album) bool {
+	for _, a := range r.albums {
+		if a.ID != album.ID && a.TenantID == album.TenantID && a.UserID == album.UserID && a.Slug == album.Slug {
+			return true
+		}
+	}
+	return false
+}
+
+// remove drops photoID from album's members and cover.
+func (r *MemoryAlbumRepo) remove(album *models.Album, photoID string) {
+	members := r.members[album.ID]
+	for i, id := range members {
+		if id == photoID {
+			r.members[album.ID] = append(members[:i:i], members[i+1:]...)
+			break
+		}
+	}
+	if album.CoverPhotoID == photoID {
+		album.CoverPhotoID = ""
+	}
+}
@@ -0,0 +1,252 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"go.uber.org/zap"
+	"nunoo.co/backend/models"
+	"nunoo.co/backend/types"
+)
+
+type PostgresAlbumRepo struct {
+	db *sql.DB
+}
+
+func NewPostgresAlbumRepo(db *sql.DB) *PostgresAlbumRepo {
+	return &PostgresAlbumRepo{db: db}
+}
+
+const albumColumns = `id, user_id, title, description, slug, cover_photo_id, visibility, created_at, updated_at`
+
+func scanAlbum(row rowScanner, album *models.Album) error {
+	var cover sql.NullString
+	err := row.Scan(&album.ID, &album.UserID, &album.Title, &album.Description, &album.Slug,
+		&cover, &album.Visibility, &album.CreatedAt, &album.UpdatedAt)
+	album.CoverPhotoID = cover.String
+	return err
+}
+
+func (r *PostgresAlbumRepo) Create(ctx context.Context, album *models.Album) error {
+	album.TenantID = types.TenantID(ctx)
+	query := `
+		INSERT INTO albums (id, tenant_id, user_id, title, description, slug, cover_photo_id, visibility, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+	`
+	_, err := r.db.ExecContext(ctx, query,
+		album.ID, album.TenantID, album.UserID, album.Title, album.Description, album.Slug,
+		nullString(album.CoverPhotoID), album.Visibility, album.CreatedAt, album.UpdatedAt)
+	if isUniqueViolation(err) {
+		return ErrAlbumSlugTaken
+	}
+	return err
+}
+
+func (r *PostgresAlbumRepo) GetByID(ctx context.Context, id string) (*models.Album, error) {
+	query := `SELECT ` + albumColumns + ` FROM albums WHERE tenant_id = $1 AND id = $2`
+	album := &models.Album{}
+	if err := scanAlbum(r.db.QueryRowContext(ctx, query, types.TenantID(ctx), id), album); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrAlbumNotFound
+		}
+		return nil, err
+	}
+	return album, nil
+}
+
+func (r *PostgresAlbumRepo) GetByUserID(ctx context.Context, userID string, publicOnly bool, page, limit int) ([]models.Album, int64, error) {
+	where := `tenant_id = $1 AND user_id = $2 AND (NOT $3 OR visibility = 'public')`
+	args := []any{types.TenantID(ctx), userID, publicOnly}
+
+	var totalCount int64
+	if err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM albums WHERE `+where, args...).Scan(&totalCount); err != nil {
+		return nil, 0, err
+	}
+
+	offset := (page - 1) * limit
+	query := `SELECT ` + albumColumns + ` FROM albums WHERE ` + where + `
+		ORDER BY created_at DESC, id DESC
+		LIMIT $4 OFFSET $5
+	`
+	rows, err := r.db.QueryContext(ctx, query, append(args, limit, offset)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			fmt.Println("failed to close rows", zap.Error(err))
+		}
+	}()
+
+	albums := []models.Album{}
+	for rows.Next() {
+		var album models.Album
+		if err := scanAlbum(rows, &album); err != nil {
+			return nil, 0, err
+		}
+		albums = append(albums, album)
+	}
+	return albums, totalCount, rows.Err()
+}
+
+func (r *PostgresAlbumRepo) Update(ctx context.Context, album *models.Album) error {
+	query := `
+		UPDATE albums
+		SET title = $3, description = $4, slug = $5, cover_photo_id = $6, visibility = $7, updated_at = $8
+		WHERE tenant_id = $1 AND id = $2
+	`
+	result, err := r.db.ExecContext(ctx, query, types.TenantID(ctx), album.ID,
+		album.Title, album.Description, album.Slug, nullString(album.CoverPhotoID), album.Visibility, album.UpdatedAt)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return ErrAlbumSlugTaken
+		}
+		return err
+	}
+	return albumAffected(result)
+}
+
+func (r *PostgresAlbumRepo) Delete(ctx context.Context, id string) error {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM albums WHERE tenant_id = $1 AND id = $2`, types.TenantID(ctx), id)
+	if err != nil {
+		return err
+	}
+	return albumAffected(result)
+}
+
+func (r *PostgresAlbumRepo) AddPhotos(ctx context.Context, albumID string, photoIDs []string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	// Locking the album serialises concurrent appends to it.
+	if err := r.lockAlbum(ctx, tx, albumID); err != nil {
+		return err
+	}
+	var next int
+	err = tx.QueryRowContext(ctx, `SELECT COALESCE(MAX(position) + 1, 0) FROM album_photos WHERE album_id = $1`, albumID).Scan(&next)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO album_photos (album_id, photo_id, tenant_id, position, added_at)
+		VALUES ($1, $2, $3, $4, now())
+		ON CONFLICT (album_id, photo_id) DO NOTHING
+	`
+	for _, photoID := range photoIDs {
+		result, err := tx.ExecContext(ctx, query, albumID, photoID, types.TenantID(ctx), next)
+		if err != nil {
+			return err
+		}
+		if n, _ := result.RowsAffected(); n > 0 {
+			next++
+		}
+	}
+	return tx.Commit()
+}
+
+func (r *PostgresAlbumRepo) RemovePhoto(ctx context.Context, albumID, photoID string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	if err := r.lockAlbum(ctx, tx, albumID); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM album_photos WHERE album_id = $1 AND photo_id = $2`, albumID, photoID); err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `UPDATE albums SET cover_photo_id = NULL WHERE id = $1 AND cover_photo_id = $2`, albumID, photoID)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *PostgresAlbumRepo) RemovePhotoEverywhere(ctx context.Context, photoID string) error {
+	tenantID := types.TenantID(ctx)
+	if _, err := r.db.ExecContext(ctx, `DELETE FROM album_photos WHERE tenant_id = $1 AND photo_id = $2`, tenantID, photoID); err != nil {
+		return err
+	}
+	_, err := r.db.ExecContext(ctx, `UPDATE albums SET cover_photo_id = NULL WHERE tenant_id = $1 AND cover_photo_id = $2`, tenantID, photoID)
+	return err
+}
+
+func (r *PostgresAlbumRepo) ReorderPhotos(ctx context.Context, albumID string, photoIDs []string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	if err := r.lockAlbum(ctx, tx, albumID); err != nil {
+		return err
+	}
+
+	// Every member must be listed exactly once, and nothing else.
+	var members, matched, distinct int
+	err = tx.QueryRowContext(ctx, `
+		SELECT
+			(SELECT COUNT(*) FROM album_photos WHERE album_id = $1),
+			(SELECT COUNT(*) FROM album_photos WHERE album_id = $1 AND photo_id = ANY($2)),
+			(SELECT COUNT(DISTINCT id) FROM unnest($2::text[]) AS id)
+	`, albumID, photoIDs).Scan(&members, &matched, &distinct)
+	if err != nil {
+		return err
+	}
+	if distinct != len(photoIDs) || matched != len(photoIDs) || members != len(photoIDs) {
+		return ErrAlbumOrderMismatch
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE album_photos ap
+		SET position = o.ord - 1
+		FROM unnest($2::text[]) WITH ORDINALITY AS o(photo_id, ord)
+		WHERE ap.album_id = $1 AND ap.photo_id = o.photo_id
+	`, albumID, photoIDs)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *PostgresAlbumRepo) HasPhoto(ctx context.Context, albumID, photoID string) (bool, error) {
+	query := `SELECT EXISTS (SELECT 1 FROM album_photos WHERE tenant_id = $1 AND album_id = $2 AND photo_id = $3)`
+	var member bool
+	err := r.db.QueryRowContext(ctx, query, types.TenantID(ctx), albumID, photoID).Scan(&member)
+	return member, err
+}
+
+// lockAlbum locks the album's row for the rest of tx, or returns
+// ErrAlbumNotFound.
+func (r *PostgresAlbumRepo) lockAlbum(ctx context.Context, tx *sql.Tx, albumID string) error {
+	var id string
+	err := tx.QueryRowContext(ctx, `SELECT id FROM albums WHERE tenant_id = $1 AND id = $2 FOR UPDATE`, types.TenantID(ctx), albumID).Scan(&id)
+	if err == sql.ErrNoRows {
+		return ErrAlbumNotFound
+	}
+	return err
+}
+
+func albumAffected(result sql.Result) error {
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrAlbumNotFound
+	}
+	return nil
+}
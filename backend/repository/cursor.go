@@ -0,0 +1,95 @@
+package repository
+
+import (
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// FeedCursor marks a position in a feed ordered by (created_at, id)
+// descending. Items strictly after the cursor are returned, so inserts at the
+// head of the feed never shift later pages.
+type FeedCursor struct {
+	CreatedAt time.Time
+	ID        string
+}
+
+// Encode returns the opaque string form handed to clients.
+func (c FeedCursor) Encode() string {
+	raw := strconv.FormatInt(c.CreatedAt.UnixNano(), 10) + ":" + c.ID
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// DecodeFeedCursor parses a cursor produced by Encode.
+func DecodeFeedCursor(s string) (*FeedCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	ts, id, ok := strings.Cut(string(raw), ":")
+	if !ok || id == "" {
+		return nil, ErrInvalidCursor
+	}
+	nanos, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	return &FeedCursor{CreatedAt: time.Unix(0, nanos).UTC(), ID: id}, nil
+}
+
+// before reports whether an item at (createdAt, id) sorts after the cursor in
+// a newest-first feed.
+func (c *FeedCursor) before(createdAt time.Time, id string) bool {
+	if c == nil {
+		return true
+	}
+	if createdAt.Equal(c.CreatedAt) {
+		return id < c.ID
+	}
+	return createdAt.Before(c.CreatedAt)
+}
+
+// SearchCursor marks a position in search results ordered by (rank, id)
+// descending.
+type SearchCursor struct {
+	Rank float64
+	ID   string
+}
+
+// Encode returns the opaque string form handed to clients.
+func (c SearchCursor) Encode() string {
+	raw := strconv.FormatFloat(c.Rank, 'g', -1, 64) + ":" + c.ID
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// DecodeSearchCursor parses a cursor produced by SearchCursor.Encode.
+func DecodeSearchCursor(s string) (*SearchCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	rank, id, ok := strings.Cut(string(raw), ":")
+	if !ok || id == "" {
+		return nil, ErrInvalidCursor
+	}
+	r, err := strconv.ParseFloat(rank, 64)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	return &SearchCursor{Rank: r, ID: id}, nil
+}
+
+// before reports whether a hit at (rank, id) sorts after the cursor.
+func (c *SearchCursor) before(rank float64, id string) bool {
+	if c == nil {
+		return true
+	}
+	if rank == c.Rank {
+		return id < c.ID
+	}
+	return rank < c.Rank
+}
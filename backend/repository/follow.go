@@ -0,0 +1,21 @@
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"nunoo.co/backend/models"
+)
+
+var ErrSelfFollow = errors.New("users cannot follow themselves")
+
+// FollowRepository stores the directed follow graph. Follow and Unfollow are
+// idempotent.
+type FollowRepository interface {
+	Follow(ctx context.Context, followerID, followeeID string) error
+	Unfollow(ctx context.Context, followerID, followeeID string) error
+	IsFollowing(ctx context.Context, followerID, followeeID string) (bool, error)
+	GetFollowers(ctx context.Context, userID string, page, limit int) ([]models.Follow, int64, error)
+	GetFollowing(ctx context.Context, userID string, page, limit int) ([]models.Follow, int64, error)
+	GetStats(ctx context.Context, userID string) (*models.FollowStats, error)
+}
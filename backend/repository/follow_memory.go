@@ -0,0 +1,131 @@
+package repository
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"nunoo.co/backend/models"
+)
+
+// MemoryFollowRepo keeps both directions of every edge so followers and
+// following lookups are equally cheap.
+type MemoryFollowRepo struct {
+	mu        sync.RWMutex
+	following map[string]map[string]time.Time // tenant+follower -> followee -> since
+	followers map[string]map[string]time.Time // tenant+followee -> follower -> since
+}
+
+func NewMemoryFollowRepo() *MemoryFollowRepo {
+	return &MemoryFollowRepo{
+		following: make(map[string]map[string]time.Time),
+		followers: make(map[string]map[string]time.Time),
+	}
+}
+
+func (r *MemoryFollowRepo) Follow(ctx context.Context, followerID, followeeID string) error {
+	if followerID == followeeID {
+		return ErrSelfFollow
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	fk, rk := tenantKey(ctx, followerID), tenantKey(ctx, followeeID)
+	if _, exists := r.following[fk][followeeID]; exists {
+		return nil
+	}
+	now := time.Now()
+	if r.following[fk] == nil {
+		r.following[fk] = make(map[string]time.Time)
+	}
+	if r.followers[rk] == nil {
+		r.followers[rk] = make(map[string]time.Time)
+	}
+	r.following[fk][followeeID] = now
+	r.followers[rk][followerID] = now
+	return nil
+}
+
+func (r *MemoryFollowRepo) Unfollow(ctx context.Context, followerID, followeeID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.following[tenantKey(ctx, followerID)], followeeID)
+	delete(r.followers[tenantKey(ctx, followeeID)], followerID)
+	return nil
+}
+
+func (r *MemoryFollowRepo) IsFollowing(ctx context.Context, followerID, followeeID string) (bool, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	_, exists := r.following[tenantKey(ctx, followerID)][followeeID]
+	return exists, nil
+}
+
+func (r *MemoryFollowRepo) GetFollowers(ctx context.Context, userID string, page, limit int) ([]models.Follow, int64, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var follows []models.Follow
+	for followerID, since := range r.followers[tenantKey(ctx, userID)] {
+		follows = append(follows, models.Follow{FollowerID: followerID, FolloweeID: userID, CreatedAt: since})
+	}
+	return paginateFollows(follows, page, limit)
+}
+
+func (r *MemoryFollowRepo) GetFollowing(ctx context.Context, userID string, page, limit int) ([]models.Follow, int64, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var follows []models.Follow
+	for followeeID, since := range r.following[tenantKey(ctx, userID)] {
+		follows = append(follows, models.Follow{FollowerID: userID, FolloweeID: followeeID, CreatedAt: since})
+	}
+	return paginateFollows(follows, page, limit)
+}
+
+func (r *MemoryFollowRepo) GetStats(ctx context.Context, userID string) (*models.FollowStats, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return &models.FollowStats{
+		UserID:    userID,
+		Followers: int64(len(r.followers[tenantKey(ctx, userID)])),
+		Following: int64(len(r.following[tenantKey(ctx, userID)])),
+	}, nil
+}
+
+// followingIDs returns the set of users followerID follows in the ctx tenant.
+func (r *MemoryFollowRepo) followingIDs(ctx context.Context, followerID string) map[string]bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	ids := make(map[string]bool, len(r.following[tenantKey(ctx, followerID)]))
+	for id := range r.following[tenantKey(ctx, followerID)] {
+		ids[id] = true
+	}
+	return ids
+}
+
+func paginateFollows(follows []models.Follow, page, limit int) ([]models.Follow, int64, error) {
+	sort.Slice(follows, func(i, j int) bool {
+		return follows[i].CreatedAt.After(follows[j].CreatedAt)
+	})
+
+	totalCount := int64(len(follows))
+	offset := (page - 1) * limit
+
+	if offset >= len(follows) {
+		return []models.Follow{}, totalCount, nil
+	}
+
+	end := offset + limit
+	if end > len(follows) {
+		end = len(follows)
+	}
+
+	return follows[offset:end], totalCount, nil
+}
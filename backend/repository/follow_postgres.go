@@ -0,0 +1,113 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"go.uber.org/zap"
+	"nunoo.co/backend/models"
+	"nunoo.co/backend/types"
+)
+
+type PostgresFollowRepo struct {
+	db *sql.DB
+}
+
+func NewPostgresFollowRepo(db *sql.DB) *PostgresFollowRepo {
+	return &PostgresFollowRepo{db: db}
+}
+
+func (r *PostgresFollowRepo) Follow(ctx context.Context, followerID, followeeID string) error {
+	if followerID == followeeID {
+		return ErrSelfFollow
+	}
+
+	query := `
+		INSERT INTO follows (tenant_id, follower_id, followee_id, created_at)
+		VALUES ($1, $2, $3, now())
+		ON CONFLICT (tenant_id, follower_id, followee_id) DO NOTHING
+	`
+	_, err := r.db.ExecContext(ctx, query, types.TenantID(ctx), followerID, followeeID)
+	return err
+}
+
+func (r *PostgresFollowRepo) Unfollow(ctx context.Context, followerID, followeeID string) error {
+	query := `DELETE FROM follows WHERE tenant_id = $1 AND follower_id = $2 AND followee_id = $3`
+	_, err := r.db.ExecContext(ctx, query, types.TenantID(ctx), followerID, followeeID)
+	return err
+}
+
+func (r *PostgresFollowRepo) IsFollowing(ctx context.Context, followerID, followeeID string) (bool, error) {
+	query := `SELECT EXISTS (SELECT 1 FROM follows WHERE tenant_id = $1 AND follower_id = $2 AND followee_id = $3)`
+	var following bool
+	err := r.db.QueryRowContext(ctx, query, types.TenantID(ctx), followerID, followeeID).Scan(&following)
+	return following, err
+}
+
+func (r *PostgresFollowRepo) GetFollowers(ctx context.Context, userID string, page, limit int) ([]models.Follow, int64, error) {
+	return r.list(ctx, "followee_id", userID, page, limit)
+}
+
+func (r *PostgresFollowRepo) GetFollowing(ctx context.Context, userID string, page, limit int) ([]models.Follow, int64, error) {
+	return r.list(ctx, "follower_id", userID, page, limit)
+}
+
+func (r *PostgresFollowRepo) GetStats(ctx context.Context, userID string) (*models.FollowStats, error) {
+	query := `
+		SELECT
+			(SELECT COUNT(*) FROM follows WHERE tenant_id = $1 AND followee_id = $2),
+			(SELECT COUNT(*) FROM follows WHERE tenant_id = $1 AND follower_id = $2)
+	`
+	stats := &models.FollowStats{UserID: userID}
+	err := r.db.QueryRowContext(ctx, query, types.TenantID(ctx), userID).Scan(&stats.Followers, &stats.Following)
+	if err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+// list pages through edges where column equals userID. column is always one
+// of the two constant names above, never user input.
+func (r *PostgresFollowRepo) list(ctx context.Context, column, userID string, page, limit int) ([]models.Follow, int64, error) {
+	tenantID := types.TenantID(ctx)
+	countQuery := fmt.Sprintf(`SELECT COUNT(*) FROM follows WHERE tenant_id = $1 AND %s = $2`, column)
+	var totalCount int64
+	if err := r.db.QueryRowContext(ctx, countQuery, tenantID, userID).Scan(&totalCount); err != nil {
+		return nil, 0, err
+	}
+
+	offset := (page - 1) * limit
+	query := fmt.Sprintf(`
+		SELECT follower_id, followee_id, created_at
+		FROM follows
+		WHERE tenant_id = $1 AND %s = $2
+		ORDER BY created_at DESC
+		LIMIT $3 OFFSET $4
+	`, column)
+
+	rows, err := r.db.QueryContext(ctx, query, tenantID, userID, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			fmt.Println("failed to close rows", zap.Error(err))
+		}
+	}()
+
+	follows := []models.Follow{}
+	for rows.Next() {
+		var f models.Follow
+		if err := rows.Scan(&f.FollowerID, &f.FolloweeID, &f.CreatedAt); err != nil {
+			return nil, 0, err
+		}
+		follows = append(follows, f)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	return follows, totalCount, nil
+}
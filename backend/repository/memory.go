@@ -7,6 +7,7 @@ import (
 	"sync"
 
 	"nunoo.co/backend/models"
+	"nunoo.co/backend/types"
 )
 
 var (
@@ -22,6 +23,7 @@ type UserRepository interface {
 }
 
 // MemoryUserRepo is an in-memory implementation suitable for tests and dev.
+// Both indexes are keyed by tenant so the same email can exist on several sites.
 type MemoryUserRepo struct {
 	mu      sync.RWMutex
 	byEmail map[string]*models.User
@@ -37,6 +39,9 @@ func NewMemoryUserRepo() *MemoryUserRepo {
 
 func normalizeEmail(e string) string { return strings.ToLower(strings.TrimSpace(e)) }
 
+// tenantKey prefixes k with the tenant from ctx for tenant-scoped map lookups.
+func tenantKey(ctx context.Context, k string) string { return types.TenantID(ctx) + "\x00" + k }
+
 func (r *MemoryUserRepo) Create(ctx context.Context, u *models.User) error {
 	// Check if context is cancelled
 	select {
@@ -47,12 +52,13 @@ func (r *MemoryUserRepo) Create(ctx context.Context, u *models.User) error {
 
 	r.mu.Lock()
 	defer r.mu.Unlock()
-	e := normalizeEmail(u.Email)
+	u.TenantID = types.TenantID(ctx)
+	e := tenantKey(ctx, normalizeEmail(u.Email))
 	if _, exists := r.byEmail[e]; exists {
 		return ErrUserExists
 	}
 	r.byEmail[e] = u
-	r.byID[u.ID] = u
+	r.byID[tenantKey(ctx, u.ID)] = u
 	return nil
 }
 
@@ -66,7 +72,7 @@ func (r *MemoryUserRepo) GetByEmail(ctx context.Context, email string) (*models.
 
 	r.mu.RLock()
 	defer r.mu.RUnlock()
-	u, ok := r.byEmail[normalizeEmail(email)]
+	u, ok := r.byEmail[tenantKey(ctx, normalizeEmail(email))]
 	if !ok {
 		return nil, ErrUserNotFound
 	}
@@ -83,7 +89,7 @@ func (r *MemoryUserRepo) GetByID(ctx context.Context, id string) (*models.User,
 
 	r.mu.RLock()
 	defer r.mu.RUnlock()
-	u, ok := r.byID[id]
+	u, ok := r.byID[tenantKey(ctx, id)]
 	if !ok {
 		return nil, ErrUserNotFound
 	}
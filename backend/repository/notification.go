@@ -0,0 +1,20 @@
+package repository
+
+import (
+	"context"
+
+	"nunoo.co/backend/models"
+)
+
+// NotificationRepository stores grouped in-app notifications. Lists are
+// ordered by most recent activity, so cursors encode (updated_at, id).
+type NotificationRepository interface {
+	// Add merges n into the recipient's unread notification with the same
+	// group key, or stores it as a new entry when there is none.
+	Add(ctx context.Context, n *models.Notification, actorID string) error
+	List(ctx context.Context, userID string, cursor *FeedCursor, limit int) ([]models.Notification, error)
+	UnreadCount(ctx context.Context, userID string) (int64, error)
+	// MarkRead and Dismiss act on the given IDs, or on everything when ids is empty.
+	MarkRead(ctx context.Context, userID string, ids []string) error
+	Dismiss(ctx context.Context, userID string, ids []string) error
+}
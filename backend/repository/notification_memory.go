@@ -0,0 +1,123 @@
+package repository
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"nunoo.co/backend/models"
+)
+
+type MemoryNotificationRepo struct {
+	mu     sync.RWMutex
+	byUser map[string][]*models.Notification // tenant+user -> notifications
+}
+
+func NewMemoryNotificationRepo() *MemoryNotificationRepo {
+	return &MemoryNotificationRepo{
+		byUser: make(map[string][]*models.Notification),
+	}
+}
+
+func (r *MemoryNotificationRepo) Add(ctx context.Context, n *models.Notification, actorID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := tenantKey(ctx, n.UserID)
+	now := time.Now()
+	for _, existing := range r.byUser[key] {
+		if !existing.Read && existing.GroupKey() == n.GroupKey() {
+			existing.AddActor(actorID, now)
+			*n = *existing
+			return nil
+		}
+	}
+
+	n.CreatedAt = now
+	n.AddActor(actorID, now)
+	stored := *n
+	r.byUser[key] = append(r.byUser[key], &stored)
+	return nil
+}
+
+func (r *MemoryNotificationRepo) List(ctx context.Context, userID string, cursor *FeedCursor, limit int) ([]models.Notification, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	list := []models.Notification{}
+	for _, n := range r.byUser[tenantKey(ctx, userID)] {
+		if cursor.before(n.UpdatedAt, n.ID) {
+			cp := *n
+			cp.ActorIDs = append([]string(nil), n.ActorIDs...)
+			list = append(list, cp)
+		}
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].UpdatedAt.Equal(list[j].UpdatedAt) {
+			return list[i].ID > list[j].ID
+		}
+		return list[i].UpdatedAt.After(list[j].UpdatedAt)
+	})
+	if len(list) > limit {
+		list = list[:limit]
+	}
+	return list, nil
+}
+
+func (r *MemoryNotificationRepo) UnreadCount(ctx context.Context, userID string) (int64, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var count int64
+	for _, n := range r.byUser[tenantKey(ctx, userID)] {
+		if !n.Read {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (r *MemoryNotificationRepo) MarkRead(ctx context.Context, userID string, ids []string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	selected := idSet(ids)
+	for _, n := range r.byUser[tenantKey(ctx, userID)] {
+		if !n.Read && (selected == nil || selected[n.ID]) {
+			n.Read = true
+			n.ReadAt = &now
+		}
+	}
+	return nil
+}
+
+func (r *MemoryNotificationRepo) Dismiss(ctx context.Context, userID string, ids []string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := tenantKey(ctx, userID)
+	selected := idSet(ids)
+	kept := r.byUser[key][:0]
+	for _, n := range r.byUser[key] {
+		if selected != nil && !selected[n.ID] {
+			kept = append(kept, n)
+		}
+	}
+	r.byUser[key] = kept
+	return nil
+}
+
+// idSet returns ids as a set, or nil when ids is empty (meaning "all").
+func idSet(ids []string) map[string]bool {
+	if len(ids) == 0 {
+		return nil
+	}
+	set := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		set[id] = true
+	}
+	return set
+}
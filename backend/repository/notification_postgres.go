@@ -0,0 +1,160 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+	"nunoo.co/backend/models"
+	"nunoo.co/backend/types"
+)
+
+type PostgresNotificationRepo struct {
+	db *sql.DB
+}
+
+func NewPostgresNotificationRepo(db *sql.DB) *PostgresNotificationRepo {
+	return &PostgresNotificationRepo{db: db}
+}
+
+const notificationColumns = `id, user_id, kind, subject_id, actor_ids, actor_count, read_at, created_at, updated_at`
+
+func scanNotification(row rowScanner, n *models.Notification) error {
+	var actorIDs []byte
+	var readAt sql.NullTime
+	err := row.Scan(&n.ID, &n.UserID, &n.Kind, &n.SubjectID, &actorIDs, &n.ActorCount, &readAt, &n.CreatedAt, &n.UpdatedAt)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(actorIDs, &n.ActorIDs); err != nil {
+		return err
+	}
+	if readAt.Valid {
+		n.Read = true
+		n.ReadAt = &readAt.Time
+	}
+	return nil
+}
+
+// Add inserts the event as a new unread entry or, when the recipient
+// already has one for the group, merges into it in the same statement. The
+// upsert on the partial unique index of unread group keys lets concurrent
+// first events merge instead of one of them failing.
+func (r *PostgresNotificationRepo) Add(ctx context.Context, n *models.Notification, actorID string) error {
+	now := time.Now()
+	n.CreatedAt = now
+	n.AddActor(actorID, now)
+	actors, err := json.Marshal(n.ActorIDs)
+	if err != nil {
+		return err
+	}
+
+	// A merged actor moves to the front of actor_ids, which keeps at most
+	// MaxNotificationActors; actors still listed are not counted again.
+	query := `
+		INSERT INTO notifications AS n (id, tenant_id, user_id, kind, subject_id, group_key, actor_ids, actor_count, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $9)
+		ON CONFLICT (tenant_id, user_id, group_key) WHERE read_at IS NULL DO UPDATE SET
+			actor_count = n.actor_count + CASE
+				WHEN $10::text <> '' AND n.actor_ids @> jsonb_build_array($10::text) THEN 0
+				ELSE 1 END,
+			actor_ids = CASE WHEN $10::text = '' THEN n.actor_ids ELSE (
+				SELECT jsonb_agg(a.id ORDER BY a.pos)
+				FROM (
+					SELECT id, pos FROM (
+						SELECT $10::text AS id, 0::bigint AS pos
+						UNION ALL
+						SELECT e.id, e.pos FROM jsonb_array_elements_text(n.actor_ids) WITH ORDINALITY AS e(id, pos)
+						WHERE e.id <> $10::text
+					) merged
+					ORDER BY pos
+					LIMIT $11
+				) a
+			) END,
+			updated_at = EXCLUDED.updated_at
+		RETURNING ` + notificationColumns
+	row := r.db.QueryRowContext(ctx, query,
+		n.ID, types.TenantID(ctx), n.UserID, n.Kind, n.SubjectID, n.GroupKey(), actors, n.ActorCount, now,
+		actorID, models.MaxNotificationActors)
+	return scanNotification(row, n)
+}
+
+func (r *PostgresNotificationRepo) List(ctx context.Context, userID string, cursor *FeedCursor, limit int) ([]models.Notification, error) {
+	var after any
+	var afterID string
+	if cursor != nil {
+		after, afterID = cursor.CreatedAt, cursor.ID
+	}
+
+	query := `
+		SELECT ` + notificationColumns + `
+		FROM notifications
+		WHERE tenant_id = $1 AND user_id = $2
+		  AND ($3::timestamptz IS NULL OR (updated_at, id) < ($3::timestamptz, $4))
+		ORDER BY updated_at DESC, id DESC
+		LIMIT $5
+	`
+	rows, err := r.db.QueryContext(ctx, query, types.TenantID(ctx), userID, after, afterID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			fmt.Println("failed to close rows", zap.Error(err))
+		}
+	}()
+
+	list := []models.Notification{}
+	for rows.Next() {
+		n := models.Notification{}
+		if err := scanNotification(rows, &n); err != nil {
+			return nil, err
+		}
+		list = append(list, n)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return list, nil
+}
+
+func (r *PostgresNotificationRepo) UnreadCount(ctx context.Context, userID string) (int64, error) {
+	query := `SELECT COUNT(*) FROM notifications WHERE tenant_id = $1 AND user_id = $2 AND read_at IS NULL`
+	var count int64
+	err := r.db.QueryRowContext(ctx, query, types.TenantID(ctx), userID).Scan(&count)
+	return count, err
+}
+
+func (r *PostgresNotificationRepo) MarkRead(ctx context.Context, userID string, ids []string) error {
+	query := `
+		UPDATE notifications SET read_at = now()
+		WHERE tenant_id = $1 AND user_id = $2 AND read_at IS NULL
+		  AND (cardinality($3::text[]) = 0 OR id = ANY($3::text[]))
+	`
+	_, err := r.db.ExecContext(ctx, query, types.TenantID(ctx), userID, textArray(ids))
+	return err
+}
+
+func (r *PostgresNotificationRepo) Dismiss(ctx context.Context, userID string, ids []string) error {
+	query := `
+		DELETE FROM notifications
+		WHERE tenant_id = $1 AND user_id = $2
+		  AND (cardinality($3::text[]) = 0 OR id = ANY($3::text[]))
+	`
+	_, err := r.db.ExecContext(ctx, query, types.TenantID(ctx), userID, textArray(ids))
+	return err
+}
+
+// textArray returns ids as a non-NULL text[] parameter; pgx encodes a nil
+// slice as NULL, which would make cardinality() NULL as well.
+func textArray(ids []string) []string {
+	if ids == nil {
+		return []string{}
+	}
+	return ids
+}
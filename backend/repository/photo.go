@@ -3,20 +3,127 @@ package repository
 import (
 	"context"
 	"errors"
+	"slices"
+	"strings"
+	"time"
 
 	"nunoo.co/backend/models"
 )
 
 var (
 	ErrPhotoNotFound = errors.New("photo not found")
-	ErrPhotoExists   = errors.New("photo already exists")
+	// ErrPhotoExists is returned by Create when the ID is taken or the user
+	// already has a photo with the same content hash.
+	ErrPhotoExists = errors.New("photo already exists")
+	// ErrPhotoVersionConflict is returned by Update when the photo was
+	// edited since the caller read it.
+	ErrPhotoVersionConflict = errors.New("photo was modified")
 )
 
+// PhotoSort orders GetAll and GetByUserID results.
+type PhotoSort string
+
+const (
+	// SortCreatedAt lists the newest uploads first. It is the default.
+	SortCreatedAt PhotoSort = "created_at"
+	// SortTakenAt lists the most recently captured photos first, followed
+	// by photos without an EXIF capture time in upload order.
+	SortTakenAt PhotoSort = "taken_at"
+)
+
+// PhotoFilter narrows and orders GetAll and GetByUserID. Zero fields match
+// every photo; camera and lens names and MIME types match
+// case-insensitively. Tag must already be normalized.
+type PhotoFilter struct {
+	Sort          PhotoSort
+	Visibility    models.Visibility
+	MimeType      string
+	Tag           string
+	CameraMake    string
+	CameraModel   string
+	LensModel     string
+	MinISO        int
+	MaxISO        int
+	TakenAfter    time.Time
+	TakenBefore   time.Time
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+}
+
+func (f PhotoFilter) matches(p *models.Photo) bool {
+	var exif models.PhotoExif
+	if p.Exif != nil {
+		exif = *p.Exif
+	}
+	switch {
+	case f.Visibility != "" && p.Visibility != f.Visibility,
+		f.MimeType != "" && !strings.EqualFold(f.MimeType, p.MimeType),
+		!f.CreatedAfter.IsZero() && p.CreatedAt.Before(f.CreatedAfter),
+		!f.CreatedBefore.IsZero() && !p.CreatedAt.Before(f.CreatedBefore),
+		f.CameraMake != "" && !strings.EqualFold(f.CameraMake, exif.CameraMake),
+		f.CameraModel != "" && !strings.EqualFold(f.CameraModel, exif.CameraModel),
+		f.LensModel != "" && !strings.EqualFold(f.LensModel, exif.LensModel),
+		f.MinISO > 0 && exif.ISO < f.MinISO,
+		f.MaxISO > 0 && (exif.ISO == 0 || exif.ISO > f.MaxISO):
+		return false
+	}
+	if f.Tag != "" && !slices.Contains(p.Tags, f.Tag) {
+		return false
+	}
+	if !f.TakenAfter.IsZero() && (p.TakenAt == nil || p.TakenAt.Before(f.TakenAfter)) {
+		return false
+	}
+	if !f.TakenBefore.IsZero() && (p.TakenAt == nil || !p.TakenAt.Before(f.TakenBefore)) {
+		return false
+	}
+	return true
+}
+
 type PhotoRepository interface {
 	Create(ctx context.Context, photo *models.Photo) error
 	GetByID(ctx context.Context, id string) (*models.Photo, error)
-	GetByUserID(ctx context.Context, userID string, page, limit int) ([]models.Photo, int64, error)
-	GetAll(ctx context.Context, page, limit int) ([]models.Photo, int64, error)
+	// GetByContentHash returns the photo userID uploaded with the given
+	// content hash, or ErrPhotoNotFound.
+	GetByContentHash(ctx context.Context, userID, hash string) (*models.Photo, error)
+	// GetByUserID lists userID's photos whatever their visibility.
+	GetByUserID(ctx context.Context, userID string, filter PhotoFilter, page, limit int) ([]models.Photo, int64, error)
+	// GetAll lists the tenant's public photos.
+	GetAll(ctx context.Context, filter PhotoFilter, page, limit int) ([]models.Photo, int64, error)
+	// GetAllAfter and GetByUserIDAfter page GetAll and GetByUserID by
+	// keyset instead of offset: up to limit photos newest first, strictly
+	// after cursor (nil for the first page). filter.Sort is ignored.
+	GetAllAfter(ctx context.Context, filter PhotoFilter, cursor *FeedCursor, limit int) ([]models.Photo, error)
+	GetByUserIDAfter(ctx context.Context, userID string, filter PhotoFilter, cursor *FeedCursor, limit int) ([]models.Photo, error)
+	// EstimateCount cheaply approximates how many photos GetAll (userID
+	// empty) or GetByUserID would list under filter.
+	EstimateCount(ctx context.Context, userID string, filter PhotoFilter) (int64, error)
+	// GetFollowingFeed returns up to limit public photos posted by accounts
+	// followerID follows, newest first, strictly after cursor (nil for the
+	// first page).
+	GetFollowingFeed(ctx context.Context, followerID string, cursor *FeedCursor, limit int) ([]models.Photo, error)
+	// GetByAlbum lists an album's photos in album order, leaving out
+	// private ones unless includePrivate is set.
+	GetByAlbum(ctx context.Context, albumID string, includePrivate bool, page, limit int) ([]models.Photo, int64, error)
+	// GetTags lists up to limit tags of public photos starting with prefix,
+	// most used first, with the number of public photos carrying each.
+	GetTags(ctx context.Context, prefix string, limit int) ([]models.TagCount, error)
+	// Search returns up to limit photos matching every word of query, best
+	// match first, strictly after cursor (nil for the first page). Only
+	// public photos and viewerID's own are searched.
+	Search(ctx context.Context, query, viewerID string, cursor *SearchCursor, limit int) ([]models.PhotoSearchHit, error)
+	// Like records that userID likes photoID and Unlike takes it back; both
+	// are idempotent and return the photo's like count afterwards, and
+	// whether this call was the one that changed it.
+	Like(ctx context.Context, photoID, userID string) (int64, bool, error)
+	Unlike(ctx context.Context, photoID, userID string) (int64, bool, error)
+	// LikedPhotoIDs reports which of photoIDs userID likes.
+	LikedPhotoIDs(ctx context.Context, userID string, photoIDs []string) (map[string]bool, error)
+	// GetLikes lists up to limit photos userID likes, most recently liked
+	// first, strictly after cursor (the like's time and photo ID; nil for
+	// the first page). Other users' private photos are left out.
+	GetLikes(ctx context.Context, userID string, cursor *FeedCursor, limit int) ([]models.PhotoLike, error)
+	// Update saves photo, tags included, if it is still at photo.Version,
+	// returning ErrPhotoVersionConflict otherwise, and bumps photo.Version.
 	Update(ctx context.Context, photo *models.Photo) error
 	Delete(ctx context.Context, id string) error
 }
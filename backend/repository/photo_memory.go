@@ -3,22 +3,47 @@ package repository
 import (
 	"context"
 	"sort"
+	"strings"
 	"sync"
+	"time"
 
 	"nunoo.co/backend/models"
+	"nunoo.co/backend/types"
 )
 
 type MemoryPhotoRepo struct {
-	mu     sync.RWMutex
-	photos map[string]*models.Photo
+	mu      sync.RWMutex
+	photos  map[string]*models.Photo
+	follows *MemoryFollowRepo
+	albums  *MemoryAlbumRepo
+	index   *searchIndex
+	likes   map[string]map[string]time.Time // photo ID -> user ID -> liked at
 }
 
 func NewMemoryPhotoRepo() *MemoryPhotoRepo {
 	return &MemoryPhotoRepo{
 		photos: make(map[string]*models.Photo),
+		index:  newSearchIndex(),
+		likes:  make(map[string]map[string]time.Time),
 	}
 }
 
+// SetFollowGraph gives the repo the follow graph GetFollowingFeed reads.
+func (r *MemoryPhotoRepo) SetFollowGraph(follows *MemoryFollowRepo) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.follows = follows
+}
+
+// SetAlbums gives the repo the album membership GetByAlbum reads.
+func (r *MemoryPhotoRepo) SetAlbums(albums *MemoryAlbumRepo) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.albums = albums
+}
+
 func (r *MemoryPhotoRepo) Create(ctx context.Context, photo *models.Photo) error {
 	r.mu.Lock()
 	defer r.mu.Unlock()
@@ -26,8 +51,24 @@ func (r *MemoryPhotoRepo) Create(ctx context.Context, photo *models.Photo) error
 	if _, exists := r.photos[photo.ID]; exists {
 		return ErrPhotoExists
 	}
+	tenantID := types.TenantID(ctx)
+	if photo.ContentHash != "" {
+		for _, p := range r.photos {
+			if p.TenantID == tenantID && p.UserID == photo.UserID && p.ContentHash == photo.ContentHash {
+				return ErrPhotoExists
+			}
+		}
+	}
 
+	photo.TenantID = tenantID
+	if photo.Visibility == "" {
+		photo.Visibility = models.VisibilityPublic
+	}
+	if photo.Version == 0 {
+		photo.Version = 1
+	}
 	r.photos[photo.ID] = photo
+	r.index.put(photo)
 	return nil
 }
 
@@ -36,27 +77,39 @@ func (r *MemoryPhotoRepo) GetByID(ctx context.Context, id string) (*models.Photo
 	defer r.mu.RUnlock()
 
 	photo, exists := r.photos[id]
-	if !exists {
+	if !exists || photo.TenantID != types.TenantID(ctx) {
 		return nil, ErrPhotoNotFound
 	}
 
 	return photo, nil
 }
 
-func (r *MemoryPhotoRepo) GetByUserID(ctx context.Context, userID string, page, limit int) ([]models.Photo, int64, error) {
+func (r *MemoryPhotoRepo) GetByContentHash(ctx context.Context, userID, hash string) (*models.Photo, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	tenantID := types.TenantID(ctx)
+	for _, photo := range r.photos {
+		if photo.TenantID == tenantID && photo.UserID == userID && photo.ContentHash == hash {
+			return photo, nil
+		}
+	}
+	return nil, ErrPhotoNotFound
+}
+
+func (r *MemoryPhotoRepo) GetByUserID(ctx context.Context, userID string, filter PhotoFilter, page, limit int) ([]models.Photo, int64, error) {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
 
+	tenantID := types.TenantID(ctx)
 	var userPhotos []models.Photo
 	for _, photo := range r.photos {
-		if photo.UserID == userID {
+		if photo.TenantID == tenantID && photo.UserID == userID && filter.matches(photo) {
 			userPhotos = append(userPhotos, *photo)
 		}
 	}
 
-	sort.Slice(userPhotos, func(i, j int) bool {
-		return userPhotos[i].CreatedAt.After(userPhotos[j].CreatedAt)
-	})
+	sortPhotos(userPhotos, filter.Sort)
 
 	totalCount := int64(len(userPhotos))
 	offset := (page - 1) * limit
@@ -77,26 +130,35 @@ func (r *MemoryPhotoRepo) Update(ctx context.Context, photo *models.Photo) error
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	if _, exists := r.photos[photo.ID]; !exists {
+	existing, exists := r.photos[photo.ID]
+	if !exists || existing.TenantID != types.TenantID(ctx) {
 		return ErrPhotoNotFound
 	}
+	if existing.Version != photo.Version {
+		return ErrPhotoVersionConflict
+	}
 
+	photo.TenantID = existing.TenantID
+	photo.LikeCount = existing.LikeCount
+	photo.Version++
 	r.photos[photo.ID] = photo
+	r.index.put(photo)
 	return nil
 }
 
-func (r *MemoryPhotoRepo) GetAll(ctx context.Context, page, limit int) ([]models.Photo, int64, error) {
+func (r *MemoryPhotoRepo) GetAll(ctx context.Context, filter PhotoFilter, page, limit int) ([]models.Photo, int64, error) {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
 
+	tenantID := types.TenantID(ctx)
 	var allPhotos []models.Photo
 	for _, photo := range r.photos {
-		allPhotos = append(allPhotos, *photo)
+		if photo.TenantID == tenantID && photo.Visibility == models.VisibilityPublic && filter.matches(photo) {
+			allPhotos = append(allPhotos, *photo)
+		}
 	}
 
-	sort.Slice(allPhotos, func(i, j int) bool {
-		return allPhotos[i].CreatedAt.After(allPhotos[j].CreatedAt)
-	})
+	sortPhotos(allPhotos, filter.Sort)
 
 	totalCount := int64(len(allPhotos))
 	offset := (page - 1) * limit
@@ -113,14 +175,321 @@ func (r *MemoryPhotoRepo) GetAll(ctx context.Context, page, limit int) ([]models
 	return allPhotos[offset:end], totalCount, nil
 }
 
+func (r *MemoryPhotoRepo) GetAllAfter(ctx context.Context, filter PhotoFilter, cursor *FeedCursor, limit int) ([]models.Photo, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.after(ctx, func(p *models.Photo) bool {
+		return p.Visibility == models.VisibilityPublic && filter.matches(p)
+	}, cursor, limit), nil
+}
+
+func (r *MemoryPhotoRepo) GetByUserIDAfter(ctx context.Context, userID string, filter PhotoFilter, cursor *FeedCursor, limit int) ([]models.Photo, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.after(ctx, func(p *models.Photo) bool {
+		return p.UserID == userID && filter.matches(p)
+	}, cursor, limit), nil
+}
+
+// EstimateCount counts exactly; the memory store has no cheaper way.
+func (r *MemoryPhotoRepo) EstimateCount(ctx context.Context, userID string, filter PhotoFilter) (int64, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	tenantID := types.TenantID(ctx)
+	var n int64
+	for _, p := range r.photos {
+		if p.TenantID != tenantID || !filter.matches(p) {
+			continue
+		}
+		if userID == "" && p.Visibility == models.VisibilityPublic || userID != "" && p.UserID == userID {
+			n++
+		}
+	}
+	return n, nil
+}
+
+// after returns up to limit of the tenant's photos accepted by keep,
+// newest first, strictly after cursor. The caller holds r.mu.
+func (r *MemoryPhotoRepo) after(ctx context.Context, keep func(*models.Photo) bool, cursor *FeedCursor, limit int) []models.Photo {
+	tenantID := types.TenantID(ctx)
+	photos := []models.Photo{}
+	for _, p := range r.photos {
+		if p.TenantID == tenantID && keep(p) && cursor.before(p.CreatedAt, p.ID) {
+			photos = append(photos, *p)
+		}
+	}
+
+	sortNewestFirst(photos)
+	if len(photos) > limit {
+		photos = photos[:limit]
+	}
+	return photos
+}
+
+func (r *MemoryPhotoRepo) GetFollowingFeed(ctx context.Context, followerID string, cursor *FeedCursor, limit int) ([]models.Photo, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if r.follows == nil {
+		return []models.Photo{}, nil
+	}
+	followed := r.follows.followingIDs(ctx, followerID)
+
+	tenantID := types.TenantID(ctx)
+	feed := []models.Photo{}
+	for _, photo := range r.photos {
+		if photo.TenantID == tenantID && photo.Visibility == models.VisibilityPublic && followed[photo.UserID] && cursor.before(photo.CreatedAt, photo.ID) {
+			feed = append(feed, *photo)
+		}
+	}
+
+	sortNewestFirst(feed)
+	if len(feed) > limit {
+		feed = feed[:limit]
+	}
+	return feed, nil
+}
+
+func (r *MemoryPhotoRepo) GetByAlbum(ctx context.Context, albumID string, includePrivate bool, page, limit int) ([]models.Photo, int64, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if r.albums == nil {
+		return []models.Photo{}, 0, nil
+	}
+	tenantID := types.TenantID(ctx)
+	var albumPhotos []models.Photo
+	for _, id := range r.albums.photoIDs(ctx, albumID) {
+		photo, exists := r.photos[id]
+		if exists && photo.TenantID == tenantID && (includePrivate || photo.Visibility != models.VisibilityPrivate) {
+			albumPhotos = append(albumPhotos, *photo)
+		}
+	}
+
+	totalCount := int64(len(albumPhotos))
+	offset := (page - 1) * limit
+
+	if offset >= len(albumPhotos) {
+		return []models.Photo{}, totalCount, nil
+	}
+
+	end := offset + limit
+	if end > len(albumPhotos) {
+		end = len(albumPhotos)
+	}
+
+	return albumPhotos[offset:end], totalCount, nil
+}
+
+func (r *MemoryPhotoRepo) GetTags(ctx context.Context, prefix string, limit int) ([]models.TagCount, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	tenantID := types.TenantID(ctx)
+	counts := make(map[string]int64)
+	for _, photo := range r.photos {
+		if photo.TenantID != tenantID || photo.Visibility != models.VisibilityPublic {
+			continue
+		}
+		for _, tag := range photo.Tags {
+			if strings.HasPrefix(tag, prefix) {
+				counts[tag]++
+			}
+		}
+	}
+
+	tags := []models.TagCount{}
+	for tag, count := range counts {
+		tags = append(tags, models.TagCount{Tag: tag, Count: count})
+	}
+	sortTagCounts(tags)
+	if len(tags) > limit {
+		tags = tags[:limit]
+	}
+	return tags, nil
+}
+
+func (r *MemoryPhotoRepo) Search(ctx context.Context, query, viewerID string, cursor *SearchCursor, limit int) ([]models.PhotoSearchHit, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	terms := searchTerms(query)
+	matched := make(map[string]bool, len(terms))
+	for _, term := range terms {
+		matched[term] = true
+	}
+
+	tenantID := types.TenantID(ctx)
+	hits := []models.PhotoSearchHit{}
+	for id, rank := range r.index.match(terms) {
+		photo := r.photos[id]
+		if photo.TenantID != tenantID || !cursor.before(rank, id) {
+			continue
+		}
+		if photo.Visibility != models.VisibilityPublic && photo.UserID != viewerID {
+			continue
+		}
+		hits = append(hits, models.PhotoSearchHit{
+			Photo:     *photo,
+			Rank:      rank,
+			Highlight: highlightTerms(photo.Caption, matched),
+		})
+	}
+
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Rank == hits[j].Rank {
+			return hits[i].Photo.ID > hits[j].Photo.ID
+		}
+		return hits[i].Rank > hits[j].Rank
+	})
+	if len(hits) > limit {
+		hits = hits[:limit]
+	}
+	return hits, nil
+}
+
 func (r *MemoryPhotoRepo) Delete(ctx context.Context, id string) error {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	if _, exists := r.photos[id]; !exists {
+	photo, exists := r.photos[id]
+	if !exists || photo.TenantID != types.TenantID(ctx) {
 		return ErrPhotoNotFound
 	}
 
 	delete(r.photos, id)
+	delete(r.likes, id)
+	r.index.remove(id)
 	return nil
 }
+
+func (r *MemoryPhotoRepo) Like(ctx context.Context, photoID, userID string) (int64, bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	photo, exists := r.photos[photoID]
+	if !exists || photo.TenantID != types.TenantID(ctx) {
+		return 0, false, ErrPhotoNotFound
+	}
+	if _, liked := r.likes[photoID][userID]; liked {
+		return photo.LikeCount, false, nil
+	}
+
+	if r.likes[photoID] == nil {
+		r.likes[photoID] = make(map[string]time.Time)
+	}
+	r.likes[photoID][userID] = time.Now().UTC()
+	return r.setLikeCount(photo, int64(len(r.likes[photoID]))), true, nil
+}
+
+func (r *MemoryPhotoRepo) Unlike(ctx context.Context, photoID, userID string) (int64, bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	photo, exists := r.photos[photoID]
+	if !exists || photo.TenantID != types.TenantID(ctx) {
+		return 0, false, ErrPhotoNotFound
+	}
+	if _, liked := r.likes[photoID][userID]; !liked {
+		return photo.LikeCount, false, nil
+	}
+
+	delete(r.likes[photoID], userID)
+	if len(r.likes[photoID]) == 0 {
+		delete(r.likes, photoID)
+	}
+	return r.setLikeCount(photo, int64(len(r.likes[photoID]))), true, nil
+}
+
+// setLikeCount stores a copy of photo with the new count, since readers
+// may hold the old pointer. The caller holds r.mu.
+func (r *MemoryPhotoRepo) setLikeCount(photo *models.Photo, n int64) int64 {
+	updated := *photo
+	updated.LikeCount = n
+	r.photos[photo.ID] = &updated
+	return n
+}
+
+func (r *MemoryPhotoRepo) LikedPhotoIDs(ctx context.Context, userID string, photoIDs []string) (map[string]bool, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	liked := make(map[string]bool)
+	for _, id := range photoIDs {
+		if _, ok := r.likes[id][userID]; ok {
+			liked[id] = true
+		}
+	}
+	return liked, nil
+}
+
+func (r *MemoryPhotoRepo) GetLikes(ctx context.Context, userID string, cursor *FeedCursor, limit int) ([]models.PhotoLike, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	tenantID := types.TenantID(ctx)
+	likes := []models.PhotoLike{}
+	for photoID, users := range r.likes {
+		likedAt, ok := users[userID]
+		photo := r.photos[photoID]
+		if !ok || photo == nil || photo.TenantID != tenantID || !cursor.before(likedAt, photoID) {
+			continue
+		}
+		if photo.Visibility == models.VisibilityPrivate && photo.UserID != userID {
+			continue
+		}
+		likes = append(likes, models.PhotoLike{Photo: *photo, LikedAt: likedAt})
+	}
+
+	sort.Slice(likes, func(i, j int) bool {
+		a, b := likes[i], likes[j]
+		if !a.LikedAt.Equal(b.LikedAt) {
+			return a.LikedAt.After(b.LikedAt)
+		}
+		return a.Photo.ID > b.Photo.ID
+	})
+	if len(likes) > limit {
+		likes = likes[:limit]
+	}
+	return likes, nil
+}
+
+// sortPhotos applies the PhotoFilter order, matching the Postgres ORDER BY.
+func sortPhotos(photos []models.Photo, order PhotoSort) {
+	sortNewestFirst(photos)
+	if order != SortTakenAt {
+		return
+	}
+	sort.SliceStable(photos, func(i, j int) bool {
+		a, b := photos[i].TakenAt, photos[j].TakenAt
+		if a == nil || b == nil {
+			return a != nil && b == nil
+		}
+		return a.After(*b)
+	})
+}
+
+// sortTagCounts orders tags most used first, then alphabetically, matching
+// the Postgres ORDER BY.
+func sortTagCounts(tags []models.TagCount) {
+	sort.Slice(tags, func(i, j int) bool {
+		if tags[i].Count == tags[j].Count {
+			return tags[i].Tag < tags[j].Tag
+		}
+		return tags[i].Count > tags[j].Count
+	})
+}
+
+// sortNewestFirst orders photos by (created_at, id) descending, matching the
+// keyset order used by FeedCursor.
+func sortNewestFirst(photos []models.Photo) {
+	sort.Slice(photos, func(i, j int) bool {
+		if photos[i].CreatedAt.Equal(photos[j].CreatedAt) {
+			return photos[i].ID > photos[j].ID
+		}
+		return photos[i].CreatedAt.After(photos[j].CreatedAt)
+	})
+}
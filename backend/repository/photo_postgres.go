@@ -3,91 +3,249 @@ package repository
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"strings"
+	"time"
 
 	"go.uber.org/zap"
 	"nunoo.co/backend/models"
+	"nunoo.co/backend/types"
 )
 
+// PostgresPhotoRepo scopes every query to the tenant carried by the context.
 type PostgresPhotoRepo struct {
 	db *sql.DB
+	// searchConfig is the text search configuration that builds search
+	// vectors and parses queries.
+	searchConfig string
 }
 
-func NewPostgresPhotoRepo(db *sql.DB) *PostgresPhotoRepo {
-	return &PostgresPhotoRepo{db: db}
+// NewPostgresPhotoRepo returns a repo that stems search text with the
+// named text search configuration, "english" when empty.
+func NewPostgresPhotoRepo(db *sql.DB, searchConfig string) *PostgresPhotoRepo {
+	if searchConfig == "" {
+		searchConfig = "english"
+	}
+	return &PostgresPhotoRepo{db: db, searchConfig: searchConfig}
 }
 
-func (r *PostgresPhotoRepo) Create(ctx context.Context, photo *models.Photo) error {
+// searchVector computes a photo's search vector from its caption (A), tags
+// (B) and camera metadata (C); $1 is the text search configuration.
+const searchVector = `
+	setweight(to_tsvector($1::regconfig, coalesce(p.caption, '')), 'A') ||
+	setweight(to_tsvector($1::regconfig, coalesce((
+		SELECT string_agg(t.name, ' ') FROM photo_tags pt JOIN tags t ON t.id = pt.tag_id WHERE pt.photo_id = p.id
+	), '')), 'B') ||
+	setweight(to_tsvector($1::regconfig, concat_ws(' ', p.camera_make, p.camera_model, p.lens_model)), 'C')`
+
+// indexPhoto refreshes the search vector of a photo within tx, after its
+// tags are set.
+func (r *PostgresPhotoRepo) indexPhoto(ctx context.Context, tx *sql.Tx, tenantID, photoID string) error {
+	query := `UPDATE photos p SET search_vector = ` + searchVector + ` WHERE p.tenant_id = $2 AND p.id = $3`
+	_, err := tx.ExecContext(ctx, query, r.searchConfig, tenantID, photoID)
+	return err
+}
+
+// ReindexSearch builds the search vector of every photo that lacks one, in
+// batches, across all tenants. It returns the number of photos indexed.
+func (r *PostgresPhotoRepo) ReindexSearch(ctx context.Context) (int64, error) {
 	query := `
-		INSERT INTO photos (id, user_id, file_name, original_url, thumbnail_url, caption, file_size, mime_type, width, height, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+		UPDATE photos p SET search_vector = ` + searchVector + `
+		WHERE p.id IN (SELECT id FROM photos WHERE search_vector IS NULL LIMIT 500)
 	`
-	_, err := r.db.ExecContext(ctx, query,
-		photo.ID, photo.UserID, photo.FileName, photo.OriginalURL, photo.ThumbnailURL,
-		photo.Caption, photo.FileSize, photo.MimeType, photo.Width, photo.Height,
-		photo.CreatedAt, photo.UpdatedAt)
-	if err != nil {
-		if isUniqueViolation(err) {
-			return ErrPhotoExists
+	var total int64
+	for {
+		result, err := r.db.ExecContext(ctx, query, r.searchConfig)
+		if err != nil {
+			return total, err
 		}
-		return err
+		n, err := result.RowsAffected()
+		if err != nil || n == 0 {
+			return total, err
+		}
+		total += n
 	}
-	return nil
 }
 
-func (r *PostgresPhotoRepo) GetByID(ctx context.Context, id string) (*models.Photo, error) {
-	query := `
-		SELECT id, user_id, file_name, original_url, thumbnail_url, caption, file_size, mime_type, width, height, created_at, updated_at
-		FROM photos WHERE id = $1
-	`
-	photo := &models.Photo{}
+// photoColumns is the column list read by scanPhoto, qualified with the p alias.
+const photoColumns = `p.id, p.user_id, p.file_name, p.original_url, p.thumbnail_url, p.caption, p.file_size, p.mime_type, p.width, p.height, p.created_at, p.updated_at,
+	p.taken_at, p.taken_at_offset, p.camera_make, p.camera_model, p.lens_model, p.focal_length, p.f_number, p.exposure_time, p.iso, p.orientation,
+	p.stripped_metadata, p.original_retained, p.content_hash, p.visibility, p.alt_text, p.version, p.like_count`
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// extraScanner scans columns selected after photoColumns into extra.
+type extraScanner struct {
+	row   rowScanner
+	extra []any
+}
+
+func withExtra(row rowScanner, extra ...any) rowScanner {
+	return extraScanner{row: row, extra: extra}
+}
+
+func (s extraScanner) Scan(dest ...any) error {
+	return s.row.Scan(append(dest, s.extra...)...)
+}
+
+func scanPhoto(row rowScanner, photo *models.Photo) error {
 	var thumbnailURL sql.NullString
 	var width, height sql.NullInt32
-
-	err := r.db.QueryRowContext(ctx, query, id).Scan(
+	var takenAt sql.NullTime
+	var takenAtOffset, cameraMake, cameraModel, lensModel, exposureTime sql.NullString
+	var focalLength, fNumber sql.NullFloat64
+	var iso, orientation sql.NullInt32
+	var stripped []byte
+	var contentHash sql.NullString
+
+	err := row.Scan(
 		&photo.ID, &photo.UserID, &photo.FileName, &photo.OriginalURL, &thumbnailURL,
 		&photo.Caption, &photo.FileSize, &photo.MimeType, &width, &height,
-		&photo.CreatedAt, &photo.UpdatedAt)
+		&photo.CreatedAt, &photo.UpdatedAt,
+		&takenAt, &takenAtOffset, &cameraMake, &cameraModel, &lensModel,
+		&focalLength, &fNumber, &exposureTime, &iso, &orientation,
+		&stripped, &photo.OriginalRetained, &contentHash, &photo.Visibility, &photo.AltText, &photo.Version, &photo.LikeCount)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return nil, ErrPhotoNotFound
-		}
-		return nil, err
+		return err
+	}
+	if err := json.Unmarshal(stripped, &photo.StrippedMetadata); err != nil {
+		return err
+	}
+
+	if takenAt.Valid {
+		t := withOffset(takenAt.Time, takenAtOffset.String)
+		photo.TakenAt = &t
+		photo.TakenAtLocal = !takenAtOffset.Valid
+	}
+	exif := models.PhotoExif{
+		CameraMake:   cameraMake.String,
+		CameraModel:  cameraModel.String,
+		LensModel:    lensModel.String,
+		FocalLength:  focalLength.Float64,
+		FNumber:      fNumber.Float64,
+		ExposureTime: exposureTime.String,
+		ISO:          int(iso.Int32),
+		Orientation:  int(orientation.Int32),
+	}
+	if exif != (models.PhotoExif{}) {
+		photo.Exif = &exif
 	}
 
 	if thumbnailURL.Valid {
 		photo.ThumbnailURL = thumbnailURL.String
 	}
+	photo.ContentHash = contentHash.String
 	if width.Valid {
 		photo.Width = int(width.Int32)
 	}
 	if height.Valid {
 		photo.Height = int(height.Int32)
 	}
-
-	return photo, nil
+	return nil
 }
 
-func (r *PostgresPhotoRepo) GetByUserID(ctx context.Context, userID string, page, limit int) ([]models.Photo, int64, error) {
-	countQuery := `SELECT COUNT(*) FROM photos WHERE user_id = $1`
-	var totalCount int64
-	err := r.db.QueryRowContext(ctx, countQuery, userID).Scan(&totalCount)
+// queryPhotos runs a query selecting photoColumns and scans every row.
+func (r *PostgresPhotoRepo) queryPhotos(ctx context.Context, query string, args ...any) ([]models.Photo, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
 	if err != nil {
-		return nil, 0, err
+		return nil, err
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			fmt.Println("failed to close rows", zap.Error(err))
+		}
+	}()
+
+	var photos []models.Photo
+	for rows.Next() {
+		photo := models.Photo{}
+		if err := scanPhoto(rows, &photo); err != nil {
+			return nil, err
+		}
+		photos = append(photos, photo)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := r.attachVariants(ctx, photos); err != nil {
+		return nil, err
+	}
+	if err := r.attachTags(ctx, photos); err != nil {
+		return nil, err
+	}
+
+	return photos, nil
+}
+
+// attachVariants loads the renditions of every photo in one query.
+func (r *PostgresPhotoRepo) attachVariants(ctx context.Context, photos []models.Photo) error {
+	if len(photos) == 0 {
+		return nil
+	}
+	ids := make([]string, len(photos))
+	byID := make(map[string]*models.Photo, len(photos))
+	for i := range photos {
+		ids[i] = photos[i].ID
+		byID[photos[i].ID] = &photos[i]
 	}
 
-	offset := (page - 1) * limit
 	query := `
-		SELECT id, user_id, file_name, original_url, thumbnail_url, caption, file_size, mime_type, width, height, created_at, updated_at
-		FROM photos
-		WHERE user_id = $1
-		ORDER BY created_at DESC
-		LIMIT $2 OFFSET $3
+		SELECT photo_id, url, width, height, bytes, format
+		FROM photo_variants
+		WHERE tenant_id = $1 AND photo_id = ANY($2)
+		ORDER BY photo_id, width
 	`
+	rows, err := r.db.QueryContext(ctx, query, types.TenantID(ctx), ids)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			fmt.Println("failed to close rows", zap.Error(err))
+		}
+	}()
 
-	rows, err := r.db.QueryContext(ctx, query, userID, limit, offset)
+	for rows.Next() {
+		var photoID string
+		var v models.PhotoVariant
+		if err := rows.Scan(&photoID, &v.URL, &v.Width, &v.Height, &v.Bytes, &v.Format); err != nil {
+			return err
+		}
+		if photo, ok := byID[photoID]; ok {
+			photo.Variants = append(photo.Variants, v)
+		}
+	}
+	return rows.Err()
+}
+
+// attachTags loads the tags of every photo in one query.
+func (r *PostgresPhotoRepo) attachTags(ctx context.Context, photos []models.Photo) error {
+	if len(photos) == 0 {
+		return nil
+	}
+	ids := make([]string, len(photos))
+	byID := make(map[string]*models.Photo, len(photos))
+	for i := range photos {
+		ids[i] = photos[i].ID
+		byID[photos[i].ID] = &photos[i]
+	}
+
+	query := `
+		SELECT pt.photo_id, t.name
+		FROM photo_tags pt
+		JOIN tags t ON t.id = pt.tag_id
+		WHERE pt.tenant_id = $1 AND pt.photo_id = ANY($2)
+		ORDER BY pt.photo_id, t.name
+	`
+	rows, err := r.db.QueryContext(ctx, query, types.TenantID(ctx), ids)
 	if err != nil {
-		return nil, 0, err
+		return err
 	}
 	defer func() {
 		if err := rows.Close(); err != nil {
@@ -95,34 +253,171 @@ func (r *PostgresPhotoRepo) GetByUserID(ctx context.Context, userID string, page
 		}
 	}()
 
-	var photos []models.Photo
 	for rows.Next() {
-		photo := models.Photo{}
-		var thumbnailURL sql.NullString
-		var width, height sql.NullInt32
+		var photoID, tag string
+		if err := rows.Scan(&photoID, &tag); err != nil {
+			return err
+		}
+		if photo, ok := byID[photoID]; ok {
+			photo.Tags = append(photo.Tags, tag)
+		}
+	}
+	return rows.Err()
+}
 
-		err := rows.Scan(
-			&photo.ID, &photo.UserID, &photo.FileName, &photo.OriginalURL, &thumbnailURL,
-			&photo.Caption, &photo.FileSize, &photo.MimeType, &width, &height,
-			&photo.CreatedAt, &photo.UpdatedAt)
-		if err != nil {
-			return nil, 0, err
+// setTags replaces the tags of a photo within tx, creating tags the tenant
+// has not used before.
+func setTags(ctx context.Context, tx *sql.Tx, tenantID, photoID string, tags []string) error {
+	if _, err := tx.ExecContext(ctx, `DELETE FROM photo_tags WHERE tenant_id = $1 AND photo_id = $2`, tenantID, photoID); err != nil {
+		return err
+	}
+	if len(tags) == 0 {
+		return nil
+	}
+
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO tags (tenant_id, name)
+		SELECT $1, unnest($2::text[])
+		ON CONFLICT (tenant_id, name) DO NOTHING
+	`, tenantID, tags)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO photo_tags (photo_id, tag_id, tenant_id)
+		SELECT $2, id, $1 FROM tags WHERE tenant_id = $1 AND name = ANY($3)
+	`, tenantID, photoID, tags)
+	return err
+}
+
+func (r *PostgresPhotoRepo) Create(ctx context.Context, photo *models.Photo) error {
+	photo.TenantID = types.TenantID(ctx)
+	if photo.Visibility == "" {
+		photo.Visibility = models.VisibilityPublic
+	}
+	if photo.Version == 0 {
+		photo.Version = 1
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	query := `
+		INSERT INTO photos (id, tenant_id, user_id, file_name, original_url, thumbnail_url, caption, file_size, mime_type, width, height, created_at, updated_at,
+		                    taken_at, taken_at_offset, camera_make, camera_model, lens_model, focal_length, f_number, exposure_time, iso, orientation,
+		                    stripped_metadata, original_retained, content_hash, visibility, alt_text, version)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21, $22, $23, $24, $25, $26, $27, $28, $29)
+	`
+	stripped, err := json.Marshal(textArray(photo.StrippedMetadata))
+	if err != nil {
+		return err
+	}
+	args := []any{
+		photo.ID, photo.TenantID, photo.UserID, photo.FileName, photo.OriginalURL, photo.ThumbnailURL,
+		photo.Caption, photo.FileSize, photo.MimeType, photo.Width, photo.Height,
+		photo.CreatedAt, photo.UpdatedAt,
+	}
+	args = append(args, exifArgs(photo)...)
+	_, err = tx.ExecContext(ctx, query, append(args, stripped, photo.OriginalRetained, nullString(photo.ContentHash), photo.Visibility, photo.AltText, photo.Version)...)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return ErrPhotoExists
 		}
+		return err
+	}
 
-		if thumbnailURL.Valid {
-			photo.ThumbnailURL = thumbnailURL.String
+	variantQuery := `
+		INSERT INTO photo_variants (photo_id, tenant_id, width, height, bytes, format, url)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`
+	for _, v := range photo.Variants {
+		_, err := tx.ExecContext(ctx, variantQuery,
+			photo.ID, photo.TenantID, v.Width, v.Height, v.Bytes, v.Format, v.URL)
+		if err != nil {
+			return err
 		}
-		if width.Valid {
-			photo.Width = int(width.Int32)
+	}
+	if err := setTags(ctx, tx, photo.TenantID, photo.ID, photo.Tags); err != nil {
+		return err
+	}
+	if err := r.indexPhoto(ctx, tx, photo.TenantID, photo.ID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (r *PostgresPhotoRepo) GetByID(ctx context.Context, id string) (*models.Photo, error) {
+	query := `SELECT ` + photoColumns + ` FROM photos p WHERE p.tenant_id = $1 AND p.id = $2`
+	photo := &models.Photo{}
+	err := scanPhoto(r.db.QueryRowContext(ctx, query, types.TenantID(ctx), id), photo)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrPhotoNotFound
 		}
-		if height.Valid {
-			photo.Height = int(height.Int32)
+		return nil, err
+	}
+
+	photos := []models.Photo{*photo}
+	if err := r.attachVariants(ctx, photos); err != nil {
+		return nil, err
+	}
+	if err := r.attachTags(ctx, photos); err != nil {
+		return nil, err
+	}
+
+	return &photos[0], nil
+}
+
+func (r *PostgresPhotoRepo) GetByContentHash(ctx context.Context, userID, hash string) (*models.Photo, error) {
+	query := `SELECT ` + photoColumns + ` FROM photos p WHERE p.tenant_id = $1 AND p.user_id = $2 AND p.content_hash = $3`
+	photo := &models.Photo{}
+	err := scanPhoto(r.db.QueryRowContext(ctx, query, types.TenantID(ctx), userID, hash), photo)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrPhotoNotFound
 		}
+		return nil, err
+	}
 
-		photos = append(photos, photo)
+	photos := []models.Photo{*photo}
+	if err := r.attachVariants(ctx, photos); err != nil {
+		return nil, err
+	}
+	if err := r.attachTags(ctx, photos); err != nil {
+		return nil, err
 	}
 
-	if err = rows.Err(); err != nil {
+	return &photos[0], nil
+}
+
+func (r *PostgresPhotoRepo) GetByUserID(ctx context.Context, userID string, filter PhotoFilter, page, limit int) ([]models.Photo, int64, error) {
+	args := []any{types.TenantID(ctx), userID}
+	where := `p.tenant_id = $1 AND p.user_id = $2` + filterClause(filter, &args)
+
+	countQuery := `SELECT COUNT(*) FROM photos p WHERE ` + where
+	var totalCount int64
+	err := r.db.QueryRowContext(ctx, countQuery, args...).Scan(&totalCount)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	offset := (page - 1) * limit
+	query := fmt.Sprintf(`
+		SELECT `+photoColumns+`
+		FROM photos p
+		WHERE %s
+		ORDER BY %s
+		LIMIT $%d OFFSET $%d
+	`, where, orderClause(filter.Sort), len(args)+1, len(args)+2)
+
+	photos, err := r.queryPhotos(ctx, query, append(args, limit, offset)...)
+	if err != nil {
 		return nil, 0, err
 	}
 
@@ -133,13 +428,33 @@ func (r *PostgresPhotoRepo) Update(ctx context.Context, photo *models.Photo) err
 	query := `
 		UPDATE photos
 		SET file_name = $2, original_url = $3, thumbnail_url = $4, caption = $5,
-		    file_size = $6, mime_type = $7, width = $8, height = $9, updated_at = $10
-		WHERE id = $1
+		    file_size = $6, mime_type = $7, width = $8, height = $9, updated_at = $10,
+		    taken_at = $12, taken_at_offset = $13, camera_make = $14, camera_model = $15, lens_model = $16,
+		    focal_length = $17, f_number = $18, exposure_time = $19, iso = $20, orientation = $21,
+		    stripped_metadata = $22, original_retained = $23, visibility = $24, alt_text = $25,
+		    version = version + 1
+		WHERE id = $1 AND tenant_id = $11 AND version = $26
 	`
-	result, err := r.db.ExecContext(ctx, query,
+	stripped, err := json.Marshal(textArray(photo.StrippedMetadata))
+	if err != nil {
+		return err
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	args := []any{
 		photo.ID, photo.FileName, photo.OriginalURL, photo.ThumbnailURL,
 		photo.Caption, photo.FileSize, photo.MimeType, photo.Width, photo.Height,
-		photo.UpdatedAt)
+		photo.UpdatedAt, types.TenantID(ctx),
+	}
+	args = append(args, exifArgs(photo)...)
+	result, err := tx.ExecContext(ctx, query, append(args, stripped, photo.OriginalRetained, photo.Visibility, photo.AltText, photo.Version)...)
 	if err != nil {
 		return err
 	}
@@ -150,75 +465,429 @@ func (r *PostgresPhotoRepo) Update(ctx context.Context, photo *models.Photo) err
 	}
 
 	if rowsAffected == 0 {
+		// Tell a stale version apart from a missing photo.
+		var exists bool
+		err := tx.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM photos WHERE tenant_id = $1 AND id = $2)`,
+			types.TenantID(ctx), photo.ID).Scan(&exists)
+		if err != nil {
+			return err
+		}
+		if exists {
+			return ErrPhotoVersionConflict
+		}
 		return ErrPhotoNotFound
 	}
+	if err := setTags(ctx, tx, types.TenantID(ctx), photo.ID, photo.Tags); err != nil {
+		return err
+	}
+	if err := r.indexPhoto(ctx, tx, types.TenantID(ctx), photo.ID); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
 
+	photo.Version++
 	return nil
 }
 
-func (r *PostgresPhotoRepo) GetAll(ctx context.Context, page, limit int) ([]models.Photo, int64, error) {
-	countQuery := `SELECT COUNT(*) FROM photos`
+func (r *PostgresPhotoRepo) GetAll(ctx context.Context, filter PhotoFilter, page, limit int) ([]models.Photo, int64, error) {
+	args := []any{types.TenantID(ctx)}
+	where := `p.tenant_id = $1 AND p.visibility = 'public'` + filterClause(filter, &args)
+
+	countQuery := `SELECT COUNT(*) FROM photos p WHERE ` + where
 	var totalCount int64
-	err := r.db.QueryRowContext(ctx, countQuery).Scan(&totalCount)
+	err := r.db.QueryRowContext(ctx, countQuery, args...).Scan(&totalCount)
 	if err != nil {
 		return nil, 0, err
 	}
 
 	offset := (page - 1) * limit
+	query := fmt.Sprintf(`
+		SELECT `+photoColumns+`
+		FROM photos p
+		WHERE %s
+		ORDER BY %s
+		LIMIT $%d OFFSET $%d
+	`, where, orderClause(filter.Sort), len(args)+1, len(args)+2)
+
+	photos, err := r.queryPhotos(ctx, query, append(args, limit, offset)...)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return photos, totalCount, nil
+}
+
+func (r *PostgresPhotoRepo) GetAllAfter(ctx context.Context, filter PhotoFilter, cursor *FeedCursor, limit int) ([]models.Photo, error) {
+	args := []any{types.TenantID(ctx)}
+	where := `p.tenant_id = $1 AND p.visibility = 'public'` + filterClause(filter, &args)
+	return r.queryAfter(ctx, where, args, cursor, limit)
+}
+
+func (r *PostgresPhotoRepo) GetByUserIDAfter(ctx context.Context, userID string, filter PhotoFilter, cursor *FeedCursor, limit int) ([]models.Photo, error) {
+	args := []any{types.TenantID(ctx), userID}
+	where := `p.tenant_id = $1 AND p.user_id = $2` + filterClause(filter, &args)
+	return r.queryAfter(ctx, where, args, cursor, limit)
+}
+
+// queryAfter lists up to limit photos matching where, newest first,
+// strictly after cursor. The row comparison walks the (created_at DESC,
+// id DESC) indexes without counting or skipping rows.
+func (r *PostgresPhotoRepo) queryAfter(ctx context.Context, where string, args []any, cursor *FeedCursor, limit int) ([]models.Photo, error) {
+	if cursor != nil {
+		args = append(args, cursor.CreatedAt, cursor.ID)
+		where += fmt.Sprintf(` AND (p.created_at, p.id) < ($%d, $%d)`, len(args)-1, len(args))
+	}
+	query := fmt.Sprintf(`
+		SELECT `+photoColumns+`
+		FROM photos p
+		WHERE %s
+		ORDER BY p.created_at DESC, p.id DESC
+		LIMIT $%d
+	`, where, len(args)+1)
+
+	photos, err := r.queryPhotos(ctx, query, append(args, limit)...)
+	if err != nil {
+		return nil, err
+	}
+	if photos == nil {
+		photos = []models.Photo{}
+	}
+	return photos, nil
+}
+
+// EstimateCount reads the planner's row estimate instead of counting, so
+// it costs the same however many photos match. It is only as good as the
+// table statistics.
+func (r *PostgresPhotoRepo) EstimateCount(ctx context.Context, userID string, filter PhotoFilter) (int64, error) {
+	args := []any{types.TenantID(ctx)}
+	where := `p.tenant_id = $1 AND p.visibility = 'public'`
+	if userID != "" {
+		args = append(args, userID)
+		where = `p.tenant_id = $1 AND p.user_id = $2`
+	}
+	where += filterClause(filter, &args)
+
+	var plan []byte
+	err := r.db.QueryRowContext(ctx, `EXPLAIN (FORMAT JSON) SELECT 1 FROM photos p WHERE `+where, args...).Scan(&plan)
+	if err != nil {
+		return 0, err
+	}
+	var explained []struct {
+		Plan struct {
+			Rows float64 `json:"Plan Rows"`
+		} `json:"Plan"`
+	}
+	if err := json.Unmarshal(plan, &explained); err != nil {
+		return 0, fmt.Errorf("parse query plan: %w", err)
+	}
+	if len(explained) == 0 {
+		return 0, errors.New("parse query plan: empty plan")
+	}
+	return int64(explained[0].Plan.Rows), nil
+}
+
+// GetFollowingFeed walks each followed account's (user_id, created_at, id)
+// index with a LATERAL subquery capped at limit rows, then merges. Work is
+// bounded by follows*limit index entries instead of every photo the followed
+// accounts ever posted.
+func (r *PostgresPhotoRepo) GetFollowingFeed(ctx context.Context, followerID string, cursor *FeedCursor, limit int) ([]models.Photo, error) {
+	var after any
+	var afterID string
+	if cursor != nil {
+		after, afterID = cursor.CreatedAt, cursor.ID
+	}
+
 	query := `
-		SELECT id, user_id, file_name, original_url, thumbnail_url, caption, file_size, mime_type, width, height, created_at, updated_at
-		FROM photos
-		ORDER BY created_at DESC
-		LIMIT $1 OFFSET $2
+		SELECT ` + photoColumns + `
+		FROM follows f
+		CROSS JOIN LATERAL (
+			SELECT *
+			FROM photos ph
+			WHERE ph.tenant_id = f.tenant_id
+			  AND ph.user_id = f.followee_id
+			  AND ph.visibility = 'public'
+			  AND ($3::timestamptz IS NULL OR (ph.created_at, ph.id) < ($3::timestamptz, $4))
+			ORDER BY ph.created_at DESC, ph.id DESC
+			LIMIT $5
+		) p
+		WHERE f.tenant_id = $1 AND f.follower_id = $2
+		ORDER BY p.created_at DESC, p.id DESC
+		LIMIT $5
 	`
 
-	rows, err := r.db.QueryContext(ctx, query, limit, offset)
+	photos, err := r.queryPhotos(ctx, query, types.TenantID(ctx), followerID, after, afterID, limit)
+	if err != nil {
+		return nil, err
+	}
+	if photos == nil {
+		photos = []models.Photo{}
+	}
+	return photos, nil
+}
+
+func (r *PostgresPhotoRepo) GetByAlbum(ctx context.Context, albumID string, includePrivate bool, page, limit int) ([]models.Photo, int64, error) {
+	args := []any{types.TenantID(ctx), albumID, includePrivate}
+	from := `
+		FROM album_photos ap
+		JOIN photos p ON p.tenant_id = ap.tenant_id AND p.id = ap.photo_id
+		WHERE ap.tenant_id = $1 AND ap.album_id = $2 AND ($3 OR p.visibility <> 'private')
+	`
+
+	var totalCount int64
+	err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) `+from, args...).Scan(&totalCount)
 	if err != nil {
 		return nil, 0, err
 	}
+
+	offset := (page - 1) * limit
+	query := `SELECT ` + photoColumns + from + `
+		ORDER BY ap.position, ap.added_at
+		LIMIT $4 OFFSET $5
+	`
+	photos, err := r.queryPhotos(ctx, query, append(args, limit, offset)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	if photos == nil {
+		photos = []models.Photo{}
+	}
+
+	return photos, totalCount, nil
+}
+
+func (r *PostgresPhotoRepo) GetTags(ctx context.Context, prefix string, limit int) ([]models.TagCount, error) {
+	query := `
+		SELECT t.name, COUNT(*)
+		FROM tags t
+		JOIN photo_tags pt ON pt.tag_id = t.id
+		JOIN photos p ON p.id = pt.photo_id
+		WHERE t.tenant_id = $1 AND t.name LIKE $2 ESCAPE '\' AND p.visibility = 'public'
+		GROUP BY t.name
+		ORDER BY COUNT(*) DESC, t.name
+		LIMIT $3
+	`
+	rows, err := r.db.QueryContext(ctx, query, types.TenantID(ctx), likePrefix(prefix), limit)
+	if err != nil {
+		return nil, err
+	}
 	defer func() {
 		if err := rows.Close(); err != nil {
 			fmt.Println("failed to close rows", zap.Error(err))
 		}
 	}()
 
-	var photos []models.Photo
+	tags := []models.TagCount{}
 	for rows.Next() {
-		photo := models.Photo{}
-		var thumbnailURL sql.NullString
-		var width, height sql.NullInt32
+		var tag models.TagCount
+		if err := rows.Scan(&tag.Tag, &tag.Count); err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+	return tags, rows.Err()
+}
 
-		err := rows.Scan(
-			&photo.ID, &photo.UserID, &photo.FileName, &photo.OriginalURL, &thumbnailURL,
-			&photo.Caption, &photo.FileSize, &photo.MimeType, &width, &height,
-			&photo.CreatedAt, &photo.UpdatedAt)
-		if err != nil {
-			return nil, 0, err
+// Search matches query as websearch_to_tsquery parses it ("quoted
+// phrases", or, -excluded) and ranks with ts_rank_cd. Highlights come from
+// ts_headline over the caption.
+func (r *PostgresPhotoRepo) Search(ctx context.Context, query, viewerID string, cursor *SearchCursor, limit int) ([]models.PhotoSearchHit, error) {
+	var afterRank any
+	var afterID string
+	if cursor != nil {
+		afterRank, afterID = cursor.Rank, cursor.ID
+	}
+
+	q := `
+		WITH q AS (SELECT websearch_to_tsquery($1::regconfig, $2) AS query)
+		SELECT ` + photoColumns + `, s.rank,
+			CASE WHEN to_tsvector($1::regconfig, coalesce(p.caption, '')) @@ q.query
+				THEN ts_headline($1::regconfig, p.caption, q.query, 'StartSel=<mark>, StopSel=</mark>, HighlightAll=true')
+				ELSE '' END
+		FROM photos p
+		CROSS JOIN q
+		CROSS JOIN LATERAL (SELECT ts_rank_cd(p.search_vector, q.query)::float8 AS rank) s
+		WHERE p.tenant_id = $3
+		  AND p.search_vector @@ q.query
+		  AND (p.visibility = 'public' OR p.user_id = $4)
+		  AND ($5::float8 IS NULL OR (s.rank, p.id) < ($5::float8, $6))
+		ORDER BY s.rank DESC, p.id DESC
+		LIMIT $7
+	`
+	rows, err := r.db.QueryContext(ctx, q, r.searchConfig, query, types.TenantID(ctx), viewerID, afterRank, afterID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			fmt.Println("failed to close rows", zap.Error(err))
 		}
+	}()
 
-		if thumbnailURL.Valid {
-			photo.ThumbnailURL = thumbnailURL.String
+	var photos []models.Photo
+	hits := []models.PhotoSearchHit{}
+	for rows.Next() {
+		var hit models.PhotoSearchHit
+		if err := scanPhoto(withExtra(rows, &hit.Rank, &hit.Highlight), &hit.Photo); err != nil {
+			return nil, err
 		}
-		if width.Valid {
-			photo.Width = int(width.Int32)
+		photos = append(photos, hit.Photo)
+		hits = append(hits, hit)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := r.attachVariants(ctx, photos); err != nil {
+		return nil, err
+	}
+	if err := r.attachTags(ctx, photos); err != nil {
+		return nil, err
+	}
+	for i := range hits {
+		hits[i].Photo = photos[i]
+	}
+	return hits, nil
+}
+
+// Like inserts the like and bumps the counter in one transaction; the
+// counter's row lock orders concurrent likes of the same photo.
+func (r *PostgresPhotoRepo) Like(ctx context.Context, photoID, userID string) (int64, bool, error) {
+	return r.changeLike(ctx, photoID, `
+		INSERT INTO photo_likes (photo_id, user_id, tenant_id, created_at)
+		SELECT id, $3, tenant_id, now() FROM photos WHERE tenant_id = $1 AND id = $2
+		ON CONFLICT (photo_id, user_id) DO NOTHING
+	`, userID)
+}
+
+func (r *PostgresPhotoRepo) Unlike(ctx context.Context, photoID, userID string) (int64, bool, error) {
+	return r.changeLike(ctx, photoID, `
+		DELETE FROM photo_likes WHERE tenant_id = $1 AND photo_id = $2 AND user_id = $3
+	`, userID)
+}
+
+// changeLike runs stmt and returns the photo's like count after it, which
+// a trigger on photo_likes keeps up to date, and whether stmt changed a
+// row.
+func (r *PostgresPhotoRepo) changeLike(ctx context.Context, photoID, stmt, userID string) (int64, bool, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, false, err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	tenantID := types.TenantID(ctx)
+	result, err := tx.ExecContext(ctx, stmt, tenantID, photoID, userID)
+	if err != nil {
+		return 0, false, err
+	}
+	changed, err := result.RowsAffected()
+	if err != nil {
+		return 0, false, err
+	}
+
+	var count int64
+	err = tx.QueryRowContext(ctx, `SELECT like_count FROM photos WHERE tenant_id = $1 AND id = $2`, tenantID, photoID).Scan(&count)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return 0, false, ErrPhotoNotFound
+		}
+		return 0, false, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, false, err
+	}
+	return count, changed > 0, nil
+}
+
+func (r *PostgresPhotoRepo) LikedPhotoIDs(ctx context.Context, userID string, photoIDs []string) (map[string]bool, error) {
+	liked := make(map[string]bool)
+	if userID == "" || len(photoIDs) == 0 {
+		return liked, nil
+	}
+
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT photo_id FROM photo_likes
+		WHERE tenant_id = $1 AND user_id = $2 AND photo_id = ANY($3)
+	`, types.TenantID(ctx), userID, photoIDs)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			fmt.Println("failed to close rows", zap.Error(err))
 		}
-		if height.Valid {
-			photo.Height = int(height.Int32)
+	}()
+
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
 		}
+		liked[id] = true
+	}
+	return liked, rows.Err()
+}
 
-		photos = append(photos, photo)
+func (r *PostgresPhotoRepo) GetLikes(ctx context.Context, userID string, cursor *FeedCursor, limit int) ([]models.PhotoLike, error) {
+	var after any
+	var afterID string
+	if cursor != nil {
+		after, afterID = cursor.CreatedAt, cursor.ID
 	}
 
-	if err = rows.Err(); err != nil {
-		return nil, 0, err
+	q := `
+		SELECT ` + photoColumns + `, l.created_at
+		FROM photo_likes l
+		JOIN photos p ON p.id = l.photo_id AND p.tenant_id = l.tenant_id
+		WHERE l.tenant_id = $1 AND l.user_id = $2
+		  AND (p.visibility <> 'private' OR p.user_id = $2)
+		  AND ($3::timestamptz IS NULL OR (l.created_at, l.photo_id) < ($3::timestamptz, $4))
+		ORDER BY l.created_at DESC, l.photo_id DESC
+		LIMIT $5
+	`
+	rows, err := r.db.QueryContext(ctx, q, types.TenantID(ctx), userID, after, afterID, limit)
+	if err != nil {
+		return nil, err
 	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			fmt.Println("failed to close rows", zap.Error(err))
+		}
+	}()
 
-	return photos, totalCount, nil
+	var photos []models.Photo
+	likes := []models.PhotoLike{}
+	for rows.Next() {
+		var like models.PhotoLike
+		if err := scanPhoto(withExtra(rows, &like.LikedAt), &like.Photo); err != nil {
+			return nil, err
+		}
+		photos = append(photos, like.Photo)
+		likes = append(likes, like)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := r.attachVariants(ctx, photos); err != nil {
+		return nil, err
+	}
+	if err := r.attachTags(ctx, photos); err != nil {
+		return nil, err
+	}
+	for i := range likes {
+		likes[i].Photo = photos[i]
+	}
+	return likes, nil
 }
 
 func (r *PostgresPhotoRepo) Delete(ctx context.Context, id string) error {
-	query := `DELETE FROM photos WHERE id = $1`
-	result, err := r.db.ExecContext(ctx, query, id)
+	query := `DELETE FROM photos WHERE tenant_id = $1 AND id = $2`
+	result, err := r.db.ExecContext(ctx, query, types.TenantID(ctx), id)
 	if err != nil {
 		return err
 	}
@@ -234,3 +903,109 @@ func (r *PostgresPhotoRepo) Delete(ctx context.Context, id string) error {
 
 	return nil
 }
+
+// filterClause renders filter as additional AND conditions on the p alias,
+// appending its parameters to args.
+func filterClause(filter PhotoFilter, args *[]any) string {
+	var b strings.Builder
+	add := func(cond string, v any) {
+		*args = append(*args, v)
+		fmt.Fprintf(&b, " AND "+cond, len(*args))
+	}
+	if filter.Visibility != "" {
+		add("p.visibility = $%d", string(filter.Visibility))
+	}
+	if filter.MimeType != "" {
+		add("lower(p.mime_type) = lower($%d)", filter.MimeType)
+	}
+	if filter.CameraMake != "" {
+		add("lower(p.camera_make) = lower($%d)", filter.CameraMake)
+	}
+	if filter.CameraModel != "" {
+		add("lower(p.camera_model) = lower($%d)", filter.CameraModel)
+	}
+	if filter.LensModel != "" {
+		add("lower(p.lens_model) = lower($%d)", filter.LensModel)
+	}
+	if filter.MinISO > 0 {
+		add("p.iso >= $%d", filter.MinISO)
+	}
+	if filter.MaxISO > 0 {
+		add("p.iso <= $%d", filter.MaxISO)
+	}
+	if filter.Tag != "" {
+		add(`EXISTS (
+			SELECT 1 FROM photo_tags pt JOIN tags t ON t.id = pt.tag_id
+			WHERE pt.photo_id = p.id AND t.tenant_id = p.tenant_id AND t.name = $%d)`, filter.Tag)
+	}
+	if !filter.TakenAfter.IsZero() {
+		add("p.taken_at >= $%d", filter.TakenAfter)
+	}
+	if !filter.TakenBefore.IsZero() {
+		add("p.taken_at < $%d", filter.TakenBefore)
+	}
+	if !filter.CreatedAfter.IsZero() {
+		add("p.created_at >= $%d", filter.CreatedAfter)
+	}
+	if !filter.CreatedBefore.IsZero() {
+		add("p.created_at < $%d", filter.CreatedBefore)
+	}
+	return b.String()
+}
+
+// likePrefix turns prefix into a LIKE pattern matching strings that start
+// with it, escaping LIKE's wildcards.
+func likePrefix(prefix string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(prefix) + "%"
+}
+
+func orderClause(order PhotoSort) string {
+	if order == SortTakenAt {
+		return "p.taken_at DESC NULLS LAST, p.created_at DESC, p.id DESC"
+	}
+	return "p.created_at DESC, p.id DESC"
+}
+
+// exifArgs returns the taken_at through orientation column values for photo.
+// The capture offset is stored separately because timestamptz keeps only
+// the instant, and is NULL when the camera did not record one.
+func exifArgs(photo *models.Photo) []any {
+	var takenAt, offset any
+	if photo.TakenAt != nil {
+		takenAt = *photo.TakenAt
+		if !photo.TakenAtLocal {
+			offset = photo.TakenAt.Format("-07:00")
+		}
+	}
+	var exif models.PhotoExif
+	if photo.Exif != nil {
+		exif = *photo.Exif
+	}
+	return []any{
+		takenAt, offset,
+		nullString(exif.CameraMake), nullString(exif.CameraModel), nullString(exif.LensModel),
+		nullFloat(exif.FocalLength), nullFloat(exif.FNumber), nullString(exif.ExposureTime),
+		nullInt(exif.ISO), nullInt(exif.Orientation),
+	}
+}
+
+// withOffset shows t in the zone it was captured in.
+func withOffset(t time.Time, offset string) time.Time {
+	if zoned, err := time.Parse("-07:00", offset); err == nil {
+		_, secs := zoned.Zone()
+		return t.In(time.FixedZone("", secs))
+	}
+	return t.UTC()
+}
+
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+func nullFloat(f float64) sql.NullFloat64 {
+	return sql.NullFloat64{Float64: f, Valid: f != 0}
+}
+
+func nullInt(n int) sql.NullInt32 {
+	return sql.NullInt32{Int32: int32(n), Valid: n != 0}
+}
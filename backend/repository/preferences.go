@@ -0,0 +1,16 @@
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"nunoo.co/backend/models"
+)
+
+var ErrPreferencesNotFound = errors.New("preferences not found")
+
+// PreferencesRepository stores one preferences document per user.
+type PreferencesRepository interface {
+	Get(ctx context.Context, userID string) (*models.Preferences, error)
+	Put(ctx context.Context, userID string, prefs *models.Preferences) error
+}
@@ -0,0 +1,47 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+
+	"nunoo.co/backend/models"
+)
+
+// MemoryPreferencesRepo keeps documents serialized so reads go through the
+// same decode and upgrade path as the Postgres implementation.
+type MemoryPreferencesRepo struct {
+	mu    sync.RWMutex
+	prefs map[string][]byte
+}
+
+func NewMemoryPreferencesRepo() *MemoryPreferencesRepo {
+	return &MemoryPreferencesRepo{
+		prefs: make(map[string][]byte),
+	}
+}
+
+func (r *MemoryPreferencesRepo) Get(ctx context.Context, userID string) (*models.Preferences, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	data, exists := r.prefs[tenantKey(ctx, userID)]
+	if !exists {
+		return nil, ErrPreferencesNotFound
+	}
+
+	return models.DecodePreferences(data)
+}
+
+func (r *MemoryPreferencesRepo) Put(ctx context.Context, userID string, prefs *models.Preferences) error {
+	data, err := json.Marshal(prefs)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.prefs[tenantKey(ctx, userID)] = data
+	return nil
+}
@@ -0,0 +1,50 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+
+	"nunoo.co/backend/models"
+	"nunoo.co/backend/types"
+)
+
+type PostgresPreferencesRepo struct {
+	db *sql.DB
+}
+
+func NewPostgresPreferencesRepo(db *sql.DB) *PostgresPreferencesRepo {
+	return &PostgresPreferencesRepo{db: db}
+}
+
+func (r *PostgresPreferencesRepo) Get(ctx context.Context, userID string) (*models.Preferences, error) {
+	query := `SELECT data FROM user_preferences WHERE tenant_id = $1 AND user_id = $2`
+	var data []byte
+	err := r.db.QueryRowContext(ctx, query, types.TenantID(ctx), userID).Scan(&data)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrPreferencesNotFound
+		}
+		return nil, err
+	}
+
+	return models.DecodePreferences(data)
+}
+
+func (r *PostgresPreferencesRepo) Put(ctx context.Context, userID string, prefs *models.Preferences) error {
+	data, err := json.Marshal(prefs)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO user_preferences (tenant_id, user_id, version, data, updated_at)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (tenant_id, user_id)
+		DO UPDATE SET version = EXCLUDED.version, data = EXCLUDED.data, updated_at = EXCLUDED.updated_at
+	`
+	_, err = r.db.ExecContext(ctx, query,
+		types.TenantID(ctx), userID, prefs.Version, data, prefs.UpdatedAt)
+	return err
+}
@@ -0,0 +1,141 @@
+package repository
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+	"nunoo.co/backend/models"
+)
+
+// Field weights, matching the Postgres ts_rank defaults for the A, B and C
+// labels the search vector gives captions, tags and camera metadata.
+const (
+	captionWeight = 1.0
+	tagWeight     = 0.4
+	cameraWeight  = 0.2
+)
+
+var termFolder = cases.Fold()
+
+// searchIndex is the in-memory stand-in for the Postgres search vector: an
+// inverted index from each word of a photo's caption, tags and camera
+// metadata to the photos containing it. It does not stem or drop stop
+// words. The owning repo's lock guards it.
+type searchIndex struct {
+	postings map[string]map[string]float64 // term -> photo ID -> weight
+	terms    map[string][]string           // photo ID -> its terms
+}
+
+func newSearchIndex() *searchIndex {
+	return &searchIndex{
+		postings: make(map[string]map[string]float64),
+		terms:    make(map[string][]string),
+	}
+}
+
+// put indexes photo, replacing what was indexed for it before.
+func (idx *searchIndex) put(photo *models.Photo) {
+	idx.remove(photo.ID)
+
+	weights := make(map[string]float64)
+	add := func(text string, weight float64) {
+		for _, term := range searchTerms(text) {
+			if weights[term] < weight {
+				weights[term] = weight
+			}
+		}
+	}
+	add(photo.Caption, captionWeight)
+	add(strings.Join(photo.Tags, " "), tagWeight)
+	if photo.Exif != nil {
+		add(photo.Exif.CameraMake+" "+photo.Exif.CameraModel+" "+photo.Exif.LensModel, cameraWeight)
+	}
+
+	for term, weight := range weights {
+		if idx.postings[term] == nil {
+			idx.postings[term] = make(map[string]float64)
+		}
+		idx.postings[term][photo.ID] = weight
+		idx.terms[photo.ID] = append(idx.terms[photo.ID], term)
+	}
+}
+
+func (idx *searchIndex) remove(photoID string) {
+	for _, term := range idx.terms[photoID] {
+		delete(idx.postings[term], photoID)
+		if len(idx.postings[term]) == 0 {
+			delete(idx.postings, term)
+		}
+	}
+	delete(idx.terms, photoID)
+}
+
+// match returns the photos containing every term with their rank, the sum
+// of each term's weight.
+func (idx *searchIndex) match(terms []string) map[string]float64 {
+	if len(terms) == 0 {
+		return nil
+	}
+	ranks := make(map[string]float64)
+	for id, weight := range idx.postings[terms[0]] {
+		ranks[id] = weight
+	}
+	for _, term := range terms[1:] {
+		postings := idx.postings[term]
+		for id := range ranks {
+			weight, ok := postings[id]
+			if !ok {
+				delete(ranks, id)
+				continue
+			}
+			ranks[id] += weight
+		}
+	}
+	return ranks
+}
+
+// searchTerms splits text into normalized, case-folded words.
+func searchTerms(text string) []string {
+	folded := norm.NFKC.String(termFolder.String(norm.NFKC.String(text)))
+	return strings.FieldsFunc(folded, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// highlightTerms wraps the words of text found in terms in <mark>, or
+// returns "" when none is.
+func highlightTerms(text string, terms map[string]bool) string {
+	var b strings.Builder
+	marked := false
+	word := -1
+	flush := func(end int) {
+		if word < 0 {
+			return
+		}
+		w := text[word:end]
+		if t := searchTerms(w); len(t) == 1 && terms[t[0]] {
+			b.WriteString("<mark>" + w + "</mark>")
+			marked = true
+		} else {
+			b.WriteString(w)
+		}
+		word = -1
+	}
+	for i, r := range text {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.Is(unicode.Mn, r) {
+			if word < 0 {
+				word = i
+			}
+			continue
+		}
+		flush(i)
+		b.WriteRune(r)
+	}
+	flush(len(text))
+	if !marked {
+		return ""
+	}
+	return b.String()
+}
@@ -0,0 +1,42 @@
+package repository
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type MemoryTokenRevocationRepo struct {
+	mu      sync.RWMutex
+	revoked map[string]time.Time
+}
+
+func NewMemoryTokenRevocationRepo() *MemoryTokenRevocationRepo {
+	return &MemoryTokenRevocationRepo{
+		revoked: make(map[string]time.Time),
+	}
+}
+
+func (r *MemoryTokenRevocationRepo) Revoke(ctx context.Context, jti string, expiresAt time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// Drop entries for tokens that can no longer be used anyway
+	now := time.Now()
+	for id, exp := range r.revoked {
+		if exp.Before(now) {
+			delete(r.revoked, id)
+		}
+	}
+
+	r.revoked[jti] = expiresAt
+	return nil
+}
+
+func (r *MemoryTokenRevocationRepo) IsRevoked(ctx context.Context, jti string) (bool, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	_, revoked := r.revoked[jti]
+	return revoked, nil
+}
@@ -0,0 +1,39 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+type PostgresTokenRevocationRepo struct {
+	db *sql.DB
+}
+
+func NewPostgresTokenRevocationRepo(db *sql.DB) *PostgresTokenRevocationRepo {
+	return &PostgresTokenRevocationRepo{db: db}
+}
+
+func (r *PostgresTokenRevocationRepo) Revoke(ctx context.Context, jti string, expiresAt time.Time) error {
+	query := `
+		INSERT INTO revoked_tokens (jti, expires_at, revoked_at)
+		VALUES ($1, $2, now())
+		ON CONFLICT (jti) DO NOTHING
+	`
+	if _, err := r.db.ExecContext(ctx, query, jti, expiresAt.UTC()); err != nil {
+		return err
+	}
+
+	// Opportunistically purge rows for tokens that have expired on their own
+	_, err := r.db.ExecContext(ctx, `DELETE FROM revoked_tokens WHERE expires_at < now()`)
+	return err
+}
+
+func (r *PostgresTokenRevocationRepo) IsRevoked(ctx context.Context, jti string) (bool, error) {
+	var revoked bool
+	err := r.db.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM revoked_tokens WHERE jti = $1)`, jti).Scan(&revoked)
+	if err != nil {
+		return false, err
+	}
+	return revoked, nil
+}
@@ -0,0 +1,84 @@
+// Package storage stores uploaded files as objects addressed by
+// slash-separated keys, on the local filesystem or in an S3-compatible
+// bucket, so several replicas can share one set of files.
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"path"
+	"strings"
+	"time"
+)
+
+var (
+	ErrNotFound     = errors.New("object not found")
+	ErrInvalidKey   = errors.New("invalid object key")
+	ErrInvalidRange = errors.New("range not satisfiable")
+)
+
+// Storage is a flat key/value store of files.
+type Storage interface {
+	// Put streams r to key, replacing any existing object once the whole body
+	// has been written. size is the length of r, or -1 when unknown.
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	// Get opens key, or the part of it rng selects when rng is non-nil.
+	// Callers must close the returned body.
+	Get(ctx context.Context, key string, rng *Range) (*Object, error)
+	// Stat describes key without reading it.
+	Stat(ctx context.Context, key string) (*ObjectInfo, error)
+	// Delete removes key. Deleting a missing key is not an error.
+	Delete(ctx context.Context, key string) error
+	// List describes every object whose key starts with prefix, in key order.
+	List(ctx context.Context, prefix string) ([]ObjectInfo, error)
+}
+
+type ObjectInfo struct {
+	Key         string
+	Size        int64
+	ContentType string
+	ModTime     time.Time
+	// ETag identifies this version of the object, quoted as in HTTP.
+	ETag string
+}
+
+// Object is an open object. Size in ObjectInfo is always the size of the
+// whole object; Range is the part Body holds, nil when it holds all of it.
+type Object struct {
+	ObjectInfo
+	Range *Range
+	Body  io.ReadCloser
+}
+
+// Range is Length bytes starting at Offset. A negative Length runs to the
+// end of the object.
+type Range struct {
+	Offset int64
+	Length int64
+}
+
+// resolve clamps r to an object of size bytes.
+func (r Range) resolve(size int64) (Range, error) {
+	if r.Offset < 0 || r.Offset >= size {
+		return Range{}, ErrInvalidRange
+	}
+	if r.Length < 0 || r.Offset+r.Length > size {
+		r.Length = size - r.Offset
+	}
+	return r, nil
+}
+
+// CleanKey validates key: slash-separated, relative, and free of empty, "."
+// or ".." segments, so no key can name something outside the store.
+func CleanKey(key string) (string, error) {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, "\\") || path.Clean(key) != key {
+		return "", ErrInvalidKey
+	}
+	for _, seg := range strings.Split(key, "/") {
+		if seg == "." || seg == ".." {
+			return "", ErrInvalidKey
+		}
+	}
+	return key, nil
+}
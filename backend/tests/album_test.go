@@ -0,0 +1,180 @@
+package api_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"nunoo.co/backend/models"
+)
+
+func decodeAlbum(t *testing.T, body []byte) models.Album {
+	t.Helper()
+	var got struct {
+		Album models.Album `json:"album"`
+	}
+	if err := json.Unmarshal(body, &got); err != nil {
+		t.Fatalf("failed to decode album: %v: %s", err, body)
+	}
+	return got.Album
+}
+
+func albumPhotoIDs(t *testing.T, h http.Handler, host, albumID, token string) []string {
+	t.Helper()
+	rr := doHostJSON(t, h, host, http.MethodGet, "/albums/"+albumID+"/photos", nil, token)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 listing album photos, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var feed models.PhotoFeed
+	if err := json.Unmarshal(rr.Body.Bytes(), &feed); err != nil {
+		t.Fatal(err)
+	}
+	ids := []string{}
+	for _, p := range feed.Photos {
+		ids = append(ids, p.ID)
+	}
+	return ids
+}
+
+func TestAlbums(t *testing.T) {
+	srv := newTestServer(t)
+	host := "example.com"
+	owner := loginOnHost(t, srv, host, "albums@example.com", "Str0ngP@ssw0rd!")
+	other := loginOnHost(t, srv, host, "albums-other@example.com", "Str0ngP@ssw0rd!")
+
+	if rr := doHostJSON(t, srv, host, http.MethodPost, "/albums", map[string]string{"title": "x"}, ""); rr.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 without a token, got %d", rr.Code)
+	}
+	if rr := doHostJSON(t, srv, host, http.MethodPost, "/albums", map[string]string{"description": "x"}, owner.AccessToken); rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 without a title, got %d", rr.Code)
+	}
+	if rr := doHostJSON(t, srv, host, http.MethodPost, "/albums", map[string]string{"title": "x", "slug": "Not A Slug"}, owner.AccessToken); rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for a malformed slug, got %d", rr.Code)
+	}
+
+	rr := doHostJSON(t, srv, host, http.MethodPost, "/albums", map[string]string{"title": "Summer Trip 2024!", "description": "Beaches"}, owner.AccessToken)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+	album := decodeAlbum(t, rr.Body.Bytes())
+	if album.Slug != "summer-trip-2024" || album.Visibility != models.VisibilityPublic || album.Description != "Beaches" {
+		t.Fatalf("unexpected album: %+v", album)
+	}
+	rr = doHostJSON(t, srv, host, http.MethodPost, "/albums", map[string]string{"title": "Summer trip 2024"}, owner.AccessToken)
+	if second := decodeAlbum(t, rr.Body.Bytes()); second.Slug != "summer-trip-2024-2" {
+		t.Fatalf("expected a numbered slug, got %q", second.Slug)
+	}
+	if rr := doHostJSON(t, srv, host, http.MethodPost, "/albums", map[string]string{"title": "x", "slug": "summer-trip-2024"}, owner.AccessToken); rr.Code != http.StatusConflict {
+		t.Fatalf("expected 409 for a taken slug, got %d", rr.Code)
+	}
+
+	// Membership keeps the order photos were added in.
+	a := uploadTestPhoto(t, srv, host, owner.AccessToken, nil)
+	b := uploadTestPhoto(t, srv, host, owner.AccessToken, nil)
+	c := uploadTestPhoto(t, srv, host, owner.AccessToken, map[string]string{"visibility": "private"})
+	foreign := uploadTestPhoto(t, srv, host, other.AccessToken, nil)
+
+	photosPath := "/albums/" + album.ID + "/photos"
+	if rr := doHostJSON(t, srv, host, http.MethodPost, photosPath, map[string][]string{"photo_ids": {foreign.ID}}, owner.AccessToken); rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 adding another user's photo, got %d", rr.Code)
+	}
+	if rr := doHostJSON(t, srv, host, http.MethodPost, photosPath, map[string][]string{"photo_ids": {a.ID}}, other.AccessToken); rr.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 editing another user's album, got %d", rr.Code)
+	}
+	for _, ids := range [][]string{{b.ID, a.ID}, {c.ID, b.ID}} {
+		if rr := doHostJSON(t, srv, host, http.MethodPost, photosPath, map[string][]string{"photo_ids": ids}, owner.AccessToken); rr.Code != http.StatusNoContent {
+			t.Fatalf("expected 204 adding photos, got %d: %s", rr.Code, rr.Body.String())
+		}
+	}
+	if got := albumPhotoIDs(t, srv, host, album.ID, owner.AccessToken); len(got) != 3 || got[0] != b.ID || got[1] != a.ID || got[2] != c.ID {
+		t.Fatalf("unexpected album order %v", got)
+	}
+	if got := albumPhotoIDs(t, srv, host, album.ID, ""); len(got) != 2 {
+		t.Fatalf("expected the private photo to be hidden from others, got %v", got)
+	}
+
+	// Reordering must name every member exactly once.
+	if rr := doHostJSON(t, srv, host, http.MethodPut, photosPath, map[string][]string{"photo_ids": {a.ID, b.ID}}, owner.AccessToken); rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for a partial order, got %d", rr.Code)
+	}
+	if rr := doHostJSON(t, srv, host, http.MethodPut, photosPath, map[string][]string{"photo_ids": {c.ID, a.ID, b.ID}}, owner.AccessToken); rr.Code != http.StatusNoContent {
+		t.Fatalf("expected 204 reordering, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if got := albumPhotoIDs(t, srv, host, album.ID, owner.AccessToken); got[0] != c.ID || got[1] != a.ID || got[2] != b.ID {
+		t.Fatalf("unexpected order after reorder %v", got)
+	}
+	rr = doHostJSON(t, srv, host, http.MethodGet, photosPath+"?limit=2&page=2", nil, owner.AccessToken)
+	var page models.PhotoFeed
+	if err := json.Unmarshal(rr.Body.Bytes(), &page); err != nil {
+		t.Fatal(err)
+	}
+	if page.TotalCount != 3 || len(page.Photos) != 1 || page.Photos[0].ID != b.ID || page.HasMore {
+		t.Fatalf("unexpected second page %+v", page)
+	}
+
+	// The cover must be a member; removing it clears the cover.
+	albumPath := "/albums/" + album.ID
+	if rr := doHostJSON(t, srv, host, http.MethodPatch, albumPath, map[string]string{"cover_photo_id": foreign.ID}, owner.AccessToken); rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for a cover outside the album, got %d", rr.Code)
+	}
+	rr = doHostJSON(t, srv, host, http.MethodPatch, albumPath, map[string]string{"cover_photo_id": a.ID, "title": "Summer"}, owner.AccessToken)
+	if got := decodeAlbum(t, rr.Body.Bytes()); rr.Code != http.StatusOK || got.CoverPhotoID != a.ID || got.Title != "Summer" || got.Slug != album.Slug {
+		t.Fatalf("unexpected album after edit %d: %+v", rr.Code, got)
+	}
+	if rr := doHostJSON(t, srv, host, http.MethodDelete, photosPath+"/"+a.ID, nil, owner.AccessToken); rr.Code != http.StatusNoContent {
+		t.Fatalf("expected 204 removing a photo, got %d", rr.Code)
+	}
+	rr = doHostJSON(t, srv, host, http.MethodGet, albumPath, nil, "")
+	if got := decodeAlbum(t, rr.Body.Bytes()); got.CoverPhotoID != "" {
+		t.Fatalf("expected the cover to be cleared, got %q", got.CoverPhotoID)
+	}
+
+	// Deleting a photo takes it out of every album.
+	rr = doHostJSON(t, srv, host, http.MethodPost, "/albums", map[string]string{"title": "Best of"}, owner.AccessToken)
+	best := decodeAlbum(t, rr.Body.Bytes())
+	doHostJSON(t, srv, host, http.MethodPost, "/albums/"+best.ID+"/photos", map[string][]string{"photo_ids": {b.ID}}, owner.AccessToken)
+	if rr := doHostJSON(t, srv, host, http.MethodDelete, "/photos/?id="+b.ID, nil, owner.AccessToken); rr.Code != http.StatusNoContent {
+		t.Fatalf("expected 204 deleting photo, got %d", rr.Code)
+	}
+	if got := albumPhotoIDs(t, srv, host, album.ID, owner.AccessToken); len(got) != 1 || got[0] != c.ID {
+		t.Fatalf("expected the deleted photo to leave the album, got %v", got)
+	}
+	if got := albumPhotoIDs(t, srv, host, best.ID, owner.AccessToken); len(got) != 0 {
+		t.Fatalf("expected the deleted photo to leave every album, got %v", got)
+	}
+
+	// Private albums are hidden from everyone but their owner.
+	if rr := doHostJSON(t, srv, host, http.MethodPatch, "/albums/"+best.ID, map[string]string{"visibility": "private"}, owner.AccessToken); rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 making the album private, got %d", rr.Code)
+	}
+	if rr := doHostJSON(t, srv, host, http.MethodGet, "/albums/"+best.ID, nil, other.AccessToken); rr.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for another user's private album, got %d", rr.Code)
+	}
+	if rr := doHostJSON(t, srv, host, http.MethodDelete, "/albums/"+best.ID, nil, other.AccessToken); rr.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 deleting another user's private album, got %d", rr.Code)
+	}
+	ownerID := userIDFor(t, srv, host, owner.AccessToken)
+	for _, tc := range []struct {
+		token string
+		want  int64
+	}{{"", 2}, {owner.AccessToken, 3}} {
+		rr = doHostJSON(t, srv, host, http.MethodGet, "/users/"+ownerID+"/albums", nil, tc.token)
+		var list models.AlbumList
+		if err := json.Unmarshal(rr.Body.Bytes(), &list); err != nil {
+			t.Fatal(err)
+		}
+		if list.TotalCount != tc.want || int64(len(list.Albums)) != tc.want {
+			t.Fatalf("expected %d albums, got %+v", tc.want, list)
+		}
+	}
+
+	if rr := doHostJSON(t, srv, host, http.MethodDelete, "/albums/"+best.ID, nil, owner.AccessToken); rr.Code != http.StatusNoContent {
+		t.Fatalf("expected 204 deleting album, got %d", rr.Code)
+	}
+	if rr := doHostJSON(t, srv, host, http.MethodGet, "/albums/"+best.ID, nil, owner.AccessToken); rr.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 after delete, got %d", rr.Code)
+	}
+	if code, _ := getPhotoAs(t, srv, host, c.ID, owner.AccessToken); code != http.StatusOK {
+		t.Fatalf("expected album photos to outlive the album, got %d", code)
+	}
+}
@@ -43,6 +43,9 @@ func newTestServer(t *testing.T) http.Handler {
 	if err != nil {
 		t.Fatalf("failed to load config: %v", err)
 	}
+	// Tests issue requests back to back; keep the limiter out of the way.
+	cfg.Security.RateLimitRPS = 10000
+	cfg.Security.RateLimitBurst = 10000
 
 	// For TDD, expect api.NewServerForTesting to exist and return an http.Handler
 	return api.NewServerForTesting(cfg)
@@ -0,0 +1,157 @@
+package api_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"nunoo.co/backend/models"
+)
+
+func cameraExif(cameraMake, model string, iso uint16, taken, offset string) ([]exifTag, []exifTag) {
+	ifd0 := []exifTag{
+		{0x010F, cameraMake},
+		{0x0110, model},
+		{0x0112, uint16(6)},
+	}
+	sub := []exifTag{
+		{0x829A, [2]uint32{1, 250}},
+		{0x829D, [2]uint32{28, 10}},
+		{0x8827, iso},
+		{0x9003, taken},
+		{0x920A, [2]uint32{35, 1}},
+		{0xA434, "XF35mmF1.4 R"},
+	}
+	if offset != "" {
+		sub = append(sub, exifTag{0x9011, offset})
+	}
+	return ifd0, sub
+}
+
+func TestUpload_ReadsExif(t *testing.T) {
+	srv := newTestServer(t)
+	host := "example.com"
+	tok := loginOnHost(t, srv, host, "exif@example.com", "Str0ngP@ssw0rd!")
+
+	ifd0, sub := cameraExif("FUJIFILM", "X-T4", 400, "2024:05:01 10:30:00", "+02:00")
+	data := withExif(t, encodeTestJPEG(t, 64, 48), ifd0, sub)
+	photo := decodeUploadResponse(t, uploadTestFile(t, srv, host, tok.AccessToken, "camera.jpg", data, nil))
+
+	want := models.PhotoExif{
+		CameraMake:   "FUJIFILM",
+		CameraModel:  "X-T4",
+		LensModel:    "XF35mmF1.4 R",
+		FocalLength:  35,
+		FNumber:      2.8,
+		ExposureTime: "1/250",
+		ISO:          400,
+		Orientation:  6,
+	}
+	if photo.Exif == nil || *photo.Exif != want {
+		t.Fatalf("expected exif %+v, got %+v", want, photo.Exif)
+	}
+	if photo.TakenAt == nil || photo.TakenAt.Format(time.RFC3339) != "2024-05-01T10:30:00+02:00" {
+		t.Fatalf("expected taken_at with offset, got %v", photo.TakenAt)
+	}
+
+	rr := doHostJSON(t, srv, host, http.MethodGet, "/photos/?id="+photo.ID, nil, "")
+	var got struct {
+		Photo json.RawMessage `json:"photo"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &got); err != nil {
+		t.Fatalf("decode photo: %v", err)
+	}
+	var fields map[string]any
+	_ = json.Unmarshal(got.Photo, &fields)
+	if fields["taken_at"] != "2024-05-01T10:30:00+02:00" || fields["exif"] == nil {
+		t.Fatalf("expected GetPhoto to expose exif, got %s", got.Photo)
+	}
+
+	// Without OffsetTimeOriginal the capture time is a bare wall clock.
+	ifd0, sub = cameraExif("FUJIFILM", "X-T4", 400, "2024:05:01 10:30:00", "")
+	local := decodeUploadResponse(t, uploadTestFile(t, srv, host, tok.AccessToken, "local.jpg", withExif(t, encodeTestJPEG(t, 64, 48), ifd0, sub), nil))
+	if local.TakenAt == nil || !local.TakenAtLocal || local.TakenAt.Format("2006-01-02T15:04:05") != "2024-05-01T10:30:00" {
+		t.Fatalf("expected a local taken_at, got %v", local.TakenAt)
+	}
+	rr = doHostJSON(t, srv, host, http.MethodGet, "/photos/?id="+local.ID, nil, "")
+	if err := json.Unmarshal(rr.Body.Bytes(), &got); err != nil {
+		t.Fatalf("decode photo: %v", err)
+	}
+	fields = nil
+	_ = json.Unmarshal(got.Photo, &fields)
+	if fields["taken_at"] != "2024-05-01T10:30:00" {
+		t.Fatalf("expected taken_at without an offset, got %s", got.Photo)
+	}
+
+	// Uploads without EXIF, or with a corrupt block, are still accepted.
+	plain := decodeUploadResponse(t, uploadTestFile(t, srv, host, tok.AccessToken, "plain.jpg", encodeTestJPEG(t, 64, 48), nil))
+	if plain.Exif != nil || plain.TakenAt != nil {
+		t.Fatalf("expected no exif, got %+v %v", plain.Exif, plain.TakenAt)
+	}
+	corrupt := withExif(t, encodeTestJPEG(t, 64, 48), []exifTag{{0x8769, uint32(0)}}, []exifTag{{0x9003, "2024:05:01 10:30:00"}})
+	corrupt[30] = 0xFF // point the sub-IFD somewhere past the segment
+	corrupt[31] = 0xFF
+	rr = uploadTestFile(t, srv, host, tok.AccessToken, "corrupt.jpg", corrupt, nil)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("expected corrupt exif to be ignored, got %d: %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestPhotoFeed_ExifSortAndFilters(t *testing.T) {
+	srv := newTestServer(t)
+	host := "exif-feed.example.com"
+	tok := loginOnHost(t, srv, host, "exif-feed@example.com", "Str0ngP@ssw0rd!")
+
+	upload := func(cameraMake string, iso uint16, taken string) string {
+		ifd0, sub := cameraExif(cameraMake, "Model", iso, taken, "")
+		data := withExif(t, encodeTestJPEG(t, 32, 32), ifd0, sub)
+		return decodeUploadResponse(t, uploadTestFile(t, srv, host, tok.AccessToken, "p.jpg", data, nil)).ID
+	}
+	old := upload("Canon", 100, "2019:01:01 08:00:00")
+	recent := upload("FUJIFILM", 3200, "2023:06:01 08:00:00")
+	none := decodeUploadResponse(t, uploadTestFile(t, srv, host, tok.AccessToken, "p.jpg", encodeTestJPEG(t, 32, 32), nil)).ID
+	middle := upload("fujifilm", 800, "2021:03:01 08:00:00")
+
+	feedIDs := func(query string) []string {
+		t.Helper()
+		rr := doHostJSON(t, srv, host, http.MethodGet, "/photos/feed"+query, nil, "")
+		if rr.Code != http.StatusOK {
+			t.Fatalf("%s: expected 200, got %d: %s", query, rr.Code, rr.Body.String())
+		}
+		var feed models.PhotoFeed
+		if err := json.Unmarshal(rr.Body.Bytes(), &feed); err != nil {
+			t.Fatalf("decode feed: %v", err)
+		}
+		ids := []string{}
+		for _, p := range feed.Photos {
+			ids = append(ids, p.ID)
+		}
+		return ids
+	}
+	expect := func(query string, want ...string) {
+		t.Helper()
+		got := feedIDs(query)
+		if len(got) != len(want) {
+			t.Fatalf("%s: expected %v, got %v", query, want, got)
+		}
+		for i := range want {
+			if got[i] != want[i] {
+				t.Fatalf("%s: expected %v, got %v", query, want, got)
+			}
+		}
+	}
+
+	expect("", middle, none, recent, old)
+	expect("?sort=taken_at", recent, middle, old, none)
+	expect("?camera_make=FujiFilm", middle, recent)
+	expect("?min_iso=500&max_iso=1000", middle)
+	expect("?taken_after=2020-01-01&taken_before=2022-01-01T00:00:00Z", middle)
+	expect("?sort=taken_at&camera_make=canon", old)
+
+	for _, q := range []string{"?sort=random", "?min_iso=lots", "?taken_after=yesterday"} {
+		if rr := doHostJSON(t, srv, host, http.MethodGet, "/photos/feed"+q, nil, ""); rr.Code != http.StatusBadRequest {
+			t.Fatalf("%s: expected 400, got %d", q, rr.Code)
+		}
+	}
+}
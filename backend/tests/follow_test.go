@@ -0,0 +1,101 @@
+package api_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"nunoo.co/backend/models"
+)
+
+func TestFollow_GraphAndFollowingFeed(t *testing.T) {
+	srv := newTestServer(t)
+	host := "example.com"
+
+	alice := loginOnHost(t, srv, host, "alice@example.com", "Str0ngP@ssw0rd!")
+	bob := loginOnHost(t, srv, host, "bob@example.com", "Str0ngP@ssw0rd!")
+	carol := loginOnHost(t, srv, host, "carol@example.com", "Str0ngP@ssw0rd!")
+	aliceID := userIDFor(t, srv, host, alice.AccessToken)
+	bobID := userIDFor(t, srv, host, bob.AccessToken)
+
+	var bobPhotos []models.Photo
+	for i := 0; i < 3; i++ {
+		bobPhotos = append(bobPhotos, uploadTestPhoto(t, srv, host, bob.AccessToken, nil))
+	}
+	_ = uploadTestPhoto(t, srv, host, carol.AccessToken, nil)
+
+	if rr := doHostJSON(t, srv, host, http.MethodPut, "/users/"+aliceID+"/follow", nil, alice.AccessToken); rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for self-follow, got %d", rr.Code)
+	}
+	if rr := doHostJSON(t, srv, host, http.MethodPut, "/users/usr_missing/follow", nil, alice.AccessToken); rr.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 following unknown user, got %d", rr.Code)
+	}
+
+	// Following is idempotent
+	for i := 0; i < 2; i++ {
+		if rr := doHostJSON(t, srv, host, http.MethodPut, "/users/"+bobID+"/follow", nil, alice.AccessToken); rr.Code != http.StatusOK {
+			t.Fatalf("expected 200 for follow, got %d: %s", rr.Code, rr.Body.String())
+		}
+	}
+
+	var stats models.FollowStats
+	rr := doHostJSON(t, srv, host, http.MethodGet, "/users/"+bobID+"/follow-stats", nil, "")
+	if err := json.Unmarshal(rr.Body.Bytes(), &stats); err != nil {
+		t.Fatal(err)
+	}
+	if stats.Followers != 1 || stats.Following != 0 {
+		t.Fatalf("unexpected stats for bob: %+v", stats)
+	}
+
+	var followers models.FollowList
+	rr = doHostJSON(t, srv, host, http.MethodGet, "/users/"+bobID+"/followers", nil, "")
+	if err := json.Unmarshal(rr.Body.Bytes(), &followers); err != nil {
+		t.Fatal(err)
+	}
+	if followers.TotalCount != 1 || len(followers.Follows) != 1 || followers.Follows[0].FollowerID != aliceID {
+		t.Fatalf("unexpected followers for bob: %+v", followers)
+	}
+
+	// Walk the following feed two photos at a time; carol's photo never appears
+	var seen []string
+	path := "/photos/feed/following?limit=2"
+	for {
+		var feed models.PhotoFeed
+		rr := doHostJSON(t, srv, host, http.MethodGet, path, nil, alice.AccessToken)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected 200 for following feed, got %d: %s", rr.Code, rr.Body.String())
+		}
+		if err := json.Unmarshal(rr.Body.Bytes(), &feed); err != nil {
+			t.Fatal(err)
+		}
+		for _, p := range feed.Photos {
+			if p.UserID != bobID {
+				t.Fatalf("feed contains photo from unfollowed user %s", p.UserID)
+			}
+			seen = append(seen, p.ID)
+		}
+		if !feed.HasMore {
+			break
+		}
+		path = "/photos/feed/following?limit=2&cursor=" + feed.NextCursor
+	}
+	if len(seen) != 3 || seen[0] != bobPhotos[2].ID || seen[2] != bobPhotos[0].ID {
+		t.Fatalf("unexpected following feed order: %v", seen)
+	}
+
+	if rr := doHostJSON(t, srv, host, http.MethodGet, "/photos/feed/following?cursor=not-a-cursor", nil, alice.AccessToken); rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for invalid cursor, got %d", rr.Code)
+	}
+
+	if rr := doHostJSON(t, srv, host, http.MethodDelete, "/users/"+bobID+"/follow", nil, alice.AccessToken); rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 for unfollow, got %d", rr.Code)
+	}
+	var feed models.PhotoFeed
+	rr = doHostJSON(t, srv, host, http.MethodGet, "/photos/feed/following", nil, alice.AccessToken)
+	if err := json.Unmarshal(rr.Body.Bytes(), &feed); err != nil {
+		t.Fatal(err)
+	}
+	if len(feed.Photos) != 0 {
+		t.Fatalf("expected empty following feed after unfollow, got %d", len(feed.Photos))
+	}
+}
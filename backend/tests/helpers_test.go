@@ -0,0 +1,240 @@
+package api_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"nunoo.co/backend/models"
+)
+
+func doHostJSON(t *testing.T, h http.Handler, host, method, path string, body any, token string) *httptest.ResponseRecorder {
+	t.Helper()
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			t.Fatalf("failed to encode body: %v", err)
+		}
+	}
+	req := httptest.NewRequest(method, path, &buf)
+	req.Host = host
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func loginOnHost(t *testing.T, h http.Handler, host, email, password string) tokenResponse {
+	t.Helper()
+	rr := doHostJSON(t, h, host, http.MethodPost, "/auth/register", registerRequest{Email: email, Password: password}, "")
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("register on %s expected 201, got %d: %s", host, rr.Code, rr.Body.String())
+	}
+	lr := doHostJSON(t, h, host, http.MethodPost, "/auth/login", registerRequest{Email: email, Password: password}, "")
+	if lr.Code != http.StatusOK {
+		t.Fatalf("login on %s expected 200, got %d: %s", host, lr.Code, lr.Body.String())
+	}
+	var tok tokenResponse
+	if err := json.Unmarshal(lr.Body.Bytes(), &tok); err != nil {
+		t.Fatalf("invalid login response json: %v", err)
+	}
+	return tok
+}
+
+// userIDFor returns the ID of the user owning token.
+func userIDFor(t *testing.T, h http.Handler, host, token string) string {
+	t.Helper()
+	rr := doHostJSON(t, h, host, http.MethodGet, "/me", nil, token)
+	var me userEnvelope
+	if err := json.Unmarshal(rr.Body.Bytes(), &me); err != nil || me.User.ID == "" {
+		t.Fatalf("failed to resolve user id: %d %s", rr.Code, rr.Body.String())
+	}
+	return me.User.ID
+}
+
+// uploadTestPhoto uploads a small JPEG with the given extra form fields and
+// returns the created photo.
+func uploadTestPhoto(t *testing.T, h http.Handler, host, token string, fields map[string]string) models.Photo {
+	t.Helper()
+	// A unique comment keeps repeated uploads from being deduplicated.
+	data := insertSegment(encodeTestJPEG(t, 8, 8), 0xFE, fmt.Appendf(nil, "upload %d", testUploads.Add(1)))
+	return decodeUploadResponse(t, uploadTestFile(t, h, host, token, "test.jpg", data, fields))
+}
+
+var testUploads atomic.Int64
+
+// uploadTestFile posts data as the photo form file and returns the raw response.
+func uploadTestFile(t *testing.T, h http.Handler, host, token, filename string, data []byte, fields map[string]string) *httptest.ResponseRecorder {
+	t.Helper()
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	for k, v := range fields {
+		if err := writer.WriteField(k, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	part, err := writer.CreateFormFile("photo", filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := part.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/photos/upload", body)
+	req.Host = host
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+// decodeUploadResponse extracts the photo from a successful upload response.
+func decodeUploadResponse(t *testing.T, rec *httptest.ResponseRecorder) models.Photo {
+	t.Helper()
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201 for upload, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var out struct {
+		Photo models.Photo `json:"photo"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &out); err != nil {
+		t.Fatal(err)
+	}
+	return out.Photo
+}
+
+// encodeTestJPEG returns a small, fully decodable JPEG.
+func encodeTestJPEG(t testing.TB, w, h int) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.RGBA{R: uint8(x * 255 / w), G: uint8(y * 255 / h), B: 128, A: 255})
+		}
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, nil); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// encodeTestPNG returns a small PNG with a transparent top row.
+func encodeTestPNG(t testing.TB, w, h int) []byte {
+	t.Helper()
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 1; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.NRGBA{R: 200, G: uint8(x), B: uint8(y), A: 255})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// fetch GETs path on host and returns the recorder.
+func fetch(t *testing.T, h http.Handler, host, path string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	req.Host = host
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+// exifTag is one TIFF entry for withExif. value is a string (ASCII), uint16
+// (SHORT), uint32 (LONG) or [2]uint32 (RATIONAL).
+type exifTag struct {
+	id    uint16
+	value any
+}
+
+// withExif inserts an APP1 Exif segment holding ifd0 and, when non-empty, an
+// Exif sub-IFD into a JPEG.
+func withExif(t *testing.T, jpegData []byte, ifd0, sub []exifTag) []byte {
+	t.Helper()
+	order := binary.LittleEndian
+	if len(sub) > 0 {
+		ifd0 = append(ifd0, exifTag{0x8769, uint32(0)}) // patched below
+	}
+	ifd0At := 8
+	subAt := ifd0At + 2 + 12*len(ifd0) + 4
+	dataAt := subAt
+	if len(sub) > 0 {
+		dataAt += 2 + 12*len(sub) + 4
+	}
+
+	var data []byte
+	writeIFD := func(tags []exifTag) []byte {
+		out := order.AppendUint16(nil, uint16(len(tags)))
+		for _, tag := range tags {
+			var typ uint16
+			var raw []byte
+			switch v := tag.value.(type) {
+			case string:
+				typ, raw = 2, append([]byte(v), 0)
+			case uint16:
+				typ, raw = 3, order.AppendUint16(nil, v)
+			case uint32:
+				if tag.id == 0x8769 {
+					v = uint32(subAt)
+				}
+				typ, raw = 4, order.AppendUint32(nil, v)
+			case [2]uint32:
+				typ, raw = 5, order.AppendUint32(order.AppendUint32(nil, v[0]), v[1])
+			default:
+				t.Fatalf("unsupported exif value %T", v)
+			}
+			count := len(raw)
+			if typ != 2 {
+				count = 1
+			}
+			out = order.AppendUint16(order.AppendUint16(out, tag.id), typ)
+			out = order.AppendUint32(out, uint32(count))
+			if len(raw) <= 4 {
+				out = append(out, append(raw, make([]byte, 4-len(raw))...)...)
+			} else {
+				out = order.AppendUint32(out, uint32(dataAt+len(data)))
+				data = append(data, raw...)
+			}
+		}
+		return order.AppendUint32(out, 0)
+	}
+
+	tiff := append([]byte("II*\x00"), order.AppendUint32(nil, uint32(ifd0At))...)
+	tiff = append(tiff, writeIFD(ifd0)...)
+	if len(sub) > 0 {
+		tiff = append(tiff, writeIFD(sub)...)
+	}
+	tiff = append(tiff, data...)
+
+	segment := append([]byte("Exif\x00\x00"), tiff...)
+	out := append([]byte{}, jpegData[:2]...)
+	out = append(out, 0xFF, 0xE1)
+	out = binary.BigEndian.AppendUint16(out, uint16(len(segment)+2))
+	out = append(out, segment...)
+	return append(out, jpegData[2:]...)
+}
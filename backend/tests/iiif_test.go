@@ -0,0 +1,180 @@
+package api_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"image"
+	_ "image/gif"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestIIIF_InfoJSON(t *testing.T) {
+	srv := newTestServer(t)
+	host := "example.com"
+	tok := loginOnHost(t, srv, host, "iiif-info@example.com", "Str0ngP@ssw0rd!")
+	photo := decodeUploadResponse(t, uploadTestFile(t, srv, host, tok.AccessToken, "wide.jpg", encodeTestJPEG(t, 800, 600), nil))
+
+	rr := fetch(t, srv, host, "/iiif/"+photo.ID)
+	if rr.Code != http.StatusSeeOther || !strings.HasSuffix(rr.Header().Get("Location"), "/iiif/"+photo.ID+"/info.json") {
+		t.Fatalf("expected redirect to info.json, got %d %q", rr.Code, rr.Header().Get("Location"))
+	}
+
+	rr = fetch(t, srv, host, "/iiif/"+photo.ID+"/info.json")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var info struct {
+		Context string `json:"@context"`
+		ID      string `json:"id"`
+		Type    string `json:"type"`
+		Profile string `json:"profile"`
+		Width   int    `json:"width"`
+		Height  int    `json:"height"`
+		Sizes   []struct {
+			Width  int `json:"width"`
+			Height int `json:"height"`
+		} `json:"sizes"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &info); err != nil {
+		t.Fatalf("decode info.json: %v", err)
+	}
+	if info.Context != "http://iiif.io/api/image/3/context.json" || info.Type != "ImageService3" || info.Profile != "level2" {
+		t.Fatalf("unexpected service description: %+v", info)
+	}
+	if info.ID != "http://example.com/iiif/"+photo.ID || info.Width != 800 || info.Height != 600 {
+		t.Fatalf("unexpected id or dimensions: %+v", info)
+	}
+	if len(info.Sizes) != len(photo.Variants) {
+		t.Fatalf("expected sizes to list the renditions, got %+v", info.Sizes)
+	}
+
+	if rr := fetch(t, srv, host, "/iiif/photo_missing/info.json"); rr.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for unknown photo, got %d", rr.Code)
+	}
+}
+
+func TestIIIF_ImageRequests(t *testing.T) {
+	srv := newTestServer(t)
+	host := "example.com"
+	tok := loginOnHost(t, srv, host, "iiif-image@example.com", "Str0ngP@ssw0rd!")
+	photo := decodeUploadResponse(t, uploadTestFile(t, srv, host, tok.AccessToken, "wide.jpg", encodeTestJPEG(t, 800, 600), nil))
+	base := "/iiif/" + photo.ID + "/"
+
+	cases := []struct {
+		path   string
+		w, h   int
+		format string
+	}{
+		{"full/max/0/default.jpg", 800, 600, "jpeg"},
+		{"square/100,/0/default.png", 100, 100, "png"},
+		{"0,0,400,300/200,/90/gray.jpg", 150, 200, "jpeg"},
+		{"pct:50,50,50,50/max/!180/default.png", 400, 300, "png"},
+		{"700,500,300,300/max/0/color.png", 100, 100, "png"},
+		{"full/!100,100/0/bitonal.gif", 100, 75, "gif"},
+		{"full/,60/270/default.jpg", 60, 80, "jpeg"},
+		{"full/pct:10/0/default.jpg", 80, 60, "jpeg"},
+		{"full/%5E1000,/0/default.jpg", 1000, 750, "jpeg"},
+	}
+	for _, c := range cases {
+		t.Run(c.path, func(t *testing.T) {
+			rr := fetch(t, srv, host, base+c.path)
+			if rr.Code != http.StatusOK {
+				t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+			}
+			cfg, format, err := image.DecodeConfig(bytes.NewReader(rr.Body.Bytes()))
+			if err != nil {
+				t.Fatalf("response is not an image: %v", err)
+			}
+			if cfg.Width != c.w || cfg.Height != c.h || format != c.format {
+				t.Fatalf("expected %s %dx%d, got %s %dx%d", c.format, c.w, c.h, format, cfg.Width, cfg.Height)
+			}
+			if !strings.Contains(strings.Join(rr.Header().Values("Link"), ","), `rel="canonical"`) {
+				t.Fatalf("expected canonical Link header, got %v", rr.Header().Values("Link"))
+			}
+		})
+	}
+
+	// The test image gets redder to the right; mirroring must flip that.
+	rr := fetch(t, srv, host, base+"full/max/!0/default.png")
+	img, _, err := image.Decode(bytes.NewReader(rr.Body.Bytes()))
+	if err != nil {
+		t.Fatalf("decode mirrored image: %v", err)
+	}
+	left, _, _, _ := img.At(10, 300).RGBA()
+	right, _, _, _ := img.At(790, 300).RGBA()
+	if left <= right {
+		t.Fatalf("expected mirrored image to be redder on the left, got left=%d right=%d", left, right)
+	}
+}
+
+func TestIIIF_InvalidRequests(t *testing.T) {
+	srv := newTestServer(t)
+	host := "example.com"
+	tok := loginOnHost(t, srv, host, "iiif-invalid@example.com", "Str0ngP@ssw0rd!")
+	photo := decodeUploadResponse(t, uploadTestFile(t, srv, host, tok.AccessToken, "wide.jpg", encodeTestJPEG(t, 800, 600), nil))
+	base := "/iiif/" + photo.ID + "/"
+
+	cases := []struct {
+		path string
+		code int
+	}{
+		{"full/1000,/0/default.jpg", http.StatusBadRequest}, // upscaling needs ^
+		{"full/%5E5000,/0/default.jpg", http.StatusBadRequest},
+		{"900,0,10,10/max/0/default.jpg", http.StatusBadRequest},
+		{"full/0,/0/default.jpg", http.StatusBadRequest},
+		{"full/max/400/default.jpg", http.StatusBadRequest},
+		{"full/max/0/fancy.jpg", http.StatusBadRequest},
+		{"full/max/0/default", http.StatusBadRequest},
+		{"bogus/max/0/default.jpg", http.StatusBadRequest},
+		{"full/max/NaN/default.jpg", http.StatusBadRequest},
+		{"full/max/1e2/default.jpg", http.StatusBadRequest},
+		{"full/max/90./default.jpg", http.StatusBadRequest},
+		{"full/max/45/default.jpg", http.StatusNotImplemented},
+		{"full/max/22.5/default.jpg", http.StatusNotImplemented},
+		{"full/max/0/default.webp", http.StatusNotImplemented},
+	}
+	for _, c := range cases {
+		if rr := fetch(t, srv, host, base+c.path); rr.Code != c.code {
+			t.Errorf("%s: expected %d, got %d: %s", c.path, c.code, rr.Code, rr.Body.String())
+		}
+	}
+}
+
+func TestIIIF_ConcurrentRequestsAndDelete(t *testing.T) {
+	srv := newTestServer(t)
+	host := "example.com"
+	tok := loginOnHost(t, srv, host, "iiif-cache@example.com", "Str0ngP@ssw0rd!")
+	photo := decodeUploadResponse(t, uploadTestFile(t, srv, host, tok.AccessToken, "wide.jpg", encodeTestJPEG(t, 800, 600), nil))
+	path := "/iiif/" + photo.ID + "/full/333,/0/default.jpg"
+
+	const n = 8
+	bodies := make([][]byte, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			rr := fetch(t, srv, host, path)
+			if rr.Code == http.StatusOK {
+				bodies[i] = rr.Body.Bytes()
+			}
+		}(i)
+	}
+	wg.Wait()
+	for i := range bodies {
+		if len(bodies[i]) == 0 || !bytes.Equal(bodies[i], bodies[0]) {
+			t.Fatalf("expected identical successful renders, response %d differs", i)
+		}
+	}
+
+	rr := doHostJSON(t, srv, host, http.MethodDelete, "/photos/?id="+photo.ID, nil, tok.AccessToken)
+	if rr.Code != http.StatusNoContent {
+		t.Fatalf("expected 204 deleting photo, got %d", rr.Code)
+	}
+	if rr := fetch(t, srv, host, path); rr.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 after delete, got %d", rr.Code)
+	}
+}
@@ -0,0 +1,139 @@
+package api_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"sync"
+	"testing"
+
+	"nunoo.co/backend/models"
+)
+
+func likePhoto(t *testing.T, h http.Handler, host, method, photoID, token string) models.PhotoLikeState {
+	t.Helper()
+	rr := doHostJSON(t, h, host, method, "/photos/"+photoID+"/like", nil, token)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 for %s like, got %d: %s", method, rr.Code, rr.Body.String())
+	}
+	var state models.PhotoLikeState
+	if err := json.Unmarshal(rr.Body.Bytes(), &state); err != nil {
+		t.Fatal(err)
+	}
+	return state
+}
+
+func TestLikes(t *testing.T) {
+	srv := newTestServer(t)
+	host := "example.com"
+	owner := loginOnHost(t, srv, host, "liked@example.com", "Str0ngP@ssw0rd!")
+	fan := loginOnHost(t, srv, host, "fan@example.com", "Str0ngP@ssw0rd!")
+
+	photo := uploadTestPhoto(t, srv, host, owner.AccessToken, nil)
+	older := uploadTestPhoto(t, srv, host, owner.AccessToken, nil)
+	private := uploadTestPhoto(t, srv, host, owner.AccessToken, map[string]string{"visibility": "private"})
+
+	if rr := doHostJSON(t, srv, host, http.MethodPut, "/photos/"+photo.ID+"/like", nil, ""); rr.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 without a token, got %d", rr.Code)
+	}
+	for _, id := range []string{"missing", private.ID} {
+		if rr := doHostJSON(t, srv, host, http.MethodPut, "/photos/"+id+"/like", nil, fan.AccessToken); rr.Code != http.StatusNotFound {
+			t.Fatalf("expected 404 liking %s, got %d", id, rr.Code)
+		}
+	}
+
+	// Liking and unliking are idempotent.
+	for range 2 {
+		if state := likePhoto(t, srv, host, http.MethodPut, photo.ID, fan.AccessToken); state.LikeCount != 1 || !state.Liked {
+			t.Fatalf("unexpected like state %+v", state)
+		}
+	}
+	if page := listNotifications(t, srv, host, owner.AccessToken); len(page.Notifications) != 1 || page.Notifications[0].Kind != models.NotificationLike || page.Notifications[0].ActorCount != 1 {
+		t.Fatalf("expected one like notification, got %+v", page.Notifications)
+	}
+	likePhoto(t, srv, host, http.MethodPut, older.ID, fan.AccessToken)
+
+	// Counts and the caller's own state are embedded in photos and feeds.
+	if _, p := getPhotoAs(t, srv, host, photo.ID, fan.AccessToken); p.LikeCount != 1 || !p.Liked {
+		t.Fatalf("expected a liked photo with one like, got %d %v", p.LikeCount, p.Liked)
+	}
+	if _, p := getPhotoAs(t, srv, host, photo.ID, owner.AccessToken); p.LikeCount != 1 || p.Liked {
+		t.Fatalf("expected the owner to see the count but no like, got %d %v", p.LikeCount, p.Liked)
+	}
+	rr := doHostJSON(t, srv, host, http.MethodGet, "/photos/feed", nil, fan.AccessToken)
+	var feed models.PhotoFeed
+	if err := json.Unmarshal(rr.Body.Bytes(), &feed); err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range feed.Photos {
+		if p.LikeCount != 1 || !p.Liked {
+			t.Fatalf("expected liked photos in the feed, got %+v", p)
+		}
+	}
+
+	// Edits keep the count.
+	if rr := patchPhoto(t, srv, photo.ID, owner.AccessToken, "*", map[string]string{"caption": "Liked"}); rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 editing caption, got %d", rr.Code)
+	}
+	if _, p := getPhotoAs(t, srv, host, photo.ID, ""); p.LikeCount != 1 || p.Liked {
+		t.Fatalf("expected the count to survive an edit, got %d %v", p.LikeCount, p.Liked)
+	}
+
+	// The caller's likes are listed most recently liked first.
+	rr = doHostJSON(t, srv, host, http.MethodGet, "/me/likes?limit=1", nil, fan.AccessToken)
+	var likes models.PhotoLikeList
+	if err := json.Unmarshal(rr.Body.Bytes(), &likes); err != nil {
+		t.Fatal(err)
+	}
+	if len(likes.Likes) != 1 || likes.Likes[0].Photo.ID != older.ID || !likes.HasMore || rr.Header().Get("Link") == "" {
+		t.Fatalf("unexpected first likes page %+v", likes)
+	}
+	rr = doHostJSON(t, srv, host, http.MethodGet, "/me/likes?limit=1&cursor="+url.QueryEscape(likes.NextCursor), nil, fan.AccessToken)
+	likes = models.PhotoLikeList{}
+	if err := json.Unmarshal(rr.Body.Bytes(), &likes); err != nil {
+		t.Fatal(err)
+	}
+	if len(likes.Likes) != 1 || likes.Likes[0].Photo.ID != photo.ID || likes.HasMore {
+		t.Fatalf("unexpected second likes page %+v", likes)
+	}
+
+	if state := likePhoto(t, srv, host, http.MethodDelete, photo.ID, fan.AccessToken); state.LikeCount != 0 || state.Liked {
+		t.Fatalf("unexpected state after unlike %+v", state)
+	}
+	if state := likePhoto(t, srv, host, http.MethodDelete, photo.ID, fan.AccessToken); state.LikeCount != 0 {
+		t.Fatalf("expected a repeated unlike to change nothing, got %+v", state)
+	}
+}
+
+func TestLikes_ConcurrentLikesKeepCount(t *testing.T) {
+	srv := newTestServer(t)
+	host := "example.com"
+	owner := loginOnHost(t, srv, host, "popular@example.com", "Str0ngP@ssw0rd!")
+	photo := uploadTestPhoto(t, srv, host, owner.AccessToken, nil)
+
+	fans := []string{owner.AccessToken}
+	for _, email := range []string{"a@example.com", "b@example.com", "c@example.com"} {
+		fans = append(fans, loginOnHost(t, srv, host, email, "Str0ngP@ssw0rd!").AccessToken)
+	}
+
+	// Every fan likes the photo several times at once.
+	var wg sync.WaitGroup
+	for _, token := range fans {
+		for range 4 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				doHostJSON(t, srv, host, http.MethodPut, "/photos/"+photo.ID+"/like", nil, token)
+			}()
+		}
+	}
+	wg.Wait()
+
+	if _, p := getPhotoAs(t, srv, host, photo.ID, ""); p.LikeCount != int64(len(fans)) {
+		t.Fatalf("expected %d likes, got %d", len(fans), p.LikeCount)
+	}
+	// Only the like that was recorded notifies, once per fan.
+	if page := listNotifications(t, srv, host, owner.AccessToken); len(page.Notifications) != 1 || page.Notifications[0].ActorCount != len(fans)-1 {
+		t.Fatalf("expected one like notification from %d fans, got %+v", len(fans)-1, page.Notifications)
+	}
+}
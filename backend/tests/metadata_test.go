@@ -0,0 +1,167 @@
+package api_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"nunoo.co/backend/api"
+	"nunoo.co/backend/config"
+	"nunoo.co/backend/exif"
+)
+
+func newImagesTestServer(t *testing.T, images config.ImagesConfig) http.Handler {
+	t.Helper()
+	cfg := &config.Config{
+		JWT: config.JWTConfig{
+			Secret:        "test-secret-access",
+			RefreshSecret: "test-secret-refresh",
+		},
+		Images: images,
+	}
+	return api.NewServerForTesting(cfg)
+}
+
+// insertSegment adds a JPEG marker segment right after SOI.
+func insertSegment(jpegData []byte, marker byte, payload []byte) []byte {
+	out := append([]byte{}, jpegData[:2]...)
+	out = append(out, 0xFF, marker)
+	out = binary.BigEndian.AppendUint16(out, uint16(len(payload)+2))
+	out = append(out, payload...)
+	return append(out, jpegData[2:]...)
+}
+
+// privateJPEG returns a JPEG carrying GPS, serial numbers, a maker note, XMP
+// and an ICC profile next to ordinary camera settings.
+func privateJPEG(t *testing.T) []byte {
+	t.Helper()
+	data := withExif(t, encodeTestJPEG(t, 64, 48),
+		[]exifTag{{0x010F, "FUJIFILM"}, {0x0112, uint16(6)}, {0x8825, uint32(8)}},
+		[]exifTag{{0x8827, uint16(400)}, {0x927C, "maker-secret"}, {0xA431, "SN-12345"}})
+	data = insertSegment(data, 0xE1, []byte("http://ns.adobe.com/xap/1.0/\x00<x:xmpmeta>GPSLatitude</x:xmpmeta>"))
+	return insertSegment(data, 0xE2, []byte("ICC_PROFILE\x00\x01\x01fake-profile"))
+}
+
+func TestUpload_StripsPrivateMetadata(t *testing.T) {
+	srv := newImagesTestServer(t, config.ImagesConfig{})
+	host := "example.com"
+	tok := loginOnHost(t, srv, host, "strip@example.com", "Str0ngP@ssw0rd!")
+
+	upload := privateJPEG(t)
+	photo := decodeUploadResponse(t, uploadTestFile(t, srv, host, tok.AccessToken, "private.jpg", upload, map[string]string{"keep_original": "true"}))
+
+	for _, group := range []string{"gps", "maker_notes", "serial_numbers", "xmp"} {
+		if !slices.Contains(photo.StrippedMetadata, group) {
+			t.Fatalf("expected %q in stripped_metadata, got %v", group, photo.StrippedMetadata)
+		}
+	}
+	if !photo.OriginalRetained {
+		t.Fatal("expected original_retained")
+	}
+	if photo.Exif == nil || photo.Exif.ISO != 400 {
+		t.Fatalf("expected exif to be read before stripping, got %+v", photo.Exif)
+	}
+
+	rr := fetch(t, srv, host, photo.OriginalURL)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 fetching served copy, got %d", rr.Code)
+	}
+	served := rr.Body.Bytes()
+	if int64(len(served)) != photo.FileSize {
+		t.Fatalf("expected file_size %d to match served copy, got %d", len(served), photo.FileSize)
+	}
+	for _, secret := range []string{"SN-12345", "maker-secret", "GPSLatitude"} {
+		if bytes.Contains(served, []byte(secret)) {
+			t.Fatalf("served copy still contains %q", secret)
+		}
+	}
+	if !bytes.Contains(served, []byte("fake-profile")) {
+		t.Fatal("expected ICC profile to be kept")
+	}
+	meta, err := exif.Decode(bytes.NewReader(served))
+	if err != nil || meta.Orientation != 6 || meta.Make != "FUJIFILM" || meta.ISO != 400 {
+		t.Fatalf("expected orientation and camera settings to survive, got %+v (%v)", meta, err)
+	}
+
+	// The untouched upload is only available to its owner.
+	rr = doHostJSON(t, srv, host, http.MethodGet, "/photos/original?id="+photo.ID, nil, tok.AccessToken)
+	if rr.Code != http.StatusOK || !bytes.Equal(rr.Body.Bytes(), upload) {
+		t.Fatalf("expected owner to get the untouched original, got %d (%d bytes)", rr.Code, rr.Body.Len())
+	}
+	other := loginOnHost(t, srv, host, "other-strip@example.com", "Str0ngP@ssw0rd!")
+	if rr := doHostJSON(t, srv, host, http.MethodGet, "/photos/original?id="+photo.ID, nil, other.AccessToken); rr.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 for another user, got %d", rr.Code)
+	}
+	if rr := doHostJSON(t, srv, host, http.MethodGet, "/photos/original?id="+photo.ID, nil, ""); rr.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 without a token, got %d", rr.Code)
+	}
+	if rr := fetch(t, srv, host, "/uploads/originals/"+photo.FileName); rr.Code != http.StatusNotFound {
+		t.Fatalf("expected originals to be unreachable under /uploads, got %d", rr.Code)
+	}
+
+	retained := filepath.Join("uploads", "originals", "default", photo.FileName)
+	if _, err := os.Stat(retained); err != nil {
+		t.Fatalf("expected retained original on disk: %v", err)
+	}
+	rr = doHostJSON(t, srv, host, http.MethodDelete, "/photos/?id="+photo.ID, nil, tok.AccessToken)
+	if rr.Code != http.StatusNoContent {
+		t.Fatalf("expected 204 deleting photo, got %d", rr.Code)
+	}
+	if _, err := os.Stat(retained); !os.IsNotExist(err) {
+		t.Fatalf("expected retained original to be removed, got %v", err)
+	}
+
+	// Without keep_original nothing is retained.
+	plain := decodeUploadResponse(t, uploadTestFile(t, srv, host, tok.AccessToken, "private.jpg", privateJPEG(t), nil))
+	if plain.OriginalRetained {
+		t.Fatal("expected no retained original by default")
+	}
+	if rr := doHostJSON(t, srv, host, http.MethodGet, "/photos/original?id="+plain.ID, nil, tok.AccessToken); rr.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for unretained original, got %d", rr.Code)
+	}
+
+	// The original is kept even when there was nothing to strip.
+	clean := encodeTestJPEG(t, 64, 48)
+	kept := decodeUploadResponse(t, uploadTestFile(t, srv, host, tok.AccessToken, "clean.jpg", clean, map[string]string{"keep_original": "true"}))
+	if !kept.OriginalRetained || len(kept.StrippedMetadata) != 0 {
+		t.Fatalf("expected a retained original with nothing stripped, got %v %v", kept.OriginalRetained, kept.StrippedMetadata)
+	}
+	rr = doHostJSON(t, srv, host, http.MethodGet, "/photos/original?id="+kept.ID, nil, tok.AccessToken)
+	if rr.Code != http.StatusOK || !bytes.Equal(rr.Body.Bytes(), clean) {
+		t.Fatalf("expected the untouched original, got %d (%d bytes)", rr.Code, rr.Body.Len())
+	}
+}
+
+func TestUpload_MetadataPolicies(t *testing.T) {
+	host := "example.com"
+
+	t.Run("strip_all", func(t *testing.T) {
+		srv := newImagesTestServer(t, config.ImagesConfig{MetadataPolicy: "strip_all"})
+		tok := loginOnHost(t, srv, host, "strip-all@example.com", "Str0ngP@ssw0rd!")
+		photo := decodeUploadResponse(t, uploadTestFile(t, srv, host, tok.AccessToken, "private.jpg", privateJPEG(t), nil))
+		if !slices.Contains(photo.StrippedMetadata, "camera_settings") {
+			t.Fatalf("expected camera_settings to be stripped, got %v", photo.StrippedMetadata)
+		}
+		meta, err := exif.Decode(bytes.NewReader(fetch(t, srv, host, photo.OriginalURL).Body.Bytes()))
+		if err != nil || meta.Orientation != 6 || meta.Make != "" || meta.ISO != 0 {
+			t.Fatalf("expected only orientation to remain, got %+v (%v)", meta, err)
+		}
+	})
+
+	t.Run("keep", func(t *testing.T) {
+		srv := newImagesTestServer(t, config.ImagesConfig{MetadataPolicy: "keep"})
+		tok := loginOnHost(t, srv, host, "keep@example.com", "Str0ngP@ssw0rd!")
+		upload := privateJPEG(t)
+		photo := decodeUploadResponse(t, uploadTestFile(t, srv, host, tok.AccessToken, "private.jpg", upload, nil))
+		if len(photo.StrippedMetadata) != 0 {
+			t.Fatalf("expected nothing stripped, got %v", photo.StrippedMetadata)
+		}
+		if !bytes.Equal(fetch(t, srv, host, photo.OriginalURL).Body.Bytes(), upload) {
+			t.Fatal("expected upload to be served byte-for-byte")
+		}
+	})
+}
@@ -0,0 +1,85 @@
+package api_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"nunoo.co/backend/models"
+)
+
+func listNotifications(t *testing.T, h http.Handler, host, token string) models.NotificationPage {
+	t.Helper()
+	rr := doHostJSON(t, h, host, http.MethodGet, "/notifications", nil, token)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 listing notifications, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var page models.NotificationPage
+	if err := json.Unmarshal(rr.Body.Bytes(), &page); err != nil {
+		t.Fatal(err)
+	}
+	return page
+}
+
+func unreadCount(t *testing.T, h http.Handler, host, token string) int64 {
+	t.Helper()
+	rr := doHostJSON(t, h, host, http.MethodGet, "/notifications/unread-count", nil, token)
+	var out map[string]int64
+	if err := json.Unmarshal(rr.Body.Bytes(), &out); err != nil {
+		t.Fatal(err)
+	}
+	return out["unread"]
+}
+
+func TestNotifications_GroupReadAndDismiss(t *testing.T) {
+	srv := newTestServer(t)
+	host := "example.com"
+
+	owner := loginOnHost(t, srv, host, "owner@example.com", "Str0ngP@ssw0rd!")
+	ownerID := userIDFor(t, srv, host, owner.AccessToken)
+
+	// Three new followers collapse into one unread entry
+	for _, email := range []string{"f1@example.com", "f2@example.com", "f3@example.com"} {
+		follower := loginOnHost(t, srv, host, email, "Str0ngP@ssw0rd!")
+		if rr := doHostJSON(t, srv, host, http.MethodPut, "/users/"+ownerID+"/follow", nil, follower.AccessToken); rr.Code != http.StatusOK {
+			t.Fatalf("expected 200 for follow, got %d", rr.Code)
+		}
+	}
+
+	page := listNotifications(t, srv, host, owner.AccessToken)
+	if len(page.Notifications) != 1 {
+		t.Fatalf("expected one grouped notification, got %d", len(page.Notifications))
+	}
+	n := page.Notifications[0]
+	if n.Kind != models.NotificationFollow || n.ActorCount != 3 || len(n.ActorIDs) != 3 || n.Read {
+		t.Fatalf("unexpected grouped notification: %+v", n)
+	}
+	if got := unreadCount(t, srv, host, owner.AccessToken); got != 1 {
+		t.Fatalf("expected 1 unread, got %d", got)
+	}
+
+	if rr := doHostJSON(t, srv, host, http.MethodPost, "/notifications/read", map[string]any{}, owner.AccessToken); rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for empty selection, got %d", rr.Code)
+	}
+	if rr := doHostJSON(t, srv, host, http.MethodPost, "/notifications/read", map[string]any{"ids": []string{n.ID}}, owner.AccessToken); rr.Code != http.StatusNoContent {
+		t.Fatalf("expected 204 marking read, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if got := unreadCount(t, srv, host, owner.AccessToken); got != 0 {
+		t.Fatalf("expected 0 unread after marking read, got %d", got)
+	}
+
+	// A follower after the group was read starts a new entry
+	late := loginOnHost(t, srv, host, "f4@example.com", "Str0ngP@ssw0rd!")
+	_ = doHostJSON(t, srv, host, http.MethodPut, "/users/"+ownerID+"/follow", nil, late.AccessToken)
+	page = listNotifications(t, srv, host, owner.AccessToken)
+	if len(page.Notifications) != 2 || page.Notifications[0].Read || page.Notifications[0].ActorCount != 1 {
+		t.Fatalf("expected a new unread entry on top, got %+v", page.Notifications)
+	}
+
+	if rr := doHostJSON(t, srv, host, http.MethodPost, "/notifications/dismiss", map[string]any{"all": true}, owner.AccessToken); rr.Code != http.StatusNoContent {
+		t.Fatalf("expected 204 dismissing, got %d", rr.Code)
+	}
+	if page := listNotifications(t, srv, host, owner.AccessToken); len(page.Notifications) != 0 {
+		t.Fatalf("expected no notifications after dismiss, got %d", len(page.Notifications))
+	}
+}
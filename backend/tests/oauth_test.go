@@ -0,0 +1,116 @@
+package api_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"nunoo.co/backend/api"
+	"nunoo.co/backend/config"
+)
+
+type introspection struct {
+	Active    bool   `json:"active"`
+	Scope     string `json:"scope"`
+	TokenType string `json:"token_type"`
+	ClientID  string `json:"client_id"`
+	Sub       string `json:"sub"`
+	Exp       int64  `json:"exp"`
+}
+
+func newOAuthTestServer(t *testing.T) http.Handler {
+	t.Helper()
+	cfg := &config.Config{
+		JWT: config.JWTConfig{
+			Secret:        "test-secret-access",
+			RefreshSecret: "test-secret-refresh",
+		},
+		OAuth: config.OAuthConfig{
+			Clients: []config.OAuthClient{{ID: "worker", Secret: "worker-secret"}},
+		},
+	}
+	return api.NewServerForTesting(cfg)
+}
+
+func doForm(t *testing.T, h http.Handler, path string, form url.Values, clientID, clientSecret string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if clientID != "" {
+		req.SetBasicAuth(clientID, clientSecret)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func introspect(t *testing.T, h http.Handler, token string) introspection {
+	t.Helper()
+	rr := doForm(t, h, "/oauth/introspect", url.Values{"token": {token}}, "worker", "worker-secret")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 from introspect, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var out introspection
+	if err := json.Unmarshal(rr.Body.Bytes(), &out); err != nil {
+		t.Fatalf("invalid introspection json: %v", err)
+	}
+	return out
+}
+
+func TestOAuth_IntrospectAndRevoke(t *testing.T) {
+	srv := newOAuthTestServer(t)
+
+	email := "oauth@example.com"
+	password := "Str0ngP@ssw0rd!"
+	_ = doJSON(t, srv, http.MethodPost, "/auth/register", registerRequest{Email: email, Password: password})
+	lr := doJSON(t, srv, http.MethodPost, "/auth/login", registerRequest{Email: email, Password: password})
+	var tok tokenResponse
+	if err := json.Unmarshal(lr.Body.Bytes(), &tok); err != nil {
+		t.Fatalf("invalid login response json: %v", err)
+	}
+
+	// Client authentication is required
+	if rr := doForm(t, srv, "/oauth/introspect", url.Values{"token": {tok.AccessToken}}, "worker", "wrong"); rr.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 for bad client credentials, got %d", rr.Code)
+	}
+
+	access := introspect(t, srv, tok.AccessToken)
+	if !access.Active || access.TokenType != "access_token" || access.Sub == "" || access.Exp == 0 || access.Scope == "" {
+		t.Fatalf("unexpected access token introspection: %+v", access)
+	}
+	// client_id names the client the token was issued to, not the caller
+	if access.ClientID != "" {
+		t.Fatalf("expected no client_id for a first-party token, got %q", access.ClientID)
+	}
+	refresh := introspect(t, srv, tok.RefreshToken)
+	if !refresh.Active || refresh.TokenType != "refresh_token" || refresh.Sub != access.Sub {
+		t.Fatalf("unexpected refresh token introspection: %+v", refresh)
+	}
+	if garbage := introspect(t, srv, "not-a-jwt"); garbage.Active {
+		t.Fatalf("expected garbage token to be inactive")
+	}
+
+	// Revoke the access token; it must stop working everywhere
+	if rr := doForm(t, srv, "/oauth/revoke", url.Values{"token": {tok.AccessToken}}, "worker", "worker-secret"); rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 from revoke, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if after := introspect(t, srv, tok.AccessToken); after.Active {
+		t.Fatalf("expected revoked access token to be inactive")
+	}
+	if mr := doWithHeaders(t, srv, http.MethodGet, "/me", authHeader(tok.AccessToken)); mr.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 for revoked token on /me, got %d", mr.Code)
+	}
+
+	// Revoke the refresh token; refreshing must fail
+	form := url.Values{"token": {tok.RefreshToken}, "token_type_hint": {"refresh_token"}}
+	if rr := doForm(t, srv, "/oauth/revoke", form, "worker", "worker-secret"); rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 from revoke, got %d: %s", rr.Code, rr.Body.String())
+	}
+	rfr := doJSON(t, srv, http.MethodPost, "/auth/refresh", map[string]string{"refresh_token": tok.RefreshToken})
+	if rfr.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 refreshing with revoked token, got %d: %s", rfr.Code, rfr.Body.String())
+	}
+}
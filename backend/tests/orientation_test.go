@@ -0,0 +1,76 @@
+package api_test
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// The fixtures in testdata/orientation_N.jpg store the same 60x40 image,
+// transformed so that EXIF orientation N displays it upright: red top-left,
+// green top-right, blue bottom-left, white bottom-right.
+func assertUpright(t *testing.T, data []byte) {
+	t.Helper()
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("not an image: %v", err)
+	}
+	b := img.Bounds()
+	if b.Dx() != 60 || b.Dy() != 40 {
+		t.Fatalf("expected 60x40, got %dx%d", b.Dx(), b.Dy())
+	}
+	quadrants := []struct {
+		x, y    int
+		name    string
+		r, g, b bool
+	}{
+		{15, 10, "red", true, false, false},
+		{45, 10, "green", false, true, false},
+		{15, 30, "blue", false, false, true},
+		{45, 30, "white", true, true, true},
+	}
+	for _, q := range quadrants {
+		r, g, bl, _ := img.At(b.Min.X+q.x, b.Min.Y+q.y).RGBA()
+		if (r > 0x8000) != q.r || (g > 0x8000) != q.g || (bl > 0x8000) != q.b {
+			t.Fatalf("expected %s at (%d,%d), got rgb(%d,%d,%d)", q.name, q.x, q.y, r>>8, g>>8, bl>>8)
+		}
+	}
+}
+
+func TestUpload_AppliesExifOrientation(t *testing.T) {
+	srv := newTestServer(t)
+	host := "example.com"
+	tok := loginOnHost(t, srv, host, "orientation@example.com", "Str0ngP@ssw0rd!")
+
+	for o := 1; o <= 8; o++ {
+		t.Run(fmt.Sprintf("orientation %d", o), func(t *testing.T) {
+			data, err := os.ReadFile(filepath.Join("testdata", fmt.Sprintf("orientation_%d.jpg", o)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			photo := decodeUploadResponse(t, uploadTestFile(t, srv, host, tok.AccessToken, "phone.jpg", data, nil))
+			if photo.Width != 60 || photo.Height != 40 {
+				t.Fatalf("expected upright 60x40 dimensions, got %dx%d", photo.Width, photo.Height)
+			}
+			if photo.Exif == nil || photo.Exif.Orientation != o {
+				t.Fatalf("expected orientation %d to be recorded, got %+v", o, photo.Exif)
+			}
+
+			rr := fetch(t, srv, host, photo.ThumbnailURL)
+			if rr.Code != http.StatusOK {
+				t.Fatalf("expected 200 fetching thumbnail, got %d", rr.Code)
+			}
+			assertUpright(t, rr.Body.Bytes())
+
+			rr = fetch(t, srv, host, "/iiif/"+photo.ID+"/full/max/0/default.png")
+			if rr.Code != http.StatusOK {
+				t.Fatalf("expected 200 from IIIF, got %d", rr.Code)
+			}
+			assertUpright(t, rr.Body.Bytes())
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package api_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"nunoo.co/backend/models"
+)
+
+func TestPhotoFeedPagination(t *testing.T) {
+	srv := newTestServer(t)
+	host := "example.com"
+	owner := loginOnHost(t, srv, host, "pages@example.com", "Str0ngP@ssw0rd!")
+
+	var uploaded []string
+	for range 5 {
+		uploaded = append(uploaded, uploadTestPhoto(t, srv, host, owner.AccessToken, nil).ID)
+	}
+
+	getFeed := func(query string) (models.PhotoFeed, http.Header) {
+		t.Helper()
+		rr := doHostJSON(t, srv, host, http.MethodGet, "/photos/feed?"+query, nil, "")
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected 200 for %q, got %d: %s", query, rr.Code, rr.Body.String())
+		}
+		var feed models.PhotoFeed
+		if err := json.Unmarshal(rr.Body.Bytes(), &feed); err != nil {
+			t.Fatal(err)
+		}
+		return feed, rr.Header()
+	}
+
+	for _, q := range []string{"cursor=!!", "cursor=&sort=taken_at"} {
+		if rr := doHostJSON(t, srv, host, http.MethodGet, "/photos/feed?"+q, nil, ""); rr.Code != http.StatusBadRequest {
+			t.Fatalf("expected 400 for %q, got %d", q, rr.Code)
+		}
+	}
+
+	// Offset paging still counts, and also hands out a cursor.
+	feed, header := getFeed("page=2&limit=2")
+	if feed.TotalCount != 5 || !feed.HasMore || feed.NextCursor == "" {
+		t.Fatalf("unexpected offset page %+v", feed)
+	}
+	link := header.Get("Link")
+	if !strings.Contains(link, "page=3") || !strings.Contains(link, `rel="next"`) || !strings.Contains(link, `rel="prev"`) {
+		t.Fatalf("unexpected Link header %q", link)
+	}
+
+	// Keyset paging is not shifted by uploads made mid-scroll.
+	feed, header = getFeed("cursor=&limit=2")
+	if feed.TotalCount != 0 || len(feed.Photos) != 2 || feed.Photos[0].ID != uploaded[4] {
+		t.Fatalf("unexpected first cursor page %+v", feed)
+	}
+	if link := header.Get("Link"); !strings.Contains(link, "cursor="+url.QueryEscape(feed.NextCursor)) {
+		t.Fatalf("expected the next cursor in the Link header, got %q", link)
+	}
+	seen := []string{feed.Photos[0].ID, feed.Photos[1].ID}
+	uploadTestPhoto(t, srv, host, owner.AccessToken, nil)
+	for feed.HasMore {
+		feed, _ = getFeed("limit=2&cursor=" + url.QueryEscape(feed.NextCursor))
+		for _, p := range feed.Photos {
+			seen = append(seen, p.ID)
+		}
+	}
+	if len(seen) != 5 {
+		t.Fatalf("expected each of the 5 original photos once, got %v", seen)
+	}
+	for i, id := range seen {
+		if id != uploaded[4-i] {
+			t.Fatalf("expected newest-first order %v, got %v", uploaded, seen)
+		}
+	}
+
+	feed, _ = getFeed("cursor=&total=approx")
+	if feed.ApproximateTotal == nil || *feed.ApproximateTotal != 6 {
+		t.Fatalf("expected an approximate total of 6, got %v", feed.ApproximateTotal)
+	}
+}
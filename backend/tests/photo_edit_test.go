@@ -0,0 +1,145 @@
+package api_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"nunoo.co/backend/api"
+	"nunoo.co/backend/config"
+	"nunoo.co/backend/models"
+)
+
+func patchPhoto(t *testing.T, h http.Handler, id, token, ifMatch string, body any) *httptest.ResponseRecorder {
+	t.Helper()
+	var buf bytes.Buffer
+	if s, ok := body.(string); ok {
+		buf.WriteString(s)
+	} else if err := json.NewEncoder(&buf).Encode(body); err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(http.MethodPatch, "/photos/"+id, &buf)
+	req.Host = "example.com"
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	if ifMatch != "" {
+		req.Header.Set("If-Match", ifMatch)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	// Stay under the server's burst limit across the many small requests here.
+	time.Sleep(50 * time.Millisecond)
+	return rec
+}
+
+func decodePhoto(t *testing.T, rec *httptest.ResponseRecorder) models.Photo {
+	t.Helper()
+	var got struct {
+		Photo models.Photo `json:"photo"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("failed to decode photo: %v: %s", err, rec.Body.String())
+	}
+	return got.Photo
+}
+
+func TestUpdatePhoto(t *testing.T) {
+	cfg := &config.Config{
+		JWT: config.JWTConfig{
+			Secret:        "test-secret-access",
+			RefreshSecret: "test-secret-refresh",
+		},
+		// An email names no admin: anyone could register it.
+		Security: config.SecurityConfig{Admins: []string{"edit-other@example.com"}},
+	}
+	srv := api.NewServerForTesting(cfg)
+	host := "example.com"
+	owner := loginOnHost(t, srv, host, "edit-owner@example.com", "Str0ngP@ssw0rd!")
+	other := loginOnHost(t, srv, host, "edit-other@example.com", "Str0ngP@ssw0rd!")
+	admin := loginOnHost(t, srv, host, "edit-admin@example.com", "Str0ngP@ssw0rd!")
+	cfg.Security.Admins = append(cfg.Security.Admins, userIDFor(t, srv, host, admin.AccessToken))
+
+	photo := uploadTestPhoto(t, srv, host, owner.AccessToken, map[string]string{"caption": "teh sunset"})
+	if photo.Version != 1 {
+		t.Fatalf("expected version 1, got %d", photo.Version)
+	}
+	rr := doHostJSON(t, srv, host, http.MethodGet, "/photos/?id="+photo.ID, nil, "")
+	if etag := rr.Header().Get("ETag"); etag != `"1"` {
+		t.Fatalf("expected ETag \"1\", got %q", etag)
+	}
+
+	for _, tc := range []struct {
+		name    string
+		token   string
+		ifMatch string
+		body    any
+		want    int
+	}{
+		{"anonymous", "", `"1"`, map[string]string{"caption": "x"}, http.StatusUnauthorized},
+		{"no If-Match", owner.AccessToken, "", map[string]string{"caption": "x"}, http.StatusPreconditionRequired},
+		{"malformed json", owner.AccessToken, `"1"`, "{", http.StatusBadRequest},
+		{"unknown field", owner.AccessToken, `"1"`, map[string]string{"file_name": "x.jpg"}, http.StatusBadRequest},
+		{"bad visibility", owner.AccessToken, `"1"`, map[string]string{"visibility": "secret"}, http.StatusBadRequest},
+		{"bad taken_at", owner.AccessToken, `"1"`, map[string]string{"taken_at": "yesterday"}, http.StatusBadRequest},
+		{"long caption", owner.AccessToken, `"1"`, map[string]string{"caption": strings.Repeat("a", 2001)}, http.StatusBadRequest},
+		{"not the owner", other.AccessToken, `"1"`, map[string]string{"caption": "x"}, http.StatusForbidden},
+	} {
+		if rr := patchPhoto(t, srv, photo.ID, tc.token, tc.ifMatch, tc.body); rr.Code != tc.want {
+			t.Fatalf("%s: expected %d, got %d: %s", tc.name, tc.want, rr.Code, rr.Body.String())
+		}
+	}
+	if rr := patchPhoto(t, srv, "photo_missing", owner.AccessToken, `"1"`, map[string]string{"caption": "x"}); rr.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for an unknown photo, got %d", rr.Code)
+	}
+
+	rr = patchPhoto(t, srv, photo.ID, owner.AccessToken, `"1"`, map[string]string{
+		"caption":    "The sunset",
+		"alt_text":   "Orange sky over the bay",
+		"visibility": "unlisted",
+		"taken_at":   "2024-05-01T19:30:00+02:00",
+	})
+	if rr.Code != http.StatusOK || rr.Header().Get("ETag") != `"2"` {
+		t.Fatalf("expected 200 with ETag \"2\", got %d %q: %s", rr.Code, rr.Header().Get("ETag"), rr.Body.String())
+	}
+	edited := decodePhoto(t, rr)
+	if edited.Caption != "The sunset" || edited.AltText != "Orange sky over the bay" || edited.Visibility != models.VisibilityUnlisted ||
+		edited.TakenAt == nil || !edited.TakenAt.Equal(time.Date(2024, 5, 1, 17, 30, 0, 0, time.UTC)) || edited.Version != 2 {
+		t.Fatalf("unexpected edited photo: %+v", edited)
+	}
+	if edited.FileName != photo.FileName || edited.ContentHash != photo.ContentHash {
+		t.Fatal("expected fields outside the patch to be kept")
+	}
+
+	// A second editor still holding version 1 is refused, not overwritten.
+	rr = patchPhoto(t, srv, photo.ID, owner.AccessToken, `"1"`, map[string]string{"caption": "stale"})
+	if rr.Code != http.StatusPreconditionFailed || rr.Header().Get("ETag") != `"2"` {
+		t.Fatalf("expected 412 with the current ETag, got %d %q", rr.Code, rr.Header().Get("ETag"))
+	}
+
+	// Admins may edit anyone's photo; an empty taken_at clears it.
+	rr = patchPhoto(t, srv, photo.ID, admin.AccessToken, `"2"`, map[string]string{"taken_at": ""})
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected the admin to edit, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if p := decodePhoto(t, rr); p.TakenAt != nil || p.Caption != "The sunset" || p.Version != 3 {
+		t.Fatalf("unexpected photo after admin edit: %+v", p)
+	}
+
+	// Going private hides the photo from everyone else, edits included.
+	if rr := patchPhoto(t, srv, photo.ID, owner.AccessToken, "*", map[string]string{"visibility": "private"}); rr.Code != http.StatusOK {
+		t.Fatalf("expected If-Match * to match, got %d", rr.Code)
+	}
+	if rr := patchPhoto(t, srv, photo.ID, other.AccessToken, "*", map[string]string{"caption": "x"}); rr.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 editing another user's private photo, got %d", rr.Code)
+	}
+	rr = doHostJSON(t, srv, host, http.MethodGet, "/photos/?id="+photo.ID, nil, owner.AccessToken)
+	if p := decodePhoto(t, rr); p.Visibility != models.VisibilityPrivate || p.Version != 4 || rr.Header().Get("ETag") != `"4"` {
+		t.Fatalf("expected the edit to be stored, got %+v", p)
+	}
+}
@@ -0,0 +1,70 @@
+package api_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+type preferencesEnvelope struct {
+	Preferences struct {
+		Version             int      `json:"version"`
+		DefaultVisibility   string   `json:"default_visibility"`
+		FeedDensity         string   `json:"feed_density"`
+		Locale              string   `json:"locale"`
+		NotificationOptOuts []string `json:"notification_opt_outs"`
+	} `json:"preferences"`
+}
+
+func TestPreferences_DefaultsPatchAndValidation(t *testing.T) {
+	srv := newTestServer(t)
+	tok := loginOnHost(t, srv, "example.com", "prefs@example.com", "Str0ngP@ssw0rd!")
+
+	// Defaults are returned before anything is stored
+	rr := doHostJSON(t, srv, "example.com", http.MethodGet, "/me/preferences", nil, tok.AccessToken)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var got preferencesEnvelope
+	if err := json.Unmarshal(rr.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Preferences.Version != 1 || got.Preferences.DefaultVisibility != "public" || got.Preferences.Locale != "en" {
+		t.Fatalf("unexpected defaults: %+v", got.Preferences)
+	}
+
+	invalid := []map[string]any{
+		{"default_visibility": "secret"},
+		{"feed_density": "huge"},
+		{"locale": "not a locale"},
+		{"notification_opt_outs": []string{"spam"}},
+		{"unknown_field": true},
+	}
+	for i, body := range invalid {
+		rr := doHostJSON(t, srv, "example.com", http.MethodPatch, "/me/preferences", body, tok.AccessToken)
+		if rr.Code != http.StatusBadRequest {
+			t.Fatalf("case %d expected 400, got %d: %s", i, rr.Code, rr.Body.String())
+		}
+	}
+
+	patch := map[string]any{"default_visibility": "private", "locale": "pt-BR", "notification_opt_outs": []string{"like"}}
+	rr = doHostJSON(t, srv, "example.com", http.MethodPatch, "/me/preferences", patch, tok.AccessToken)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 for patch, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	// Unpatched fields keep their defaults and the patch is persisted
+	rr = doHostJSON(t, srv, "example.com", http.MethodGet, "/me/preferences", nil, tok.AccessToken)
+	got = preferencesEnvelope{}
+	if err := json.Unmarshal(rr.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	p := got.Preferences
+	if p.DefaultVisibility != "private" || p.Locale != "pt-BR" || p.FeedDensity != "comfortable" || len(p.NotificationOptOuts) != 1 {
+		t.Fatalf("unexpected preferences after patch: %+v", p)
+	}
+
+	if rr := doHostJSON(t, srv, "example.com", http.MethodGet, "/me/preferences", nil, ""); rr.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 without token, got %d", rr.Code)
+	}
+}
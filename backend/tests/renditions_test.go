@@ -0,0 +1,108 @@
+package api_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"image"
+	"net/http"
+	"slices"
+	"testing"
+
+	"nunoo.co/backend/api"
+	"nunoo.co/backend/config"
+	"nunoo.co/backend/models"
+)
+
+func TestUpload_GeneratesRenditions(t *testing.T) {
+	srv := newTestServer(t)
+	host := "example.com"
+	tok := loginOnHost(t, srv, host, "renditions@example.com", "Str0ngP@ssw0rd!")
+
+	photo := decodeUploadResponse(t, uploadTestFile(t, srv, host, tok.AccessToken, "wide.jpg", encodeTestJPEG(t, 1500, 1000), nil))
+
+	// 2048 is wider than the original and must not be generated.
+	want := []struct{ w, h int }{{320, 213}, {640, 426}, {1280, 853}}
+	if len(photo.Variants) != len(want) {
+		t.Fatalf("expected %d variants, got %+v", len(want), photo.Variants)
+	}
+	for i, v := range photo.Variants {
+		if v.Width != want[i].w || v.Height != want[i].h || v.Format != "jpeg" {
+			t.Fatalf("variant %d: expected jpeg %dx%d, got %+v", i, want[i].w, want[i].h, v)
+		}
+		rr := fetch(t, srv, host, v.URL)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected 200 fetching %s, got %d", v.URL, rr.Code)
+		}
+		if int64(rr.Body.Len()) != v.Bytes {
+			t.Fatalf("variant %d: expected %d bytes, got %d", i, v.Bytes, rr.Body.Len())
+		}
+		cfg, _, err := image.DecodeConfig(bytes.NewReader(rr.Body.Bytes()))
+		if err != nil || cfg.Width != v.Width || cfg.Height != v.Height {
+			t.Fatalf("variant %d: decoded %dx%d (%v)", i, cfg.Width, cfg.Height, err)
+		}
+	}
+
+	rr := doHostJSON(t, srv, host, http.MethodGet, "/photos/?id="+photo.ID, nil, "")
+	var got struct {
+		Photo models.Photo `json:"photo"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &got); err != nil {
+		t.Fatalf("decode photo: %v", err)
+	}
+	if len(got.Photo.Variants) != len(want) {
+		t.Fatalf("expected GetPhoto to return variants, got %+v", got.Photo.Variants)
+	}
+
+	rr = doHostJSON(t, srv, host, http.MethodGet, "/photos/feed", nil, "")
+	var feed models.PhotoFeed
+	if err := json.Unmarshal(rr.Body.Bytes(), &feed); err != nil {
+		t.Fatalf("decode feed: %v", err)
+	}
+	if len(feed.Photos) == 0 || len(feed.Photos[0].Variants) != len(want) {
+		t.Fatalf("expected feed to include variants, got %+v", feed.Photos)
+	}
+
+	rr = doHostJSON(t, srv, host, http.MethodDelete, "/photos/?id="+photo.ID, nil, tok.AccessToken)
+	if rr.Code != http.StatusNoContent {
+		t.Fatalf("expected 204 deleting photo, got %d", rr.Code)
+	}
+	for _, v := range photo.Variants {
+		if rr := fetch(t, srv, host, v.URL); rr.Code != http.StatusNotFound {
+			t.Fatalf("expected %s to be removed, got %d", v.URL, rr.Code)
+		}
+	}
+}
+
+func TestConfig_RenditionWidthsAreUnique(t *testing.T) {
+	cfg := &config.Config{Images: config.ImagesConfig{Renditions: []config.Rendition{
+		{Width: 640, Quality: 80}, {Width: 320, Quality: 75}, {Width: 640, Quality: 90},
+	}}}
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	want := []config.Rendition{{Width: 640, Quality: 80}, {Width: 320, Quality: 75}}
+	if !slices.Equal(cfg.Images.Renditions, want) {
+		t.Fatalf("expected %v, got %v", want, cfg.Images.Renditions)
+	}
+
+	for _, bad := range []config.Rendition{{Width: 0, Quality: 80}, {Width: 320, Quality: 0}, {Width: 320, Quality: 101}} {
+		cfg := &config.Config{Images: config.ImagesConfig{Renditions: []config.Rendition{bad}}}
+		if err := cfg.Validate(); err == nil {
+			t.Fatalf("expected %+v to be rejected", bad)
+		}
+	}
+
+	// Duplicates that reach the server directly still upload once per width.
+	srv := api.NewServerForTesting(&config.Config{
+		JWT: config.JWTConfig{Secret: "test-secret-access", RefreshSecret: "test-secret-refresh"},
+		Images: config.ImagesConfig{Renditions: []config.Rendition{
+			{Width: 320, Quality: 75}, {Width: 320, Quality: 90},
+		}},
+	})
+	host := "example.com"
+	tok := loginOnHost(t, srv, host, "dup-widths@example.com", "Str0ngP@ssw0rd!")
+	photo := decodeUploadResponse(t, uploadTestFile(t, srv, host, tok.AccessToken, "wide.jpg", encodeTestJPEG(t, 800, 600), nil))
+	if len(photo.Variants) != 1 || photo.Variants[0].Width != 320 {
+		t.Fatalf("expected one 320px variant, got %+v", photo.Variants)
+	}
+}
@@ -0,0 +1,107 @@
+package api_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"nunoo.co/backend/models"
+)
+
+func searchPhotos(t *testing.T, h http.Handler, host, query, token string) models.PhotoSearchResults {
+	t.Helper()
+	rr := doHostJSON(t, h, host, http.MethodGet, "/photos/search?"+query, nil, token)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 searching %q, got %d: %s", query, rr.Code, rr.Body.String())
+	}
+	var results models.PhotoSearchResults
+	if err := json.Unmarshal(rr.Body.Bytes(), &results); err != nil {
+		t.Fatal(err)
+	}
+	return results
+}
+
+func hitIDs(results models.PhotoSearchResults) []string {
+	ids := []string{}
+	for _, hit := range results.Hits {
+		ids = append(ids, hit.Photo.ID)
+	}
+	return ids
+}
+
+func TestSearchPhotos(t *testing.T) {
+	srv := newTestServer(t)
+	host := "example.com"
+	owner := loginOnHost(t, srv, host, "search@example.com", "Str0ngP@ssw0rd!")
+
+	for _, q := range []string{"", "q=+", "q=x&cursor=!!"} {
+		if rr := doHostJSON(t, srv, host, http.MethodGet, "/photos/search?"+q, nil, ""); rr.Code != http.StatusBadRequest {
+			t.Fatalf("expected 400 for %q, got %d", q, rr.Code)
+		}
+	}
+
+	dusk := uploadTestPhoto(t, srv, host, owner.AccessToken, map[string]string{"caption": "Lighthouse at dusk", "tags": "coast"})
+	road := uploadTestPhoto(t, srv, host, owner.AccessToken, map[string]string{"caption": "Coast road", "tags": "lighthouse"})
+	private := uploadTestPhoto(t, srv, host, owner.AccessToken, map[string]string{"caption": "Secret lighthouse", "visibility": "private"})
+	ifd0, sub := cameraExif("FUJIFILM", "X-T4", 400, "2024:05:01 10:30:00", "")
+	camera := decodeUploadResponse(t, uploadTestFile(t, srv, host, owner.AccessToken, "camera.jpg", withExif(t, encodeTestJPEG(t, 16, 16), ifd0, sub), nil))
+
+	// Caption matches outrank tag matches; only the caption is highlighted.
+	results := searchPhotos(t, srv, host, "q=LIGHTHOUSE", "")
+	if got := hitIDs(results); len(got) != 2 || got[0] != dusk.ID || got[1] != road.ID {
+		t.Fatalf("expected the caption match before the tag match, got %v", got)
+	}
+	if results.Hits[0].Rank <= results.Hits[1].Rank {
+		t.Fatalf("expected decreasing ranks, got %v and %v", results.Hits[0].Rank, results.Hits[1].Rank)
+	}
+	if h := results.Hits[0].Highlight; h != "<mark>Lighthouse</mark> at dusk" {
+		t.Fatalf("unexpected highlight %q", h)
+	}
+	if h := results.Hits[1].Highlight; h != "" {
+		t.Fatalf("expected no highlight for a tag match, got %q", h)
+	}
+
+	// Owners also find their private photos.
+	if got := hitIDs(searchPhotos(t, srv, host, "q=lighthouse", owner.AccessToken)); len(got) != 3 {
+		t.Fatalf("expected the owner to find 3 photos, got %v", got)
+	}
+	if got := hitIDs(searchPhotos(t, srv, host, "q=secret", "")); len(got) != 0 {
+		t.Fatalf("expected private photos to stay hidden, got %v", got)
+	}
+	if got := hitIDs(searchPhotos(t, srv, host, "q=secret", owner.AccessToken)); len(got) != 1 || got[0] != private.ID {
+		t.Fatalf("expected the owner's private photo, got %v", got)
+	}
+
+	// Every word must match; camera and lens are searchable.
+	if got := hitIDs(searchPhotos(t, srv, host, "q=coast+dusk", "")); len(got) != 1 || got[0] != dusk.ID {
+		t.Fatalf("expected only the photo matching both words, got %v", got)
+	}
+	if got := hitIDs(searchPhotos(t, srv, host, "q=fujifilm+xf35mmf1", "")); len(got) != 1 || got[0] != camera.ID {
+		t.Fatalf("expected the camera match, got %v", got)
+	}
+
+	// Cursors page through hits without repeats.
+	first := searchPhotos(t, srv, host, "q=lighthouse&limit=1", "")
+	if !first.HasMore || first.NextCursor == "" || hitIDs(first)[0] != dusk.ID {
+		t.Fatalf("unexpected first page %+v", first)
+	}
+	second := searchPhotos(t, srv, host, "q=lighthouse&limit=1&cursor="+url.QueryEscape(first.NextCursor), "")
+	if second.HasMore || len(second.Hits) != 1 || second.Hits[0].Photo.ID != road.ID {
+		t.Fatalf("unexpected second page %+v", second)
+	}
+
+	// Edits and deletes update the index.
+	if rr := patchPhoto(t, srv, road.ID, owner.AccessToken, "*", map[string]string{"caption": "Keeper's cottage"}); rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 editing caption, got %d", rr.Code)
+	}
+	if got := hitIDs(searchPhotos(t, srv, host, "q=cottage", "")); len(got) != 1 || got[0] != road.ID {
+		t.Fatalf("expected the edited caption to be found, got %v", got)
+	}
+	if rr := doHostJSON(t, srv, host, http.MethodDelete, "/photos/?id="+dusk.ID, nil, owner.AccessToken); rr.Code != http.StatusNoContent {
+		t.Fatalf("expected 204 deleting photo, got %d", rr.Code)
+	}
+	if got := hitIDs(searchPhotos(t, srv, host, "q=dusk", "")); len(got) != 0 {
+		t.Fatalf("expected the deleted photo to leave the index, got %v", got)
+	}
+}
@@ -0,0 +1,246 @@
+package api_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"nunoo.co/backend/api"
+	"nunoo.co/backend/config"
+	"nunoo.co/backend/handlers"
+	"nunoo.co/backend/models"
+)
+
+func newSigningServer(t *testing.T, signed config.SignedURLsConfig) http.Handler {
+	t.Helper()
+	return api.NewServerForTesting(&config.Config{
+		JWT: config.JWTConfig{
+			Secret:        "test-secret-access",
+			RefreshSecret: "test-secret-refresh",
+		},
+		Uploads: config.UploadsConfig{SignedURLs: signed},
+	})
+}
+
+// getFile GETs path on host with an optional bearer token and extra headers.
+func getFile(t *testing.T, h http.Handler, host, path, token string, headers map[string]string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	req.Host = host
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestSignedURLs_RestrictedFiles(t *testing.T) {
+	srv := newSigningServer(t, config.SignedURLsConfig{
+		Keys:    []config.SigningKey{{ID: "k2", Secret: "second-secret"}, {ID: "k1", Secret: "first-secret"}},
+		SignAll: true,
+	})
+	host := "example.com"
+	tok := loginOnHost(t, srv, host, "signed@example.com", "Str0ngP@ssw0rd!")
+
+	photo := decodeUploadResponse(t, uploadTestFile(t, srv, host, tok.AccessToken, "signed.jpg", encodeTestJPEG(t, 500, 400), nil))
+	for _, u := range []string{photo.OriginalURL, photo.ThumbnailURL, photo.Variants[0].URL} {
+		parsed, err := url.Parse(u)
+		if err != nil || parsed.Query().Get("kid") != "k2" || parsed.Query().Get("sig") == "" || parsed.Query().Get("expires") == "" {
+			t.Fatalf("expected %q to be signed with the first key", u)
+		}
+		if rr := getFile(t, srv, host, u, "", nil); rr.Code != http.StatusOK {
+			t.Fatalf("expected signed %s to be served, got %d: %s", parsed.Path, rr.Code, rr.Body.String())
+		}
+		if rr := getFile(t, srv, host, parsed.Path, "", nil); rr.Code != http.StatusNotFound {
+			t.Fatalf("expected unsigned %s to be refused, got %d", parsed.Path, rr.Code)
+		}
+	}
+
+	// Signed responses still support ranges and revalidation.
+	rr := getFile(t, srv, host, photo.OriginalURL, "", map[string]string{"Range": "bytes=0-3"})
+	if rr.Code != http.StatusPartialContent || rr.Body.Len() != 4 || rr.Header().Get("Cache-Control") != "private" {
+		t.Fatalf("expected a private 206, got %d %v", rr.Code, rr.Header())
+	}
+	etag := rr.Header().Get("ETag")
+	if rr := getFile(t, srv, host, photo.OriginalURL, "", map[string]string{"If-None-Match": etag}); rr.Code != http.StatusNotModified {
+		t.Fatalf("expected 304, got %d", rr.Code)
+	}
+
+	// A signature is only good for the path, expiry and key it was made for.
+	signed, _ := url.Parse(photo.OriginalURL)
+	q := signed.Query()
+	tampered := []url.Values{}
+	for _, change := range []func(url.Values){
+		func(v url.Values) { v.Set("sig", strings.Repeat("A", len(v.Get("sig")))) },
+		func(v url.Values) { v.Set("expires", "99999999999") },
+		func(v url.Values) { v.Set("kid", "k1") },
+		func(v url.Values) { v.Set("kid", "unknown") },
+		func(v url.Values) { v.Set("uid", "usr_someone") },
+	} {
+		v := url.Values{}
+		for k, vs := range q {
+			v[k] = append([]string(nil), vs...)
+		}
+		change(v)
+		tampered = append(tampered, v)
+	}
+	for _, v := range tampered {
+		if rr := getFile(t, srv, host, signed.Path+"?"+v.Encode(), "", nil); rr.Code != http.StatusForbidden {
+			t.Fatalf("expected 403 for %v, got %d", v, rr.Code)
+		}
+	}
+	thumb, _ := url.Parse(photo.ThumbnailURL)
+	if rr := getFile(t, srv, host, thumb.Path+"?"+q.Encode(), "", nil); rr.Code != http.StatusForbidden {
+		t.Fatalf("expected another file's signature to be refused, got %d", rr.Code)
+	}
+
+	// Other responses sign too.
+	rr = doHostJSON(t, srv, host, http.MethodGet, "/photos/?id="+photo.ID, nil, "")
+	var got struct {
+		Photo models.Photo `json:"photo"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(got.Photo.OriginalURL, "sig=") {
+		t.Fatalf("expected GetPhoto to sign URLs, got %q", got.Photo.OriginalURL)
+	}
+
+	// IIIF URLs cannot be signed, so restricted photos are owner-only there.
+	if rr := fetch(t, srv, host, "/iiif/"+photo.ID+"/info.json"); rr.Code != http.StatusNotFound {
+		t.Fatalf("expected anonymous IIIF to be refused, got %d", rr.Code)
+	}
+	if rr := getFile(t, srv, host, "/iiif/"+photo.ID+"/info.json", tok.AccessToken, nil); rr.Code != http.StatusOK {
+		t.Fatalf("expected the owner to reach IIIF, got %d", rr.Code)
+	}
+}
+
+func TestSignedURLs_BoundToUser(t *testing.T) {
+	srv := newSigningServer(t, config.SignedURLsConfig{SignAll: true, BindUser: true})
+	host := "example.com"
+	owner := loginOnHost(t, srv, host, "bound@example.com", "Str0ngP@ssw0rd!")
+	other := loginOnHost(t, srv, host, "bound-other@example.com", "Str0ngP@ssw0rd!")
+
+	photo := decodeUploadResponse(t, uploadTestFile(t, srv, host, owner.AccessToken, "bound.jpg", encodeTestJPEG(t, 64, 48), nil))
+	if !strings.Contains(photo.OriginalURL, "uid=") {
+		t.Fatalf("expected the URL to be bound to its user, got %q", photo.OriginalURL)
+	}
+	if rr := getFile(t, srv, host, photo.OriginalURL, owner.AccessToken, nil); rr.Code != http.StatusOK {
+		t.Fatalf("expected the bound user to fetch the file, got %d", rr.Code)
+	}
+	if rr := getFile(t, srv, host, photo.OriginalURL, "", nil); rr.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 without a token, got %d", rr.Code)
+	}
+	if rr := getFile(t, srv, host, photo.OriginalURL, other.AccessToken, nil); rr.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 for another user, got %d", rr.Code)
+	}
+
+	// Anonymous viewers get unbound URLs.
+	rr := doHostJSON(t, srv, host, http.MethodGet, "/photos/feed", nil, "")
+	var feed models.PhotoFeed
+	if err := json.Unmarshal(rr.Body.Bytes(), &feed); err != nil {
+		t.Fatal(err)
+	}
+	if len(feed.Photos) != 1 || strings.Contains(feed.Photos[0].OriginalURL, "uid=") || !strings.Contains(feed.Photos[0].OriginalURL, "sig=") {
+		t.Fatalf("expected an unbound signed URL, got %+v", feed.Photos)
+	}
+	if rr := getFile(t, srv, host, feed.Photos[0].OriginalURL, "", nil); rr.Code != http.StatusOK {
+		t.Fatalf("expected unbound URL to be served, got %d", rr.Code)
+	}
+}
+
+func TestSignedURLs_PublicByDefault(t *testing.T) {
+	srv := newTestServer(t)
+	host := "example.com"
+	tok := loginOnHost(t, srv, host, "unsigned@example.com", "Str0ngP@ssw0rd!")
+
+	photo := decodeUploadResponse(t, uploadTestFile(t, srv, host, tok.AccessToken, "public.jpg", encodeTestJPEG(t, 64, 48), nil))
+	if strings.Contains(photo.OriginalURL, "?") {
+		t.Fatalf("expected a plain URL, got %q", photo.OriginalURL)
+	}
+	if rr := fetch(t, srv, host, photo.OriginalURL); rr.Code != http.StatusOK {
+		t.Fatalf("expected public file to be served, got %d", rr.Code)
+	}
+	if rr := fetch(t, srv, host, photo.OriginalURL+"?expires=1&kid=x&sig=forged"); rr.Code != http.StatusForbidden {
+		t.Fatalf("expected a forged signature to be refused even on a public file, got %d", rr.Code)
+	}
+	if rr := fetch(t, srv, host, "/uploads/photos/photo_guessed.jpg"); rr.Code != http.StatusNotFound {
+		t.Fatalf("expected unknown files to 404, got %d", rr.Code)
+	}
+}
+
+func TestURLSigner_RotationAndExpiry(t *testing.T) {
+	ctx := context.Background()
+	oldKey := handlers.SigningKey{ID: "old", Secret: []byte("old-secret")}
+	newKey := handlers.SigningKey{ID: "new", Secret: []byte("new-secret")}
+
+	before := handlers.NewURLSigner(handlers.URLSignerOptions{Keys: []handlers.SigningKey{oldKey}})
+	during := handlers.NewURLSigner(handlers.URLSignerOptions{Keys: []handlers.SigningKey{newKey, oldKey}})
+	after := handlers.NewURLSigner(handlers.URLSignerOptions{Keys: []handlers.SigningKey{newKey}})
+
+	verify := func(s *handlers.URLSigner, signed string) error {
+		u, _ := url.Parse(signed)
+		_, err := s.Verify(ctx, u.Path, u.Query())
+		return err
+	}
+	issued := before.Sign(ctx, "/uploads/photos/a.jpg", "")
+	if err := verify(during, issued); err != nil {
+		t.Fatalf("expected URLs from the old key to verify during rotation: %v", err)
+	}
+	if err := verify(after, issued); err != handlers.ErrSignatureInvalid {
+		t.Fatalf("expected the retired key to be refused, got %v", err)
+	}
+	if u, _ := url.Parse(during.Sign(ctx, "/uploads/photos/a.jpg", "")); u.Query().Get("kid") != "new" {
+		t.Fatal("expected the first key to sign")
+	}
+
+	short := handlers.NewURLSigner(handlers.URLSignerOptions{Keys: []handlers.SigningKey{newKey}, TTL: time.Second})
+	issued = short.Sign(ctx, "/uploads/photos/a.jpg", "")
+	if err := verify(short, issued); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(3 * time.Second)
+	if err := verify(short, issued); err != handlers.ErrSignatureExpired {
+		t.Fatalf("expected an expired signature, got %v", err)
+	}
+}
+
+func TestSignedURLs_KeysRequiredWithSharedStorage(t *testing.T) {
+	t.Setenv("DATABASE_URL", "")
+	fake, s3srv := newFakeS3(t)
+	cfg := &config.Config{
+		Storage: config.StorageConfig{
+			Driver: "s3",
+			S3: config.S3Config{
+				Endpoint:        s3srv.URL,
+				Region:          fake.region,
+				Bucket:          fake.bucket,
+				AccessKeyID:     fake.accessKey,
+				SecretAccessKey: fake.secretKey,
+				PathStyle:       true,
+			},
+		},
+	}
+	if _, err := api.NewServer(cfg); err == nil || !strings.Contains(err.Error(), "signed_urls.keys") {
+		t.Fatalf("expected missing signing keys to be refused, got %v", err)
+	}
+
+	cfg.Uploads.SignedURLs.Keys = []config.SigningKey{{ID: "k1", Secret: "shared-secret"}}
+	if _, err := api.NewServer(cfg); err == nil || !strings.Contains(err.Error(), "tus_sticky_sessions") {
+		t.Fatalf("expected tus without sticky sessions to be refused, got %v", err)
+	}
+
+	cfg.Uploads.TusStickySessions = true
+	if _, err := api.NewServer(cfg); err != nil {
+		t.Fatalf("expected configured keys to be accepted, got %v", err)
+	}
+}
@@ -0,0 +1,515 @@
+package api_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"nunoo.co/backend/api"
+	"nunoo.co/backend/config"
+	"nunoo.co/backend/handlers"
+	"nunoo.co/backend/storage"
+)
+
+// fakeS3 is an in-process S3 bucket speaking just enough of the API for
+// storage.S3: object PUT/GET/HEAD/DELETE with ranges, and ListObjectsV2.
+// Every request must carry a valid Signature Version 4.
+type fakeS3 struct {
+	bucket, accessKey, secretKey, region string
+	pageSize                             int
+
+	mu      sync.Mutex
+	objects map[string]fakeObject
+}
+
+type fakeObject struct {
+	data        []byte
+	contentType string
+	modTime     time.Time
+}
+
+func newFakeS3(t *testing.T) (*fakeS3, *httptest.Server) {
+	t.Helper()
+	f := &fakeS3{
+		bucket:    "photos",
+		accessKey: "AKIDTEST",
+		secretKey: "test-secret-key",
+		region:    "eu-test-1",
+		pageSize:  2, // small, so listings page
+		objects:   make(map[string]fakeObject),
+	}
+	srv := httptest.NewServer(f)
+	t.Cleanup(srv.Close)
+	return f, srv
+}
+
+func (f *fakeS3) options(endpoint string) storage.S3Options {
+	return storage.S3Options{
+		Endpoint:        endpoint,
+		Region:          f.region,
+		Bucket:          f.bucket,
+		AccessKeyID:     f.accessKey,
+		SecretAccessKey: f.secretKey,
+		PathStyle:       true,
+	}
+}
+
+func (f *fakeS3) keys() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var keys []string
+	for k := range f.objects {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func s3Error(w http.ResponseWriter, status int, code string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	fmt.Fprintf(w, "<Error><Code>%s</Code><Message>%s</Message></Error>", code, code)
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !f.verify(r) {
+		s3Error(w, http.StatusForbidden, "SignatureDoesNotMatch")
+		return
+	}
+	rest, ok := strings.CutPrefix(r.URL.Path, "/"+f.bucket)
+	if !ok {
+		s3Error(w, http.StatusNotFound, "NoSuchBucket")
+		return
+	}
+	key := strings.TrimPrefix(rest, "/")
+	if key == "" && r.Method == http.MethodGet && r.URL.Query().Get("list-type") == "2" {
+		f.list(w, r)
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	obj, exists := f.objects[key]
+	switch r.Method {
+	case http.MethodPut:
+		if r.ContentLength < 0 {
+			s3Error(w, http.StatusLengthRequired, "MissingContentLength")
+			return
+		}
+		data, _ := io.ReadAll(r.Body)
+		f.objects[key] = fakeObject{data: data, contentType: r.Header.Get("Content-Type"), modTime: time.Now()}
+		w.WriteHeader(http.StatusOK)
+	case http.MethodDelete:
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	case http.MethodGet, http.MethodHead:
+		if !exists {
+			s3Error(w, http.StatusNotFound, "NoSuchKey")
+			return
+		}
+		sum := md5.Sum(obj.data)
+		w.Header().Set("ETag", `"`+hex.EncodeToString(sum[:])+`"`)
+		w.Header().Set("Content-Type", obj.contentType)
+		w.Header().Set("Last-Modified", obj.modTime.UTC().Format(http.TimeFormat))
+		data, status := obj.data, http.StatusOK
+		if spec, ok := strings.CutPrefix(r.Header.Get("Range"), "bytes="); ok {
+			first, last, _ := strings.Cut(spec, "-")
+			start, _ := strconv.Atoi(first)
+			end := len(data) - 1
+			if last != "" {
+				end, _ = strconv.Atoi(last)
+				end = min(end, len(data)-1)
+			}
+			if start >= len(data) {
+				s3Error(w, http.StatusRequestedRangeNotSatisfiable, "InvalidRange")
+				return
+			}
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, len(data)))
+			data, status = data[start:end+1], http.StatusPartialContent
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+		w.WriteHeader(status)
+		if r.Method == http.MethodGet {
+			_, _ = w.Write(data)
+		}
+	default:
+		s3Error(w, http.StatusMethodNotAllowed, "MethodNotAllowed")
+	}
+}
+
+func (f *fakeS3) list(w http.ResponseWriter, r *http.Request) {
+	prefix := r.URL.Query().Get("prefix")
+	after := r.URL.Query().Get("continuation-token")
+	type content struct {
+		Key  string `xml:"Key"`
+		Size int    `xml:"Size"`
+		ETag string `xml:"ETag"`
+	}
+	var result struct {
+		XMLName               xml.Name  `xml:"ListBucketResult"`
+		Contents              []content `xml:"Contents"`
+		IsTruncated           bool      `xml:"IsTruncated"`
+		NextContinuationToken string    `xml:"NextContinuationToken,omitempty"`
+	}
+	for _, k := range f.keys() {
+		if !strings.HasPrefix(k, prefix) || k <= after {
+			continue
+		}
+		if len(result.Contents) == f.pageSize {
+			result.IsTruncated = true
+			result.NextContinuationToken = result.Contents[len(result.Contents)-1].Key
+			break
+		}
+		f.mu.Lock()
+		size := len(f.objects[k].data)
+		f.mu.Unlock()
+		result.Contents = append(result.Contents, content{Key: k, Size: size})
+	}
+	w.Header().Set("Content-Type", "application/xml")
+	_ = xml.NewEncoder(w).Encode(result)
+}
+
+// verify checks r's Signature Version 4, computed independently of the
+// client's signer.
+func (f *fakeS3) verify(r *http.Request) bool {
+	auth, ok := strings.CutPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 ")
+	if !ok {
+		return false
+	}
+	fields := map[string]string{}
+	for _, part := range strings.Split(auth, ", ") {
+		k, v, _ := strings.Cut(part, "=")
+		fields[k] = v
+	}
+	amzDate := r.Header.Get("X-Amz-Date")
+	if len(amzDate) != 16 {
+		return false
+	}
+	scope := amzDate[:8] + "/" + f.region + "/s3/aws4_request"
+	if fields["Credential"] != f.accessKey+"/"+scope {
+		return false
+	}
+
+	var headers strings.Builder
+	for _, name := range strings.Split(fields["SignedHeaders"], ";") {
+		value := r.Header.Get(name)
+		if name == "host" {
+			value = r.Host
+		}
+		headers.WriteString(name + ":" + strings.TrimSpace(value) + "\n")
+	}
+	query := r.URL.Query()
+	var params []string
+	for k, vs := range query {
+		for _, v := range vs {
+			params = append(params, awsEscape(k)+"="+awsEscape(v))
+		}
+	}
+	sort.Strings(params)
+	canonical := strings.Join([]string{
+		r.Method,
+		r.URL.EscapedPath(),
+		strings.Join(params, "&"),
+		headers.String(),
+		fields["SignedHeaders"],
+		r.Header.Get("X-Amz-Content-Sha256"),
+	}, "\n")
+	digest := sha256.Sum256([]byte(canonical))
+	toSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(digest[:])
+
+	mac := func(key []byte, data string) []byte {
+		h := hmac.New(sha256.New, key)
+		h.Write([]byte(data))
+		return h.Sum(nil)
+	}
+	key := mac([]byte("AWS4"+f.secretKey), amzDate[:8])
+	key = mac(mac(mac(key, f.region), "s3"), "aws4_request")
+	return hmac.Equal([]byte(fields["Signature"]), []byte(hex.EncodeToString(mac(key, toSign))))
+}
+
+func awsEscape(s string) string {
+	var b strings.Builder
+	for _, c := range []byte(s) {
+		if strings.IndexByte("ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789-._~", c) >= 0 {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// exerciseStorage runs the behaviour every Storage must share.
+func exerciseStorage(t *testing.T, store storage.Storage) {
+	ctx := context.Background()
+	data := []byte("0123456789abcdef")
+	put := func(key string, body []byte, size int64) {
+		t.Helper()
+		if err := store.Put(ctx, key, bytes.NewReader(body), size, "image/jpeg"); err != nil {
+			t.Fatalf("put %s: %v", key, err)
+		}
+	}
+	read := func(key string, rng *storage.Range) (*storage.Object, []byte) {
+		t.Helper()
+		obj, err := store.Get(ctx, key, rng)
+		if err != nil {
+			t.Fatalf("get %s: %v", key, err)
+		}
+		defer obj.Body.Close()
+		body, err := io.ReadAll(obj.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return obj, body
+	}
+
+	put("photos/t1/a.jpg", data, int64(len(data)))
+	put("photos/t1/b.jpg", []byte("streamed"), -1)
+	put("photos/t2/c.jpg", []byte("other tenant"), -1)
+	put("thumbnails/t1/a.jpg", []byte("thumb"), 5)
+
+	info, err := store.Stat(ctx, "photos/t1/a.jpg")
+	if err != nil || info.Size != int64(len(data)) || info.ContentType != "image/jpeg" || info.ETag == "" {
+		t.Fatalf("unexpected stat %+v (%v)", info, err)
+	}
+	if _, body := read("photos/t1/a.jpg", nil); !bytes.Equal(body, data) {
+		t.Fatalf("expected %q, got %q", data, body)
+	}
+	obj, body := read("photos/t1/a.jpg", &storage.Range{Offset: 2, Length: 3})
+	if string(body) != "234" || obj.Size != int64(len(data)) || obj.Range == nil || obj.Range.Offset != 2 || obj.Range.Length != 3 {
+		t.Fatalf("unexpected range read %q %+v %+v", body, obj.ObjectInfo, obj.Range)
+	}
+	if _, body := read("photos/t1/a.jpg", &storage.Range{Offset: 14, Length: -1}); string(body) != "ef" {
+		t.Fatalf("expected open-ended range to read to the end, got %q", body)
+	}
+	if _, err := store.Get(ctx, "photos/t1/a.jpg", &storage.Range{Offset: 16, Length: 1}); !errors.Is(err, storage.ErrInvalidRange) {
+		t.Fatalf("expected ErrInvalidRange past the end, got %v", err)
+	}
+
+	list, err := store.List(ctx, "photos/t1/")
+	if err != nil || len(list) != 2 || list[0].Key != "photos/t1/a.jpg" || list[1].Key != "photos/t1/b.jpg" || list[1].Size != 8 {
+		t.Fatalf("unexpected listing %+v (%v)", list, err)
+	}
+	if list, err := store.List(ctx, "photos/"); err != nil || len(list) != 3 {
+		t.Fatalf("expected 3 photos across tenants, got %+v (%v)", list, err)
+	}
+
+	put("photos/t1/a.jpg", []byte("replaced"), 8)
+	if _, body := read("photos/t1/a.jpg", nil); string(body) != "replaced" {
+		t.Fatalf("expected overwrite, got %q", body)
+	}
+
+	if err := store.Delete(ctx, "photos/t1/a.jpg"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Stat(ctx, "photos/t1/a.jpg"); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound after delete, got %v", err)
+	}
+	if _, err := store.Get(ctx, "photos/t1/a.jpg", nil); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound after delete, got %v", err)
+	}
+	if err := store.Delete(ctx, "photos/t1/a.jpg"); err != nil {
+		t.Fatalf("expected deleting a missing key to succeed, got %v", err)
+	}
+
+	for _, key := range []string{"../escape.jpg", "/abs.jpg", "photos//a.jpg", "photos/./a.jpg", "photos/t1/"} {
+		if err := store.Put(ctx, key, strings.NewReader("x"), 1, ""); !errors.Is(err, storage.ErrInvalidKey) {
+			t.Fatalf("expected ErrInvalidKey for %q, got %v", key, err)
+		}
+	}
+}
+
+func TestStorage_Local(t *testing.T) {
+	dir := t.TempDir()
+	exerciseStorage(t, storage.NewLocal(dir))
+
+	if _, err := os.Stat(filepath.Join(dir, "photos", "t1", "b.jpg")); err != nil {
+		t.Fatalf("expected objects to be plain files under the root: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(filepath.Dir(dir), "escape.jpg")); !os.IsNotExist(err) {
+		t.Fatal("expected nothing written outside the root")
+	}
+}
+
+func TestStorage_S3(t *testing.T) {
+	fake, srv := newFakeS3(t)
+	store, err := storage.NewS3(fake.options(srv.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	exerciseStorage(t, store)
+
+	opts := fake.options(srv.URL)
+	opts.SecretAccessKey = "wrong"
+	bad, err := storage.NewS3(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = bad.Put(context.Background(), "photos/t1/x.jpg", strings.NewReader("x"), 1, "")
+	if err == nil || !strings.Contains(err.Error(), "SignatureDoesNotMatch") {
+		t.Fatalf("expected a signature error, got %v", err)
+	}
+}
+
+func TestStorage_ServesPhotosFromS3(t *testing.T) {
+	fake, s3srv := newFakeS3(t)
+	cfg := &config.Config{
+		JWT: config.JWTConfig{
+			Secret:        "test-secret-access",
+			RefreshSecret: "test-secret-refresh",
+		},
+		Storage: config.StorageConfig{
+			Driver: "s3",
+			S3: config.S3Config{
+				Endpoint:        s3srv.URL,
+				Region:          fake.region,
+				Bucket:          fake.bucket,
+				AccessKeyID:     fake.accessKey,
+				SecretAccessKey: fake.secretKey,
+				PathStyle:       true,
+			},
+		},
+		Uploads: config.UploadsConfig{
+			TusStickySessions: true,
+			SignedURLs: config.SignedURLsConfig{
+				Keys: []config.SigningKey{{ID: "k1", Secret: "test-signing-secret"}},
+			},
+		},
+	}
+	srv := api.NewServerForTesting(cfg)
+	host := "example.com"
+	tok := loginOnHost(t, srv, host, "s3@example.com", "Str0ngP@ssw0rd!")
+
+	photo := decodeUploadResponse(t, uploadTestFile(t, srv, host, tok.AccessToken, "bucket.jpg", encodeTestJPEG(t, 700, 500), nil))
+	if _, err := os.Stat(filepath.Join("uploads", "photos", "default", photo.FileName)); !os.IsNotExist(err) {
+		t.Fatal("expected nothing written to local disk")
+	}
+	keys := fake.keys()
+	want := []string{
+		"photos/default/" + photo.FileName,
+		"thumbnails/default/" + photo.ID + "-thumb.jpg",
+	}
+	for _, v := range photo.Variants {
+		want = append(want, "variants/default/"+strings.TrimPrefix(v.URL, "/uploads/variants/"))
+	}
+	if len(photo.Variants) == 0 || len(keys) != len(want) {
+		t.Fatalf("expected %v in the bucket, got %v", want, keys)
+	}
+	for _, k := range want {
+		if !strings.Contains(strings.Join(keys, " "), k) {
+			t.Fatalf("expected %s in the bucket, got %v", k, keys)
+		}
+	}
+
+	full := fetch(t, srv, host, photo.OriginalURL)
+	if full.Code != http.StatusOK || full.Body.Len() != int(photo.FileSize) || full.Header().Get("Content-Type") != "image/jpeg" {
+		t.Fatalf("unexpected photo response %d (%d bytes, %s)", full.Code, full.Body.Len(), full.Header().Get("Content-Type"))
+	}
+	if rr := fetch(t, srv, host, photo.ThumbnailURL); rr.Code != http.StatusOK {
+		t.Fatalf("expected thumbnail to be served, got %d", rr.Code)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, photo.OriginalURL, nil)
+	req.Host = host
+	req.Header.Set("Range", "bytes=0-9")
+	rr := httptest.NewRecorder()
+	srv.ServeHTTP(rr, req)
+	if rr.Code != http.StatusPartialContent || !bytes.Equal(rr.Body.Bytes(), full.Body.Bytes()[:10]) ||
+		rr.Header().Get("Content-Range") != fmt.Sprintf("bytes 0-9/%d", photo.FileSize) {
+		t.Fatalf("unexpected range response %d %v", rr.Code, rr.Header())
+	}
+
+	req = httptest.NewRequest(http.MethodGet, photo.OriginalURL, nil)
+	req.Host = host
+	req.Header.Set("If-None-Match", full.Header().Get("ETag"))
+	rr = httptest.NewRecorder()
+	srv.ServeHTTP(rr, req)
+	if rr.Code != http.StatusNotModified {
+		t.Fatalf("expected 304 for a matching ETag, got %d", rr.Code)
+	}
+
+	if rr := fetch(t, srv, host, "/iiif/"+photo.ID+"/full/100,/0/default.jpg"); rr.Code != http.StatusOK {
+		t.Fatalf("expected IIIF to render from the bucket, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if rr := fetch(t, srv, host, "/uploads/photos/../thumbnails/"+photo.ID+"-thumb.jpg"); rr.Code != http.StatusNotFound {
+		t.Fatalf("expected paths outside a prefix to be refused, got %d", rr.Code)
+	}
+
+	if rr := doHostJSON(t, srv, host, http.MethodDelete, "/photos/?id="+photo.ID, nil, tok.AccessToken); rr.Code != http.StatusNoContent {
+		t.Fatalf("expected 204 deleting photo, got %d", rr.Code)
+	}
+	if keys := fake.keys(); len(keys) != 0 {
+		t.Fatalf("expected the bucket to be emptied, got %v", keys)
+	}
+}
+
+func TestStorage_MovesLegacyUploadsToDefaultTenant(t *testing.T) {
+	store := storage.NewLocal(t.TempDir())
+	ctx := context.Background()
+	put := func(keys ...string) {
+		t.Helper()
+		for _, key := range keys {
+			if err := store.Put(ctx, key, strings.NewReader(key), int64(len(key)), "image/jpeg"); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	keys := func() []string {
+		t.Helper()
+		objects, err := store.List(ctx, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, o := range objects {
+			got = append(got, o.Key)
+		}
+		return got
+	}
+	put("photos/legacy.jpg", "thumbnails/legacy-thumb.jpg", "photos/t1/current.jpg")
+
+	// Files from before tenancy move under the default tenant; tenant files
+	// stay where they are.
+	if n, err := handlers.MoveLegacyUploads(ctx, store); err != nil || n != 2 {
+		t.Fatalf("expected 2 files moved, got %d %v", n, err)
+	}
+	want := []string{handlers.LegacyUploadsMarker, "photos/default/legacy.jpg", "photos/t1/current.jpg", "thumbnails/default/legacy-thumb.jpg"}
+	if got := keys(); strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+	obj, err := store.Get(ctx, "photos/default/legacy.jpg", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(obj.Body)
+	_ = obj.Body.Close()
+	if string(body) != "photos/legacy.jpg" {
+		t.Fatalf("expected the legacy file's content, got %q", body)
+	}
+
+	// Once done, later starts do not look at the files again.
+	put("photos/late.jpg")
+	if n, err := handlers.MoveLegacyUploads(ctx, store); err != nil || n != 0 {
+		t.Fatalf("expected a second run to move nothing, got %d %v", n, err)
+	}
+	if _, err := store.Stat(ctx, "photos/late.jpg"); err != nil {
+		t.Fatalf("expected the marker to skip the move, got %v", err)
+	}
+}
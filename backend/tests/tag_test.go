@@ -0,0 +1,102 @@
+package api_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+
+	"nunoo.co/backend/models"
+)
+
+func TestNormalizeTag(t *testing.T) {
+	for raw, want := range map[string]string{
+		"Sunset":          "sunset",
+		"  #Sunset  ":     "sunset",
+		"ÉTÉ":             "été",
+		"e\u0301te\u0301": "été",   // decomposed accents
+		"Ｂｅａｃｈ":           "beach", // full-width
+		"Straße":          "strasse",
+		"new   york":      "new york",
+		"#":               "",
+	} {
+		if got := models.NormalizeTag(raw); got != want {
+			t.Errorf("NormalizeTag(%q) = %q, want %q", raw, got, want)
+		}
+	}
+}
+
+func TestTags(t *testing.T) {
+	srv := newTestServer(t)
+	host := "example.com"
+	owner := loginOnHost(t, srv, host, "tags@example.com", "Str0ngP@ssw0rd!")
+
+	tooMany := make([]string, models.MaxTags+1)
+	for i := range tooMany {
+		tooMany[i] = "tag" + strings.Repeat("x", i)
+	}
+	if rr := uploadTestFile(t, srv, host, owner.AccessToken, "x.jpg", encodeTestJPEG(t, 8, 8), map[string]string{"tags": strings.Join(tooMany, ",")}); rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for too many tags, got %d", rr.Code)
+	}
+
+	beach := uploadTestPhoto(t, srv, host, owner.AccessToken, map[string]string{"tags": "Sunset, #sunset,ÉTÉ, Ｂｅａｃｈ,"})
+	if want := []string{"beach", "sunset", "été"}; !slices.Equal(beach.Tags, want) {
+		t.Fatalf("expected tags %v, got %v", want, beach.Tags)
+	}
+	dawn := uploadTestPhoto(t, srv, host, owner.AccessToken, map[string]string{"tags": "sunrise,SUNSET"})
+	uploadTestPhoto(t, srv, host, owner.AccessToken, map[string]string{"tags": "sun-secret", "visibility": "private"})
+
+	// Autocomplete counts public photos only.
+	rr := doHostJSON(t, srv, host, http.MethodGet, "/tags?prefix=SUN", nil, "")
+	var list models.TagList
+	if err := json.Unmarshal(rr.Body.Bytes(), &list); err != nil {
+		t.Fatal(err)
+	}
+	want := []models.TagCount{{Tag: "sunset", Count: 2}, {Tag: "sunrise", Count: 1}}
+	if !slices.Equal(list.Tags, want) {
+		t.Fatalf("expected %v, got %v", want, list.Tags)
+	}
+
+	feedIDs := func(tag string) []string {
+		t.Helper()
+		rr := doHostJSON(t, srv, host, http.MethodGet, "/photos/feed?tag="+tag, nil, "")
+		var feed models.PhotoFeed
+		if err := json.Unmarshal(rr.Body.Bytes(), &feed); err != nil {
+			t.Fatal(err)
+		}
+		ids := []string{}
+		for _, p := range feed.Photos {
+			ids = append(ids, p.ID)
+		}
+		return ids
+	}
+	if got := feedIDs("Sunset"); len(got) != 2 {
+		t.Fatalf("expected both sunset photos, got %v", got)
+	}
+	if got := feedIDs("%23beach"); len(got) != 1 || got[0] != beach.ID {
+		t.Fatalf("expected only the beach photo, got %v", got)
+	}
+	if got := feedIDs("sun-secret"); len(got) != 0 {
+		t.Fatalf("expected private photos to stay out of tag feeds, got %v", got)
+	}
+
+	// Edits replace the tags.
+	rr = patchPhoto(t, srv, dawn.ID, owner.AccessToken, "*", map[string][]string{"tags": {"Beach", "beach"}})
+	if p := decodePhoto(t, rr); rr.Code != http.StatusOK || !slices.Equal(p.Tags, []string{"beach"}) {
+		t.Fatalf("expected tags to be replaced, got %d %v", rr.Code, p.Tags)
+	}
+	if got := feedIDs("sunset"); len(got) != 1 || got[0] != beach.ID {
+		t.Fatalf("expected the edit to leave the sunset feed, got %v", got)
+	}
+	if got := feedIDs("beach"); len(got) != 2 {
+		t.Fatalf("expected both beach photos, got %v", got)
+	}
+	rr = patchPhoto(t, srv, dawn.ID, owner.AccessToken, "*", map[string][]string{"tags": {}})
+	if p := decodePhoto(t, rr); len(p.Tags) != 0 {
+		t.Fatalf("expected an empty list to clear tags, got %v", p.Tags)
+	}
+	if rr := patchPhoto(t, srv, dawn.ID, owner.AccessToken, "*", map[string][]string{"tags": {strings.Repeat("a", models.MaxTagLength+1)}}); rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for a long tag, got %d", rr.Code)
+	}
+}
@@ -0,0 +1,80 @@
+package api_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"nunoo.co/backend/api"
+	"nunoo.co/backend/config"
+	"nunoo.co/backend/models"
+)
+
+func newTenancyTestServer(t *testing.T) http.Handler {
+	t.Helper()
+	cfg := &config.Config{
+		JWT: config.JWTConfig{
+			Secret:        "test-secret-access",
+			RefreshSecret: "test-secret-refresh",
+		},
+		Tenancy: config.TenancyConfig{
+			Tenants: []config.Tenant{
+				{ID: "alpha", Hosts: []string{"alpha.test"}},
+				{ID: "beta", Hosts: []string{"beta.test"}, JWTSecret: "beta-access", JWTRefreshSecret: "beta-refresh"},
+			},
+		},
+	}
+	return api.NewServerForTesting(cfg)
+}
+
+func TestTenancy_IsolatesSites(t *testing.T) {
+	srv := newTenancyTestServer(t)
+
+	// The same email can register independently on each site
+	email := "shared@example.com"
+	password := "Str0ngP@ssw0rd!"
+	alpha := loginOnHost(t, srv, "alpha.test", email, password)
+	beta := loginOnHost(t, srv, "beta.test:8080", email, password)
+
+	if rr := doHostJSON(t, srv, "alpha.test", http.MethodGet, "/me", nil, alpha.AccessToken); rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 for own-site token, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	// A valid token from one site must not work on another
+	if rr := doHostJSON(t, srv, "beta.test", http.MethodGet, "/me", nil, alpha.AccessToken); rr.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 for cross-site access token, got %d", rr.Code)
+	}
+	if rr := doHostJSON(t, srv, "alpha.test", http.MethodGet, "/me", nil, beta.AccessToken); rr.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 for cross-site access token, got %d", rr.Code)
+	}
+	rr := doHostJSON(t, srv, "beta.test", http.MethodPost, "/auth/refresh", map[string]string{"refresh_token": alpha.RefreshToken}, "")
+	if rr.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 for cross-site refresh token, got %d", rr.Code)
+	}
+
+	// Photos uploaded on one site are invisible on the other
+	photo := uploadTestPhoto(t, srv, "alpha.test", alpha.AccessToken, nil)
+
+	var feed models.PhotoFeed
+	rr = doHostJSON(t, srv, "beta.test", http.MethodGet, "/photos/feed", nil, "")
+	if err := json.Unmarshal(rr.Body.Bytes(), &feed); err != nil {
+		t.Fatal(err)
+	}
+	if len(feed.Photos) != 0 {
+		t.Fatalf("expected empty feed on other site, got %d photos", len(feed.Photos))
+	}
+	if rr := doHostJSON(t, srv, "beta.test", http.MethodGet, "/photos/?id="+photo.ID, nil, ""); rr.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 fetching another site's photo, got %d", rr.Code)
+	}
+	if rr := doHostJSON(t, srv, "beta.test", http.MethodGet, photo.OriginalURL, nil, ""); rr.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 fetching another site's file, got %d", rr.Code)
+	}
+	if rr := doHostJSON(t, srv, "alpha.test", http.MethodGet, photo.OriginalURL, nil, ""); rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 fetching own site's file, got %d", rr.Code)
+	}
+
+	// Unknown hosts are rejected when no default tenant is configured
+	if rr := doHostJSON(t, srv, "gamma.test", http.MethodGet, "/health", nil, ""); rr.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for unknown host, got %d", rr.Code)
+	}
+}
@@ -0,0 +1,51 @@
+package api_test
+
+import (
+	"bytes"
+	"image"
+	"net/http"
+	"testing"
+)
+
+func TestUpload_ThumbnailAndDimensions(t *testing.T) {
+	srv := newTestServer(t)
+	host := "example.com"
+	tok := loginOnHost(t, srv, host, "thumbs@example.com", "Str0ngP@ssw0rd!")
+
+	cases := []struct {
+		name        string
+		filename    string
+		data        []byte
+		w, h        int
+		thumbW      int
+		thumbH      int
+		thumbFormat string
+	}{
+		{"landscape jpeg", "wide.jpg", encodeTestJPEG(t, 800, 600), 800, 600, 400, 300, "jpeg"},
+		{"portrait png", "tall.png", encodeTestPNG(t, 300, 900), 300, 900, 133, 400, "png"},
+		{"small jpeg is not upscaled", "small.jpg", encodeTestJPEG(t, 120, 80), 120, 80, 120, 80, "jpeg"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			photo := decodeUploadResponse(t, uploadTestFile(t, srv, host, tok.AccessToken, c.filename, c.data, nil))
+			if photo.Width != c.w || photo.Height != c.h {
+				t.Fatalf("expected %dx%d, got %dx%d", c.w, c.h, photo.Width, photo.Height)
+			}
+			if photo.ThumbnailURL == "" {
+				t.Fatal("expected thumbnail_url to be set")
+			}
+
+			rr := fetch(t, srv, host, photo.ThumbnailURL)
+			if rr.Code != http.StatusOK {
+				t.Fatalf("expected 200 fetching thumbnail, got %d", rr.Code)
+			}
+			cfg, format, err := image.DecodeConfig(bytes.NewReader(rr.Body.Bytes()))
+			if err != nil {
+				t.Fatalf("thumbnail is not a valid image: %v", err)
+			}
+			if cfg.Width != c.thumbW || cfg.Height != c.thumbH || format != c.thumbFormat {
+				t.Fatalf("expected %s thumbnail %dx%d, got %s %dx%d", c.thumbFormat, c.thumbW, c.thumbH, format, cfg.Width, cfg.Height)
+			}
+		})
+	}
+}
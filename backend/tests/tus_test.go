@@ -0,0 +1,181 @@
+package api_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"nunoo.co/backend/api"
+	"nunoo.co/backend/config"
+	"nunoo.co/backend/models"
+)
+
+func tusRequest(t *testing.T, h http.Handler, method, path, token string, headers map[string]string, body []byte) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(method, path, bytes.NewReader(body))
+	req.Host = "example.com"
+	req.Header.Set("Tus-Resumable", "1.0.0")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	// Stay under the server's burst limit across the many small requests here.
+	time.Sleep(50 * time.Millisecond)
+	return rec
+}
+
+func createTusUpload(t *testing.T, h http.Handler, token string, length int, metadata string) string {
+	t.Helper()
+	rec := tusRequest(t, h, http.MethodPost, "/uploads/tus", token, map[string]string{
+		"Upload-Length":   strconv.Itoa(length),
+		"Upload-Metadata": metadata,
+	}, nil)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201 creating upload, got %d: %s", rec.Code, rec.Body.String())
+	}
+	location := rec.Header().Get("Location")
+	if location == "" || rec.Header().Get("Upload-Expires") == "" {
+		t.Fatalf("expected Location and Upload-Expires, got %v", rec.Header())
+	}
+	return location
+}
+
+func patchTus(t *testing.T, h http.Handler, token, location string, offset int, chunk []byte) *httptest.ResponseRecorder {
+	t.Helper()
+	return tusRequest(t, h, http.MethodPatch, location, token, map[string]string{
+		"Content-Type":  "application/offset+octet-stream",
+		"Upload-Offset": strconv.Itoa(offset),
+	}, chunk)
+}
+
+func TestTus_ResumableUpload(t *testing.T) {
+	srv := newTestServer(t)
+	host := "example.com"
+	tok := loginOnHost(t, srv, host, "tus@example.com", "Str0ngP@ssw0rd!")
+	other := loginOnHost(t, srv, host, "tus-other@example.com", "Str0ngP@ssw0rd!")
+
+	rec := tusRequest(t, srv, http.MethodOptions, "/uploads/tus", "", nil, nil)
+	if rec.Code != http.StatusNoContent || rec.Header().Get("Tus-Version") != "1.0.0" || rec.Header().Get("Tus-Extension") != "creation,termination,expiration" {
+		t.Fatalf("unexpected discovery response %d: %v", rec.Code, rec.Header())
+	}
+
+	upload := encodeTestJPEG(t, 64, 48)
+	caption := base64.StdEncoding.EncodeToString([]byte("resumed"))
+	location := createTusUpload(t, srv, tok.AccessToken, len(upload), "filename dGVzdC5qcGc=,caption "+caption)
+
+	half := len(upload) / 2
+	rec = patchTus(t, srv, tok.AccessToken, location, 0, upload[:half])
+	if rec.Code != http.StatusNoContent || rec.Header().Get("Upload-Offset") != strconv.Itoa(half) {
+		t.Fatalf("expected 204 at offset %d, got %d %q: %s", half, rec.Code, rec.Header().Get("Upload-Offset"), rec.Body.String())
+	}
+
+	// A client that lost track asks where to resume.
+	rec = tusRequest(t, srv, http.MethodHead, location, tok.AccessToken, nil, nil)
+	if rec.Code != http.StatusOK || rec.Header().Get("Upload-Offset") != strconv.Itoa(half) || rec.Header().Get("Upload-Length") != strconv.Itoa(len(upload)) {
+		t.Fatalf("unexpected HEAD %d: %v", rec.Code, rec.Header())
+	}
+	if rec := tusRequest(t, srv, http.MethodHead, location, other.AccessToken, nil, nil); rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for another user's upload, got %d", rec.Code)
+	}
+	if rec := patchTus(t, srv, other.AccessToken, location, half, upload[half:]); rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 patching another user's upload, got %d", rec.Code)
+	}
+	if rec := tusRequest(t, srv, http.MethodDelete, location, other.AccessToken, nil, nil); rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 terminating another user's upload, got %d", rec.Code)
+	}
+	if rec := patchTus(t, srv, tok.AccessToken, location, 0, upload[:half]); rec.Code != http.StatusConflict {
+		t.Fatalf("expected 409 for a stale offset, got %d", rec.Code)
+	}
+	if rec := tusRequest(t, srv, http.MethodHead, location, tok.AccessToken, map[string]string{"Tus-Resumable": "0.2.2"}, nil); rec.Code != http.StatusPreconditionFailed {
+		t.Fatalf("expected 412 for an unsupported version, got %d", rec.Code)
+	}
+
+	rec = patchTus(t, srv, tok.AccessToken, location, half, upload[half:])
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("expected 204 completing upload, got %d: %s", rec.Code, rec.Body.String())
+	}
+	photoID := rec.Header().Get("Photo-Id")
+	if photoID == "" {
+		t.Fatal("expected Photo-Id on completion")
+	}
+	rec = tusRequest(t, srv, http.MethodHead, location, tok.AccessToken, nil, nil)
+	if rec.Header().Get("Photo-Id") != photoID || rec.Header().Get("Upload-Offset") != strconv.Itoa(len(upload)) {
+		t.Fatalf("expected finished upload to report its photo, got %v", rec.Header())
+	}
+
+	rr := doHostJSON(t, srv, host, http.MethodGet, "/photos/?id="+photoID, nil, "")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected photo to exist, got %d", rr.Code)
+	}
+	var got struct {
+		Photo models.Photo `json:"photo"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if photo := got.Photo; photo.Caption != "resumed" || photo.Width != 64 || photo.FileSize == 0 {
+		t.Fatalf("unexpected photo %+v", got.Photo)
+	}
+}
+
+func TestTus_RejectsAndTerminates(t *testing.T) {
+	srv := newTestServer(t)
+	tok := loginOnHost(t, srv, "example.com", "tus-reject@example.com", "Str0ngP@ssw0rd!")
+
+	if rec := tusRequest(t, srv, http.MethodPost, "/uploads/tus", tok.AccessToken, map[string]string{"Upload-Length": strconv.Itoa(200 << 20)}, nil); rec.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expected 413 over the size limit, got %d", rec.Code)
+	}
+	if rec := tusRequest(t, srv, http.MethodPost, "/uploads/tus", "", map[string]string{"Upload-Length": "10"}, nil); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 without a token, got %d", rec.Code)
+	}
+	if rec := tusRequest(t, srv, http.MethodPost, "/uploads/tus", tok.AccessToken, map[string]string{"Upload-Length": "10", "Upload-Metadata": "visibility c2VjcmV0"}, nil); rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for an unknown visibility, got %d", rec.Code)
+	}
+
+	// Finished uploads are validated like any other.
+	script := []byte("#!/bin/sh\necho owned\n")
+	location := createTusUpload(t, srv, tok.AccessToken, len(script), "")
+	if rec := patchTus(t, srv, tok.AccessToken, location, 0, script); rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for a script, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := tusRequest(t, srv, http.MethodHead, location, tok.AccessToken, nil, nil); rec.Code != http.StatusNotFound {
+		t.Fatalf("expected rejected upload to be discarded, got %d", rec.Code)
+	}
+
+	location = createTusUpload(t, srv, tok.AccessToken, 100, "")
+	if rec := tusRequest(t, srv, http.MethodDelete, location, tok.AccessToken, nil, nil); rec.Code != http.StatusNoContent {
+		t.Fatalf("expected 204 terminating upload, got %d", rec.Code)
+	}
+	if rec := patchTus(t, srv, tok.AccessToken, location, 0, []byte("data")); rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 after termination, got %d", rec.Code)
+	}
+}
+
+func TestTus_ExpiresAbandonedUploads(t *testing.T) {
+	cfg := &config.Config{
+		JWT: config.JWTConfig{
+			Secret:        "test-secret-access",
+			RefreshSecret: "test-secret-refresh",
+		},
+		Uploads: config.UploadsConfig{TusExpiry: time.Millisecond},
+	}
+	srv := api.NewServerForTesting(cfg)
+	tok := loginOnHost(t, srv, "example.com", "tus-expire@example.com", "Str0ngP@ssw0rd!")
+
+	location := createTusUpload(t, srv, tok.AccessToken, 100, "")
+	if rec := patchTus(t, srv, tok.AccessToken, location, 0, []byte("data")); rec.Code != http.StatusGone {
+		t.Fatalf("expected 410 for an expired upload, got %d", rec.Code)
+	}
+	if rec := tusRequest(t, srv, http.MethodHead, location, tok.AccessToken, nil, nil); rec.Code != http.StatusNotFound {
+		t.Fatalf("expected expired upload to be removed, got %d", rec.Code)
+	}
+}
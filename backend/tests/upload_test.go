@@ -0,0 +1,237 @@
+package api_test
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"nunoo.co/backend/config"
+	"nunoo.co/backend/models"
+)
+
+// stagedFiles lists what is left in the default tenant's staging directory.
+func stagedFiles(t *testing.T) []os.DirEntry {
+	t.Helper()
+	entries, err := os.ReadDir(filepath.Join("uploads", "staging", "default"))
+	if err != nil && !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+	return entries
+}
+
+func TestUpload_StreamsFieldsInAnyOrder(t *testing.T) {
+	srv := newImagesTestServer(t, config.ImagesConfig{})
+	host := "example.com"
+	tok := loginOnHost(t, srv, host, "stream@example.com", "Str0ngP@ssw0rd!")
+
+	// Fields after the file part must still be honoured.
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	part, err := writer.CreateFormFile("photo", "after.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	upload := encodeTestJPEG(t, 32, 24)
+	if _, err := part.Write(upload); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.WriteField("caption", "written last"); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/photos/upload", body)
+	req.Host = host
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	req.Header.Set("Authorization", "Bearer "+tok.AccessToken)
+	rec := httptest.NewRecorder()
+	srv.ServeHTTP(rec, req)
+
+	photo := decodeUploadResponse(t, rec)
+	if photo.Caption != "written last" {
+		t.Fatalf("expected caption from trailing field, got %q", photo.Caption)
+	}
+	if photo.FileSize != int64(len(upload)) {
+		t.Fatalf("expected file_size %d, got %d", len(upload), photo.FileSize)
+	}
+	stored, err := os.ReadFile(filepath.Join("uploads", "photos", "default", photo.FileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(stored, upload) {
+		t.Fatal("stored file differs from upload")
+	}
+	if left := stagedFiles(t); len(left) != 0 {
+		t.Fatalf("expected staging to be empty, found %d files", len(left))
+	}
+}
+
+func TestUpload_RejectsWithoutLeavingStagedFiles(t *testing.T) {
+	srv := newImagesTestServer(t, config.ImagesConfig{})
+	host := "example.com"
+	tok := loginOnHost(t, srv, host, "reject@example.com", "Str0ngP@ssw0rd!")
+	jpeg := encodeTestJPEG(t, 16, 16)
+
+	t.Run("oversized file streamed without a length", func(t *testing.T) {
+		pr, pw := io.Pipe()
+		writer := multipart.NewWriter(pw)
+		go func() {
+			part, err := writer.CreateFormFile("photo", "huge.jpg")
+			if err == nil {
+				_, err = io.Copy(part, io.MultiReader(bytes.NewReader(jpeg), io.LimitReader(zeros{}, 21<<20)))
+			}
+			if err == nil {
+				err = writer.Close()
+			}
+			pw.CloseWithError(err)
+		}()
+
+		req := httptest.NewRequest(http.MethodPost, "/photos/upload", pr)
+		req.Host = host
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+		req.Header.Set("Authorization", "Bearer "+tok.AccessToken)
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, req)
+		_ = pr.Close()
+
+		if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "file too large") {
+			t.Fatalf("expected 400 file too large, got %d: %s", rec.Code, rec.Body.String())
+		}
+		if left := stagedFiles(t); len(left) != 0 {
+			t.Fatalf("expected staging to be empty, found %d files", len(left))
+		}
+	})
+
+	t.Run("two photo parts", func(t *testing.T) {
+		body := &bytes.Buffer{}
+		writer := multipart.NewWriter(body)
+		for _, name := range []string{"a.jpg", "b.jpg"} {
+			part, err := writer.CreateFormFile("photo", name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := part.Write(jpeg); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := writer.Close(); err != nil {
+			t.Fatal(err)
+		}
+		req := httptest.NewRequest(http.MethodPost, "/photos/upload", body)
+		req.Host = host
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+		req.Header.Set("Authorization", "Bearer "+tok.AccessToken)
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusBadRequest {
+			t.Fatalf("expected 400, got %d: %s", rec.Code, rec.Body.String())
+		}
+		if left := stagedFiles(t); len(left) != 0 {
+			t.Fatalf("expected staging to be empty, found %d files", len(left))
+		}
+	})
+
+	t.Run("oversized field", func(t *testing.T) {
+		rec := uploadTestFile(t, srv, host, tok.AccessToken, "a.jpg", jpeg, map[string]string{"caption": strings.Repeat("x", 65<<10)})
+		if rec.Code != http.StatusBadRequest {
+			t.Fatalf("expected 400, got %d: %s", rec.Code, rec.Body.String())
+		}
+	})
+
+	t.Run("missing photo", func(t *testing.T) {
+		body := &bytes.Buffer{}
+		writer := multipart.NewWriter(body)
+		if err := writer.WriteField("caption", "no file"); err != nil {
+			t.Fatal(err)
+		}
+		if err := writer.Close(); err != nil {
+			t.Fatal(err)
+		}
+		req := httptest.NewRequest(http.MethodPost, "/photos/upload", body)
+		req.Host = host
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+		req.Header.Set("Authorization", "Bearer "+tok.AccessToken)
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "photo file is required") {
+			t.Fatalf("expected 400 photo file is required, got %d: %s", rec.Code, rec.Body.String())
+		}
+	})
+}
+
+type zeros struct{}
+
+func (zeros) Read(p []byte) (int, error) {
+	clear(p)
+	return len(p), nil
+}
+
+func TestUpload_DeduplicatesByContentHash(t *testing.T) {
+	srv := newImagesTestServer(t, config.ImagesConfig{})
+	host := "example.com"
+	alice := loginOnHost(t, srv, host, "dedup-alice@example.com", "Str0ngP@ssw0rd!")
+	bob := loginOnHost(t, srv, host, "dedup-bob@example.com", "Str0ngP@ssw0rd!")
+	upload := encodeTestJPEG(t, 24, 24)
+
+	first := decodeUploadResponse(t, uploadTestFile(t, srv, host, alice.AccessToken, "a.jpg", upload, nil))
+	sum := sha256.Sum256(upload)
+	if first.ContentHash != hex.EncodeToString(sum[:]) {
+		t.Fatalf("expected content_hash of the uploaded bytes, got %q", first.ContentHash)
+	}
+
+	rec := uploadTestFile(t, srv, host, alice.AccessToken, "again.jpg", upload, nil)
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("expected 409 for duplicate, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var conflict struct {
+		Photo models.Photo `json:"photo"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &conflict); err != nil {
+		t.Fatal(err)
+	}
+	if conflict.Photo.ID != first.ID {
+		t.Fatalf("expected 409 to point at %s, got %s", first.ID, conflict.Photo.ID)
+	}
+	if loc := rec.Header().Get("Location"); !strings.Contains(loc, first.ID) {
+		t.Fatalf("expected Location to point at %s, got %q", first.ID, loc)
+	}
+
+	rec = uploadTestFile(t, srv, host, alice.AccessToken, "again.jpg", upload, map[string]string{"on_duplicate": "return"})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200 with on_duplicate=return, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var returned struct {
+		Photo models.Photo `json:"photo"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &returned); err != nil {
+		t.Fatal(err)
+	}
+	if returned.Photo.ID != first.ID {
+		t.Fatalf("expected existing photo %s, got %s", first.ID, returned.Photo.ID)
+	}
+
+	if rec := uploadTestFile(t, srv, host, alice.AccessToken, "a.jpg", upload, map[string]string{"on_duplicate": "merge"}); rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for unknown on_duplicate, got %d", rec.Code)
+	}
+	if left := stagedFiles(t); len(left) != 0 {
+		t.Fatalf("expected duplicates to leave staging empty, found %d files", len(left))
+	}
+
+	// Hashes are unique per user, not across users.
+	other := decodeUploadResponse(t, uploadTestFile(t, srv, host, bob.AccessToken, "a.jpg", upload, nil))
+	if other.ID == first.ID {
+		t.Fatal("expected a separate photo for another user")
+	}
+}
@@ -0,0 +1,84 @@
+package api_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"nunoo.co/backend/models"
+)
+
+func TestUserPhotos(t *testing.T) {
+	srv := newTestServer(t)
+	host := "example.com"
+	owner := loginOnHost(t, srv, host, "library@example.com", "Str0ngP@ssw0rd!")
+	other := loginOnHost(t, srv, host, "visitor@example.com", "Str0ngP@ssw0rd!")
+	ownerID := userIDFor(t, srv, host, owner.AccessToken)
+
+	public := uploadTestPhoto(t, srv, host, owner.AccessToken, nil)
+	unlisted := uploadTestPhoto(t, srv, host, owner.AccessToken, map[string]string{"visibility": "unlisted"})
+	private := uploadTestPhoto(t, srv, host, owner.AccessToken, map[string]string{"visibility": "private"})
+	png := decodeUploadResponse(t, uploadTestFile(t, srv, host, owner.AccessToken, "photo.png", encodeTestPNG(t, 8, 8), nil))
+	uploadTestPhoto(t, srv, host, other.AccessToken, nil)
+
+	listIDs := func(path, token string) []string {
+		t.Helper()
+		rr := doHostJSON(t, srv, host, http.MethodGet, path, nil, token)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected 200 for %s, got %d: %s", path, rr.Code, rr.Body.String())
+		}
+		var feed models.PhotoFeed
+		if err := json.Unmarshal(rr.Body.Bytes(), &feed); err != nil {
+			t.Fatal(err)
+		}
+		ids := []string{}
+		for _, p := range feed.Photos {
+			ids = append(ids, p.ID)
+		}
+		return ids
+	}
+
+	// Visitors see public photos only; the owner sees everything.
+	stream := "/users/" + ownerID + "/photos"
+	for _, token := range []string{"", other.AccessToken} {
+		if got := listIDs(stream, token); len(got) != 2 || got[0] != png.ID || got[1] != public.ID {
+			t.Fatalf("expected the two public photos, got %v", got)
+		}
+	}
+	if got := listIDs(stream, owner.AccessToken); len(got) != 4 {
+		t.Fatalf("expected the owner to see all 4 photos, got %v", got)
+	}
+	if got := listIDs(stream+"?cursor=&limit=1", ""); len(got) != 1 || got[0] != png.ID {
+		t.Fatalf("expected cursor paging on the stream, got %v", got)
+	}
+
+	// The caller's own library filters by visibility, MIME type and date.
+	if rr := doHostJSON(t, srv, host, http.MethodGet, "/me/photos", nil, ""); rr.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 without a token, got %d", rr.Code)
+	}
+	for _, q := range []string{"visibility=secret", "created_after=yesterday", "sort=size"} {
+		if rr := doHostJSON(t, srv, host, http.MethodGet, "/me/photos?"+q, nil, owner.AccessToken); rr.Code != http.StatusBadRequest {
+			t.Fatalf("expected 400 for %q, got %d", q, rr.Code)
+		}
+	}
+	if got := listIDs("/me/photos", owner.AccessToken); len(got) != 4 {
+		t.Fatalf("expected 4 photos in the library, got %v", got)
+	}
+	if got := listIDs("/me/photos?visibility=private", owner.AccessToken); len(got) != 1 || got[0] != private.ID {
+		t.Fatalf("expected only the private photo, got %v", got)
+	}
+	if got := listIDs("/me/photos?visibility=unlisted", owner.AccessToken); len(got) != 1 || got[0] != unlisted.ID {
+		t.Fatalf("expected only the unlisted photo, got %v", got)
+	}
+	if got := listIDs("/me/photos?mime_type=IMAGE/PNG", owner.AccessToken); len(got) != 1 || got[0] != png.ID {
+		t.Fatalf("expected only the PNG, got %v", got)
+	}
+	tomorrow := time.Now().UTC().AddDate(0, 0, 1).Format("2006-01-02")
+	if got := listIDs("/me/photos?created_after="+tomorrow, owner.AccessToken); len(got) != 0 {
+		t.Fatalf("expected nothing created after %s, got %v", tomorrow, got)
+	}
+	if got := listIDs("/me/photos?created_before="+tomorrow+"&sort=taken_at", owner.AccessToken); len(got) != 4 {
+		t.Fatalf("expected all 4 photos created before %s, got %v", tomorrow, got)
+	}
+}
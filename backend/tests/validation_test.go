@@ -0,0 +1,221 @@
+package api_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/gif"
+	"net/http"
+	"strings"
+	"testing"
+
+	"nunoo.co/backend/handlers"
+)
+
+// pngChunk encodes one PNG chunk with its CRC.
+func pngChunk(typ string, data []byte) []byte {
+	out := binary.BigEndian.AppendUint32(nil, uint32(len(data)))
+	out = append(out, typ...)
+	out = append(out, data...)
+	return binary.BigEndian.AppendUint32(out, crc32.ChecksumIEEE(append([]byte(typ), data...)))
+}
+
+// pngHeaderOnly is a PNG whose IHDR claims w x h with almost no pixel data.
+func pngHeaderOnly(w, h uint32) []byte {
+	ihdr := binary.BigEndian.AppendUint32(nil, w)
+	ihdr = binary.BigEndian.AppendUint32(ihdr, h)
+	ihdr = append(ihdr, 8, 2, 0, 0, 0) // 8-bit RGB
+	out := []byte("\x89PNG\r\n\x1a\n")
+	out = append(out, pngChunk("IHDR", ihdr)...)
+	out = append(out, pngChunk("IDAT", []byte{0x78, 0x9c, 0x03, 0x00, 0x00, 0x00, 0x00, 0x01})...)
+	return append(out, pngChunk("IEND", nil)...)
+}
+
+func encodeTestGIF(t testing.TB, w, h int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	palette := color.Palette{color.Black, color.White}
+	if err := gif.Encode(&buf, image.NewPaletted(image.Rect(0, 0, w, h), palette), nil); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// webpLossless is the header of a VP8L WebP of w x h.
+func webpLossless(w, h int) []byte {
+	bits := uint32(w-1) | uint32(h-1)<<14
+	chunk := append([]byte("VP8L"), 10, 0, 0, 0, 0x2F)
+	chunk = binary.LittleEndian.AppendUint32(chunk, bits)
+	chunk = append(chunk, make([]byte, 5)...) // a token bitstream
+	out := append([]byte("RIFF"), binary.LittleEndian.AppendUint32(nil, uint32(4+len(chunk)))...)
+	out = append(out, "WEBP"...)
+	return append(out, chunk...)
+}
+
+// bmp24 is an uncompressed 24-bit BMP of w x h.
+func bmp24(w, h int) []byte {
+	row := (w*3 + 3) &^ 3
+	size := 54 + row*h
+	out := append([]byte("BM"), binary.LittleEndian.AppendUint32(nil, uint32(size))...)
+	out = append(out, 0, 0, 0, 0, 54, 0, 0, 0)
+	out = binary.LittleEndian.AppendUint32(out, 40)
+	out = binary.LittleEndian.AppendUint32(out, uint32(w))
+	out = binary.LittleEndian.AppendUint32(out, uint32(h))
+	out = append(out, 1, 0, 24, 0)
+	out = append(out, make([]byte, 24)...)
+	return append(out, make([]byte, row*h)...)
+}
+
+// tiffHeader is a little-endian TIFF whose first IFD records w x h.
+func tiffHeader(w, h uint16) []byte {
+	out := []byte("II*\x00\x08\x00\x00\x00\x02\x00")
+	for _, e := range [][2]uint16{{256, w}, {257, h}} {
+		out = binary.LittleEndian.AppendUint16(out, e[0])
+		out = binary.LittleEndian.AppendUint16(out, 3)
+		out = binary.LittleEndian.AppendUint32(out, 1)
+		out = binary.LittleEndian.AppendUint32(out, uint32(e[1]))
+	}
+	return binary.LittleEndian.AppendUint32(out, 0)
+}
+
+func box(typ string, body ...[]byte) []byte {
+	payload := bytes.Join(body, nil)
+	out := binary.BigEndian.AppendUint32(nil, uint32(8+len(payload)))
+	return append(append(out, typ...), payload...)
+}
+
+// heicHeader is the box structure of a HEIC declaring a w x h image.
+func heicHeader(w, h uint32) []byte {
+	ispe := binary.BigEndian.AppendUint32(make([]byte, 4), w)
+	ispe = binary.BigEndian.AppendUint32(ispe, h)
+	meta := box("meta", make([]byte, 4), box("iprp", box("ipco", box("ispe", ispe))))
+	return append(box("ftyp", []byte("heic\x00\x00\x00\x00mif1heic")), meta...)
+}
+
+// zipArchive is a minimal ZIP holding one empty stored file.
+func zipArchive() []byte {
+	local := append([]byte("PK\x03\x04"), make([]byte, 22)...)
+	local = append(local, 1, 0, 0, 0, 'x')
+	central := append([]byte("PK\x01\x02"), make([]byte, 24)...)
+	central = append(central, 1, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 'x')
+	eocd := append([]byte("PK\x05\x06"), 0, 0, 0, 0, 1, 0, 1, 0)
+	eocd = binary.LittleEndian.AppendUint32(eocd, uint32(len(central)))
+	eocd = binary.LittleEndian.AppendUint32(eocd, uint32(len(local)))
+	eocd = append(eocd, 0, 0)
+	return append(append(local, central...), eocd...)
+}
+
+func validate(data []byte) (*handlers.ImageInfo, error) {
+	return handlers.ValidateImage(bytes.NewReader(data), int64(len(data)))
+}
+
+func TestValidateImage_Formats(t *testing.T) {
+	cases := []struct {
+		name   string
+		data   []byte
+		format string
+		w, h   int
+	}{
+		{"jpeg", encodeTestJPEG(t, 30, 20), "jpeg", 30, 20},
+		{"png", encodeTestPNG(t, 12, 34), "png", 12, 34},
+		{"gif", encodeTestGIF(t, 7, 9), "gif", 7, 9},
+		{"webp", webpLossless(640, 480), "webp", 640, 480},
+		{"bmp", bmp24(5, 3), "bmp", 5, 3},
+		{"tiff", tiffHeader(300, 200), "tiff", 300, 200},
+		{"heic", heicHeader(4032, 3024), "heic", 4032, 3024},
+		{"jpeg with motion photo video", append(encodeTestJPEG(t, 30, 20), box("ftyp", []byte("mp42"))...), "jpeg", 30, 20},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			info, err := validate(c.data)
+			if err != nil {
+				t.Fatalf("expected %s to validate, got %v", c.name, err)
+			}
+			if info.Format != c.format || info.Width != c.w || info.Height != c.h {
+				t.Fatalf("expected %s %dx%d, got %+v", c.format, c.w, c.h, info)
+			}
+		})
+	}
+}
+
+func TestValidateImage_Rejects(t *testing.T) {
+	jpegData := encodeTestJPEG(t, 30, 20)
+	cases := []struct {
+		name string
+		data []byte
+		err  error
+	}{
+		{"script", []byte("#!/bin/sh\nrm -rf /\n"), handlers.ErrUnsupportedImage},
+		{"executable", append([]byte("MZ\x90\x00"), make([]byte, 64)...), handlers.ErrUnsupportedImage},
+		{"html", []byte("<html><script>alert(1)</script></html>"), handlers.ErrUnsupportedImage},
+		{"too short", []byte{0xFF, 0xD8}, handlers.ErrInvalidImageFile},
+		{"truncated jpeg", jpegData[:len(jpegData)/2], handlers.ErrInvalidImageFile},
+		{"corrupt header", append([]byte{0xFF, 0xD8, 0xFF, 0xC0, 0x00, 0x11}, make([]byte, 40)...), handlers.ErrInvalidImageFile},
+		{"decompression bomb", pngHeaderOnly(100000, 100000), handlers.ErrImageTooLarge},
+		{"too many pixels", pngHeaderOnly(15000, 15000), handlers.ErrImageTooLarge},
+		{"heic bomb", heicHeader(30000, 30000), handlers.ErrImageTooLarge},
+		{"zip appended to jpeg", append(append([]byte{}, jpegData...), zipArchive()...), handlers.ErrMaliciousFile},
+		{"html appended to png", append(encodeTestPNG(t, 4, 4), "<!DOCTYPE html><SCRIPT>alert(1)</SCRIPT>"...), handlers.ErrMaliciousFile},
+		{"zip directory in a tiff", append(tiffHeader(10, 10), zipArchive()...), handlers.ErrMaliciousFile},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if _, err := validate(c.data); err != c.err {
+				t.Fatalf("expected %v, got %v", c.err, err)
+			}
+		})
+	}
+}
+
+func TestUpload_StoresDetectedFormat(t *testing.T) {
+	srv := newTestServer(t)
+	host := "example.com"
+	tok := loginOnHost(t, srv, host, "formats@example.com", "Str0ngP@ssw0rd!")
+
+	// A PNG named .jpg is stored as what it is.
+	photo := decodeUploadResponse(t, uploadTestFile(t, srv, host, tok.AccessToken, "holiday.jpg", encodeTestPNG(t, 20, 10), nil))
+	if photo.MimeType != "image/png" || !strings.HasSuffix(photo.FileName, ".png") {
+		t.Fatalf("expected image/png stored as .png, got %s %s", photo.MimeType, photo.FileName)
+	}
+
+	polyglot := append(encodeTestJPEG(t, 20, 10), zipArchive()...)
+	rec := uploadTestFile(t, srv, host, tok.AccessToken, "polyglot.jpg", polyglot, nil)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for a polyglot, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if left := stagedFiles(t); len(left) != 0 {
+		t.Fatalf("expected staging to be empty, found %d files", len(left))
+	}
+}
+
+func FuzzValidateImage(f *testing.F) {
+	for _, seed := range [][]byte{
+		encodeTestJPEG(f, 8, 8),
+		encodeTestPNG(f, 8, 8),
+		encodeTestGIF(f, 8, 8),
+		webpLossless(8, 8),
+		bmp24(2, 2),
+		tiffHeader(8, 8),
+		heicHeader(8, 8),
+		pngHeaderOnly(100000, 100000),
+		append(encodeTestJPEG(f, 8, 8), zipArchive()...),
+	} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		info, err := validate(data)
+		if err != nil {
+			return
+		}
+		if info.Format == "" || info.MimeType == "" {
+			t.Fatalf("accepted file without a format: %+v", info)
+		}
+		if info.Width <= 0 || info.Height <= 0 || info.Width > handlers.MaxImageEdge || info.Height > handlers.MaxImageEdge ||
+			int64(info.Width)*int64(info.Height) > handlers.MaxImagePixels {
+			t.Fatalf("accepted out-of-bounds dimensions %dx%d", info.Width, info.Height)
+		}
+	})
+}
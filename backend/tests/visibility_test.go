@@ -0,0 +1,135 @@
+package api_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"nunoo.co/backend/models"
+)
+
+func getPhotoAs(t *testing.T, h http.Handler, host, id, token string) (int, models.Photo) {
+	t.Helper()
+	rr := doHostJSON(t, h, host, http.MethodGet, "/photos/?id="+id, nil, token)
+	var got struct {
+		Photo models.Photo `json:"photo"`
+	}
+	if rr.Code == http.StatusOK {
+		if err := json.Unmarshal(rr.Body.Bytes(), &got); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return rr.Code, got.Photo
+}
+
+func TestVisibility(t *testing.T) {
+	srv := newTestServer(t)
+	host := "example.com"
+	owner := loginOnHost(t, srv, host, "visibility@example.com", "Str0ngP@ssw0rd!")
+	other := loginOnHost(t, srv, host, "visibility-other@example.com", "Str0ngP@ssw0rd!")
+
+	if rr := uploadTestFile(t, srv, host, owner.AccessToken, "x.jpg", encodeTestJPEG(t, 8, 8), map[string]string{"visibility": "secret"}); rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for an unknown visibility, got %d", rr.Code)
+	}
+
+	public := uploadTestPhoto(t, srv, host, owner.AccessToken, nil)
+	unlisted := uploadTestPhoto(t, srv, host, owner.AccessToken, map[string]string{"visibility": "unlisted"})
+	private := uploadTestPhoto(t, srv, host, owner.AccessToken, map[string]string{"visibility": "private"})
+	if public.Visibility != models.VisibilityPublic || unlisted.Visibility != models.VisibilityUnlisted || private.Visibility != models.VisibilityPrivate {
+		t.Fatalf("unexpected visibilities: %q %q %q", public.Visibility, unlisted.Visibility, private.Visibility)
+	}
+
+	// Only public photos are listed.
+	var feed models.PhotoFeed
+	rr := doHostJSON(t, srv, host, http.MethodGet, "/photos/feed", nil, owner.AccessToken)
+	if err := json.Unmarshal(rr.Body.Bytes(), &feed); err != nil {
+		t.Fatal(err)
+	}
+	if feed.TotalCount != 1 || len(feed.Photos) != 1 || feed.Photos[0].ID != public.ID {
+		t.Fatalf("expected only the public photo in the feed, got %+v", feed)
+	}
+
+	// Unlisted photos open by link; private ones only for their owner.
+	for _, tc := range []struct {
+		photo models.Photo
+		token string
+		want  int
+	}{
+		{public, "", http.StatusOK},
+		{unlisted, "", http.StatusOK},
+		{unlisted, other.AccessToken, http.StatusOK},
+		{private, "", http.StatusNotFound},
+		{private, other.AccessToken, http.StatusNotFound},
+		{private, owner.AccessToken, http.StatusOK},
+	} {
+		if code, _ := getPhotoAs(t, srv, host, tc.photo.ID, tc.token); code != tc.want {
+			t.Fatalf("expected %d for %s photo, got %d", tc.want, tc.photo.Visibility, code)
+		}
+	}
+
+	// Deleting someone else's photo is forbidden only if it can be seen.
+	if rr := doHostJSON(t, srv, host, http.MethodDelete, "/photos/?id="+unlisted.ID, nil, other.AccessToken); rr.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 deleting another user's unlisted photo, got %d", rr.Code)
+	}
+	if rr := doHostJSON(t, srv, host, http.MethodDelete, "/photos/?id="+private.ID, nil, other.AccessToken); rr.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 deleting another user's private photo, got %d", rr.Code)
+	}
+
+	// Files follow the same rules.
+	if rr := fetch(t, srv, host, unlisted.OriginalURL); rr.Code != http.StatusOK {
+		t.Fatalf("expected unlisted file to be served by link, got %d", rr.Code)
+	}
+	signed, _ := url.Parse(private.OriginalURL)
+	if signed.Query().Get("sig") == "" {
+		t.Fatalf("expected private file URLs to be signed, got %q", private.OriginalURL)
+	}
+	if rr := fetch(t, srv, host, signed.Path); rr.Code != http.StatusNotFound {
+		t.Fatalf("expected unsigned private file to be hidden, got %d", rr.Code)
+	}
+	if rr := getFile(t, srv, host, signed.Path, other.AccessToken, nil); rr.Code != http.StatusNotFound {
+		t.Fatalf("expected private file to be hidden from other users, got %d", rr.Code)
+	}
+	if rr := getFile(t, srv, host, signed.Path, owner.AccessToken, nil); rr.Code != http.StatusOK || rr.Header().Get("Cache-Control") != "private" {
+		t.Fatalf("expected the owner to fetch their private file, got %d %v", rr.Code, rr.Header())
+	}
+	if rr := fetch(t, srv, host, private.OriginalURL); rr.Code != http.StatusOK {
+		t.Fatalf("expected the signed private URL to be served, got %d", rr.Code)
+	}
+	if rr := fetch(t, srv, host, "/iiif/"+private.ID+"/info.json"); rr.Code != http.StatusNotFound {
+		t.Fatalf("expected private IIIF to be hidden, got %d", rr.Code)
+	}
+	if rr := fetch(t, srv, host, "/iiif/"+unlisted.ID+"/info.json"); rr.Code != http.StatusOK {
+		t.Fatalf("expected unlisted IIIF to be served, got %d", rr.Code)
+	}
+
+	// Followers only see public photos.
+	ownerID := userIDFor(t, srv, host, owner.AccessToken)
+	if rr := doHostJSON(t, srv, host, http.MethodPut, "/users/"+ownerID+"/follow", nil, other.AccessToken); rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 for follow, got %d", rr.Code)
+	}
+	rr = doHostJSON(t, srv, host, http.MethodGet, "/photos/feed/following", nil, other.AccessToken)
+	var following models.PhotoFeed
+	if err := json.Unmarshal(rr.Body.Bytes(), &following); err != nil {
+		t.Fatal(err)
+	}
+	if len(following.Photos) != 1 || following.Photos[0].ID != public.ID {
+		t.Fatalf("expected only the public photo in the following feed, got %+v", following.Photos)
+	}
+
+	// Uploads that do not choose follow the owner's default_visibility.
+	if rr := doHostJSON(t, srv, host, http.MethodPatch, "/me/preferences", map[string]string{"default_visibility": "private"}, owner.AccessToken); rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 updating preferences, got %d", rr.Code)
+	}
+	if p := uploadTestPhoto(t, srv, host, owner.AccessToken, nil); p.Visibility != models.VisibilityPrivate {
+		t.Fatalf("expected the preferred visibility, got %q", p.Visibility)
+	}
+	if p := uploadTestPhoto(t, srv, host, owner.AccessToken, map[string]string{"visibility": "public"}); p.Visibility != models.VisibilityPublic {
+		t.Fatalf("expected the field to override the preference, got %q", p.Visibility)
+	}
+	data := encodeTestJPEG(t, 8, 8)
+	rec := patchTus(t, srv, owner.AccessToken, createTusUpload(t, srv, owner.AccessToken, len(data), ""), 0, data)
+	if _, p := getPhotoAs(t, srv, host, rec.Header().Get("Photo-Id"), owner.AccessToken); p.Visibility != models.VisibilityPrivate {
+		t.Fatalf("expected resumable uploads to follow the preference, got %q", p.Visibility)
+	}
+}
@@ -1,4 +1,40 @@
 package types
 
+import "context"
+
 // ctxKey is the context key type for user injection
 type CtxKey struct{}
+
+// TenantCtxKey is the context key type for the tenant resolved from the request
+type TenantCtxKey struct{}
+
+// DefaultTenant is the tenant used when tenancy is not configured.
+const DefaultTenant = "default"
+
+// WithTenant returns a copy of ctx carrying the given tenant ID.
+func WithTenant(ctx context.Context, tenantID string) context.Context {
+	return context.WithValue(ctx, TenantCtxKey{}, tenantID)
+}
+
+// TenantID returns the tenant carried by ctx, falling back to DefaultTenant.
+func TenantID(ctx context.Context) string {
+	if id, ok := ctx.Value(TenantCtxKey{}).(string); ok && id != "" {
+		return id
+	}
+	return DefaultTenant
+}
+
+// AdminCtxKey is the context key marking a request made by an admin of the
+// resolved tenant
+type AdminCtxKey struct{}
+
+// WithAdmin returns a copy of ctx marking the caller as an admin.
+func WithAdmin(ctx context.Context) context.Context {
+	return context.WithValue(ctx, AdminCtxKey{}, true)
+}
+
+// IsAdmin reports whether ctx was marked by WithAdmin.
+func IsAdmin(ctx context.Context) bool {
+	admin, _ := ctx.Value(AdminCtxKey{}).(bool)
+	return admin
+}